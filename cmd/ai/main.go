@@ -10,6 +10,7 @@ import (
 	rpcsubcommand "github.com/tiancaiamao/ai/subcommand/rpc"
 	"github.com/tiancaiamao/ai/subcommand/run"
 	"github.com/tiancaiamao/ai/subcommand/send"
+	sessionsubcommand "github.com/tiancaiamao/ai/subcommand/session"
 )
 
 func main() {
@@ -42,6 +43,10 @@ func main() {
 		send.SendSubcommand()
 	case "kill":
 		kill.KillSubcommand()
+	case "export":
+		sessionsubcommand.ExportSubcommand()
+	case "session", "sessions":
+		sessionsubcommand.SessionSubcommand()
 	default:
 		fmt.Fprintf(os.Stderr, "ai: unknown command %q\n\n", subcmd)
 		rpcsubcommand.PrintUsage()
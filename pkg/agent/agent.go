@@ -81,6 +81,7 @@ type Agent struct {
 	shutdownOnce  sync.Once
 	traceSeq      atomic.Uint64
 	manualCompact atomic.Bool
+	cfgMu         sync.RWMutex // Protects LoopConfig changes made through the setters
 
 	// LoopConfig embedded for unified configuration management
 	LoopConfig
@@ -137,13 +138,13 @@ func NewAgentFromConfigWithContext(model llm.Model, apiKey string, agentCtx *age
 
 	// Set GetModel callback to enable dynamic model switching during loop execution.
 	// This allows the loop to get the current model value after SetModel() is called.
-	a.LoopConfig.GetModel = func() llm.Model {
-		return a.model
-	}
+	a.LoopConfig.GetModel = a.GetModel
 
 	// Set GetAPIKey callback to enable dynamic API key switching during loop execution.
 	// This allows the loop to get the current API key value after SetAPIKey() is called.
 	a.LoopConfig.GetAPIKey = func() string {
+		a.cfgMu.RLock()
+		defer a.cfgMu.RUnlock()
 		return a.apiKey
 	}
 	a.LoopConfig.ConsumeManualCompaction = func() bool {
@@ -213,6 +214,28 @@ func (a *Agent) Prompt(message string) error {
 	}
 }
 
+// newPromptMessage builds the user message for a prompt. The first prompt of
+// a conversation is the task statement, so it is pinned: compaction keeps it
+// verbatim instead of summarizing it.
+func newPromptMessage(text string, history []agentctx.AgentMessage) agentctx.AgentMessage {
+	msg := agentctx.NewUserMessage(text)
+	for _, m := range history {
+		if m.Role != "user" {
+			continue
+		}
+		kind := ""
+		if m.Metadata != nil {
+			kind = m.Metadata.Kind
+		}
+		switch kind {
+		case "", "user", "compactionSummary", "sessionDigest":
+			return msg
+		}
+	}
+	pinned := agentctx.PriorityPinned
+	return msg.WithPriority(&pinned)
+}
+
 // processPrompt handles a single prompt (shared by Prompt and follow-up).
 func (a *Agent) processPrompt(ctx context.Context, message string) {
 	hadError := false
@@ -232,7 +255,7 @@ func (a *Agent) processPrompt(ctx context.Context, message string) {
 		traceevent.Field{Key: "turn_count", Value: len(a.context.RecentMessages)})
 	defer eventLoopSpan.End()
 
-	prompts := []agentctx.AgentMessage{agentctx.NewUserMessage(message)}
+	prompts := []agentctx.AgentMessage{newPromptMessage(message, a.context.RecentMessages)}
 
 	slog.Info("[Agent] Starting RunLoop")
 	stream := a.runLoopFn(ctx, prompts, a.context, &a.LoopConfig)
@@ -358,6 +381,7 @@ func (a *Agent) processPrompt(ctx context.Context, message string) {
 			a.ctxMu.Lock()
 			a.context.RecentMessages = append([]agentctx.AgentMessage(nil), event.Value.Messages...)
 			a.ctxMu.Unlock()
+			event.Value.Todos = a.todosSnapshot()
 		}
 
 		// Send to event channel
@@ -540,17 +564,23 @@ func (a *Agent) GetState() map[string]any {
 
 // SetModel updates the active model configuration.
 func (a *Agent) SetModel(model llm.Model) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	a.model = model
 	a.LoopConfig.Model = model // Keep LoopConfig in sync for loop that reads from config
 }
 
 // SetAPIKey updates the API key for the active model.
 func (a *Agent) SetAPIKey(apiKey string) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	a.apiKey = apiKey
 }
 
 // GetModel returns the active model configuration.
 func (a *Agent) GetModel() llm.Model {
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
 	return a.model
 }
 
@@ -561,6 +591,27 @@ func (a *Agent) GetMessages() []agentctx.AgentMessage {
 	return a.context.RecentMessages
 }
 
+// SetMessagePriority sets the priority of the message at index and returns
+// the updated message. A nil priority resets it to the default.
+func (a *Agent) SetMessagePriority(index int, priority *float64) (agentctx.AgentMessage, bool) {
+	a.ctxMu.Lock()
+	defer a.ctxMu.Unlock()
+	if index < 0 || index >= len(a.context.RecentMessages) {
+		return agentctx.AgentMessage{}, false
+	}
+	msg := a.context.RecentMessages[index].WithPriority(priority)
+	a.context.RecentMessages[index] = msg
+	return msg, true
+}
+
+// EditMessages replaces the messages with the result of edit, which must
+// not modify its argument in place. Used for manual context edits.
+func (a *Agent) EditMessages(edit func([]agentctx.AgentMessage) []agentctx.AgentMessage) {
+	a.ctxMu.Lock()
+	defer a.ctxMu.Unlock()
+	a.context.RecentMessages = edit(a.context.RecentMessages)
+}
+
 // AddTool adds a tool to the agent.
 func (a *Agent) AddTool(tool agentctx.Tool) {
 	a.context.AddTool(tool)
@@ -581,21 +632,29 @@ func (a *Agent) GetContext() *agentctx.AgentContext {
 
 // SetCompactor sets the compactor for automatic context compression.
 func (a *Agent) SetCompactor(compactor Compactor) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	a.LoopConfig.Compactor = compactor
 }
 
 // SetExecutor sets the tool executor for concurrency control.
 func (a *Agent) SetExecutor(executor ToolExecutor) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	a.LoopConfig.Executor = executor
 }
 
 // SetToolOutputLimits sets truncation limits for tool output.
 func (a *Agent) SetToolOutputLimits(limits ToolOutputLimits) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	a.LoopConfig.ToolOutput = normalizeToolOutputLimits(limits)
 }
 
 // SetToolCallCutoff sets threshold for automatic tool output summarization.
 func (a *Agent) SetToolCallCutoff(cutoff int) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	if cutoff < 0 {
 		cutoff = 0
 	}
@@ -604,11 +663,15 @@ func (a *Agent) SetToolCallCutoff(cutoff int) {
 
 // SetThinkingLevel controls reasoning depth instructions sent to the model.
 func (a *Agent) SetThinkingLevel(level string) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	a.LoopConfig.ThinkingLevel = prompt.NormalizeThinkingLevel(level)
 }
 
 // SetAutoRetry enables/disables LLM automatic retry behavior.
 func (a *Agent) SetAutoRetry(enabled bool) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	if enabled {
 		if a.LoopConfig.MaxLLMRetries <= 0 {
 			a.LoopConfig.MaxLLMRetries = defaultLLMMaxRetries
@@ -623,12 +686,23 @@ func (a *Agent) SetAutoRetry(enabled bool) {
 
 // SetContextWindow sets the context window for the model.
 func (a *Agent) SetContextWindow(contextWindow int) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
 	if contextWindow < 0 {
 		contextWindow = 0
 	}
 	a.LoopConfig.ContextWindow = contextWindow
 }
 
+// LoopConfigSnapshot returns a copy of the loop config, taken under the
+// lock the setters hold, for code that builds a loop of its own from it.
+func (a *Agent) LoopConfigSnapshot() *LoopConfig {
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
+	cfg := a.LoopConfig
+	return &cfg
+}
+
 // GetPendingFollowUps returns the number of queued follow-up messages.
 func (a *Agent) GetPendingFollowUps() int {
 	return len(a.followUpQueue)
@@ -662,6 +736,7 @@ func (a *Agent) abortCurrentStream() bool {
 	a.ctxMu.RUnlock()
 
 	agentEnd := NewAgentEndEvent(recent)
+	agentEnd.Todos = a.todosSnapshot()
 	if stream != nil && !stream.IsDone() {
 		stream.Push(agentEnd)
 	}
@@ -673,6 +748,27 @@ func (a *Agent) abortCurrentStream() bool {
 	return stream != nil && !stream.IsDone()
 }
 
+// todosSnapshot returns a copy of the current todo list for agent_end events.
+func (a *Agent) todosSnapshot() []agentctx.TodoItem {
+	a.ctxMu.RLock()
+	defer a.ctxMu.RUnlock()
+	if a.context == nil || a.context.AgentState == nil {
+		return nil
+	}
+	return agentctx.CloneTodos(a.context.AgentState.Todos)
+}
+
+// SetTodos replaces the todo list on the agent state. The todo tool writes
+// through it so readers such as todosSnapshot never see a half-done write.
+func (a *Agent) SetTodos(todos []agentctx.TodoItem) {
+	a.ctxMu.Lock()
+	defer a.ctxMu.Unlock()
+	if a.context == nil || a.context.AgentState == nil {
+		return
+	}
+	a.context.AgentState.Todos = todos
+}
+
 func (a *Agent) clearFollowUps() {
 	for {
 		select {
@@ -93,6 +93,10 @@ func TestAgentAbort(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed to prompt after abort: %v", err)
 	}
+
+	// Stop the prompt's loop so it does not outlive the test.
+	agent.Abort()
+	agent.Wait()
 }
 
 // TestAgentEvents tests the event channel.
@@ -319,3 +323,35 @@ func TestAgentState(t *testing.T) {
 		t.Errorf("Expected 0 tools, got %d", state["toolCount"].(int))
 	}
 }
+
+func TestNewPromptMessagePinsTaskStatement(t *testing.T) {
+	first := newPromptMessage("fix the bug", nil)
+	if !first.IsPinned() {
+		t.Fatal("expected the first prompt to be pinned")
+	}
+
+	// Hook-injected user messages do not count as an earlier prompt.
+	history := []agentctx.AgentMessage{agentctx.NewUserMessage("style guide").WithKind("hook")}
+	if !newPromptMessage("fix the bug", history).IsPinned() {
+		t.Fatal("expected the first real prompt to be pinned")
+	}
+
+	history = append(history, first)
+	if newPromptMessage("now add tests", history).IsPinned() {
+		t.Fatal("expected follow-up prompts to keep the default priority")
+	}
+}
+
+func TestSetMessagePriority(t *testing.T) {
+	agent := NewAgent(llm.Model{}, "test-key", "test")
+	agent.GetContext().RecentMessages = []agentctx.AgentMessage{agentctx.NewUserMessage("hello")}
+
+	p := agentctx.PriorityPinned
+	msg, ok := agent.SetMessagePriority(0, &p)
+	if !ok || !msg.IsPinned() || !agent.GetMessages()[0].IsPinned() {
+		t.Fatalf("expected message 0 to be pinned, got %+v", msg)
+	}
+	if _, ok := agent.SetMessagePriority(1, &p); ok {
+		t.Fatal("expected out-of-range index to fail")
+	}
+}
@@ -43,6 +43,16 @@ type AgentEvent struct {
 
 	// LLM retry events
 	LLMRetry *LLMRetryInfo `json:"llmRetry,omitempty"`
+
+	// agent_end: final state of the todo list
+	Todos []agentctx.TodoItem `json:"todos,omitempty"`
+
+	// verify/agent_end: result of the latest verification round
+	Verify *agentctx.VerifyResult `json:"verify,omitempty"`
+
+	// ParentToolCallID is set on events of a task subagent: the id of the
+	// task tool call that spawned it.
+	ParentToolCallID string `json:"parentToolCallId,omitempty"`
 }
 
 // AssistantMessageEvent provides a stable, json-tagged shape for streaming updates.
@@ -73,6 +83,7 @@ const (
 	EventToolCallRecovery   = "tool_call_recovery"
 	EventError              = "error"
 	EventLLMRetry           = "llm_retry"
+	EventVerify             = "verify"
 )
 
 // CompactionInfo describes a compaction event.
@@ -126,6 +137,15 @@ func NewLoopGuardTriggeredEvent(info LoopGuardInfo) AgentEvent {
 	}
 }
 
+// NewVerifyEvent creates a verify event.
+func NewVerifyEvent(result *agentctx.VerifyResult) AgentEvent {
+	return AgentEvent{
+		Type:    EventVerify,
+		EventAt: time.Now().UnixNano(),
+		Verify:  result,
+	}
+}
+
 // NewErrorEvent creates an error event.
 func NewErrorEvent(err error) AgentEvent {
 	err = WithErrorStack(err)
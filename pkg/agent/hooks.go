@@ -31,12 +31,33 @@ type AfterToolHook func(hctx HookContext, toolName string, result agentctx.Agent
 // Hooks are called sequentially with no data passing between them.
 type AfterAgentHook func(hctx HookContext)
 
+// BeforeToolDecision is the outcome of a BeforeToolHook.
+type BeforeToolDecision struct {
+	// Deny blocks the tool call; Reason is returned to the model as the tool result.
+	Deny   bool
+	Reason string
+	// Args, if non-nil, replaces the tool call arguments.
+	Args map[string]any
+}
+
+// BeforeToolHook is called before each tool executes, after its arguments are validated.
+// Hooks are chained: rewritten args feed the next hook, and the first deny wins.
+type BeforeToolHook func(hctx HookContext, toolName string, args map[string]any) (BeforeToolDecision, error)
+
+// SessionStartHook is called when a session is opened. source is "startup",
+// "new", "resume" or "fork". It returns messages to add to the conversation.
+type SessionStartHook func(hctx HookContext, source string) ([]agentctx.AgentMessage, error)
+
 // HookRegistry manages registered hooks. All methods are nil-safe:
 // calling Run* on a nil HookRegistry returns zero values without panic.
 type HookRegistry struct {
 	BeforeModelHooks []BeforeModelHook
 	AfterToolHooks   []AfterToolHook
 	AfterAgentHooks  []AfterAgentHook
+	BeforeToolHooks  []BeforeToolHook
+	// SessionStartHooks are run by the host (e.g. rpc) when it opens a session;
+	// the agent loop never calls them.
+	SessionStartHooks []SessionStartHook
 }
 
 // RunBeforeModel executes all BeforeModel hooks in fan-out style:
@@ -99,3 +120,56 @@ func (r *HookRegistry) RunAfterAgent(hctx HookContext) {
 		hook(hctx)
 	}
 }
+
+// RunBeforeTool executes all BeforeTool hooks in chain style and returns the
+// final decision. Args in the result is always set to the arguments to execute.
+// Hook errors are logged and skipped. If r is nil, the call is allowed unchanged.
+func (r *HookRegistry) RunBeforeTool(hctx HookContext, toolName string, args map[string]any) BeforeToolDecision {
+	decision := BeforeToolDecision{Args: args}
+	if r == nil {
+		return decision
+	}
+	for i, hook := range r.BeforeToolHooks {
+		d, err := hook(hctx, toolName, decision.Args)
+		if err != nil {
+			slog.Warn("[Hook] BeforeTool hook error",
+				"hook_index", i,
+				"tool_name", toolName,
+				"error", err,
+			)
+			continue
+		}
+		if d.Args != nil {
+			decision.Args = d.Args
+		}
+		if d.Deny {
+			decision.Deny = true
+			decision.Reason = d.Reason
+			return decision
+		}
+	}
+	return decision
+}
+
+// RunSessionStart executes all SessionStart hooks and returns the merged
+// messages they produced. The caller decides where to record them.
+// If r is nil, returns nil.
+func (r *HookRegistry) RunSessionStart(hctx HookContext, source string) []agentctx.AgentMessage {
+	if r == nil {
+		return nil
+	}
+	var all []agentctx.AgentMessage
+	for i, hook := range r.SessionStartHooks {
+		msgs, err := hook(hctx, source)
+		if err != nil {
+			slog.Warn("[Hook] SessionStart hook error",
+				"hook_index", i,
+				"source", source,
+				"error", err,
+			)
+			continue
+		}
+		all = append(all, msgs...)
+	}
+	return all
+}
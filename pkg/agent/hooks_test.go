@@ -194,6 +194,54 @@ func TestAfterToolChain(t *testing.T) {
 	}
 }
 
+// ---- BeforeTool hook chain: rewritten args feed the next hook, first deny wins ----
+
+func TestBeforeToolChain(t *testing.T) {
+	var calls int
+	r := &HookRegistry{
+		BeforeToolHooks: []BeforeToolHook{
+			func(hctx HookContext, toolName string, args map[string]any) (BeforeToolDecision, error) {
+				calls++
+				return BeforeToolDecision{Args: map[string]any{"command": "ls -la"}}, nil
+			},
+			func(hctx HookContext, toolName string, args map[string]any) (BeforeToolDecision, error) {
+				calls++
+				if args["command"] != "ls -la" {
+					t.Fatalf("second hook did not receive rewritten args, got %v", args)
+				}
+				return BeforeToolDecision{}, errors.New("boom")
+			},
+		},
+	}
+	hctx := HookContext{
+		Ctx:      context.Background(),
+		AgentCtx: &agentctx.AgentContext{},
+		Config:   &LoopConfig{},
+	}
+
+	d := r.RunBeforeTool(hctx, "bash", map[string]any{"command": "ls"})
+	if d.Deny || d.Args["command"] != "ls -la" || calls != 2 {
+		t.Fatalf("unexpected decision %+v after %d calls", d, calls)
+	}
+
+	r.BeforeToolHooks = append([]BeforeToolHook{
+		func(hctx HookContext, toolName string, args map[string]any) (BeforeToolDecision, error) {
+			return BeforeToolDecision{Deny: true, Reason: "blocked"}, nil
+		},
+	}, r.BeforeToolHooks...)
+	calls = 0
+	d = r.RunBeforeTool(hctx, "bash", map[string]any{"command": "ls"})
+	if !d.Deny || d.Reason != "blocked" || calls != 0 {
+		t.Fatalf("expected first deny to win, got %+v after %d calls", d, calls)
+	}
+
+	var nilReg *HookRegistry
+	args := map[string]any{"command": "ls"}
+	if d := nilReg.RunBeforeTool(hctx, "bash", args); d.Deny || d.Args["command"] != "ls" {
+		t.Fatalf("RunBeforeTool on nil HookRegistry = %+v, want unchanged allow", d)
+	}
+}
+
 // ---- L2-5: AfterAgent hook sequential execution ----
 
 func TestAfterAgentOrder(t *testing.T) {
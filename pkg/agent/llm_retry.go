@@ -271,7 +271,11 @@ func streamAssistantResponseWithRetry(
 		}
 
 		attemptCtx := context.WithValue(ctx, llmAttemptKey, attempt)
-		msg, err := streamAssistantResponseFn(attemptCtx, agentCtx, config, stream)
+		streamFn := config.streamFn
+		if streamFn == nil {
+			streamFn = streamAssistantResponseFn
+		}
+		msg, err := streamFn(attemptCtx, agentCtx, config, stream)
 		if err == nil {
 			return msg, nil
 		}
@@ -34,6 +34,7 @@ func streamAssistantResponse(
 	var llmMessages []llm.LLMMessage
 
 	selectedMessages, _ := selectMessagesForLLM(agentCtx)
+	selectedMessages = annotateStaleOutputs(agentCtx, selectedMessages, config)
 	llmMessages = agentctx.ConvertMessagesToLLM(selectedMessages)
 
 	// Resolve model early — needed for thinking API detection, cache mode, and capability filtering.
@@ -62,6 +63,17 @@ func streamAssistantResponse(
 		}
 	}
 
+	// The stale-output guidance is stable within a session, so it goes in the
+	// system prompt rather than next to the annotated messages.
+	if config.Stale != nil && strings.TrimSpace(config.Stale.Guidance) != "" {
+		guidance := strings.TrimSpace(config.Stale.Guidance)
+		if strings.TrimSpace(systemPrompt) == "" {
+			systemPrompt = guidance
+		} else {
+			systemPrompt = systemPrompt + "\n\n" + guidance
+		}
+	}
+
 	// Inject runtime_state as ephemeral message before last user message.
 	runtimeAppendix := injectRuntimeMeta(agentCtx, config)
 	if runtimeAppendix != "" {
@@ -289,6 +301,7 @@ func streamAssistantResponse(
 				TotalTokens:  e.Usage.TotalTokens,
 				CacheRead:    cachedTokens,
 			}
+			finalMessage.Usage.Cost = agentctx.UsageCost(model.Cost, finalMessage.Usage)
 
 			// Try to inject tool calls from tagged text
 			if updated, ok := injectToolCallsFromTaggedText(finalMessage); ok {
@@ -423,6 +436,9 @@ func updateRuntimeMetaSnapshot(
 		runtimeYAMLString(currentWorkdir),
 		runtimeYAMLString(startupPath),
 	)
+	// The todo list lives in AgentState, not in RecentMessages, so this is
+	// how the model sees it again after compaction.
+	snapshot += runtimeTodosYAML(agentCtx.AgentState.Todos)
 
 	agentCtx.AgentState.RuntimeMetaSnapshot = snapshot
 	agentCtx.AgentState.RuntimeMetaBand = band
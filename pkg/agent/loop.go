@@ -40,6 +40,8 @@ type LoopConfig struct {
 	GetStartupPath func() string
 	// GetSessionDir returns the session directory for checkpoint management.
 	GetSessionDir func() string
+	// GetSessionID returns the current session ID, for hooks that report it.
+	GetSessionID func() string
 	// RunID is the run ID assigned by the parent ai serve process.
 	// Empty when running standalone (ai --mode rpc without ai serve).
 	RunID      string
@@ -60,6 +62,13 @@ type LoopConfig struct {
 	MaxToolCallsPerName int
 	// MaxTurns is the maximum number of conversation turns (0=default=unlimited).
 	MaxTurns int
+	// TokenBudget stops the loop once input+output tokens summed over all
+	// LLM responses of the run reach it (0=unlimited).
+	TokenBudget int
+	// CostBudget stops the loop once the cost in dollars of all LLM
+	// responses of the run reaches it (0=unlimited). Costs come from the
+	// model's prices in models.json; a model without prices costs nothing.
+	CostBudget float64
 	// ContextWindow is the context window for the model (0=use default 128000).
 	ContextWindow int
 	// LLMTotalTimeout is the total timeout for an LLM request (default 10min).
@@ -80,9 +89,22 @@ type LoopConfig struct {
 	// prefix cache hits — both skills and instructions are stable within a session.
 	AgentContextPrefix string
 
+	// Verify declares post-run checks whose failures are fed back to the
+	// model. Nil disables verification.
+	Verify *VerifyConfig
+
+	// Stale tags old or changed-on-disk tool outputs as likely_stale in the
+	// messages sent to the model. Nil disables the annotation.
+	Stale *StaleConfig
+
 	// ConsumeManualCompaction reports and consumes a pending manual compaction request.
 	// It is called by the agent loop at a safe step boundary.
 	ConsumeManualCompaction func() bool
+
+	// streamFn replaces streamAssistantResponseFn for this loop, so tests can
+	// fake the model without touching the package variable. Subagent loops
+	// inherit it with the rest of the parent config.
+	streamFn streamAssistantResponseFunc
 }
 
 // getEffectiveModel returns the current model, using GetModel callback if available.
@@ -115,7 +137,15 @@ func DefaultLoopConfig() *LoopConfig {
 	}
 }
 
-var streamAssistantResponseFn = streamAssistantResponse
+// streamAssistantResponseFunc streams one assistant response into stream.
+type streamAssistantResponseFunc func(
+	ctx context.Context,
+	agentCtx *agentctx.AgentContext,
+	config *LoopConfig,
+	stream *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+) (*agentctx.AgentMessage, error)
+
+var streamAssistantResponseFn streamAssistantResponseFunc = streamAssistantResponse
 
 // RunLoop starts a new agent loop with the given prompts.
 func RunLoop(
@@ -229,6 +259,7 @@ func runInnerLoop(
 
 		agentCtx.RecentMessages = append(agentCtx.RecentMessages, *msg)
 		state.newMessages = append(state.newMessages, *msg)
+		state.recordUsage(msg)
 
 		// Update AgentState with token usage after successful LLM response.
 		if msg.Usage != nil && msg.Usage.TotalTokens > 0 {
@@ -259,9 +290,16 @@ func runInnerLoop(
 		}
 
 		hasMore, toolResults := state.processToolCalls(ctx, msg)
+		state.noteEdits(msg)
 
 		stream.Push(NewTurnEndEvent(msg, toolResults))
 
+		// In edit mode, check the tree after every turn that changed files;
+		// a failure is appended after the tool results for the next call.
+		if hasMore && state.editedSinceVerify && config.Verify.RunOn == VerifyOnEdit {
+			state.verify(ctx)
+		}
+
 		// A manual compact requested during a turn runs after the completed
 		// tool step and before the next model call. For a final response, this
 		// also runs before agent_end below.
@@ -298,6 +336,12 @@ func runInnerLoop(
 				continue
 			}
 
+			// Verification runs on a clean finish. In edit mode it only
+			// runs again if files changed since the last round.
+			if state.shouldVerify(msg) && state.verify(ctx) {
+				continue
+			}
+
 			break
 		}
 	}
@@ -309,7 +353,9 @@ func runInnerLoop(
 		Config:   config,
 	})
 
-	stream.Push(NewAgentEndEvent(agentCtx.RecentMessages))
+	end := NewAgentEndEvent(agentCtx.RecentMessages)
+	end.Verify = state.verifyResult
+	stream.Push(end)
 }
 
 func hashAny(value any) string {
@@ -30,6 +30,17 @@ type loopState struct {
 	// recovery turn after a loop guard hard abort. Prevents re-triggering
 	// if the LLM continues the loop.
 	guardAbortRecovery bool
+	// tokensSpent sums input+output tokens of every LLM response in this
+	// run, checked against LoopConfig.TokenBudget.
+	tokensSpent int
+	// costSpent sums the dollar cost of those responses, checked against
+	// LoopConfig.CostBudget.
+	costSpent float64
+
+	// verifyAttempts counts verification rounds; verifyResult is the latest.
+	verifyAttempts    int
+	verifyResult      *agentctx.VerifyResult
+	editedSinceVerify bool
 }
 
 func newLoopState(
@@ -51,7 +62,7 @@ func newLoopState(
 // cleanup is a no-op now that the checkpoint manager holds no resources.
 func (s *loopState) cleanup() {}
 
-// shouldStop checks for context cancellation and max turns limit.
+// shouldStop checks for context cancellation, the max turns limit and the token and cost budgets.
 // Returns true if the loop should terminate. Pushes AgentEndEvent on stop.
 func (s *loopState) shouldStop(ctx context.Context) bool {
 	select {
@@ -69,9 +80,50 @@ func (s *loopState) shouldStop(ctx context.Context) bool {
 		return true
 	}
 
+	if s.config.TokenBudget > 0 && s.tokensSpent >= s.config.TokenBudget {
+		slog.Info("[Loop] token budget exhausted",
+			"tokens", s.tokensSpent,
+			"tokenBudget", s.config.TokenBudget)
+		s.stream.Push(NewAgentEndEvent(s.agentCtx.RecentMessages))
+		return true
+	}
+
+	if s.config.CostBudget > 0 && s.costSpent >= s.config.CostBudget {
+		slog.Info("[Loop] cost budget exhausted",
+			"cost", s.costSpent,
+			"costBudget", s.config.CostBudget)
+		s.stream.Push(NewAgentEndEvent(s.agentCtx.RecentMessages))
+		return true
+	}
+
 	return false
 }
 
+// recordUsage adds a response's token usage and cost to the run totals.
+func (s *loopState) recordUsage(msg *agentctx.AgentMessage) {
+	if msg != nil && msg.Usage != nil {
+		s.tokensSpent += msg.Usage.InputTokens + msg.Usage.OutputTokens
+		s.costSpent += msg.Usage.Cost.Total
+	}
+}
+
+// shouldVerify reports whether a final response should be verified.
+// Aborted or errored responses are never verified, and rounds stop once
+// MaxAttempts is used up.
+func (s *loopState) shouldVerify(msg *agentctx.AgentMessage) bool {
+	cfg := s.config.Verify
+	if !cfg.enabled() || msg == nil || msg.StopReason == "aborted" || msg.StopReason == "error" {
+		return false
+	}
+	if s.verifyAttempts >= cfg.maxAttempts() {
+		return false
+	}
+	if cfg.RunOn == VerifyOnEdit {
+		return s.editedSinceVerify
+	}
+	return true
+}
+
 // advanceTurn increments the turn counter.
 func (s *loopState) advanceTurn() {
 	s.turnCount++
@@ -247,15 +299,22 @@ func (s *loopState) processToolCalls(
 		return hasMore, nil
 	}
 
-	// Dispatch tool calls to the executor.
-	toolResults = executeToolCalls(ctx, s.agentCtx, s.agentCtx.Tools, s.agentCtx.GetAllowedToolsMap(), msg, s.stream, s.config.Executor, s.config.ToolOutput)
-
-	// Run AfterTool hooks: chain-style, each hook's output feeds the next.
 	hookCtx := HookContext{
 		Ctx:      ctx,
 		AgentCtx: s.agentCtx,
 		Config:   s.config,
 	}
+	var beforeTool beforeToolFunc
+	if s.config.Hooks != nil && len(s.config.Hooks.BeforeToolHooks) > 0 {
+		beforeTool = func(toolName string, args map[string]any) BeforeToolDecision {
+			return s.config.Hooks.RunBeforeTool(hookCtx, toolName, args)
+		}
+	}
+
+	// Dispatch tool calls to the executor.
+	toolResults = executeToolCalls(ctx, s.agentCtx, s.agentCtx.Tools, s.agentCtx.GetAllowedToolsMap(), msg, s.stream, s.config.Executor, s.config.ToolOutput, beforeTool)
+
+	// Run AfterTool hooks: chain-style, each hook's output feeds the next.
 	for i := range toolResults {
 		toolResults[i] = s.config.Hooks.RunAfterTool(hookCtx, toolResults[i].ToolName, toolResults[i])
 	}
@@ -407,6 +407,7 @@ func TestStreamAssistantResponse_LengthStopReasonProducesTruncationGuidance(t *t
 		newLoopTestEventStream(),
 		nil,
 		DefaultToolOutputLimits(),
+		nil,
 	)
 	if len(results) != 1 {
 		t.Fatalf("expected 1 tool result, got %d", len(results))
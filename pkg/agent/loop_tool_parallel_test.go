@@ -93,6 +93,7 @@ func TestExecuteToolCallsParallelFanInFanOut(t *testing.T) {
 		newLoopTestEventStream(),
 		nil,
 		DefaultToolOutputLimits(),
+		nil,
 	)
 	elapsed := time.Since(start)
 
@@ -128,6 +129,7 @@ func TestExecuteToolCallsPreservesOrderWithImmediateError(t *testing.T) {
 		newLoopTestEventStream(),
 		nil,
 		DefaultToolOutputLimits(),
+		nil,
 	)
 
 	if len(results) != 2 {
@@ -169,6 +171,7 @@ func TestExecuteToolCallsInjectsCurrentAgentContext(t *testing.T) {
 		newLoopTestEventStream(),
 		nil,
 		DefaultToolOutputLimits(),
+		nil,
 	)
 
 	if len(results) != 1 {
@@ -203,6 +206,7 @@ func TestExecuteToolCallsReportsMaxTokensTruncationClearly(t *testing.T) {
 		newLoopTestEventStream(),
 		nil,
 		DefaultToolOutputLimits(),
+		nil,
 	)
 
 	if len(results) != 1 {
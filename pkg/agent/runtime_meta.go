@@ -83,6 +83,25 @@ func runtimeYAMLString(value string) string {
 	return strconv.Quote(trimmed)
 }
 
+// runtimeTodosYAML renders the todo list as a runtime_state section.
+// Returns "" when there are no todos.
+func runtimeTodosYAML(todos []agentctx.TodoItem) string {
+	if len(todos) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n  todos:")
+	for _, item := range todos {
+		b.WriteString("\n    - id: ")
+		b.WriteString(runtimeYAMLString(item.ID))
+		b.WriteString("\n      status: ")
+		b.WriteString(item.Status)
+		b.WriteString("\n      content: ")
+		b.WriteString(runtimeYAMLString(item.Content))
+	}
+	return b.String()
+}
+
 // ContextMeta holds telemetry values for runtime state snapshot.
 type ContextMeta struct {
 	TokensUsed        int     `json:"tokens_used"`
@@ -240,3 +240,19 @@ func TestInsertBeforeFirstUserMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateRuntimeMetaSnapshotIncludesTodos(t *testing.T) {
+	agentCtx := agentctx.NewAgentContext("sys")
+	agentCtx.AgentState.Todos = []agentctx.TodoItem{
+		{ID: "1", Content: "write parser", Status: agentctx.TodoStatusCompleted},
+		{ID: "2", Content: "add tests", Status: agentctx.TodoStatusPending},
+	}
+	meta := ContextMeta{TokensUsed: 100, TokensMax: 128000, TokensPercent: 1.0, MessagesInHistory: 2}
+
+	snapshot := updateRuntimeMetaSnapshot(agentCtx, meta, 3, "", "", "")
+	for _, want := range []string{"todos:", `id: "1"`, "status: completed", `content: "add tests"`} {
+		if !containsString(snapshot, want) {
+			t.Fatalf("expected %q in snapshot, got: %s", want, snapshot)
+		}
+	}
+}
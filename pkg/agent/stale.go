@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// StaleConfig enables likely_stale annotations on old tool outputs. Outputs
+// are tagged only in the copy sent to the model; the history is unchanged.
+type StaleConfig struct {
+	// Policy holds the age thresholds. Its WorkingDir is filled from
+	// LoopConfig.GetWorkingDir on each call.
+	Policy agentctx.StalePolicy
+	// Guidance is appended to the system prompt to tell the model what the
+	// annotation means. Empty means no guidance.
+	Guidance string
+}
+
+// stalePolicy returns the policy of cfg with the current working directory.
+func stalePolicy(cfg *StaleConfig, config *LoopConfig) agentctx.StalePolicy {
+	policy := cfg.Policy
+	if config.GetWorkingDir != nil {
+		policy.WorkingDir = config.GetWorkingDir()
+	}
+	return policy
+}
+
+// annotateStaleOutputs returns messages with a likely_stale tag prepended to
+// every stale tool result. messages must be agentCtx.RecentMessages.
+// Duplicate outputs are replaced first: a tag on an old copy would make it
+// differ from the fresh one and defeat DedupToolOutputs.
+func annotateStaleOutputs(agentCtx *agentctx.AgentContext, messages []agentctx.AgentMessage, config *LoopConfig) []agentctx.AgentMessage {
+	if config.Stale == nil || len(messages) == 0 {
+		return messages
+	}
+	stale := agentCtx.StaleOutputs(stalePolicy(config.Stale, config))
+	if len(stale) == 0 {
+		return messages
+	}
+	annotated := append([]agentctx.AgentMessage(nil), agentctx.DedupToolOutputs(messages)...)
+	for i, reason := range stale {
+		msg := annotated[i]
+		content := make([]agentctx.ContentBlock, 0, len(msg.Content)+1)
+		content = append(content, agentctx.TextContent{Type: "text", Text: staleTag(reason)})
+		content = append(content, msg.Content...)
+		msg.Content = content
+		annotated[i] = msg
+	}
+	return annotated
+}
+
+// staleTag formats the annotation for one output.
+func staleTag(reason string) string {
+	return fmt.Sprintf("[likely_stale=true: %s]\n", strings.TrimSpace(reason))
+}
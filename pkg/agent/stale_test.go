@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func TestAnnotateStaleOutputs(t *testing.T) {
+	call := agentctx.NewAssistantMessage()
+	call.Content = []agentctx.ContentBlock{agentctx.ToolCallContent{ID: "c1", Type: "toolCall", Name: "grep", Arguments: map[string]any{"pattern": "x"}}}
+	result := agentctx.NewToolResultMessage("c1", "grep", []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "a.go:1: x"}}, false)
+	agentCtx := agentctx.NewAgentContext("sys")
+	agentCtx.RecentMessages = []agentctx.AgentMessage{call, result}
+	for i := 0; i < 4; i++ {
+		agentCtx.RecentMessages = append(agentCtx.RecentMessages, agentctx.NewUserMessage("next"))
+	}
+
+	// Disabled: messages are returned as is.
+	cfg := &LoopConfig{}
+	if got := annotateStaleOutputs(agentCtx, agentCtx.RecentMessages, cfg); got[1].ExtractText() != "a.go:1: x" {
+		t.Fatalf("unexpected annotation without config: %q", got[1].ExtractText())
+	}
+
+	cfg.Stale = &StaleConfig{Policy: agentctx.StalePolicy{InvestigativeAge: 3}}
+	got := annotateStaleOutputs(agentCtx, agentCtx.RecentMessages, cfg)
+	if !strings.HasPrefix(got[1].ExtractText(), "[likely_stale=true: 4 messages old]") {
+		t.Fatalf("expected stale tag, got %q", got[1].ExtractText())
+	}
+	if agentCtx.RecentMessages[1].ExtractText() != "a.go:1: x" {
+		t.Fatal("annotation must not modify the history")
+	}
+}
@@ -0,0 +1,511 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+	traceevent "github.com/tiancaiamao/ai/pkg/traceevent"
+)
+
+const (
+	// TaskToolName is the name of the in-process subagent tool.
+	TaskToolName = "task"
+
+	defaultTaskMaxTurns = 30
+)
+
+// taskExcludedTools are never handed to a subagent: task would allow
+// unbounded recursion, todo writes to the parent's persisted list, and
+// nobody answers a subagent's ask_user.
+var taskExcludedTools = map[string]bool{
+	TaskToolName: true,
+	"todo":       true,
+	"ask_user":   true,
+}
+
+const taskSystemPromptSuffix = `
+
+## Subagent Mode
+
+You are a subagent running a single task delegated by another agent. Work autonomously; nobody will answer questions. When you are done, reply with a concise final report: what you did, what you found, and anything left unresolved. Only that final reply is returned to the delegating agent.`
+
+// TaskRole is a named subagent profile resolved by the host.
+type TaskRole struct {
+	SystemPrompt string
+	// Tools is the role's tool whitelist (nil = inherit the parent's tools).
+	Tools []string
+	// Model overrides the parent's model when non-empty.
+	Model string
+}
+
+// TaskToolConfig connects the task tool to its host.
+type TaskToolConfig struct {
+	// ParentConfig returns the parent's loop config. The child runs on a copy.
+	ParentConfig func() *LoopConfig
+	// ResolveRole looks up a role by name. Nil disables the role argument.
+	ResolveRole func(name string) (TaskRole, error)
+	// ResolveModel resolves a model name to a model and API key.
+	// Nil disables model overrides.
+	ResolveModel func(name string) (llm.Model, string, error)
+	// Emit receives every child event except streaming updates, tagged with
+	// ParentToolCallID. May be nil.
+	Emit func(AgentEvent)
+	// DefaultMaxTurns caps child turns when the call sets no max_turns (0 = 30).
+	DefaultMaxTurns int
+	// MaxConcurrentTools and QueueTimeout size the child's own tool executor.
+	MaxConcurrentTools int
+	QueueTimeout       int
+}
+
+// TaskTool runs a child agent loop in-process and returns its final report.
+// Several task calls in one assistant message run in parallel, like any
+// other tool calls.
+type TaskTool struct {
+	cfg TaskToolConfig
+}
+
+// NewTaskTool creates a new task tool.
+func NewTaskTool(cfg TaskToolConfig) *TaskTool {
+	if cfg.DefaultMaxTurns <= 0 {
+		cfg.DefaultMaxTurns = defaultTaskMaxTurns
+	}
+	if cfg.MaxConcurrentTools <= 0 {
+		cfg.MaxConcurrentTools = 10
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = 60
+	}
+	return &TaskTool{cfg: cfg}
+}
+
+// Name returns the tool name.
+func (t *TaskTool) Name() string {
+	return TaskToolName
+}
+
+// Description returns the tool description.
+func (t *TaskTool) Description() string {
+	return "Delegate a self-contained task to a subagent with its own fresh context. The subagent sees only the prompt you give it, so include every detail it needs. Only its final report is returned. Call task several times in one response to run subagents in parallel. Optional: role (named profile), system_prompt, tools (subset of your tools), model, max_turns, max_tokens, max_cost."
+}
+
+// Parameters returns the JSON Schema for the tool parameters.
+func (t *TaskTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"prompt": map[string]any{
+				"type":        "string",
+				"description": "Complete task description for the subagent",
+			},
+			"description": map[string]any{
+				"type":        "string",
+				"description": "Short label shown in progress output (3-8 words)",
+			},
+			"role": map[string]any{
+				"type":        "string",
+				"description": "Named role whose system prompt, tools and model the subagent uses",
+			},
+			"system_prompt": map[string]any{
+				"type":        "string",
+				"description": "System prompt for the subagent (overrides the role's prompt)",
+			},
+			"tools": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Tools the subagent may use (default: all of yours except task, todo and ask_user)",
+			},
+			"model": map[string]any{
+				"type":        "string",
+				"description": "Model override, e.g. provider/model-id",
+			},
+			"max_turns": map[string]any{
+				"type":        "integer",
+				"description": "Maximum LLM turns for the subagent",
+			},
+			"max_tokens": map[string]any{
+				"type":        "integer",
+				"description": "Token budget (input + output across all turns); the subagent is stopped when exceeded",
+			},
+			"max_cost": map[string]any{
+				"type":        "number",
+				"description": "Cost budget in dollars across all turns; the subagent is stopped when exceeded",
+			},
+		},
+		"required": []string{"prompt"},
+	}
+}
+
+// taskRequest holds the parsed arguments of one task call.
+type taskRequest struct {
+	prompt       string
+	description  string
+	role         string
+	systemPrompt string
+	tools        []string
+	model        string
+	maxTurns     int
+	maxTokens    int
+	maxCost      float64
+}
+
+func parseTaskRequest(args map[string]any) (taskRequest, error) {
+	var req taskRequest
+	req.prompt = strings.TrimSpace(stringArg(args, "prompt"))
+	if req.prompt == "" {
+		return req, fmt.Errorf("prompt is required")
+	}
+	req.description = strings.TrimSpace(stringArg(args, "description"))
+	req.role = strings.TrimSpace(stringArg(args, "role"))
+	req.systemPrompt = strings.TrimSpace(stringArg(args, "system_prompt"))
+	req.model = strings.TrimSpace(stringArg(args, "model"))
+	req.tools = stringListArg(args["tools"])
+	req.maxTurns = intArg(args, "max_turns")
+	req.maxTokens = intArg(args, "max_tokens")
+	req.maxCost = floatArg(args, "max_cost")
+	if req.maxTurns < 0 || req.maxTokens < 0 || req.maxCost < 0 {
+		return req, fmt.Errorf("max_turns, max_tokens and max_cost must not be negative")
+	}
+	return req, nil
+}
+
+// Execute runs the subagent to completion and returns its final report.
+func (t *TaskTool) Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error) {
+	parent := agentctx.ToolExecutionAgentContext(ctx)
+	if parent == nil {
+		return nil, fmt.Errorf("task tool requires an active agent context")
+	}
+	var parentCfg *LoopConfig
+	if t.cfg.ParentConfig != nil {
+		parentCfg = t.cfg.ParentConfig()
+	}
+	if parentCfg == nil {
+		return nil, fmt.Errorf("task tool is not configured")
+	}
+
+	req, err := parseTaskRequest(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var role TaskRole
+	if req.role != "" {
+		if t.cfg.ResolveRole == nil {
+			return nil, fmt.Errorf("roles are not available")
+		}
+		role, err = t.cfg.ResolveRole(req.role)
+		if err != nil {
+			return nil, fmt.Errorf("resolve role %q: %w", req.role, err)
+		}
+	}
+
+	systemPrompt := req.systemPrompt
+	if systemPrompt == "" {
+		systemPrompt = role.SystemPrompt
+	}
+	if systemPrompt == "" {
+		systemPrompt = parent.SystemPrompt
+	}
+	systemPrompt += taskSystemPromptSuffix
+
+	allowed := req.tools
+	if allowed == nil {
+		allowed = role.Tools
+	}
+	childTools, err := selectTaskTools(parent, allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	childCfg := *parentCfg
+	// The child shares neither the parent's middleware nor its compactor,
+	// whose state and persistence belong to the parent session. Verification
+	// checks the parent's finished work, not each subtask.
+	childCfg.Hooks = nil
+	childCfg.Compactor = nil
+	childCfg.ConsumeManualCompaction = nil
+	childCfg.Verify = nil
+	childCfg.Executor = NewToolExecutor(t.cfg.MaxConcurrentTools, t.cfg.QueueTimeout)
+	childCfg.MaxTurns = t.cfg.DefaultMaxTurns
+	if req.maxTurns > 0 {
+		childCfg.MaxTurns = req.maxTurns
+	}
+	childCfg.TokenBudget = req.maxTokens
+	childCfg.CostBudget = req.maxCost
+
+	modelName := req.model
+	if modelName == "" {
+		modelName = role.Model
+	}
+	if modelName != "" {
+		if t.cfg.ResolveModel == nil {
+			return nil, fmt.Errorf("model override is not available")
+		}
+		model, apiKey, err := t.cfg.ResolveModel(modelName)
+		if err != nil {
+			return nil, fmt.Errorf("resolve model %q: %w", modelName, err)
+		}
+		childCfg.Model = model
+		childCfg.APIKey = apiKey
+		childCfg.GetModel = nil
+		childCfg.GetAPIKey = nil
+		if model.ContextWindow > 0 {
+			childCfg.ContextWindow = model.ContextWindow
+		}
+	}
+	if childCfg.CostBudget > 0 && getEffectiveModel(&childCfg).Cost == nil {
+		return nil, fmt.Errorf("max_cost needs the prices of model %q in models.json", getEffectiveModel(&childCfg).ID)
+	}
+
+	childCtx := agentctx.NewAgentContext(systemPrompt)
+	childCtx.AgentContextPrefix = parent.AgentContextPrefix
+	childCtx.Tools = childTools
+	if parent.AgentState != nil {
+		childCtx.AgentState.WorkspaceRoot = parent.AgentState.WorkspaceRoot
+		childCtx.AgentState.CurrentWorkingDir = parent.AgentState.CurrentWorkingDir
+	}
+
+	parentCallID := agentctx.ToolExecutionCallID(ctx)
+	span := traceevent.StartSpan(ctx, "subagent", traceevent.CategoryTool,
+		traceevent.Field{Key: "parent_tool_call_id", Value: parentCallID},
+		traceevent.Field{Key: "description", Value: req.description},
+		traceevent.Field{Key: "role", Value: req.role},
+		traceevent.Field{Key: "model", Value: getEffectiveModel(&childCfg).ID},
+		traceevent.Field{Key: "max_turns", Value: childCfg.MaxTurns},
+		traceevent.Field{Key: "token_budget", Value: childCfg.TokenBudget},
+		traceevent.Field{Key: "cost_budget", Value: childCfg.CostBudget},
+	)
+	defer span.End()
+
+	slog.Info("[Task] Starting subagent",
+		"parentToolCallID", parentCallID,
+		"description", req.description,
+		"role", req.role,
+		"tools", len(childTools),
+		"maxTurns", childCfg.MaxTurns)
+
+	run := t.run(span.Context(), parentCallID, req, childCtx, &childCfg)
+
+	span.AddField("turns", run.turns)
+	span.AddField("tokens", run.tokens)
+	span.AddField("cost", run.cost)
+	span.AddField("budget_exceeded", run.budgetExceeded)
+	span.AddField("cost_budget_exceeded", run.costExceeded)
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if run.report == "" {
+		if run.err != "" {
+			span.AddField("error", true)
+			span.AddField("error_message", run.err)
+			return nil, fmt.Errorf("subagent failed: %s", run.err)
+		}
+		if run.budgetExceeded {
+			return nil, fmt.Errorf("subagent exceeded its token budget (%d tokens used) before reporting", run.tokens)
+		}
+		if run.costExceeded {
+			return nil, fmt.Errorf("subagent exceeded its cost budget ($%.4f spent) before reporting", run.cost)
+		}
+		return nil, errors.New("subagent finished without a report")
+	}
+
+	report := run.report
+	switch {
+	case run.budgetExceeded:
+		report = fmt.Sprintf("[subagent stopped: token budget of %d exceeded; report may be incomplete]\n\n%s", req.maxTokens, report)
+	case run.costExceeded:
+		report = fmt.Sprintf("[subagent stopped: cost budget of $%.4f exceeded; report may be incomplete]\n\n%s", req.maxCost, report)
+	case run.turnLimitHit:
+		report = fmt.Sprintf("[subagent stopped: reached max_turns=%d; report may be incomplete]\n\n%s", childCfg.MaxTurns, report)
+	}
+	return []agentctx.ContentBlock{
+		agentctx.TextContent{Type: "text", Text: report},
+	}, nil
+}
+
+// taskRun summarizes one finished child loop.
+type taskRun struct {
+	report         string
+	err            string
+	turns          int
+	tokens         int
+	cost           float64
+	budgetExceeded bool
+	costExceeded   bool
+	turnLimitHit   bool
+}
+
+// run drives the child loop and forwards its events. Turn, token and cost
+// limits are enforced by the loop itself (MaxTurns, TokenBudget, CostBudget).
+func (t *TaskTool) run(
+	ctx context.Context,
+	parentCallID string,
+	req taskRequest,
+	childCtx *agentctx.AgentContext,
+	cfg *LoopConfig,
+) taskRun {
+	var result taskRun
+	stream := RunLoop(ctx, []agentctx.AgentMessage{newPromptMessage(req.prompt, nil)}, childCtx, cfg)
+	for event := range stream.Iterator(ctx) {
+		if event.Done {
+			break
+		}
+		ev := event.Value
+		switch ev.Type {
+		case EventTurnEnd:
+			if ev.Message == nil {
+				break
+			}
+			result.turns++
+			if ev.Message.Usage != nil {
+				result.tokens += ev.Message.Usage.InputTokens + ev.Message.Usage.OutputTokens
+				result.cost += ev.Message.Usage.Cost.Total
+			}
+			if text := strings.TrimSpace(ev.Message.ExtractText()); text != "" {
+				result.report = text
+			}
+		case EventError:
+			result.err = ev.Error
+		case EventAgentEnd:
+			if lastMessageHasToolCalls(ev.Messages) {
+				result.budgetExceeded = cfg.TokenBudget > 0 && result.tokens >= cfg.TokenBudget
+				result.costExceeded = !result.budgetExceeded && cfg.CostBudget > 0 && result.cost >= cfg.CostBudget
+				result.turnLimitHit = !result.budgetExceeded && !result.costExceeded && cfg.MaxTurns > 0 && result.turns >= cfg.MaxTurns
+			}
+		}
+		if t.cfg.Emit != nil && ev.Type != EventMessageUpdate {
+			ev.ParentToolCallID = parentCallID
+			t.cfg.Emit(ev)
+		}
+	}
+	if result.budgetExceeded {
+		slog.Warn("[Task] Subagent stopped by token budget",
+			"parentToolCallID", parentCallID,
+			"tokens", result.tokens,
+			"tokenBudget", cfg.TokenBudget)
+	}
+	if result.costExceeded {
+		slog.Warn("[Task] Subagent stopped by cost budget",
+			"parentToolCallID", parentCallID,
+			"cost", result.cost,
+			"costBudget", cfg.CostBudget)
+	}
+	return result
+}
+
+// lastMessageHasToolCalls reports whether the loop stopped while the model
+// still wanted to call tools, i.e. it was cut off rather than finished.
+func lastMessageHasToolCalls(messages []agentctx.AgentMessage) bool {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" {
+			return len(messages[i].ExtractToolCalls()) > 0
+		}
+	}
+	return false
+}
+
+// selectTaskTools returns the parent tools the subagent may use. An empty
+// allowed list means every permitted parent tool except the excluded ones.
+func selectTaskTools(parent *agentctx.AgentContext, allowed []string) ([]agentctx.Tool, error) {
+	available := make(map[string]agentctx.Tool)
+	for _, tool := range parent.Tools {
+		if tool == nil || taskExcludedTools[tool.Name()] || !parent.IsToolAllowed(tool.Name()) {
+			continue
+		}
+		available[tool.Name()] = tool
+	}
+
+	if len(allowed) == 0 {
+		out := make([]agentctx.Tool, 0, len(available))
+		for _, tool := range parent.Tools {
+			if tool != nil && available[tool.Name()] != nil {
+				out = append(out, tool)
+			}
+		}
+		return out, nil
+	}
+
+	out := make([]agentctx.Tool, 0, len(allowed))
+	seen := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		// Role whitelists usually list task/todo for the role's own use.
+		if seen[name] || taskExcludedTools[name] {
+			continue
+		}
+		seen[name] = true
+		tool, ok := available[name]
+		if !ok {
+			names := make([]string, 0, len(available))
+			for n := range available {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("tool %q is not available to subagents (available: %s)", name, strings.Join(names, ", "))
+		}
+		out = append(out, tool)
+	}
+	return out, nil
+}
+
+func stringArg(args map[string]any, key string) string {
+	s, _ := args[key].(string)
+	return s
+}
+
+// intArg reads a numeric argument; JSON numbers arrive as float64.
+func intArg(args map[string]any, key string) int {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// floatArg reads a numeric argument as a float64.
+func floatArg(args map[string]any, key string) float64 {
+	switch v := args[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+// stringListArg accepts a JSON array of strings or a comma-separated string.
+func stringListArg(v any) []string {
+	var out []string
+	switch val := v.(type) {
+	case []any:
+		for _, item := range val {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
+	case []string:
+		for _, s := range val {
+			if strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
+	case string:
+		for _, s := range strings.Split(val, ",") {
+			if strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,305 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+func newTaskTestParent(t *testing.T, toolNames ...string) context.Context {
+	t.Helper()
+	parent := agentctx.NewAgentContext("parent system prompt")
+	for _, name := range toolNames {
+		parent.AddTool(&characterizationTestTool{name: name})
+	}
+	ctx := agentctx.WithToolExecutionAgentContext(context.Background(), parent)
+	return agentctx.WithToolExecutionCallID(ctx, "call-task-1")
+}
+
+// fakeModelConfig returns parent configs whose loops answer with fake
+// instead of calling a model.
+func fakeModelConfig(fake streamAssistantResponseFunc) func() *LoopConfig {
+	return func() *LoopConfig {
+		cfg := DefaultLoopConfig()
+		cfg.streamFn = fake
+		return cfg
+	}
+}
+
+func toolNames(tools []agentctx.Tool) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Name())
+	}
+	return names
+}
+
+func TestTaskToolReturnsFinalReportAndForwardsEvents(t *testing.T) {
+	var gotPrompt string
+	var gotTools []string
+	var calls atomic.Int32
+	fake := streamAssistantResponseFunc(func(
+		_ context.Context,
+		agentCtx *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		n := calls.Add(1)
+		msg := agentctx.NewAssistantMessage()
+		msg.StopReason = "stop"
+		if n == 1 {
+			gotPrompt = agentCtx.SystemPrompt
+			gotTools = toolNames(agentCtx.Tools)
+			msg.Content = []agentctx.ContentBlock{
+				agentctx.TextContent{Type: "text", Text: "looking"},
+				agentctx.ToolCallContent{ID: "child-1", Type: "toolCall", Name: "read", Arguments: map[string]any{"input": "a.go"}},
+			}
+			msg.StopReason = "toolUse"
+			return &msg, nil
+		}
+		msg.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "final report: a.go is fine"}}
+		return &msg, nil
+	})
+
+	var mu sync.Mutex
+	var forwarded []AgentEvent
+	tool := NewTaskTool(TaskToolConfig{
+		ParentConfig: fakeModelConfig(fake),
+		Emit: func(ev AgentEvent) {
+			mu.Lock()
+			forwarded = append(forwarded, ev)
+			mu.Unlock()
+		},
+	})
+
+	ctx := newTaskTestParent(t, "read", "bash", TaskToolName, "todo", "ask_user")
+	result, err := tool.Execute(ctx, map[string]any{"prompt": "check a.go", "tools": []any{"read"}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if text := result[0].(agentctx.TextContent).Text; text != "final report: a.go is fine" {
+		t.Fatalf("unexpected report: %q", text)
+	}
+	if !strings.HasPrefix(gotPrompt, "parent system prompt") || !strings.Contains(gotPrompt, "Subagent Mode") {
+		t.Fatalf("unexpected child system prompt: %q", gotPrompt)
+	}
+	if strings.Join(gotTools, ",") != "read" {
+		t.Fatalf("child tools = %v, want [read]", gotTools)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sawToolStart, sawAgentEnd := false, false
+	for _, ev := range forwarded {
+		if ev.ParentToolCallID != "call-task-1" {
+			t.Fatalf("event %s missing parent tool call id", ev.Type)
+		}
+		switch ev.Type {
+		case EventToolExecutionStart:
+			sawToolStart = true
+		case EventAgentEnd:
+			sawAgentEnd = true
+		case EventMessageUpdate:
+			t.Fatal("streaming updates must not be forwarded")
+		}
+	}
+	if !sawToolStart || !sawAgentEnd {
+		t.Fatalf("expected forwarded tool start and agent end, got %d events", len(forwarded))
+	}
+}
+
+func TestTaskToolStopsOnTokenBudget(t *testing.T) {
+	var calls atomic.Int32
+	fake := streamAssistantResponseFunc(func(
+		_ context.Context,
+		_ *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		n := calls.Add(1)
+		msg := agentctx.NewAssistantMessage()
+		msg.Content = []agentctx.ContentBlock{
+			agentctx.TextContent{Type: "text", Text: fmt.Sprintf("progress %d", n)},
+			agentctx.ToolCallContent{ID: fmt.Sprintf("c%d", n), Type: "toolCall", Name: "read", Arguments: map[string]any{"input": n}},
+		}
+		msg.StopReason = "toolUse"
+		msg.Usage = &agentctx.Usage{InputTokens: 900, OutputTokens: 100, TotalTokens: 1000}
+		return &msg, nil
+	})
+
+	tool := NewTaskTool(TaskToolConfig{ParentConfig: fakeModelConfig(fake)})
+	ctx := newTaskTestParent(t, "read")
+	result, err := tool.Execute(ctx, map[string]any{"prompt": "explore", "max_tokens": float64(1500)})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	text := result[0].(agentctx.TextContent).Text
+	if !strings.Contains(text, "token budget of 1500 exceeded") || !strings.Contains(text, "progress 2") {
+		t.Fatalf("unexpected budget report: %q", text)
+	}
+	if calls.Load() > 3 {
+		t.Fatalf("subagent kept running after budget: %d calls", calls.Load())
+	}
+}
+
+func TestTaskToolStopsOnCostBudget(t *testing.T) {
+	var calls atomic.Int32
+	fake := streamAssistantResponseFunc(func(
+		_ context.Context,
+		_ *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		n := calls.Add(1)
+		msg := agentctx.NewAssistantMessage()
+		msg.Content = []agentctx.ContentBlock{
+			agentctx.TextContent{Type: "text", Text: fmt.Sprintf("progress %d", n)},
+			agentctx.ToolCallContent{ID: fmt.Sprintf("c%d", n), Type: "toolCall", Name: "read", Arguments: map[string]any{"input": n}},
+		}
+		msg.StopReason = "toolUse"
+		msg.Usage = &agentctx.Usage{InputTokens: 900, OutputTokens: 100, TotalTokens: 1000, Cost: agentctx.Cost{Total: 0.03}}
+		return &msg, nil
+	})
+
+	priced := func() *LoopConfig {
+		cfg := DefaultLoopConfig()
+		cfg.streamFn = fake
+		cfg.Model = llm.Model{ID: "m", Cost: &llm.ModelCost{Input: 3, Output: 15}}
+		return cfg
+	}
+	tool := NewTaskTool(TaskToolConfig{ParentConfig: priced})
+	ctx := newTaskTestParent(t, "read")
+	result, err := tool.Execute(ctx, map[string]any{"prompt": "explore", "max_cost": 0.05})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	text := result[0].(agentctx.TextContent).Text
+	if !strings.Contains(text, "cost budget of $0.0500 exceeded") || !strings.Contains(text, "progress 2") {
+		t.Fatalf("unexpected budget report: %q", text)
+	}
+	if calls.Load() > 3 {
+		t.Fatalf("subagent kept running after budget: %d calls", calls.Load())
+	}
+
+	// Without prices the cap could never trigger.
+	unpriced := NewTaskTool(TaskToolConfig{ParentConfig: func() *LoopConfig { return DefaultLoopConfig() }})
+	if _, err := unpriced.Execute(ctx, map[string]any{"prompt": "explore", "max_cost": 0.05}); err == nil ||
+		!strings.Contains(err.Error(), "prices") {
+		t.Fatalf("expected missing prices error, got %v", err)
+	}
+}
+
+func TestTaskToolMaxTurns(t *testing.T) {
+	var calls atomic.Int32
+	fake := streamAssistantResponseFunc(func(
+		_ context.Context,
+		_ *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		n := calls.Add(1)
+		msg := agentctx.NewAssistantMessage()
+		msg.Content = []agentctx.ContentBlock{
+			agentctx.TextContent{Type: "text", Text: "still going"},
+			agentctx.ToolCallContent{ID: fmt.Sprintf("c%d", n), Type: "toolCall", Name: "read", Arguments: map[string]any{"input": n}},
+		}
+		msg.StopReason = "toolUse"
+		return &msg, nil
+	})
+
+	tool := NewTaskTool(TaskToolConfig{ParentConfig: fakeModelConfig(fake)})
+	result, err := tool.Execute(newTaskTestParent(t, "read"), map[string]any{"prompt": "explore", "max_turns": float64(2)})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("LLM calls = %d, want 2", calls.Load())
+	}
+	if text := result[0].(agentctx.TextContent).Text; !strings.Contains(text, "reached max_turns=2") {
+		t.Fatalf("unexpected report: %q", text)
+	}
+}
+
+func TestTaskToolRunsInParallel(t *testing.T) {
+	// Each child blocks until both have started; serial execution would time out.
+	var started sync.WaitGroup
+	started.Add(2)
+	fake := streamAssistantResponseFunc(func(
+		ctx context.Context,
+		_ *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		started.Done()
+		done := make(chan struct{})
+		go func() { started.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			return nil, fmt.Errorf("children did not run in parallel")
+		}
+		msg := agentctx.NewAssistantMessage()
+		msg.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "ok"}}
+		msg.StopReason = "stop"
+		return &msg, nil
+	})
+
+	tool := NewTaskTool(TaskToolConfig{ParentConfig: fakeModelConfig(fake)})
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := tool.Execute(newTaskTestParent(t, "read"), map[string]any{"prompt": "work"})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Execute error: %v", err)
+		}
+	}
+}
+
+func TestTaskToolRoleAndErrors(t *testing.T) {
+	parentCfg := func() *LoopConfig { return DefaultLoopConfig() }
+
+	tool := NewTaskTool(TaskToolConfig{ParentConfig: parentCfg})
+	ctx := newTaskTestParent(t, "read", "bash")
+
+	if _, err := tool.Execute(ctx, map[string]any{}); err == nil {
+		t.Fatal("expected error without prompt")
+	}
+	if _, err := tool.Execute(ctx, map[string]any{"prompt": "x", "tools": []any{"write"}}); err == nil ||
+		!strings.Contains(err.Error(), "available: bash, read") {
+		t.Fatalf("expected unavailable tool error, got %v", err)
+	}
+	if _, err := tool.Execute(ctx, map[string]any{"prompt": "x", "role": "reviewer"}); err == nil {
+		t.Fatal("expected error when roles are not configured")
+	}
+	if _, err := tool.Execute(context.Background(), map[string]any{"prompt": "x"}); err == nil {
+		t.Fatal("expected error without agent context")
+	}
+
+	// Role tool whitelists may mention task/todo; those are dropped silently.
+	tools, err := selectTaskTools(agentctx.ToolExecutionAgentContext(newTaskTestParent(t, "read", "bash", TaskToolName)), []string{"bash", TaskToolName})
+	if err != nil {
+		t.Fatalf("selectTaskTools error: %v", err)
+	}
+	if got := strings.Join(toolNames(tools), ","); got != "bash" {
+		t.Fatalf("selected tools = %s, want bash", got)
+	}
+	// By default the child gets every tool but task, todo and ask_user.
+	tools, err = selectTaskTools(agentctx.ToolExecutionAgentContext(newTaskTestParent(t, "read", "ask_user", "todo", "bash")), nil)
+	if err != nil {
+		t.Fatalf("selectTaskTools error: %v", err)
+	}
+	if got := strings.Join(toolNames(tools), ","); got != "read,bash" {
+		t.Fatalf("default tools = %s, want read,bash", got)
+	}
+}
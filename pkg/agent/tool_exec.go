@@ -14,6 +14,9 @@ import (
 	"log/slog"
 )
 
+// beforeToolFunc screens a validated tool call before it runs; see HookRegistry.RunBeforeTool.
+type beforeToolFunc func(toolName string, args map[string]any) BeforeToolDecision
+
 func executeToolCalls(
 	ctx context.Context,
 	agentCtx *agentctx.AgentContext,
@@ -23,6 +26,7 @@ func executeToolCalls(
 	stream *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
 	executor ToolExecutor,
 	toolOutputLimits ToolOutputLimits,
+	beforeTool beforeToolFunc,
 ) []agentctx.AgentMessage {
 	toolCalls := assistantMsg.ExtractToolCalls()
 	if len(toolCalls) == 0 {
@@ -184,6 +188,36 @@ func executeToolCalls(
 			continue
 		}
 
+		if beforeTool != nil {
+			decision := beforeTool(normalized.Name, normalized.Arguments)
+			if decision.Deny {
+				reason := decision.Reason
+				if reason == "" {
+					reason = "no reason given"
+				}
+				toolSpan.AddField("error", true)
+				toolSpan.AddField("error_message", "denied by hook")
+				toolSpan.End()
+				traceevent.Log(ctx, traceevent.CategoryTool, "tool_call_denied",
+					traceevent.Field{Key: "tool", Value: normalized.Name},
+					traceevent.Field{Key: "tool_call_id", Value: normalized.ID},
+					traceevent.Field{Key: "reason", Value: reason},
+				)
+				slog.Info("[Loop] tool call denied by hook",
+					"tool", normalized.Name,
+					"toolCallID", normalized.ID,
+					"reason", reason)
+				result := agentctx.NewToolResultMessage(normalized.ID, normalized.Name, []agentctx.ContentBlock{
+					agentctx.TextContent{Type: "text", Text: fmt.Sprintf("Tool call denied by hook: %s", reason)},
+				}, true)
+				stream.Push(NewToolExecutionEndEvent(normalized.ID, normalized.Name, &result, true))
+				resultCopy := result
+				resultsByIndex[i] = &resultCopy
+				continue
+			}
+			normalized.Arguments = decision.Args
+		}
+
 		plans = append(plans, toolExecutionPlan{
 			index:      i,
 			normalized: normalized,
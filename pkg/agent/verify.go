@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	traceevent "github.com/tiancaiamao/ai/pkg/traceevent"
+	"github.com/tiancaiamao/ai/pkg/truncate"
+)
+
+// Verify trigger modes.
+const (
+	// VerifyOnAgentEnd runs the checks when the model finishes without errors.
+	VerifyOnAgentEnd = "agent_end"
+	// VerifyOnEdit runs the checks after every turn that edited files.
+	VerifyOnEdit = "edit"
+)
+
+const (
+	defaultVerifyMaxAttempts    = 3
+	defaultVerifyTimeout        = 5 * time.Minute
+	defaultVerifyMaxOutputChars = 4000
+)
+
+// VerifyConfig declares commands that check the agent's work. Failures are
+// fed back to the model as a user message and the loop continues, until the
+// checks pass or MaxAttempts rounds have run.
+type VerifyConfig struct {
+	Commands []string
+	// RunOn is VerifyOnAgentEnd (default) or VerifyOnEdit.
+	RunOn string
+	// MaxAttempts caps the number of check rounds per run (0=default=3).
+	MaxAttempts int
+	// Timeout applies to each command (0=default=5min).
+	Timeout time.Duration
+	// MaxOutputChars caps the output fed back per failed command (0=default=4000).
+	MaxOutputChars int
+	// EditTools are the tool names that count as editing files (default write, edit).
+	EditTools []string
+}
+
+func (c *VerifyConfig) enabled() bool {
+	return c != nil && len(c.Commands) > 0
+}
+
+func (c *VerifyConfig) maxAttempts() int {
+	if c.MaxAttempts > 0 {
+		return c.MaxAttempts
+	}
+	return defaultVerifyMaxAttempts
+}
+
+func (c *VerifyConfig) isEditTool(name string) bool {
+	editTools := c.EditTools
+	if len(editTools) == 0 {
+		editTools = []string{"write", "edit"}
+	}
+	for _, t := range editTools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runVerifyCommands runs every command in dir and returns their results.
+// All commands run even if an earlier one fails, so one round reports
+// every broken check.
+func runVerifyCommands(ctx context.Context, cfg *VerifyConfig, dir string) []agentctx.VerifyCheck {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultVerifyTimeout
+	}
+	maxChars := cfg.MaxOutputChars
+	if maxChars <= 0 {
+		maxChars = defaultVerifyMaxOutputChars
+	}
+
+	checks := make([]agentctx.VerifyCheck, 0, len(cfg.Commands))
+	for _, command := range cfg.Commands {
+		checks = append(checks, runVerifyCommand(ctx, command, dir, timeout, maxChars))
+	}
+	return checks
+}
+
+func runVerifyCommand(ctx context.Context, command, dir string, timeout time.Duration, maxChars int) agentctx.VerifyCheck {
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(cmdCtx, "/bin/sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Kill the whole process group so test binaries do not outlive a timeout.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	check := agentctx.VerifyCheck{
+		Command:    command,
+		Passed:     err == nil,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err == nil {
+		return check
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		check.ExitCode = exitErr.ExitCode()
+	} else {
+		check.ExitCode = -1
+	}
+	text := output.String()
+	if cmdCtx.Err() == context.DeadlineExceeded {
+		text += fmt.Sprintf("\n[verify: command timed out after %s]", timeout)
+	} else if check.ExitCode == -1 {
+		text += "\n[verify: " + err.Error() + "]"
+	}
+	check.Output = truncate.Truncate(strings.TrimSpace(text), maxChars)
+	return check
+}
+
+// buildVerifyFailureMessage turns failed checks into the user message that
+// asks the model to fix them.
+func buildVerifyFailureMessage(result *agentctx.VerifyResult) agentctx.AgentMessage {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[verify] Automatic verification failed (attempt %d/%d). Fix the problems below; the checks run again when you finish.\n",
+		result.Attempts, result.MaxAttempts)
+	for _, c := range result.Checks {
+		if c.Passed {
+			continue
+		}
+		fmt.Fprintf(&b, "\n$ %s\nexit code %d\n```\n%s\n```\n", c.Command, c.ExitCode, c.Output)
+	}
+	return agentctx.NewUserMessage(strings.TrimRight(b.String(), "\n"))
+}
+
+// verify runs one round of checks, emits a verify event and records the
+// result on the loop state. When the checks fail and attempts remain, the
+// failure is appended to the conversation and verify returns true: the loop
+// must continue so the model can fix it.
+func (s *loopState) verify(ctx context.Context) bool {
+	cfg := s.config.Verify
+	dir := ""
+	if s.config.GetWorkingDir != nil {
+		dir = s.config.GetWorkingDir()
+	}
+
+	span := traceevent.StartSpan(ctx, "verify", traceevent.CategoryTool,
+		traceevent.Field{Key: "attempt", Value: s.verifyAttempts + 1})
+	defer span.End()
+
+	s.verifyAttempts++
+	result := &agentctx.VerifyResult{
+		Passed:      true,
+		Attempts:    s.verifyAttempts,
+		MaxAttempts: cfg.maxAttempts(),
+		Checks:      runVerifyCommands(ctx, cfg, dir),
+	}
+	for _, c := range result.Checks {
+		if !c.Passed {
+			result.Passed = false
+		}
+	}
+	s.verifyResult = result
+	s.editedSinceVerify = false
+	span.AddField("passed", result.Passed)
+	slog.Info("[Verify] "+result.Summary(), "dir", dir)
+	s.stream.Push(NewVerifyEvent(result))
+
+	if result.Passed || result.Attempts >= result.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+
+	feedback := buildVerifyFailureMessage(result)
+	s.agentCtx.RecentMessages = append(s.agentCtx.RecentMessages, feedback)
+	s.newMessages = append(s.newMessages, feedback)
+	s.stream.Push(NewMessageStartEvent(feedback))
+	s.stream.Push(NewMessageEndEvent(feedback))
+	return true
+}
+
+// noteEdits records whether msg called a file-editing tool.
+func (s *loopState) noteEdits(msg *agentctx.AgentMessage) {
+	if !s.config.Verify.enabled() || msg == nil {
+		return
+	}
+	for _, tc := range msg.ExtractToolCalls() {
+		if s.config.Verify.isEditTool(tc.Name) {
+			s.editedSinceVerify = true
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+func runVerifyLoop(t *testing.T, cfg *LoopConfig, agentCtx *agentctx.AgentContext) []AgentEvent {
+	t.Helper()
+	stream := RunLoop(context.Background(), []agentctx.AgentMessage{agentctx.NewUserMessage("do it")}, agentCtx, cfg)
+	var events []AgentEvent
+	for ev := range stream.Iterator(context.Background()) {
+		if ev.Done {
+			break
+		}
+		events = append(events, ev.Value)
+	}
+	return events
+}
+
+func verifyEvents(events []AgentEvent) (rounds []*agentctx.VerifyResult, end *AgentEvent) {
+	for i := range events {
+		switch events[i].Type {
+		case EventVerify:
+			rounds = append(rounds, events[i].Verify)
+		case EventAgentEnd:
+			end = &events[i]
+		}
+	}
+	return rounds, end
+}
+
+func TestVerifyFeedsFailureBackUntilChecksPass(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "fixed")
+	var feedback string
+	var calls atomic.Int32
+	fake := streamAssistantResponseFunc(func(
+		_ context.Context,
+		agentCtx *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		n := calls.Add(1)
+		if n == 2 {
+			// The model "fixes" the failure it was told about.
+			feedback = agentCtx.RecentMessages[len(agentCtx.RecentMessages)-1].ExtractText()
+			if err := os.WriteFile(marker, nil, 0o644); err != nil {
+				return nil, err
+			}
+		}
+		msg := agentctx.NewAssistantMessage()
+		msg.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "done"}}
+		msg.StopReason = "stop"
+		return &msg, nil
+	})
+
+	cfg := DefaultLoopConfig()
+	cfg.streamFn = fake
+	cfg.GetWorkingDir = func() string { return dir }
+	cfg.Verify = &VerifyConfig{Commands: []string{"echo checking; test -f fixed"}}
+	events := runVerifyLoop(t, cfg, agentctx.NewAgentContext("sys"))
+
+	if calls.Load() != 2 {
+		t.Fatalf("LLM calls = %d, want 2", calls.Load())
+	}
+	if !strings.Contains(feedback, "[verify]") || !strings.Contains(feedback, "$ echo checking; test -f fixed") ||
+		!strings.Contains(feedback, "exit code 1") || !strings.Contains(feedback, "checking") {
+		t.Fatalf("unexpected feedback message: %q", feedback)
+	}
+
+	rounds, end := verifyEvents(events)
+	if len(rounds) != 2 || rounds[0].Passed || !rounds[1].Passed {
+		t.Fatalf("unexpected verify rounds: %+v", rounds)
+	}
+	if end == nil || end.Verify == nil || !end.Verify.Passed || end.Verify.Attempts != 2 {
+		t.Fatalf("agent_end verify = %+v", end)
+	}
+}
+
+func TestVerifyStopsAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	fake := streamAssistantResponseFunc(func(
+		_ context.Context,
+		_ *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		calls.Add(1)
+		msg := agentctx.NewAssistantMessage()
+		msg.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "done"}}
+		msg.StopReason = "stop"
+		return &msg, nil
+	})
+
+	cfg := DefaultLoopConfig()
+	cfg.streamFn = fake
+	cfg.Verify = &VerifyConfig{Commands: []string{"true", "exit 3"}, MaxAttempts: 2}
+	_, end := verifyEvents(runVerifyLoop(t, cfg, agentctx.NewAgentContext("sys")))
+
+	if calls.Load() != 2 {
+		t.Fatalf("LLM calls = %d, want 2", calls.Load())
+	}
+	if end == nil || end.Verify == nil {
+		t.Fatal("agent_end should carry the verify result")
+	}
+	v := end.Verify
+	if v.Passed || v.Attempts != 2 || len(v.Checks) != 2 || !v.Checks[0].Passed || v.Checks[1].ExitCode != 3 {
+		t.Fatalf("unexpected verify result: %+v", v)
+	}
+}
+
+func TestVerifyOnEditRunsAfterEditingTurns(t *testing.T) {
+	var calls atomic.Int32
+	fake := streamAssistantResponseFunc(func(
+		_ context.Context,
+		_ *agentctx.AgentContext,
+		_ *LoopConfig,
+		_ *llm.EventStream[AgentEvent, []agentctx.AgentMessage],
+	) (*agentctx.AgentMessage, error) {
+		n := calls.Add(1)
+		msg := agentctx.NewAssistantMessage()
+		switch n {
+		case 1:
+			msg.Content = []agentctx.ContentBlock{
+				agentctx.ToolCallContent{ID: "r1", Type: "toolCall", Name: "read", Arguments: map[string]any{"input": "a"}},
+			}
+			msg.StopReason = "toolUse"
+		case 2:
+			msg.Content = []agentctx.ContentBlock{
+				agentctx.ToolCallContent{ID: "w1", Type: "toolCall", Name: "write", Arguments: map[string]any{"input": "b"}},
+			}
+			msg.StopReason = "toolUse"
+		default:
+			msg.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "done"}}
+			msg.StopReason = "stop"
+		}
+		return &msg, nil
+	})
+
+	agentCtx := agentctx.NewAgentContext("sys")
+	agentCtx.AddTool(&characterizationTestTool{name: "read"})
+	agentCtx.AddTool(&characterizationTestTool{name: "write"})
+
+	cfg := DefaultLoopConfig()
+	cfg.streamFn = fake
+	cfg.Verify = &VerifyConfig{Commands: []string{"true"}, RunOn: VerifyOnEdit}
+	rounds, end := verifyEvents(runVerifyLoop(t, cfg, agentCtx))
+
+	// Only the write turn triggers a round; the final answer made no edits.
+	if len(rounds) != 1 || !rounds[0].Passed {
+		t.Fatalf("verify rounds = %+v, want one passing round", rounds)
+	}
+	if end == nil || end.Verify == nil || !end.Verify.Passed {
+		t.Fatalf("agent_end verify = %+v", end)
+	}
+}
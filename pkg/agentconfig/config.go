@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/tiancaiamao/ai/pkg/compact"
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,6 +27,10 @@ type AgentConfig struct {
 	Model        string            `yaml:"model,omitempty"`
 	Middlewares  []MiddlewareEntry `yaml:"middlewares"`
 	Tools        []ToolEntry       `yaml:"tools,omitempty"`
+	Verify       *VerifyEntry      `yaml:"verify,omitempty"`
+
+	ContextManagement *ContextManagementEntry `yaml:"context_management,omitempty"`
+	Compactor         *CompactorEntry         `yaml:"compactor,omitempty"`
 
 	// dir is the directory of the YAML file, used for resolving relative paths.
 	dir string
@@ -46,6 +51,33 @@ func (c *AgentConfig) GetEnabledTools() []string {
 	return result
 }
 
+// VerifyEntry declares checks that run after the agent finishes (or after
+// each turn that edited files); failures are fed back to the model.
+type VerifyEntry struct {
+	Commands       []string `yaml:"commands"`
+	RunOn          string   `yaml:"run_on,omitempty"`           // agent_end (default) or edit
+	MaxAttempts    int      `yaml:"max_attempts,omitempty"`     // check rounds per run (default 3)
+	Timeout        int      `yaml:"timeout,omitempty"`          // seconds per command (default 300)
+	MaxOutputChars int      `yaml:"max_output_chars,omitempty"` // output fed back per failure (default 4000)
+}
+
+// ContextManagementEntry configures likely_stale annotations on old tool
+// outputs and the compaction strategy. Ages are in messages; prompt_file is
+// guidance for the model.
+type ContextManagementEntry struct {
+	StaleAnnotation       bool   `yaml:"stale_annotation"`
+	StaleAgeInvestigative int    `yaml:"stale_age_investigative,omitempty"` // read/grep/find/ls/bash (default 20)
+	StaleAgeModification  int    `yaml:"stale_age_modification,omitempty"`  // edit/write (default 30)
+	PromptFile            string `yaml:"prompt_file,omitempty"`
+	Compaction            string `yaml:"compaction,omitempty"` // llm (default) or extractive
+}
+
+// CompactorEntry configures the compactor of the role. Model runs
+// compaction calls on a different model than the role's.
+type CompactorEntry struct {
+	Model *compact.ModelConfig `yaml:"model,omitempty"`
+}
+
 // MiddlewareEntry represents a single middleware reference in the config.
 type MiddlewareEntry struct {
 	Name    string         `yaml:"name"`
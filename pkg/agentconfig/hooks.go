@@ -1,13 +1,26 @@
 package agentconfig
 
 import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/tiancaiamao/ai/pkg/agent"
+	"github.com/tiancaiamao/ai/pkg/compact"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
 	"github.com/tiancaiamao/ai/pkg/middlewares"
 )
 
 // BuildHooks creates a HookRegistry from the configured middleware entries.
 // Middleware entries with enabled=false or unknown names are silently skipped.
 func (c *AgentConfig) BuildHooks() *agent.HookRegistry {
+	return c.BuildHooksWithDefaults(nil)
+}
+
+// BuildHooksWithDefaults is BuildHooks with default params from the host,
+// keyed by middleware name. Params set in agent.yaml take precedence.
+func (c *AgentConfig) BuildHooksWithDefaults(defaults map[string]map[string]any) *agent.HookRegistry {
 	// Filter to enabled entries only.
 	enabled := make([]middlewares.MiddlewareEntry, 0, len(c.Middlewares))
 	for _, m := range c.Middlewares {
@@ -18,9 +31,19 @@ func (c *AgentConfig) BuildHooks() *agent.HookRegistry {
 		if middlewares.Lookup(m.Name) == nil {
 			continue
 		}
+		params := m.Params
+		if d := defaults[m.Name]; len(d) > 0 {
+			params = make(map[string]any, len(d)+len(m.Params))
+			for k, v := range d {
+				params[k] = v
+			}
+			for k, v := range m.Params {
+				params[k] = v
+			}
+		}
 		enabled = append(enabled, middlewares.MiddlewareEntry{
 			Name:   m.Name,
-			Params: m.Params,
+			Params: params,
 		})
 	}
 
@@ -31,7 +54,102 @@ func (c *AgentConfig) BuildHooks() *agent.HookRegistry {
 	registry, err := middlewares.BuildHooks(enabled)
 	if err != nil {
 		// Log but don't fail — degraded mode is acceptable.
+		slog.Warn("[AgentConfig] failed to build middleware hooks", "error", err)
 		return nil
 	}
 	return registry
 }
+
+// BuildVerify converts the verify section into the loop's VerifyConfig.
+// Returns nil when no commands are configured.
+func (c *AgentConfig) BuildVerify() *agent.VerifyConfig {
+	if c.Verify == nil {
+		return nil
+	}
+	commands := make([]string, 0, len(c.Verify.Commands))
+	for _, cmd := range c.Verify.Commands {
+		if strings.TrimSpace(cmd) != "" {
+			commands = append(commands, cmd)
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	runOn := c.Verify.RunOn
+	switch runOn {
+	case "", agent.VerifyOnAgentEnd, agent.VerifyOnEdit:
+	default:
+		slog.Warn("[AgentConfig] unknown verify run_on, using agent_end", "run_on", runOn)
+		runOn = agent.VerifyOnAgentEnd
+	}
+	return &agent.VerifyConfig{
+		Commands:       commands,
+		RunOn:          runOn,
+		MaxAttempts:    c.Verify.MaxAttempts,
+		Timeout:        time.Duration(c.Verify.Timeout) * time.Second,
+		MaxOutputChars: c.Verify.MaxOutputChars,
+	}
+}
+
+// Default stale ages, in messages.
+const (
+	defaultStaleAgeInvestigative = 20
+	defaultStaleAgeModification  = 30
+)
+
+// BuildStale converts the context_management section into the loop's
+// StaleConfig. Returns nil unless stale_annotation is enabled. A missing
+// prompt_file is logged and the annotation runs without guidance.
+func (c *AgentConfig) BuildStale() *agent.StaleConfig {
+	cm := c.ContextManagement
+	if cm == nil || !cm.StaleAnnotation {
+		return nil
+	}
+	cfg := &agent.StaleConfig{
+		Policy: agentctx.StalePolicy{
+			InvestigativeAge: cm.StaleAgeInvestigative,
+			ModificationAge:  cm.StaleAgeModification,
+		},
+	}
+	if cfg.Policy.InvestigativeAge <= 0 {
+		cfg.Policy.InvestigativeAge = defaultStaleAgeInvestigative
+	}
+	if cfg.Policy.ModificationAge <= 0 {
+		cfg.Policy.ModificationAge = defaultStaleAgeModification
+	}
+	if cm.PromptFile != "" {
+		path := c.resolvePath(cm.PromptFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("[AgentConfig] failed to read context_management prompt_file", "path", path, "error", err)
+		} else {
+			cfg.Guidance = string(data)
+		}
+	}
+	return cfg
+}
+
+// CompactionStrategy returns the compaction strategy chosen by
+// context_management.compaction, or "" for the default. An unknown value is
+// logged and ignored.
+func (c *AgentConfig) CompactionStrategy() string {
+	if c.ContextManagement == nil {
+		return ""
+	}
+	switch strategy := c.ContextManagement.Compaction; strategy {
+	case "", compact.StrategyLLM, compact.StrategyExtractive:
+		return strategy
+	default:
+		slog.Warn("[AgentConfig] unknown context_management compaction strategy, using llm", "compaction", strategy)
+		return ""
+	}
+}
+
+// CompactionModel returns the separate compaction model from
+// compactor.model, or nil to use the role's model.
+func (c *AgentConfig) CompactionModel() *compact.ModelConfig {
+	if c.Compactor == nil || c.Compactor.Model == nil || c.Compactor.Model.Name == "" {
+		return nil
+	}
+	return c.Compactor.Model
+}
@@ -1,8 +1,13 @@
 package agentconfig
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/tiancaiamao/ai/pkg/agent"
+	"github.com/tiancaiamao/ai/pkg/compact"
 	"github.com/tiancaiamao/ai/pkg/middlewares"
 )
 
@@ -58,6 +63,32 @@ func TestEnabledKnownMiddleware(t *testing.T) {
 	}
 }
 
+// --- Host defaults fill params agent.yaml leaves unset ---
+
+func TestBuildHooksWithDefaults(t *testing.T) {
+	cfg := &AgentConfig{
+		Version: 1,
+		Middlewares: []MiddlewareEntry{
+			{Name: "memory_extract", Enabled: true, Params: map[string]any{"min_messages": 2}},
+		},
+	}
+	result := cfg.BuildHooksWithDefaults(map[string]map[string]any{
+		"memory_extract": {"dir": t.TempDir(), "max_entries": 10},
+	})
+	if result == nil || len(result.AfterAgentHooks) != 1 {
+		t.Fatalf("expected one AfterAgentHook, got %+v", result)
+	}
+	if cfg.Middlewares[0].Params["dir"] != nil {
+		t.Fatal("defaults must not be written into the config")
+	}
+
+	// A host that turned memory off turns extraction off too.
+	result = cfg.BuildHooksWithDefaults(map[string]map[string]any{"memory_extract": {"disabled": true}})
+	if result != nil && len(result.AfterAgentHooks) != 0 {
+		t.Fatalf("expected no hooks, got %+v", result)
+	}
+}
+
 // --- Mixed: one unknown, one disabled, one enabled known ---
 
 func TestMixedMiddlewares(t *testing.T) {
@@ -104,3 +135,146 @@ func TestMiddlewarePackageIndirectImport(t *testing.T) {
 		t.Fatal("destructive_guard should be registered in the middleware registry")
 	}
 }
+
+// --- verify section converts to agent.VerifyConfig ---
+
+func TestBuildVerify(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "agent.yaml")
+	yaml := `version: 1
+system_prompt: sp.md
+verify:
+  commands:
+    - go build ./...
+    - "  "
+  run_on: edit
+  max_attempts: 2
+  timeout: 90
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := cfg.BuildVerify()
+	if v == nil {
+		t.Fatal("expected VerifyConfig")
+	}
+	if len(v.Commands) != 1 || v.Commands[0] != "go build ./..." {
+		t.Fatalf("commands = %q", v.Commands)
+	}
+	if v.RunOn != agent.VerifyOnEdit || v.MaxAttempts != 2 || v.Timeout != 90*time.Second {
+		t.Fatalf("unexpected VerifyConfig: %+v", v)
+	}
+
+	// No section, or no usable commands, disables verification.
+	if (&AgentConfig{}).BuildVerify() != nil {
+		t.Fatal("expected nil without verify section")
+	}
+	if (&AgentConfig{Verify: &VerifyEntry{Commands: []string{""}}}).BuildVerify() != nil {
+		t.Fatal("expected nil without commands")
+	}
+	// Unknown run_on falls back to agent_end.
+	if v := (&AgentConfig{Verify: &VerifyEntry{Commands: []string{"true"}, RunOn: "sometimes"}}).BuildVerify(); v.RunOn != agent.VerifyOnAgentEnd {
+		t.Fatalf("run_on = %q, want agent_end", v.RunOn)
+	}
+}
+
+// --- context_management section converts to agent.StaleConfig ---
+
+func TestBuildStale(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "agent.yaml")
+	yaml := `version: 1
+system_prompt: sp.md
+context_management:
+  stale_annotation: true
+  stale_age_investigative: 12
+  prompt_file: ./cm.md
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cm.md"), []byte("stale guidance"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cfg.BuildStale()
+	if s == nil {
+		t.Fatal("expected StaleConfig")
+	}
+	if s.Policy.InvestigativeAge != 12 || s.Policy.ModificationAge != defaultStaleAgeModification {
+		t.Fatalf("unexpected ages: %+v", s.Policy)
+	}
+	if s.Guidance != "stale guidance" {
+		t.Fatalf("guidance = %q", s.Guidance)
+	}
+
+	// Disabled annotation, or no section, yields nil.
+	if (&AgentConfig{}).BuildStale() != nil {
+		t.Fatal("expected nil without context_management section")
+	}
+	if (&AgentConfig{ContextManagement: &ContextManagementEntry{StaleAgeInvestigative: 5}}).BuildStale() != nil {
+		t.Fatal("expected nil with stale_annotation: false")
+	}
+	// A missing prompt file only drops the guidance.
+	cfg.ContextManagement.PromptFile = "missing.md"
+	if s := cfg.BuildStale(); s == nil || s.Guidance != "" {
+		t.Fatalf("expected config without guidance, got %+v", s)
+	}
+}
+
+func TestCompactionStrategy(t *testing.T) {
+	for _, tc := range []struct {
+		compaction string
+		want       string
+	}{
+		{"", ""},
+		{"llm", "llm"},
+		{"extractive", "extractive"},
+		{"bogus", ""},
+	} {
+		cfg := &AgentConfig{ContextManagement: &ContextManagementEntry{Compaction: tc.compaction}}
+		if got := cfg.CompactionStrategy(); got != tc.want {
+			t.Errorf("CompactionStrategy(%q) = %q, want %q", tc.compaction, got, tc.want)
+		}
+	}
+	if got := (&AgentConfig{}).CompactionStrategy(); got != "" {
+		t.Errorf("CompactionStrategy without section = %q", got)
+	}
+}
+
+func TestCompactionModel(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "agent.yaml")
+	yaml := `version: 1
+system_prompt: sp.md
+compactor:
+  model:
+    name: openai/gpt-4o-mini
+    thinking_level: "off"
+    context_window: 128000
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := cfg.CompactionModel()
+	if m == nil || m.Name != "openai/gpt-4o-mini" || m.ThinkingLevel != "off" || m.ContextWindow != 128000 {
+		t.Fatalf("CompactionModel = %+v", m)
+	}
+	if (&AgentConfig{}).CompactionModel() != nil {
+		t.Fatal("expected nil without compactor section")
+	}
+	if (&AgentConfig{Compactor: &CompactorEntry{Model: &compact.ModelConfig{}}}).CompactionModel() != nil {
+		t.Fatal("expected nil without a model name")
+	}
+}
@@ -0,0 +1,218 @@
+package compact
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session/search"
+)
+
+// ArchivedMessage is one message read back from a compaction archive.
+// ID is "<archive>:<index>", e.g. "3:17" is the 17th message (1-based) of
+// compactions/archived_00003.jsonl.
+type ArchivedMessage struct {
+	ID      string
+	Archive int
+	Index   int
+	Message agentctx.AgentMessage
+	// ToolArgs holds the arguments of the tool call that produced a tool
+	// result, when the call was archived alongside it.
+	ToolArgs map[string]any
+}
+
+// ArchiveHit is a search result from SearchArchives.
+type ArchiveHit struct {
+	ArchivedMessage
+	Score float64
+}
+
+// archiveID formats the recall ID of a message in an archive.
+func archiveID(archive, index int) string {
+	return fmt.Sprintf("%d:%d", archive, index)
+}
+
+// archiveNumber extracts NNNNN from an archived_NNNNN.jsonl path.
+// Returns 0 if the name does not match.
+func archiveNumber(path string) int {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, "archived_") || !strings.HasSuffix(name, ".jsonl") {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "archived_"), ".jsonl"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// LoadArchives reads every compaction archive in sessionDir, oldest first.
+// A missing compactions directory yields no messages and no error; lines
+// that fail to decode are skipped.
+func LoadArchives(sessionDir string) ([]ArchivedMessage, error) {
+	if sessionDir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(sessionDir, "compactions", "archived_*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(paths, func(i, j int) bool { return archiveNumber(paths[i]) < archiveNumber(paths[j]) })
+
+	var all []ArchivedMessage
+	for _, path := range paths {
+		n := archiveNumber(path)
+		if n == 0 {
+			continue
+		}
+		msgs, err := loadArchive(path, n)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, msgs...)
+	}
+	return all, nil
+}
+
+// loadArchive reads one archive file and links tool results to the
+// arguments of the call that produced them.
+func loadArchive(path string, archive int) ([]ArchivedMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msgs []ArchivedMessage
+	callArgs := map[string]map[string]any{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	index := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		index++
+		var msg agentctx.AgentMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+		am := ArchivedMessage{ID: archiveID(archive, index), Archive: archive, Index: index, Message: msg}
+		for _, tc := range msg.ExtractToolCalls() {
+			callArgs[tc.ID] = tc.Arguments
+		}
+		if msg.Role == "toolResult" {
+			am.ToolArgs = callArgs[msg.ToolCallID]
+		}
+		msgs = append(msgs, am)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read archive %s: %w", path, err)
+	}
+	return msgs, nil
+}
+
+// FindArchived returns the archived message with the given recall ID
+// ("<archive>:<index>") or session entry ID.
+func FindArchived(msgs []ArchivedMessage, id string) (ArchivedMessage, bool) {
+	id = strings.TrimSpace(id)
+	for _, m := range msgs {
+		if m.ID == id || (m.Message.EntryID != "" && m.Message.EntryID == id) {
+			return m, true
+		}
+	}
+	return ArchivedMessage{}, false
+}
+
+// SearchText is the text indexed for m: tool name, tool arguments and content.
+func (m ArchivedMessage) SearchText() string {
+	var b strings.Builder
+	if m.Message.ToolName != "" {
+		b.WriteString(m.Message.ToolName)
+		b.WriteByte('\n')
+	}
+	if len(m.ToolArgs) > 0 {
+		if data, err := json.Marshal(m.ToolArgs); err == nil {
+			b.Write(data)
+			b.WriteByte('\n')
+		}
+	}
+	for _, tc := range m.Message.ExtractToolCalls() {
+		b.WriteString(tc.Name)
+		if data, err := json.Marshal(tc.Arguments); err == nil {
+			b.WriteByte(' ')
+			b.Write(data)
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(m.Message.ExtractText())
+	return b.String()
+}
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchArchives ranks msgs against query with BM25 over SearchText and
+// returns at most limit hits, best first. Messages with no query term
+// are never returned.
+func SearchArchives(msgs []ArchivedMessage, query string, limit int) []ArchiveHit {
+	terms := search.Tokens(query)
+	if len(terms) == 0 || len(msgs) == 0 {
+		return nil
+	}
+
+	docs := make([]map[string]int, len(msgs))
+	lengths := make([]int, len(msgs))
+	df := map[string]int{}
+	total := 0
+	for i, m := range msgs {
+		tf := map[string]int{}
+		tokens := search.Tokens(m.SearchText())
+		for _, tok := range tokens {
+			tf[tok]++
+		}
+		for tok := range tf {
+			df[tok]++
+		}
+		docs[i] = tf
+		lengths[i] = len(tokens)
+		total += len(tokens)
+	}
+	avgLen := float64(total) / float64(len(msgs))
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	n := float64(len(msgs))
+	var hits []ArchiveHit
+	for i, tf := range docs {
+		score := 0.0
+		for _, term := range terms {
+			f := float64(tf[term])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[term])+0.5)/(float64(df[term])+0.5))
+			score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/avgLen))
+		}
+		if score > 0 {
+			hits = append(hits, ArchiveHit{ArchivedMessage: msgs[i], Score: score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
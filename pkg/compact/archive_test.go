@@ -170,3 +170,81 @@ func TestCompact_SummaryContainsArchivePath(t *testing.T) {
 		t.Error("no archived_*.jsonl file found in compactions dir")
 	}
 }
+
+func writeTestArchive(t *testing.T, dir string, msgs ...agentctx.AgentMessage) {
+	t.Helper()
+	if path := saveArchivedMessages(dir, msgs); path == "" {
+		t.Fatal("saveArchivedMessages failed")
+	}
+}
+
+func archivedToolCall(id, name string, args map[string]any) agentctx.AgentMessage {
+	msg := agentctx.NewAssistantMessage()
+	msg.Content = []agentctx.ContentBlock{agentctx.ToolCallContent{ID: id, Type: "toolCall", Name: name, Arguments: args}}
+	return msg
+}
+
+func archivedToolResult(id, name, text string) agentctx.AgentMessage {
+	return agentctx.NewToolResultMessage(id, name, []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: text}}, false)
+}
+
+func TestLoadArchives_IDsAndToolArgs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestArchive(t, dir, agentctx.NewUserMessage("first archive"))
+	writeTestArchive(t, dir,
+		archivedToolCall("c1", "read", map[string]any{"path": "pkg/compact/compact.go"}),
+		archivedToolResult("c1", "read", "package compact"),
+	)
+
+	msgs, err := LoadArchives(dir)
+	if err != nil {
+		t.Fatalf("LoadArchives: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 archived messages, got %d", len(msgs))
+	}
+	if msgs[0].ID != "1:1" || msgs[1].ID != "2:1" || msgs[2].ID != "2:2" {
+		t.Errorf("unexpected IDs %q %q %q", msgs[0].ID, msgs[1].ID, msgs[2].ID)
+	}
+	if msgs[2].ToolArgs["path"] != "pkg/compact/compact.go" {
+		t.Errorf("tool result should carry its call arguments, got %v", msgs[2].ToolArgs)
+	}
+	if m, ok := FindArchived(msgs, "2:2"); !ok || m.Message.ExtractText() != "package compact" {
+		t.Errorf("FindArchived(2:2) = %+v, %v", m, ok)
+	}
+
+	if msgs, err := LoadArchives(t.TempDir()); err != nil || len(msgs) != 0 {
+		t.Errorf("empty session dir: got %d messages, err %v", len(msgs), err)
+	}
+}
+
+func TestSearchArchives_RanksByToolArgsAndContent(t *testing.T) {
+	dir := t.TempDir()
+	writeTestArchive(t, dir,
+		agentctx.NewUserMessage("please fix the flaky watcher test"),
+		archivedToolCall("c1", "read", map[string]any{"path": "pkg/watch/watcher.go"}),
+		archivedToolResult("c1", "read", "func (w *Watcher) Start() error { ... }"),
+		archivedToolCall("c2", "bash", map[string]any{"command": "go test ./pkg/session/..."}),
+		archivedToolResult("c2", "bash", "ok  session 0.3s"),
+	)
+	msgs, err := LoadArchives(dir)
+	if err != nil {
+		t.Fatalf("LoadArchives: %v", err)
+	}
+
+	hits := SearchArchives(msgs, "watcher.go", 10)
+	if len(hits) < 2 {
+		t.Fatalf("expected hits for watcher.go, got %+v", hits)
+	}
+	top := map[string]bool{hits[0].ID: true, hits[1].ID: true}
+	if !top["1:2"] || !top["1:3"] {
+		t.Errorf("expected the read call and result to rank first, got %s, %s", hits[0].ID, hits[1].ID)
+	}
+
+	if hits := SearchArchives(msgs, "session", 1); len(hits) != 1 || hits[0].ID != "1:5" {
+		t.Errorf("expected the bash result as top hit for session, got %+v", hits)
+	}
+	if hits := SearchArchives(msgs, "nonexistent", 10); len(hits) != 0 {
+		t.Errorf("expected no hits, got %d", len(hits))
+	}
+}
@@ -36,6 +36,15 @@ type Config struct {
 	GracePeriod int
 	AutoCompact bool // Whether to automatically compact
 
+	// KeepSegments is how many segment summaries (one per compaction) stay
+	// in context before the oldest are merged into the session digest.
+	// 0 means 4.
+	KeepSegments int
+
+	// Model, when set, runs compaction calls on a different model than the
+	// agent's; see ModelConfig.
+	Model *ModelConfig `json:"model,omitempty"`
+
 	// LLMDecide enables LLM-decides compaction mode for large context windows.
 	// When set, ShouldCompact uses soft/hard thresholds + tool-call intervals,
 	// and asks the LLM whether to compact when an interval is reached.
@@ -133,9 +142,20 @@ type Compactor struct {
 	// askLLM/GenerateSummary requests include the same thinking/reasoning
 	// parameters, keeping them in the same prefix-cache partition.
 	thinkingLevel string
+	// separateModel is set by UseModel: model is not the agent's model.
+	separateModel bool
+	// fixedThinking keeps thinkingLevel when the agent's level changes.
+	fixedThinking bool
+	// meter accumulates the usage of compaction calls; see SetUsageMeter.
+	meter *UsageMeter
 	// sessionDir is the session directory used for archiving old messages
 	// that are removed during compaction. When empty, archiving is skipped.
 	sessionDir string
+	// stalePolicy, when set, makes tool results it finds stale go first
+	// among equal priorities when excess results are archived.
+	stalePolicy *agentctx.StalePolicy
+	// getWorkingDir resolves relative paths for stalePolicy.
+	getWorkingDir func() string
 	// askFunc allows tests to inject a fake LLM decision without a real API
 	// call. nil means use the real askLLM method.
 	askFunc func(ctx context.Context, agentCtx *agentctx.AgentContext, tokens int) (bool, error)
@@ -167,6 +187,7 @@ func NewCompactor(config *Config, model llm.Model, apiKey, systemPrompt string,
 		systemPrompt:  systemPrompt,
 		contextWindow: contextWindow,
 		sessionDir:    sessionDir,
+		meter:         &UsageMeter{},
 	}
 }
 
@@ -272,9 +293,34 @@ func (c *Compactor) SetAgentContextPrefix(prefix string) {
 	c.agentContextPrefix = prefix
 }
 
+// SetStalePolicy enables stale-first eviction of tool results. A nil policy
+// disables it; getWorkingDir may be nil.
+func (c *Compactor) SetStalePolicy(policy *agentctx.StalePolicy, getWorkingDir func() string) {
+	c.stalePolicy = policy
+	c.getWorkingDir = getWorkingDir
+}
+
+// staleOutputs returns the stale tool results of messages by index, or nil
+// when no policy is set.
+func (c *Compactor) staleOutputs(messages []agentctx.AgentMessage) map[int]string {
+	if c.stalePolicy == nil {
+		return nil
+	}
+	policy := *c.stalePolicy
+	if c.getWorkingDir != nil {
+		policy.WorkingDir = c.getWorkingDir()
+	}
+	ctx := &agentctx.AgentContext{RecentMessages: messages}
+	return ctx.StaleOutputs(policy)
+}
+
 // SetThinkingLevel sets the thinking level used in askLLM/GenerateSummary
 // requests so they match the agent loop's thinking/reasoning parameters.
+// It is ignored when UseModel set a thinking level of its own.
 func (c *Compactor) SetThinkingLevel(level string) {
+	if c.fixedThinking {
+		return
+	}
 	c.thinkingLevel = level
 }
 
@@ -375,6 +421,21 @@ func estimateMessageTokens(msg agentctx.AgentMessage) int {
 // goCtx carries trace context (trace buf + span) so LLM calls within
 // compaction are properly traced.
 func (c *Compactor) Compact(goCtx context.Context, ctx *agentctx.AgentContext) (*agentctx.CompactionResult, error) {
+	return c.compact(goCtx, ctx, c)
+}
+
+// summarizer writes the summaries of a compaction.
+type summarizer interface {
+	// summarize writes the segment summary of conversation, the part of
+	// oldMessages that is not an earlier summary.
+	summarize(goCtx context.Context, ctx *agentctx.AgentContext, oldMessages, conversation []agentctx.AgentMessage) (string, error)
+	// digest merges folded summaries into the session digest; "" joins
+	// them with fallbackDigest.
+	digest(goCtx context.Context, ctx *agentctx.AgentContext, summaries []agentctx.AgentMessage) (string, error)
+}
+
+// compact runs the compaction pipeline with the summaries written by s.
+func (c *Compactor) compact(goCtx context.Context, ctx *agentctx.AgentContext, s summarizer) (*agentctx.CompactionResult, error) {
 	if len(ctx.RecentMessages) == 0 {
 		return &agentctx.CompactionResult{
 			TokensBefore: 0,
@@ -412,16 +473,56 @@ func (c *Compactor) Compact(goCtx context.Context, ctx *agentctx.AgentContext) (
 			}, nil
 		}
 	}
+	// Pinned messages are never summarized: keep them verbatim after the summary.
+	oldMessages, pinned := splitPinned(oldMessages)
+	if len(oldMessages) == 0 {
+		return &agentctx.CompactionResult{
+			TokensBefore: tokensBefore,
+			TokensAfter:  tokensBefore,
+		}, nil
+	}
+	warnPinnedBudget(pinned, keepRecentTokens)
+	// Earlier summaries are not summarized again: they stay in context until
+	// they are folded into the session digest.
+	summaries, conversation := splitSummaries(oldMessages)
+	if len(conversation) == 0 {
+		return &agentctx.CompactionResult{
+			TokensBefore: tokensBefore,
+			TokensAfter:  tokensBefore,
+		}, nil
+	}
+
 	slog.Info("[Compact] Compressing messages",
 		"count", len(ctx.RecentMessages),
 		"keepTokens", keepRecentTokens,
 		"threshold", c.CalculateDynamicThreshold(),
 		"contextWindow", c.contextWindow)
 
-	// Generate summary of old messages (with previous summary for incremental update)
-	summary, err := c.GenerateSummary(goCtx, oldMessages, ctx.SystemPrompt, c.agentContextPrefix, ctx.Tools)
+	summary, err := s.summarize(goCtx, ctx, oldMessages, conversation)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate summary: %w", err)
+		return nil, err
+	}
+
+	// Fold the oldest segments, and the digest they are merged into, out of
+	// the context.
+	var folded []agentctx.AgentMessage
+	segments := 0
+	for _, msg := range summaries {
+		if messageKind(msg) == "compactionSummary" {
+			segments++
+		}
+	}
+	if n := segmentsToFold(segments, c.KeepSegments()); n > 0 {
+		for _, msg := range summaries {
+			if messageKind(msg) == "sessionDigest" {
+				n++
+			}
+			if len(folded) == n {
+				break
+			}
+			folded = append(folded, msg)
+		}
+		summaries = summaries[len(folded):]
 	}
 
 	slog.Info("[Compact] Generated summary", "chars", len(summary))
@@ -429,10 +530,12 @@ func (c *Compactor) Compact(goCtx context.Context, ctx *agentctx.AgentContext) (
 	// Ensure tool_call and tool_result pairing is preserved.
 	// GracePeriod <= 0 is clamped to 1 inside, so the most recent tool
 	// result is always protected.
-	recentMessages = c.ensureToolCallPairingWithGrace(oldMessages, recentMessages)
+	// Calls stripped from pinned assistant messages count as summarized.
+	recentMessages = c.ensureToolCallPairingWithGrace(append(append([]agentctx.AgentMessage{}, conversation...), pinned...), recentMessages)
 
 	// Archive old messages so the agent can access them via read/grep later.
-	archivePath := saveArchivedMessages(c.sessionDir, oldMessages)
+	// Folded summaries leave the context too, so they are archived with them.
+	archivePath := saveArchivedMessages(c.sessionDir, append(append([]agentctx.AgentMessage{}, folded...), conversation...))
 
 	// Create new recent messages with summary, including archive path note.
 	// The archive note is placed BEFORE the summary so the agent sees it first
@@ -440,13 +543,23 @@ func (c *Compactor) Compact(goCtx context.Context, ctx *agentctx.AgentContext) (
 	recentMessages = RemoveAllCanaries(recentMessages)
 	summaryText := summary
 	if archivePath != "" {
-		summaryText = fmt.Sprintf(archiveNoteTemplate, archivePath) + "\n\n" + summary
+		summaryText = fmt.Sprintf(archiveNoteTemplate, archivePath, archiveNumber(archivePath)) + "\n\n" + summary
 	}
-	newRecentMessages := []agentctx.AgentMessage{
-		agentctx.NewCompactionSummaryMessage(summaryText),
+	var newRecentMessages []agentctx.AgentMessage
+	if len(folded) > 0 {
+		digest, err := c.rollupDigest(goCtx, ctx, s, folded)
+		if err != nil {
+			return nil, err
+		}
+		newRecentMessages = append(newRecentMessages, digest)
+	}
+	newRecentMessages = append(newRecentMessages, summaries...)
+	newRecentMessages = append(newRecentMessages, agentctx.NewCompactionSummaryMessage(summaryText))
+	for _, msg := range pinned {
+		newRecentMessages = append(newRecentMessages, keepPinned(msg))
 	}
 
-	recentMessages = compactToolResultsInRecent(recentMessages, c.config.ToolCallCutoff)
+	recentMessages = compactToolResultsInRecent(recentMessages, c.config.ToolCallCutoff, c.staleOutputs(recentMessages))
 	recentMessages = cleanOldRuntimeState(recentMessages)
 	newRecentMessages = append(newRecentMessages, recentMessages...)
 	messagesBefore := len(ctx.RecentMessages)
@@ -475,7 +588,7 @@ Context was compacted. The summary above preserves key information, but some det
 
 2. **Check "Behavioral Constraints"** — these are process rules from loaded skills. Follow them even though the skill content is gone.
 
-3. **Read the archived conversation** if anything seems unclear: The full pre-compaction conversation is stored at the path mentioned in the <critical> section of the summary. Use the read or grep tool to load it.
+3. **Recall the archived conversation** if anything seems unclear: The full pre-compaction conversation is archived as mentioned in the <critical> section of the summary. Use the recall tool to search it (e.g. a file you read or a command you ran) instead of re-running tools.
 
 4. **Re-read any design docs or planning files** you were working with. Do NOT proceed based on stale memory.
 
@@ -496,6 +609,22 @@ Do NOT skip these steps. If you skip them and produce incorrect work, the user w
 	}, nil
 }
 
+// summarize writes the segment summary with GenerateSummary. Errors are
+// returned: NewFallbackCompactor decides what to do when the model fails.
+func (c *Compactor) summarize(goCtx context.Context, ctx *agentctx.AgentContext, oldMessages, conversation []agentctx.AgentMessage) (string, error) {
+	// The model sees the earlier summaries too: they are the cached prefix
+	// of the request and give the segment its context.
+	instruction := summarizationPrompt
+	if len(conversation) < len(oldMessages) {
+		instruction += segmentInstruction
+	}
+	summary, err := c.generateSummary(goCtx, "GenerateSummary", instruction, oldMessages, ctx.SystemPrompt, c.agentContextPrefix, ctx.Tools)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate summary: %w", err)
+	}
+	return summary, nil
+}
+
 // cleanOldRuntimeState removes all but the last runtime_state message from the
 // given slice. During compaction, older runtime_state snapshots are stale — only
 // the most recent one carries useful telemetry. Cleaning them unconditionally
@@ -527,9 +656,9 @@ func cleanOldRuntimeState(messages []agentctx.AgentMessage) []agentctx.AgentMess
 // where to find the full pre-compaction conversation. It uses directive language
 // to encourage proactive recovery of lost context.
 const archiveNoteTemplate = "<critical>\n" +
-	"The full conversation before this summary is archived at `%s`.\n" +
+	"The full conversation before this summary is archived at `%s` (archive %d).\n" +
 	"This summary may omit important details — analysis results, intermediate findings, discussion context.\n" +
-	"If anything seems incomplete or you are unsure what was discussed earlier, read this file (use the read or grep tool) BEFORE asking the user.\n" +
+	"If anything seems incomplete or you are unsure what was discussed earlier, search it with the recall tool (recall query=\"...\"; messages of this archive have IDs %[2]d:<n>) BEFORE asking the user or re-running tools.\n" +
 	"</critical>"
 
 // saveArchivedMessages writes old messages removed during compaction to a
@@ -752,6 +881,16 @@ func (c *Compactor) askLLM(ctx context.Context, agentCtx *agentctx.AgentContext,
 	span.AddField("tokens", tokens)
 	span.AddField("budget_pct", budgetPct)
 
+	// A separate compaction model with a smaller window cannot read the
+	// context to answer; if it cannot read it, it cannot summarize it later
+	// either, so compact now.
+	if budget := c.modelInputBudget(); budget > 0 && tokens > budget {
+		span.AddField("model", c.model.ID)
+		span.AddField("exceeds_model_window", budget)
+		span.AddField("decision", true)
+		return true, nil
+	}
+
 	// Canary recall check. The canary was planted after the last compaction
 	// and is never modified by askLLM — zero cache disruption.
 	canaryVal := c.canaryValue
@@ -802,6 +941,7 @@ func (c *Compactor) askLLM(ctx context.Context, agentCtx *agentctx.AgentContext,
 			if e.Usage.PromptTokensDetails != nil {
 				span.AddField("cache_read", e.Usage.PromptTokensDetails.CachedTokens)
 			}
+			c.recordUsage(span, e.Usage)
 		case llm.LLMErrorEvent:
 			span.AddField("error", e.Error.Error())
 			return false, e.Error
@@ -15,6 +15,8 @@ import (
 
 var (
 	summarizationPrompt = prompt.CompactSummarizePrompt()
+	digestPrompt        = prompt.CompactDigestPrompt()
+	branchPrompt        = prompt.BranchSummaryPrompt()
 )
 
 // GenerateSummary generates a structured summary of messages.
@@ -34,7 +36,20 @@ var (
 // The previous compaction summary (if any) is part of oldMessages, so the LLM
 // can see it without a separate prompt.
 func (c *Compactor) GenerateSummary(goCtx context.Context, messages []agentctx.AgentMessage, systemPrompt string, contextPrefix string, tools []agentctx.Tool) (string, error) {
-	span := traceevent.StartSpan(goCtx, "GenerateSummary", traceevent.CategoryEvent)
+	return c.generateSummary(goCtx, "GenerateSummary", summarizationPrompt, messages, systemPrompt, contextPrefix, tools)
+}
+
+// GenerateBranchSummary summarizes the messages of another branch of the
+// conversation, for merging its conclusions into the current one. The
+// request is laid out like GenerateSummary's.
+func (c *Compactor) GenerateBranchSummary(goCtx context.Context, messages []agentctx.AgentMessage, systemPrompt string, contextPrefix string, tools []agentctx.Tool) (string, error) {
+	return c.generateSummary(goCtx, "GenerateBranchSummary", branchPrompt, messages, systemPrompt, contextPrefix, tools)
+}
+
+// generateSummary is GenerateSummary with the span name and trailing
+// instruction chosen by the caller; the session digest uses it too.
+func (c *Compactor) generateSummary(goCtx context.Context, spanName, instruction string, messages []agentctx.AgentMessage, systemPrompt string, contextPrefix string, tools []agentctx.Tool) (string, error) {
+	span := traceevent.StartSpan(goCtx, spanName, traceevent.CategoryEvent)
 	defer span.End()
 
 	if len(messages) == 0 {
@@ -50,7 +65,19 @@ func (c *Compactor) GenerateSummary(goCtx context.Context, messages []agentctx.A
 		return "", fmt.Errorf("no agent-visible messages to summarize")
 	}
 
-	llmCtx := buildCacheFriendlyLLMContext(messages, systemPrompt, contextPrefix, tools, summarizationPrompt, c.thinkingLevel, c.model.SupportsVision)
+	// A separate compaction model may have a smaller window than the agent's.
+	if budget := c.modelInputBudget(); budget > 0 {
+		overhead := estimateStringTokens(systemPrompt) + estimateStringTokens(contextPrefix) + agentctx.EstimateToolsTokens(tools)
+		var dropped int
+		messages, dropped = fitModelWindow(messages, overhead, budget)
+		if dropped > 0 {
+			slog.Warn("[Compact] Oldest messages dropped to fit the compaction model window",
+				"model", c.model.ID, "dropped", dropped, "budget", budget)
+			span.AddField("dropped_for_window", dropped)
+		}
+	}
+
+	llmCtx := buildCacheFriendlyLLMContext(messages, systemPrompt, contextPrefix, tools, instruction, c.thinkingLevel, c.model.SupportsVision)
 
 	const maxRetries = 3
 	const totalTimeout = 5 * time.Minute
@@ -95,6 +122,9 @@ func (c *Compactor) GenerateSummary(goCtx context.Context, messages []agentctx.A
 			cachedTokens = doneEvent.Usage.PromptTokensDetails.CachedTokens
 		}
 		span.AddField("cache_read", cachedTokens)
+		if doneEvent.Usage.TotalTokens > 0 || doneEvent.Usage.InputTokens > 0 {
+			c.recordUsage(span, doneEvent.Usage)
+		}
 
 		if streamErr != nil {
 			lastErr = streamErr
@@ -23,7 +23,7 @@ func hasAgentContent(blocks []agentctx.ContentBlock) bool {
 	return false
 }
 
-func compactToolResultsInRecent(messages []agentctx.AgentMessage, cutoff int) []agentctx.AgentMessage {
+func compactToolResultsInRecent(messages []agentctx.AgentMessage, cutoff int, stale map[int]string) []agentctx.AgentMessage {
 	if cutoff <= 0 || len(messages) == 0 {
 		return messages
 	}
@@ -39,6 +39,20 @@ func compactToolResultsInRecent(messages []agentctx.AgentMessage, cutoff int) []
 	if excess <= 0 {
 		return messages
 	}
+
+	// Pinned results and the newest result are never archived; the rest go
+	// lowest priority first, then stale before fresh, then oldest first.
+	candidates := make([]int, 0, len(visibleToolIndexes))
+	for _, idx := range visibleToolIndexes[:len(visibleToolIndexes)-1] {
+		if !messages[idx].IsPinned() {
+			candidates = append(candidates, idx)
+		}
+	}
+	evict := evictionOrder(messages, candidates, stale)
+	excess = min(excess, len(evict))
+	if excess == 0 {
+		return messages
+	}
 	ctx := context.Background()
 	summarySpan := traceevent.StartSpan(ctx, "tool_summary_batch", traceevent.CategoryTool,
 		traceevent.Field{Key: "mode", Value: "compaction_digest"},
@@ -54,7 +68,7 @@ func compactToolResultsInRecent(messages []agentctx.AgentMessage, cutoff int) []
 	// We also remove corresponding tool_calls from assistant messages below,
 	// otherwise strict APIs reject unmatched assistant/tool sequences.
 	for i := 0; i < excess; i++ {
-		idx := visibleToolIndexes[i]
+		idx := evict[i]
 		original := compacted[idx]
 		compacted[idx] = original.WithVisibility(false, original.IsUserVisible()).WithKind("tool_result_archived")
 		if strings.TrimSpace(original.ToolCallID) != "" {
@@ -155,6 +169,11 @@ func (c *Compactor) ensureToolCallPairingWithGrace(oldMessages, recentMessages [
 		}
 
 		if msg.Role == "toolResult" && msg.ToolCallID != "" {
+			if oldToolCallIDs[msg.ToolCallID] && msg.IsPinned() {
+				// Pinned results outlive their summarized call.
+				keptMessages = append(keptMessages, keepPinned(msg))
+				continue
+			}
 			if oldToolCallIDs[msg.ToolCallID] {
 				// This tool_result's call is in oldMessages - hide it to prevent mismatch
 				archivedMsg := msg.WithVisibility(false, msg.IsUserVisible()).WithKind("tool_result_archived")
@@ -50,7 +50,7 @@ func TestCompactToolResultsInRecent(t *testing.T) {
 		}, false),
 	}
 
-	compacted := compactToolResultsInRecent(messages, 1)
+	compacted := compactToolResultsInRecent(messages, 1, nil)
 
 	visibleToolResults := 0
 	for _, msg := range compacted {
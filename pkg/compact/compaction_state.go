@@ -9,9 +9,15 @@ type CompactionState struct {
 	ReserveTokens         int    `json:"reserveTokens,omitempty"`
 	ToolCallCutoff        int    `json:"toolCallCutoff,omitempty"`
 	ToolSummaryAutomation string `json:"toolSummaryAutomation,omitempty"`
-	ContextWindow         int    `json:"contextWindow,omitempty"`
-	TokenLimit            int    `json:"tokenLimit,omitempty"`
-	TokenLimitSource      string `json:"tokenLimitSource,omitempty"`
+	// Strategy is the agent.yaml compaction strategy; the host sets it.
+	Strategy         string `json:"strategy,omitempty"`
+	KeepSegments     int    `json:"keepSegments,omitempty"`
+	ContextWindow    int    `json:"contextWindow,omitempty"`
+	TokenLimit       int    `json:"tokenLimit,omitempty"`
+	TokenLimitSource string `json:"tokenLimitSource,omitempty"`
+	// Summaries is the summary layout of the current context. The host sets
+	// it with BuildSummaryLayout; the compactor does not hold the messages.
+	Summaries *SummaryLayout `json:"summaries,omitempty"`
 }
 
 // BuildCompactionState converts internal compactor config and state into an RPC-facing snapshot.
@@ -28,6 +34,7 @@ func BuildCompactionState(cfg *Config, compactor *Compactor) *CompactionState {
 		ReserveTokens:         compactor.ReserveTokens(),
 		ToolCallCutoff:        cfg.ToolCallCutoff,
 		ToolSummaryAutomation: cfg.ToolSummaryAutomation,
+		KeepSegments:          compactor.KeepSegments(),
 		ContextWindow:         compactor.ContextWindow(),
 		TokenLimit:            limit,
 		TokenLimitSource:      source,
@@ -0,0 +1,345 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/traceevent"
+)
+
+// Compaction strategies a role picks in agent.yaml.
+const (
+	// StrategyLLM compacts with the Compactor, falling back to the
+	// ExtractiveCompactor when the model fails. It is the default; an
+	// empty strategy means the same.
+	StrategyLLM = "llm"
+	// StrategyExtractive compacts with the ExtractiveCompactor only.
+	StrategyExtractive = "extractive"
+)
+
+// ExtractiveCompactor compacts with ExtractiveSummary and never calls a
+// model. It runs the pipeline of the Compactor it wraps, so both share the
+// session archives, thresholds and segment layout.
+type ExtractiveCompactor struct {
+	base *Compactor
+}
+
+// NewExtractiveCompactor creates an ExtractiveCompactor on top of base.
+func NewExtractiveCompactor(base *Compactor) *ExtractiveCompactor {
+	return &ExtractiveCompactor{base: base}
+}
+
+// ShouldCompact compacts from TierHigh, where the LLM-decides mode would
+// ask most often: there is no model to ask.
+func (e *ExtractiveCompactor) ShouldCompact(ctx context.Context, agentCtx *agentctx.AgentContext) bool {
+	if !e.base.config.AutoCompact {
+		return false
+	}
+	cfg := e.base.config.LLMDecide
+	if cfg == nil {
+		decide := DefaultLLMDecideConfig(e.base.contextWindow)
+		cfg = &decide
+	}
+	tokens := agentCtx.EstimateTokens()
+	if tokens < cfg.TierHigh {
+		return false
+	}
+	traceevent.Log(ctx, traceevent.CategoryEvent, "compact_llm_decide_check",
+		traceevent.Field{Key: "decision", Value: true},
+		traceevent.Field{Key: "reason", Value: "extractive"},
+		traceevent.Field{Key: "tokens", Value: tokens},
+	)
+	return true
+}
+
+// Compact implements the context.Compactor interface.
+func (e *ExtractiveCompactor) Compact(goCtx context.Context, ctx *agentctx.AgentContext) (*agentctx.CompactionResult, error) {
+	return e.base.compact(goCtx, ctx, extractiveSummarizer{})
+}
+
+// extractiveSummarizer writes the summaries of an ExtractiveCompactor.
+type extractiveSummarizer struct{}
+
+func (extractiveSummarizer) summarize(_ context.Context, _ *agentctx.AgentContext, _, conversation []agentctx.AgentMessage) (string, error) {
+	return ExtractiveSummary(conversation), nil
+}
+
+func (extractiveSummarizer) digest(context.Context, *agentctx.AgentContext, []agentctx.AgentMessage) (string, error) {
+	return "", nil
+}
+
+// Size limits of the extractive digest, in characters.
+const (
+	extractiveUserChars      = 1500 // per user message (the current task is kept whole)
+	extractiveAssistantChars = 800  // per final assistant text
+	extractiveDiffChars      = 1200 // per edit/write change
+	extractiveEarlierChars   = 3000 // previous summary carried over
+	extractiveMaxEntries     = 20   // newest entries kept per list section
+)
+
+// grepLineRe matches "path:line:" and "path-line-" prefixes in grep output.
+var grepLineRe = regexp.MustCompile(`^(.+?)[:-](\d+)[:-]`)
+
+// ExtractiveSummary builds a structured digest of messages without an LLM
+// call. It keeps the user messages, the final assistant text of each turn
+// and edit/write changes, and reduces read/grep outputs to file and line
+// references. The sections follow the LLM summary prompt, so the
+// post-compaction hint applies to both.
+func ExtractiveSummary(messages []agentctx.AgentMessage) string {
+	var (
+		args              = map[string]map[string]any{}
+		files             = map[string][]string{}
+		fileOrder         []string
+		earlier, task     string
+		users, finals     []string
+		changes, errs     []string
+		skills            []string
+		lastAssistantText string
+	)
+	addFile := func(path, ref string) {
+		if path == "" {
+			return
+		}
+		if _, ok := files[path]; !ok {
+			fileOrder = append(fileOrder, path)
+		}
+		if ref != "" && !slices.Contains(files[path], ref) {
+			files[path] = append(files[path], ref)
+		}
+	}
+	flushFinal := func() {
+		if lastAssistantText != "" {
+			finals = append(finals, truncateDigest(lastAssistantText, extractiveAssistantChars))
+			lastAssistantText = ""
+		}
+	}
+
+	for _, msg := range messages {
+		if !msg.IsAgentVisible() {
+			continue
+		}
+		switch msg.Role {
+		case "user":
+			switch messageKind(msg) {
+			case "compactionSummary":
+				earlier = previousSummary(msg.ExtractText())
+			case "", "user":
+				flushFinal()
+				text := strings.TrimSpace(msg.ExtractText())
+				if text != "" {
+					task = text
+					users = append(users, truncateDigest(text, extractiveUserChars))
+				}
+			}
+		case "assistant":
+			calls := msg.ExtractToolCalls()
+			for _, tc := range calls {
+				args[tc.ID] = tc.Arguments
+			}
+			if text := strings.TrimSpace(msg.ExtractText()); text != "" {
+				lastAssistantText = text
+			}
+			if len(calls) == 0 {
+				flushFinal()
+			}
+		case "toolResult":
+			a := args[msg.ToolCallID]
+			path, _ := a["path"].(string)
+			if msg.IsError {
+				errs = append(errs, fmt.Sprintf("%s: %s", strings.TrimSpace(msg.ToolName+" "+path), firstLine(msg.ExtractText())))
+				continue
+			}
+			switch msg.ToolName {
+			case "read":
+				addFile(path, readRange(a))
+			case "grep":
+				pattern, _ := a["pattern"].(string)
+				refs := grepRefs(msg.ExtractText())
+				if len(refs) == 0 {
+					addFile(path, fmt.Sprintf("grep %q: no matches", pattern))
+				}
+				for _, ref := range refs {
+					addFile(ref.path, fmt.Sprintf("grep %q: lines %s", pattern, ref.lines))
+				}
+			case "edit":
+				addFile(path, "edited")
+				oldText, _ := a["oldText"].(string)
+				newText, _ := a["newText"].(string)
+				changes = append(changes, fmt.Sprintf("edit %s\n```diff\n%s\n```",
+					path, truncateDigest(diffLines(oldText, newText), extractiveDiffChars)))
+			case "write":
+				addFile(path, "written")
+				content, _ := a["content"].(string)
+				changes = append(changes, fmt.Sprintf("write %s (%d lines)\n```\n%s\n```",
+					path, strings.Count(content, "\n")+1, truncateDigest(content, extractiveDiffChars)))
+			case "find_skill":
+				if load, _ := a["load"].(bool); load {
+					name, _ := a["name"].(string)
+					if name == "" {
+						name, _ = a["query"].(string)
+					}
+					if name != "" && !slices.Contains(skills, name) {
+						skills = append(skills, name)
+					}
+				}
+			}
+		}
+	}
+	flushFinal()
+
+	var fileLines []string
+	for _, path := range fileOrder {
+		line := "- " + path
+		if refs := files[path]; len(refs) > 0 {
+			line += ": " + strings.Join(refs, "; ")
+		}
+		fileLines = append(fileLines, line)
+	}
+
+	var b strings.Builder
+	b.WriteString("<!-- extractive summary: built without an LLM; tool outputs are reduced to references, use recall for details -->\n\n")
+	writeSection(&b, "Current Task (MOST IMPORTANT)", []string{task}, "")
+	if earlier != "" {
+		writeSection(&b, "Earlier Summary", []string{truncateDigest(earlier, extractiveEarlierChars)}, "")
+	}
+	writeSection(&b, "User Messages", bulleted(users), "- ")
+	writeSection(&b, "Assistant Conclusions", bulleted(finals), "- ")
+	writeSection(&b, "Files Involved", fileLines, "")
+	writeSection(&b, "Changes Made", bulleted(changes), "- ")
+	writeSection(&b, "Errors Encountered", bulleted(errs), "- ")
+	writeSection(&b, "Skills Loaded", bulleted(skills), "- ")
+	return strings.TrimSpace(b.String())
+}
+
+// writeSection writes a "## title" section with the newest
+// extractiveMaxEntries lines, or "None".
+func writeSection(b *strings.Builder, title string, lines []string, prefix string) {
+	fmt.Fprintf(b, "## %s\n", title)
+	var kept []string
+	for _, line := range lines {
+		if strings.TrimSpace(strings.TrimPrefix(line, prefix)) != "" {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == 0 {
+		b.WriteString("None\n\n")
+		return
+	}
+	if n := len(kept) - extractiveMaxEntries; n > 0 {
+		fmt.Fprintf(b, "[%d earlier entries omitted]\n", n)
+		kept = kept[n:]
+	}
+	b.WriteString(strings.Join(kept, "\n"))
+	b.WriteString("\n\n")
+}
+
+// bulleted prefixes each item with "- ".
+func bulleted(items []string) []string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = "- " + item
+	}
+	return lines
+}
+
+// messageKind returns the metadata kind of msg, or "".
+func messageKind(msg agentctx.AgentMessage) string {
+	if msg.Metadata == nil {
+		return ""
+	}
+	return msg.Metadata.Kind
+}
+
+// previousSummary strips the summary prefix and archive note from the text
+// of a compaction summary or session digest message.
+func previousSummary(text string) string {
+	text = strings.TrimPrefix(text, "[Previous conversation summary]\n\n")
+	text = strings.TrimPrefix(text, "[Session digest]\n\n")
+	if i := strings.Index(text, "</critical>"); strings.HasPrefix(text, "<critical>") && i >= 0 {
+		text = text[i+len("</critical>"):]
+	}
+	return strings.TrimSpace(text)
+}
+
+// readRange describes the lines a read call covered.
+func readRange(args map[string]any) string {
+	offset := intArg(args, "offset")
+	limit := intArg(args, "limit")
+	switch {
+	case offset > 0 && limit > 0:
+		return fmt.Sprintf("read lines %d-%d", offset, offset+limit-1)
+	case offset > 0:
+		return fmt.Sprintf("read from line %d", offset)
+	case limit > 0:
+		return fmt.Sprintf("read lines 1-%d", limit)
+	default:
+		return "read"
+	}
+}
+
+type grepRef struct {
+	path  string
+	lines string
+}
+
+// grepRefs collapses grep output into the matched line numbers per file.
+func grepRefs(output string) []grepRef {
+	byPath := map[string][]string{}
+	var order []string
+	for _, line := range strings.Split(output, "\n") {
+		m := grepLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if _, ok := byPath[m[1]]; !ok {
+			order = append(order, m[1])
+		}
+		if !slices.Contains(byPath[m[1]], m[2]) {
+			byPath[m[1]] = append(byPath[m[1]], m[2])
+		}
+	}
+	refs := make([]grepRef, 0, len(order))
+	for _, path := range order {
+		refs = append(refs, grepRef{path: path, lines: strings.Join(byPath[path], ",")})
+	}
+	return refs
+}
+
+// diffLines renders an edit as removed and added lines.
+func diffLines(oldText, newText string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(oldText, "\n") {
+		b.WriteString("-" + line + "\n")
+	}
+	for _, line := range strings.Split(newText, "\n") {
+		b.WriteString("+" + line + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// firstLine returns the first non-empty line of text.
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return truncateDigest(line, 200)
+		}
+	}
+	return ""
+}
+
+// truncateDigest cuts s to at most n bytes on a rune boundary.
+func truncateDigest(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s... [%d chars omitted]", s[:cut], len(s)-cut)
+}
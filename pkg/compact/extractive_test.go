@@ -0,0 +1,149 @@
+package compact
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+func extractiveConversation() []agentctx.AgentMessage {
+	assistantCall := func(id, name string, args map[string]any) agentctx.AgentMessage {
+		m := agentctx.NewAssistantMessage()
+		m.Content = []agentctx.ContentBlock{
+			agentctx.ToolCallContent{ID: id, Type: "toolCall", Name: name, Arguments: args},
+		}
+		return m
+	}
+	final := agentctx.NewAssistantMessage()
+	final.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "The debounce bug is fixed."}}
+	failed := toolResultMessage("call-4", "bash", "exit status 1\ngo: no such package")
+	failed.IsError = true
+
+	return []agentctx.AgentMessage{
+		agentctx.NewUserMessage("fix the debounce bug in watcher.go"),
+		assistantCall("call-1", "read", map[string]any{"path": "watcher.go", "offset": float64(10), "limit": float64(40)}),
+		toolResultMessage("call-1", "read", strings.Repeat("func watch() {}\n", 40)),
+		assistantCall("call-2", "grep", map[string]any{"pattern": "debounce", "path": "."}),
+		toolResultMessage("call-2", "grep", "watcher.go:12: debounce := 10\nwatcher.go:30:\tdebounce++\nwatcher_test.go:5: // debounce"),
+		assistantCall("call-3", "edit", map[string]any{"path": "watcher.go", "oldText": "debounce := 10", "newText": "debounce := 50"}),
+		toolResultMessage("call-3", "edit", "Successfully replaced text"),
+		assistantCall("call-4", "bash", map[string]any{"command": "go test ./..."}),
+		failed,
+		final,
+		agentctx.NewUserMessage("now update the changelog"),
+	}
+}
+
+func TestExtractiveSummary(t *testing.T) {
+	summary := ExtractiveSummary(extractiveConversation())
+
+	for _, want := range []string{
+		"## Current Task (MOST IMPORTANT)\nnow update the changelog",
+		"- fix the debounce bug in watcher.go",
+		"- The debounce bug is fixed.",
+		"- watcher.go: read lines 10-49; grep \"debounce\": lines 12,30; edited",
+		"- watcher_test.go: grep \"debounce\": lines 5",
+		"-debounce := 10\n+debounce := 50",
+		"- bash: exit status 1",
+		"## Skills Loaded\nNone",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+	if strings.Contains(summary, "func watch()") {
+		t.Errorf("read output should be reduced to a reference:\n%s", summary)
+	}
+}
+
+func TestExtractiveSummary_CarriesEarlierSummary(t *testing.T) {
+	earlier := agentctx.NewCompactionSummaryMessage(
+		"<critical>\narchive note\n</critical>\n\n## Current Task (MOST IMPORTANT)\nold task")
+	summary := ExtractiveSummary([]agentctx.AgentMessage{earlier, agentctx.NewUserMessage("next")})
+	if !strings.Contains(summary, "## Earlier Summary\n## Current Task (MOST IMPORTANT)\nold task") {
+		t.Fatalf("earlier summary not carried over:\n%s", summary)
+	}
+	if strings.Contains(summary, "archive note") {
+		t.Fatalf("stale archive note carried over:\n%s", summary)
+	}
+}
+
+func TestCompact_FallsBackToExtractiveSummary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	cfg := &Config{MaxMessages: 10, MaxTokens: 1000, KeepRecent: 2, KeepRecentTokens: 10, AutoCompact: true}
+	model := llm.Model{ID: "test", BaseURL: server.URL, API: "openai", ContextWindow: 200000}
+	llmCompactor := NewCompactor(cfg, model, "key", "sys", 200000, t.TempDir())
+
+	agentCtx := &agentctx.AgentContext{RecentMessages: extractiveConversation(), AgentState: &agentctx.AgentState{}}
+	if _, err := llmCompactor.Compact(t.Context(), agentCtx); err == nil {
+		t.Fatal("expected the LLM compactor to fail")
+	}
+	if len(agentCtx.RecentMessages) != len(extractiveConversation()) {
+		t.Fatal("failed compaction modified the context")
+	}
+
+	compactor := NewFallbackCompactor(llmCompactor, NewExtractiveCompactor(llmCompactor))
+	result, err := compactor.Compact(t.Context(), agentCtx)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if !strings.Contains(result.Summary, "## Files Involved") {
+		t.Fatalf("expected extractive summary, got %q", result.Summary)
+	}
+}
+
+func TestCompact_CancelledDoesNotFallBack(t *testing.T) {
+	cfg := &Config{MaxMessages: 10, MaxTokens: 1000, KeepRecent: 2, KeepRecentTokens: 10, AutoCompact: true}
+	model := llm.Model{ID: "test", BaseURL: "http://127.0.0.1:1", API: "openai", ContextWindow: 200000}
+	llmCompactor := NewCompactor(cfg, model, "key", "sys", 200000, t.TempDir())
+	compactor := NewFallbackCompactor(llmCompactor, NewExtractiveCompactor(llmCompactor))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	agentCtx := &agentctx.AgentContext{RecentMessages: extractiveConversation(), AgentState: &agentctx.AgentState{}}
+	if _, err := compactor.Compact(ctx, agentCtx); err == nil {
+		t.Fatal("expected cancelled compaction to fail")
+	}
+	if len(agentCtx.RecentMessages) != len(extractiveConversation()) {
+		t.Fatal("cancelled compaction modified the context")
+	}
+}
+
+func TestExtractiveCompactor(t *testing.T) {
+	compactor := NewExtractiveCompactor(NewCompactor(&Config{KeepRecentTokens: 10, AutoCompact: true}, llm.Model{}, "", "", 200000, t.TempDir()))
+	decide := DefaultLLMDecideConfig(200000)
+
+	// No model to ask: compact only from TierHigh.
+	small := &agentctx.AgentContext{
+		RecentMessages: []agentctx.AgentMessage{agentctx.NewUserMessage(strings.Repeat("a", decide.SoftThreshold*4))},
+		AgentState:     &agentctx.AgentState{ToolCallsSinceLastTrigger: 100},
+	}
+	if compactor.ShouldCompact(t.Context(), small) {
+		t.Error("should not compact below TierHigh")
+	}
+	large := &agentctx.AgentContext{
+		RecentMessages: []agentctx.AgentMessage{agentctx.NewUserMessage(strings.Repeat("a", decide.TierHigh*4))},
+		AgentState:     &agentctx.AgentState{},
+	}
+	if !compactor.ShouldCompact(t.Context(), large) {
+		t.Error("should compact at TierHigh without asking")
+	}
+
+	agentCtx := &agentctx.AgentContext{RecentMessages: extractiveConversation(), AgentState: &agentctx.AgentState{}}
+	result, err := compactor.Compact(t.Context(), agentCtx)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if !strings.Contains(result.Summary, "fix the debounce bug") {
+		t.Fatalf("unexpected summary %q", result.Summary)
+	}
+}
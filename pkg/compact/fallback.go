@@ -0,0 +1,48 @@
+package compact
+
+import (
+	"context"
+	"log/slog"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/traceevent"
+)
+
+// FallbackCompactor compacts with Primary and, when that fails while the
+// provider is down or rate-limited, with Fallback. Primary decides when to
+// compact. A cancelled compaction does not fall back: it does not compact.
+type FallbackCompactor struct {
+	Primary  agentctx.Compactor
+	Fallback agentctx.Compactor
+}
+
+// NewFallbackCompactor creates a FallbackCompactor.
+func NewFallbackCompactor(primary, fallback agentctx.Compactor) *FallbackCompactor {
+	return &FallbackCompactor{Primary: primary, Fallback: fallback}
+}
+
+// ShouldCompact implements the context.Compactor interface.
+func (f *FallbackCompactor) ShouldCompact(ctx context.Context, agentCtx *agentctx.AgentContext) bool {
+	return f.Primary.ShouldCompact(ctx, agentCtx)
+}
+
+// Compact implements the context.Compactor interface.
+func (f *FallbackCompactor) Compact(goCtx context.Context, ctx *agentctx.AgentContext) (*agentctx.CompactionResult, error) {
+	result, err := f.Primary.Compact(goCtx, ctx)
+	if err == nil || goCtx.Err() != nil {
+		return result, err
+	}
+	slog.Warn("[Compact] Compaction failed, using the fallback compactor", "error", err)
+	traceevent.Log(goCtx, traceevent.CategoryEvent, "compact_fallback",
+		traceevent.Field{Key: "error", Value: err.Error()},
+	)
+	return f.Fallback.Compact(goCtx, ctx)
+}
+
+// SetCanaryValue records the canary on Primary, the compactor that asks
+// the model about it.
+func (f *FallbackCompactor) SetCanaryValue(val string) {
+	if c, ok := f.Primary.(interface{ SetCanaryValue(string) }); ok {
+		c.SetCanaryValue(val)
+	}
+}
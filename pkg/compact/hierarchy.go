@@ -0,0 +1,213 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/traceevent"
+)
+
+// Summary hierarchy. Each compaction adds a segment summary of the messages
+// it removes; earlier segment summaries stay in the context as they are.
+// When more than Config.KeepSegments segments accumulate, the oldest are
+// merged with the previous session digest into a new one. The context then
+// starts with:
+//
+//	[session digest]          ← everything up to archive N
+//	[segment summary N+1]
+//	...
+//	[segment summary M]       ← the latest compaction
+//
+// Folded segments and replaced digests are archived with the compaction
+// that removes them, so the recall tool still finds them.
+
+// defaultKeepSegments is the segment summaries kept in context when
+// Config.KeepSegments is unset.
+const defaultKeepSegments = 4
+
+// maxFallbackDigestChars caps the session digest built without a model.
+const maxFallbackDigestChars = 12000
+
+// segmentInstruction is added to the summarization prompt when earlier
+// summaries precede the messages. They stay in the context, so the new
+// summary only covers what came after them.
+const segmentInstruction = "\n\nThe [Session digest] and [Previous conversation summary] messages above stay in the context unchanged. " +
+	"Summarize ONLY the conversation after the last of them. Repeat earlier content only where the current task, plan or next steps depend on it."
+
+// digestNoteTemplate starts the session digest. The archive number is read
+// back by BuildSummaryLayout.
+const digestNoteTemplate = "<critical>\n" +
+	"This digest merges the summaries of the conversation up to archive %d. " +
+	"The summaries themselves are archived with later compactions; search them with the recall tool when a detail is missing here.\n" +
+	"</critical>"
+
+var (
+	segmentArchiveRe = regexp.MustCompile(`\(archive (\d+)\)`)
+	digestArchiveRe  = regexp.MustCompile(`up to archive (\d+)\.`)
+)
+
+// SummaryInfo is one summary in the context.
+type SummaryInfo struct {
+	// Archive is the archive of a segment summary, or the last archive the
+	// session digest covers. 0 when the session has no directory.
+	Archive int `json:"archive,omitempty"`
+	Tokens  int `json:"tokens"`
+}
+
+// SummaryLayout describes the summaries at the start of the context.
+type SummaryLayout struct {
+	Digest   *SummaryInfo  `json:"digest,omitempty"`
+	Segments []SummaryInfo `json:"segments"`
+}
+
+// KeepSegments returns the effective number of segment summaries kept in
+// context before the oldest are folded into the session digest.
+func (c *Compactor) KeepSegments() int {
+	if c.config == nil || c.config.KeepSegments <= 0 {
+		return defaultKeepSegments
+	}
+	return c.config.KeepSegments
+}
+
+// isSummary reports whether msg is a segment summary or the session digest.
+func isSummary(msg agentctx.AgentMessage) bool {
+	switch messageKind(msg) {
+	case "compactionSummary", "sessionDigest":
+		return true
+	}
+	return false
+}
+
+// splitSummaries separates summaries from the conversation, keeping the
+// order of both.
+func splitSummaries(messages []agentctx.AgentMessage) (summaries, rest []agentctx.AgentMessage) {
+	for _, msg := range messages {
+		if isSummary(msg) {
+			summaries = append(summaries, msg)
+		} else {
+			rest = append(rest, msg)
+		}
+	}
+	return summaries, rest
+}
+
+// segmentsToFold returns how many of the oldest segments to fold into the
+// digest when a compaction adds one to segments. Folding leaves half of
+// keep, so the digest is regenerated every keep/2+1 compactions rather than
+// on every one.
+func segmentsToFold(segments, keep int) int {
+	if segments+1 <= keep {
+		return 0
+	}
+	return segments + 1 - max(keep/2, 1)
+}
+
+// BuildSummaryLayout lists the session digest and segment summaries in
+// messages. Returns nil when there are none.
+func BuildSummaryLayout(messages []agentctx.AgentMessage) *SummaryLayout {
+	var layout SummaryLayout
+	for _, msg := range messages {
+		if !msg.IsAgentVisible() || !isSummary(msg) {
+			continue
+		}
+		info := SummaryInfo{Tokens: estimateMessageTokens(msg)}
+		if messageKind(msg) == "sessionDigest" {
+			info.Archive = archiveRef(digestArchiveRe, msg)
+			layout.Digest = &info
+			continue
+		}
+		info.Archive = archiveRef(segmentArchiveRe, msg)
+		layout.Segments = append(layout.Segments, info)
+	}
+	if layout.Digest == nil && len(layout.Segments) == 0 {
+		return nil
+	}
+	return &layout
+}
+
+// archiveRef reads the archive number the note of a summary refers to.
+func archiveRef(re *regexp.Regexp, msg agentctx.AgentMessage) int {
+	m := re.FindStringSubmatch(msg.ExtractText())
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// rollupDigest merges the previous digest (if any) and the folded segment
+// summaries into a new session digest message written by s.
+func (c *Compactor) rollupDigest(goCtx context.Context, ctx *agentctx.AgentContext, s summarizer, summaries []agentctx.AgentMessage) (agentctx.AgentMessage, error) {
+	through := 0
+	for _, msg := range summaries {
+		if n := archiveRef(segmentArchiveRe, msg); n > through {
+			through = n
+		}
+	}
+
+	digest, err := s.digest(goCtx, ctx, summaries)
+	if err != nil {
+		return agentctx.AgentMessage{}, err
+	}
+	if digest == "" {
+		digest = fallbackDigest(summaries)
+	}
+	slog.Info("[Compact] Rolled up session digest", "summaries", len(summaries), "through_archive", through, "chars", len(digest))
+
+	if through > 0 {
+		digest = fmt.Sprintf(digestNoteTemplate, through) + "\n\n" + digest
+	}
+	return agentctx.NewSessionDigestMessage(digest), nil
+}
+
+// digest merges the summaries with GenerateDigest, and joins them when the
+// model call fails: the segment summary is already written at this point.
+func (c *Compactor) digest(goCtx context.Context, ctx *agentctx.AgentContext, summaries []agentctx.AgentMessage) (string, error) {
+	digest, err := c.generateSummary(goCtx, "GenerateDigest", digestPrompt, summaries, ctx.SystemPrompt, c.agentContextPrefix, ctx.Tools)
+	if err == nil {
+		return digest, nil
+	}
+	if goCtx.Err() != nil {
+		return "", fmt.Errorf("failed to generate session digest: %w", err)
+	}
+	slog.Warn("[Compact] Session digest generation failed, joining summaries", "error", err)
+	traceevent.Log(goCtx, traceevent.CategoryEvent, "compact_digest_fallback",
+		traceevent.Field{Key: "error", Value: err.Error()},
+	)
+	return "", nil
+}
+
+// fallbackDigest joins the summaries without a model call. Past
+// maxFallbackDigestChars the middle is cut: the oldest decisions and the
+// latest state matter most, and the cut part stays in the archives.
+func fallbackDigest(summaries []agentctx.AgentMessage) string {
+	var parts []string
+	for _, msg := range summaries {
+		text := previousSummary(msg.ExtractText())
+		if text == "" {
+			continue
+		}
+		if n := archiveRef(segmentArchiveRe, msg); n > 0 {
+			text = fmt.Sprintf("### Up to archive %d\n\n%s", n, text)
+		}
+		parts = append(parts, text)
+	}
+	digest := strings.Join(parts, "\n\n")
+	if len(digest) <= maxFallbackDigestChars {
+		return digest
+	}
+	head, tail := maxFallbackDigestChars/2, len(digest)-maxFallbackDigestChars/2
+	for head > 0 && !utf8.RuneStart(digest[head]) {
+		head--
+	}
+	for tail < len(digest) && !utf8.RuneStart(digest[tail]) {
+		tail++
+	}
+	return fmt.Sprintf("%s\n\n[... %d chars omitted; use the recall tool ...]\n\n%s", digest[:head], tail-head, digest[tail:])
+}
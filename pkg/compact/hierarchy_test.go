@@ -0,0 +1,106 @@
+package compact
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+func TestSegmentsToFold(t *testing.T) {
+	for _, tc := range []struct{ segments, keep, want int }{
+		{0, 4, 0},
+		{3, 4, 0},
+		{4, 4, 3}, // 5 segments: keep the newest 2
+		{1, 1, 1},
+		{2, 2, 2},
+	} {
+		if got := segmentsToFold(tc.segments, tc.keep); got != tc.want {
+			t.Errorf("segmentsToFold(%d, %d) = %d, want %d", tc.segments, tc.keep, got, tc.want)
+		}
+	}
+}
+
+func TestCompact_FoldsSegmentsIntoDigest(t *testing.T) {
+	dir := t.TempDir()
+	compactor := NewExtractiveCompactor(NewCompactor(&Config{KeepRecentTokens: 10, KeepSegments: 2, AutoCompact: true}, llm.Model{}, "", "", 200000, dir))
+	agentCtx := &agentctx.AgentContext{AgentState: &agentctx.AgentState{}}
+
+	compactN := func(n int) *SummaryLayout {
+		t.Helper()
+		agentCtx.RecentMessages = append(agentCtx.RecentMessages, extractiveConversation()...)
+		agentCtx.RecentMessages = append(agentCtx.RecentMessages, agentctx.NewUserMessage(fmt.Sprintf("task %d", n)))
+		if _, err := compactor.Compact(t.Context(), agentCtx); err != nil {
+			t.Fatalf("Compact %d: %v", n, err)
+		}
+		return BuildSummaryLayout(agentCtx.RecentMessages)
+	}
+
+	if layout := compactN(1); layout.Digest != nil || len(layout.Segments) != 1 || layout.Segments[0].Archive != 1 {
+		t.Fatalf("after 1 compaction: %+v", layout)
+	}
+	if layout := compactN(2); layout.Digest != nil || len(layout.Segments) != 2 {
+		t.Fatalf("after 2 compactions: %+v", layout)
+	}
+	// A third segment exceeds KeepSegments: segments 1 and 2 become the digest.
+	layout := compactN(3)
+	if layout.Digest == nil || layout.Digest.Archive != 2 || len(layout.Segments) != 1 || layout.Segments[0].Archive != 3 {
+		t.Fatalf("after 3 compactions: digest %+v, segments %+v", layout.Digest, layout.Segments)
+	}
+	if messageKind(agentCtx.RecentMessages[0]) != "sessionDigest" {
+		t.Fatalf("context does not start with the digest: %s", messageKind(agentCtx.RecentMessages[0]))
+	}
+
+	// Segment summaries are not summarized again.
+	segment := agentCtx.RecentMessages[1].ExtractText()
+	if strings.Contains(segment, "Earlier Summary") {
+		t.Fatalf("segment summary re-summarizes earlier summaries:\n%s", segment)
+	}
+
+	// The folded summaries are archived with the third compaction.
+	archived, err := LoadArchives(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folded := 0
+	for _, m := range archived {
+		if m.Archive == 3 && messageKind(m.Message) == "compactionSummary" {
+			folded++
+		}
+	}
+	if folded != 2 {
+		t.Fatalf("archive 3 holds %d folded summaries, want 2", folded)
+	}
+}
+
+func TestCompact_SegmentInstruction(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, sseTwoLineResponse("## Current Task (MOST IMPORTANT)\nsegment", ""))
+	}))
+	defer server.Close()
+
+	cfg := &Config{KeepRecentTokens: 10, AutoCompact: true}
+	model := llm.Model{ID: "test", BaseURL: server.URL, API: "openai", ContextWindow: 200000}
+	compactor := NewCompactor(cfg, model, "key", "sys", 200000, "")
+
+	messages := append([]agentctx.AgentMessage{agentctx.NewCompactionSummaryMessage("earlier")}, extractiveConversation()...)
+	agentCtx := &agentctx.AgentContext{RecentMessages: messages, AgentState: &agentctx.AgentState{}}
+	if _, err := compactor.Compact(t.Context(), agentCtx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "Summarize ONLY the conversation after the last of them") {
+		t.Fatalf("segment instruction not sent: %d requests", len(bodies))
+	}
+	if layout := BuildSummaryLayout(agentCtx.RecentMessages); layout == nil || len(layout.Segments) != 2 {
+		t.Fatalf("earlier summary not kept: %+v", layout)
+	}
+}
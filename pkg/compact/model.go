@@ -0,0 +1,150 @@
+package compact
+
+import (
+	"sync"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+	"github.com/tiancaiamao/ai/pkg/traceevent"
+)
+
+// ModelConfig names a separate model for compaction calls (the LLM-decide
+// check and summaries). compact does not read models.json; the host
+// resolves Name and calls Compactor.UseModel.
+type ModelConfig struct {
+	// Name is "provider/id", or a bare id that only one provider has.
+	Name string `json:"name" yaml:"name"`
+	// ThinkingLevel for compaction calls; empty mirrors the agent's.
+	ThinkingLevel string `json:"thinkingLevel,omitempty" yaml:"thinking_level,omitempty"`
+	// ContextWindow overrides the window from models.json.
+	ContextWindow int `json:"contextWindow,omitempty" yaml:"context_window,omitempty"`
+}
+
+// ModelUsage is the token usage and cost of compaction calls. Model and
+// Provider name the model of the latest call.
+type ModelUsage struct {
+	Model        string  `json:"model"`
+	Provider     string  `json:"provider"`
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	CachedTokens int     `json:"cachedTokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// UsageMeter accumulates ModelUsage across concurrent calls. The host owns
+// it and hands it to every Compactor it builds with SetUsageMeter, so the
+// usage outlives compactors rebuilt on model and session switches.
+type UsageMeter struct {
+	mu    sync.Mutex
+	usage ModelUsage
+}
+
+// Add records one call to model, priced with the model's prices. A nil
+// meter records nothing.
+func (m *UsageMeter) Add(model llm.Model, usage llm.Usage) {
+	if m == nil {
+		return
+	}
+	cached := 0
+	if usage.PromptTokensDetails != nil {
+		cached = usage.PromptTokensDetails.CachedTokens
+	}
+	cost := agentctx.UsageCost(model.Cost, &agentctx.Usage{
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		CacheRead:    cached,
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.Model, m.usage.Provider = model.ID, model.Provider
+	m.usage.Calls++
+	m.usage.InputTokens += usage.InputTokens
+	m.usage.OutputTokens += usage.OutputTokens
+	m.usage.CachedTokens += cached
+	m.usage.Cost += cost.Total
+}
+
+// Usage returns the usage recorded so far.
+func (m *UsageMeter) Usage() ModelUsage {
+	if m == nil {
+		return ModelUsage{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// UseModel makes compaction calls use model and apiKey instead of the
+// agent's. A non-empty thinkingLevel is kept for these calls and
+// SetThinkingLevel no longer changes it: requests to another model cannot
+// share the agent's prompt cache anyway. Requests that exceed the model's
+// context window are trimmed (summaries) or skipped (LLM-decide checks).
+func (c *Compactor) UseModel(model llm.Model, apiKey, thinkingLevel string) {
+	c.model = model
+	c.apiKey = apiKey
+	c.separateModel = true
+	if thinkingLevel != "" {
+		c.thinkingLevel = thinkingLevel
+		c.fixedThinking = true
+	}
+}
+
+// Model returns the model compaction calls use.
+func (c *Compactor) Model() llm.Model {
+	return c.model
+}
+
+// SetUsageMeter makes the compactor record the usage of its calls on m.
+func (c *Compactor) SetUsageMeter(m *UsageMeter) {
+	c.meter = m
+}
+
+// Usage returns the usage recorded on the compactor's meter.
+func (c *Compactor) Usage() ModelUsage {
+	return c.meter.Usage()
+}
+
+// recordUsage adds one call to the usage meter and attributes it to the
+// compaction model on span.
+func (c *Compactor) recordUsage(span *traceevent.Span, usage llm.Usage) {
+	span.AddField("model", c.model.ID)
+	span.AddField("provider", c.model.Provider)
+	c.meter.Add(c.model, usage)
+}
+
+// modelInputBudget returns the input tokens a compaction request may use,
+// or 0 when the compactor uses the agent's model (whose context already
+// fits) or the window is unknown.
+func (c *Compactor) modelInputBudget() int {
+	if !c.separateModel || c.model.ContextWindow <= 0 {
+		return 0
+	}
+	return max(c.model.ContextWindow-c.ReserveTokens(), 0)
+}
+
+// fitModelWindow drops the oldest messages until overhead plus messages fit
+// budget. Previous compaction summaries and the session digest are kept, and the cut moves forward
+// to a user message so no tool result loses its call. Returns the kept
+// messages and how many were dropped.
+func fitModelWindow(messages []agentctx.AgentMessage, overhead, budget int) ([]agentctx.AgentMessage, int) {
+	total := overhead
+	for _, msg := range messages {
+		total += agentctx.EstimateMessageTokens(msg)
+	}
+	if budget <= 0 || total <= budget {
+		return messages, 0
+	}
+
+	var summaries []agentctx.AgentMessage
+	cut := 0
+	for cut < len(messages) && (total > budget || messages[cut].Role != "user") {
+		if isSummary(messages[cut]) {
+			summaries = append(summaries, messages[cut])
+		} else {
+			total -= agentctx.EstimateMessageTokens(messages[cut])
+		}
+		cut++
+	}
+	return append(summaries, messages[cut:]...), cut - len(summaries)
+}
@@ -0,0 +1,106 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+func TestUseModel_FixesThinkingLevel(t *testing.T) {
+	c := NewCompactor(DefaultConfig(), llm.Model{ID: "big"}, "k1", "sys", 200000, "")
+	c.SetThinkingLevel("high")
+	c.UseModel(llm.Model{ID: "small", Provider: "p"}, "k2", "off")
+	c.SetThinkingLevel("medium")
+	if c.thinkingLevel != "off" || c.apiKey != "k2" || c.Model().ID != "small" {
+		t.Fatalf("thinking=%q apiKey=%q model=%q", c.thinkingLevel, c.apiKey, c.Model().ID)
+	}
+
+	// Without a level the agent's level is still mirrored.
+	c = NewCompactor(DefaultConfig(), llm.Model{ID: "big"}, "k1", "sys", 200000, "")
+	c.UseModel(llm.Model{ID: "small"}, "k2", "")
+	c.SetThinkingLevel("medium")
+	if c.thinkingLevel != "medium" {
+		t.Fatalf("thinking = %q, want medium", c.thinkingLevel)
+	}
+}
+
+func TestAskLLM_SeparateModelWindow(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, sseTwoLineResponse("reject", ""))
+	}))
+	defer server.Close()
+
+	cfg := askTestConfig()
+	cfg.ReserveTokens = 1000
+	c := NewCompactor(cfg, llm.Model{ID: "big"}, "k", "sys", 200000, "")
+	c.UseModel(llm.Model{ID: "small", Provider: "p", ContextWindow: 9000, BaseURL: server.URL, API: "openai"}, "k", "")
+
+	// Over the small model's window: compact without asking.
+	got, err := c.askLLM(context.Background(), newAskTestCtx(), 50000)
+	if err != nil || !got || requests.Load() != 0 {
+		t.Fatalf("over window: got %v, err %v, requests %d", got, err, requests.Load())
+	}
+
+	got, err = c.askLLM(context.Background(), newAskTestCtx(), 1000)
+	if err != nil || got || requests.Load() != 1 {
+		t.Fatalf("within window: got %v, err %v, requests %d", got, err, requests.Load())
+	}
+	if usage := c.Usage(); usage.Calls != 1 || usage.Model != "small" || usage.Provider != "p" {
+		t.Fatalf("Usage = %+v", usage)
+	}
+}
+
+func TestUsageMeter_OutlivesCompactor(t *testing.T) {
+	meter := &UsageMeter{}
+	model := llm.Model{ID: "small", Provider: "p", Cost: &llm.ModelCost{Input: 1, Output: 2}}
+	c := NewCompactor(askTestConfig(), model, "k", "sys", 200000, "")
+	c.SetUsageMeter(meter)
+	c.meter.Add(c.model, llm.Usage{InputTokens: 1_000_000, OutputTokens: 500_000})
+
+	// A rebuilt compactor keeps adding to the host's meter.
+	rebuilt := NewCompactor(askTestConfig(), model, "k", "sys", 200000, "")
+	rebuilt.SetUsageMeter(meter)
+	rebuilt.meter.Add(rebuilt.model, llm.Usage{InputTokens: 1_000_000})
+
+	usage := rebuilt.Usage()
+	if usage.Calls != 2 || usage.InputTokens != 2_000_000 || usage.OutputTokens != 500_000 {
+		t.Fatalf("Usage = %+v", usage)
+	}
+	if want := 1.0 + 1.0 + 1.0; usage.Cost < want-1e-9 || usage.Cost > want+1e-9 {
+		t.Fatalf("Cost = %v, want %v", usage.Cost, want)
+	}
+}
+
+func TestFitModelWindow(t *testing.T) {
+	big := strings.Repeat("x", 4000) // ~1000 tokens
+	messages := []agentctx.AgentMessage{
+		agentctx.NewCompactionSummaryMessage("earlier work"),
+		agentctx.NewUserMessage(big),
+		agentctx.NewAssistantMessage(),
+		agentctx.NewUserMessage(big),
+		agentctx.NewAssistantMessage(),
+		agentctx.NewUserMessage("last"),
+	}
+
+	if kept, dropped := fitModelWindow(messages, 0, 0); dropped != 0 || len(kept) != len(messages) {
+		t.Fatalf("no budget: kept %d dropped %d", len(kept), dropped)
+	}
+
+	kept, dropped := fitModelWindow(messages, 100, 1500)
+	if dropped != 2 || len(kept) != 4 {
+		t.Fatalf("kept %d dropped %d, want 4 and 2", len(kept), dropped)
+	}
+	if messageKind(kept[0]) != "compactionSummary" || kept[1].Role != "user" {
+		t.Fatalf("summary not kept or cut not at a user message: %s, %s", messageKind(kept[0]), kept[1].Role)
+	}
+}
@@ -0,0 +1,100 @@
+package compact
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// splitPinned separates pinned messages from the messages about to be
+// summarized. Pinned messages are kept verbatim after the summary.
+func splitPinned(messages []agentctx.AgentMessage) (rest, pinned []agentctx.AgentMessage) {
+	for _, msg := range messages {
+		if msg.IsPinned() && msg.IsAgentVisible() {
+			pinned = append(pinned, msg)
+			continue
+		}
+		rest = append(rest, msg)
+	}
+	return rest, pinned
+}
+
+// keepPinned rewrites a pinned message so it stays valid once the messages
+// around it are summarized: the tool calls it was paired with are gone, so
+// tool results become user messages and assistant tool calls become text.
+func keepPinned(msg agentctx.AgentMessage) agentctx.AgentMessage {
+	switch msg.Role {
+	case "toolResult":
+		kept := msg
+		kept.Role = "user"
+		kept.ToolCallID = ""
+		kept.ToolName = ""
+		kept.IsError = false
+		kept.Content = []agentctx.ContentBlock{agentctx.TextContent{
+			Type: "text",
+			Text: fmt.Sprintf("[Pinned %s result]\n%s", msg.ToolName, msg.ExtractText()),
+		}}
+		// WithPriority copies the metadata, so WithKind does not touch msg's.
+		return kept.WithPriority(msg.Metadata.Priority).WithKind("pinned_tool_result")
+	case "assistant":
+		calls := msg.ExtractToolCalls()
+		if len(calls) == 0 {
+			return msg
+		}
+		content := make([]agentctx.ContentBlock, 0, len(msg.Content))
+		for _, block := range msg.Content {
+			if _, ok := block.(agentctx.ToolCallContent); !ok {
+				content = append(content, block)
+			}
+		}
+		if !hasAgentContent(content) {
+			var b strings.Builder
+			for _, tc := range calls {
+				args, _ := json.Marshal(tc.Arguments)
+				fmt.Fprintf(&b, "[Pinned tool call] %s %s\n", tc.Name, args)
+			}
+			content = append(content, agentctx.TextContent{Type: "text", Text: strings.TrimRight(b.String(), "\n")})
+		}
+		kept := msg
+		kept.Content = content
+		return kept
+	default:
+		return msg
+	}
+}
+
+// warnPinnedBudget logs when pinned messages alone exceed the recent-message
+// budget: compaction can no longer shrink the context below them.
+func warnPinnedBudget(pinned []agentctx.AgentMessage, keepRecentTokens int) {
+	tokens := 0
+	for _, msg := range pinned {
+		tokens += estimateMessageTokens(msg)
+	}
+	if keepRecentTokens > 0 && tokens > keepRecentTokens {
+		slog.Warn("[Compact] Pinned messages exceed the keep-recent budget",
+			"pinned", len(pinned),
+			"pinnedTokens", tokens,
+			"keepRecentTokens", keepRecentTokens)
+	}
+}
+
+// evictionOrder returns candidate indexes (into messages) ordered for
+// eviction: lowest priority first, then outputs in stale (keyed by index)
+// before fresh ones, then oldest first.
+func evictionOrder(messages []agentctx.AgentMessage, candidates []int, stale map[int]string) []int {
+	order := append([]int(nil), candidates...)
+	sort.SliceStable(order, func(i, j int) bool {
+		pi, pj := messages[order[i]].GetPriority(), messages[order[j]].GetPriority()
+		if pi != pj {
+			return pi < pj
+		}
+		_, si := stale[order[i]]
+		_, sj := stale[order[j]]
+		return si && !sj
+	})
+	return order
+}
@@ -0,0 +1,152 @@
+package compact
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+func withPriority(msg agentctx.AgentMessage, p float64) agentctx.AgentMessage {
+	return msg.WithPriority(&p)
+}
+
+func toolCallMessage(id, name string) agentctx.AgentMessage {
+	m := agentctx.NewAssistantMessage()
+	m.Content = []agentctx.ContentBlock{
+		agentctx.ToolCallContent{ID: id, Type: "toolCall", Name: name, Arguments: map[string]any{"path": id + ".go"}},
+	}
+	return m
+}
+
+func toolResultMessage(id, name, text string) agentctx.AgentMessage {
+	return agentctx.NewToolResultMessage(id, name, []agentctx.ContentBlock{
+		agentctx.TextContent{Type: "text", Text: text},
+	}, false)
+}
+
+func TestCompact_KeepsPinnedMessagesVerbatim(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, sseTextResponse("mock summary content"))
+	}))
+	defer server.Close()
+
+	cfg := &Config{MaxMessages: 10, MaxTokens: 1000, KeepRecent: 2, KeepRecentTokens: 100, AutoCompact: true}
+	model := llm.Model{ID: "test", BaseURL: server.URL, API: "openai", ContextWindow: 200000}
+	compactor := NewCompactor(cfg, model, "key", "sys", 200000, t.TempDir())
+
+	messages := []agentctx.AgentMessage{
+		withPriority(agentctx.NewUserMessage("TASK: fix the flaky watcher test"), agentctx.PriorityPinned),
+		toolCallMessage("call-1", "read"),
+		withPriority(toolResultMessage("call-1", "read", "KEY FACT: watcher debounce is 50ms"), agentctx.PriorityPinned),
+	}
+	for i := 0; i < 8; i++ {
+		messages = append(messages, agentctx.NewUserMessage(strings.Repeat("x", 200)))
+	}
+	agentCtx := &agentctx.AgentContext{RecentMessages: messages, AgentState: &agentctx.AgentState{}}
+
+	if _, err := compactor.Compact(t.Context(), agentCtx); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	var task, fact *agentctx.AgentMessage
+	for i, msg := range agentCtx.RecentMessages {
+		if !msg.IsAgentVisible() {
+			continue
+		}
+		if msg.Role == "toolResult" && msg.ToolCallID == "call-1" {
+			t.Fatalf("pinned tool result kept as an orphan tool result: %+v", msg)
+		}
+		text := msg.ExtractText()
+		if strings.Contains(text, "TASK: fix the flaky watcher test") {
+			task = &agentCtx.RecentMessages[i]
+		}
+		if strings.Contains(text, "KEY FACT: watcher debounce is 50ms") {
+			fact = &agentCtx.RecentMessages[i]
+		}
+	}
+	if task == nil || !task.IsPinned() {
+		t.Fatalf("pinned task statement was not kept: %+v", agentCtx.RecentMessages)
+	}
+	if fact == nil || fact.Role != "user" || !fact.IsPinned() {
+		t.Fatalf("pinned tool result was not kept as a pinned user message: %+v", fact)
+	}
+}
+
+func TestCompactToolResultsInRecent_EvictsLowPriorityFirstAndKeepsPinned(t *testing.T) {
+	messages := []agentctx.AgentMessage{
+		agentctx.NewUserMessage("start"),
+		toolCallMessage("call-1", "read"),
+		withPriority(toolResultMessage("call-1", "read", "pinned output"), agentctx.PriorityPinned),
+		toolCallMessage("call-2", "grep"),
+		toolResultMessage("call-2", "grep", "normal output"),
+		toolCallMessage("call-3", "bash"),
+		withPriority(toolResultMessage("call-3", "bash", "noisy output"), agentctx.PriorityLow),
+		toolCallMessage("call-4", "read"),
+		toolResultMessage("call-4", "read", "newest output"),
+	}
+
+	compacted := compactToolResultsInRecent(messages, 2, nil)
+
+	visible := map[string]bool{}
+	for _, msg := range compacted {
+		if msg.Role == "toolResult" && msg.IsAgentVisible() {
+			visible[msg.ToolCallID] = true
+		}
+	}
+	// Two results must go: the low-priority one first, then the oldest
+	// normal one. The pinned and newest results stay.
+	if visible["call-2"] || visible["call-3"] || !visible["call-1"] || !visible["call-4"] {
+		t.Fatalf("unexpected visible tool results: %v", visible)
+	}
+}
+
+func TestCompactToolResultsInRecent_AllPinned(t *testing.T) {
+	messages := []agentctx.AgentMessage{
+		toolCallMessage("call-1", "read"),
+		withPriority(toolResultMessage("call-1", "read", "a"), agentctx.PriorityPinned),
+		toolCallMessage("call-2", "read"),
+		withPriority(toolResultMessage("call-2", "read", "b"), agentctx.PriorityPinned),
+	}
+	compacted := compactToolResultsInRecent(messages, 1, nil)
+	for _, msg := range compacted {
+		if msg.Role == "toolResult" && !msg.IsAgentVisible() {
+			t.Fatalf("pinned tool result was archived: %+v", msg)
+		}
+	}
+}
+
+func TestKeepPinned_AssistantToolCallBecomesText(t *testing.T) {
+	msg := withPriority(toolCallMessage("call-1", "read"), agentctx.PriorityPinned)
+	kept := keepPinned(msg)
+	if len(kept.ExtractToolCalls()) != 0 {
+		t.Fatalf("expected tool calls to be stripped, got %+v", kept)
+	}
+	if !strings.Contains(kept.ExtractText(), "[Pinned tool call] read") || !kept.IsPinned() {
+		t.Fatalf("unexpected kept message: %+v", kept)
+	}
+	if len(msg.ExtractToolCalls()) != 1 {
+		t.Fatal("keepPinned modified its input")
+	}
+}
+
+func TestCompactToolResultsInRecent_EvictsStaleFirst(t *testing.T) {
+	messages := []agentctx.AgentMessage{
+		toolCallMessage("call-1", "read"),
+		toolResultMessage("call-1", "read", "still relevant"),
+		toolCallMessage("call-2", "read"),
+		toolResultMessage("call-2", "read", "file changed since"),
+		toolCallMessage("call-3", "read"),
+		toolResultMessage("call-3", "read", "newest"),
+	}
+	compacted := compactToolResultsInRecent(messages, 2, map[int]string{3: "changed on disk"})
+	if !compacted[1].IsAgentVisible() || compacted[3].IsAgentVisible() {
+		t.Fatalf("expected the stale result to be archived before the older fresh one")
+	}
+}
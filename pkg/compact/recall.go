@@ -0,0 +1,199 @@
+package compact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/truncate"
+)
+
+const (
+	defaultRecallLimit   = 5
+	maxRecallLimit       = 20
+	recallExcerptChars   = 400
+	recallMaxResultChars = 20000
+)
+
+// RecallTool searches the messages that compaction archived under
+// <sessionDir>/compactions/archived_NNNNN.jsonl and returns them by ID.
+type RecallTool struct {
+	sessionDir func() string
+}
+
+// NewRecallTool creates a recall tool. sessionDir returns the current
+// session directory; it is called on every execution so session switches
+// are picked up.
+func NewRecallTool(sessionDir func() string) *RecallTool {
+	return &RecallTool{sessionDir: sessionDir}
+}
+
+// Name returns the tool name.
+func (t *RecallTool) Name() string {
+	return "recall"
+}
+
+// Description returns the tool description.
+func (t *RecallTool) Description() string {
+	return "Retrieve conversation history that context compaction removed. query ranks archived messages (tool name, arguments and output) by keyword and returns excerpts with IDs; id returns one archived message in full (IDs look like 3:17, archive 3, message 17). Use this instead of re-running a tool whose output was compacted away."
+}
+
+// Parameters returns the JSON Schema for the tool parameters.
+func (t *RecallTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "Keywords to search for, e.g. a file path, function name or command",
+			},
+			"id": map[string]any{
+				"type":        "string",
+				"description": "ID of an archived message to return in full (from a previous search or the compaction summary)",
+			},
+			"archive": map[string]any{
+				"type":        "integer",
+				"description": "Only search this archive number (optional)",
+			},
+			"limit": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of search results (default %d, max %d)", defaultRecallLimit, maxRecallLimit),
+			},
+		},
+	}
+}
+
+// Execute searches the archives or returns one archived message.
+func (t *RecallTool) Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error) {
+	dir := ""
+	if t.sessionDir != nil {
+		dir = t.sessionDir()
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("recall requires a session directory")
+	}
+	msgs, err := LoadArchives(dir)
+	if err != nil {
+		return nil, fmt.Errorf("load archives: %w", err)
+	}
+	if len(msgs) == 0 {
+		return recallText("No archived messages: nothing has been compacted in this session yet."), nil
+	}
+
+	if id, _ := args["id"].(string); strings.TrimSpace(id) != "" {
+		m, ok := FindArchived(msgs, id)
+		if !ok {
+			return nil, fmt.Errorf("archived message %q not found", strings.TrimSpace(id))
+		}
+		return recallText(truncate.Truncate(formatArchivedMessage(m), recallMaxResultChars)), nil
+	}
+
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("either query or id is required")
+	}
+	if archive := intArg(args, "archive"); archive > 0 {
+		filtered := msgs[:0:0]
+		for _, m := range msgs {
+			if m.Archive == archive {
+				filtered = append(filtered, m)
+			}
+		}
+		msgs = filtered
+	}
+	limit := intArg(args, "limit")
+	if limit <= 0 {
+		limit = defaultRecallLimit
+	}
+	limit = min(limit, maxRecallLimit)
+
+	hits := SearchArchives(msgs, query, limit)
+	if len(hits) == 0 {
+		return recallText(fmt.Sprintf("No archived messages match %q.", query)), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d archived message(s) match %q. Use recall with id to see one in full.\n", len(hits), query)
+	for _, h := range hits {
+		b.WriteString("\n")
+		b.WriteString(archivedHeader(h.ArchivedMessage))
+		b.WriteString("\n")
+		b.WriteString(excerpt(h.Message.ExtractText(), query, recallExcerptChars))
+		b.WriteString("\n")
+	}
+	return recallText(strings.TrimRight(b.String(), "\n")), nil
+}
+
+// archivedHeader is the one-line description of an archived message.
+func archivedHeader(m ArchivedMessage) string {
+	header := fmt.Sprintf("[%s] %s", m.ID, m.Message.Role)
+	if m.Message.ToolName != "" {
+		header += " " + m.Message.ToolName
+		if len(m.ToolArgs) > 0 {
+			if data, err := json.Marshal(m.ToolArgs); err == nil {
+				header += " " + truncate.TruncateString(string(data), 200)
+			}
+		}
+	}
+	if m.Message.IsError {
+		header += " (error)"
+	}
+	return header
+}
+
+// formatArchivedMessage renders an archived message in full.
+func formatArchivedMessage(m ArchivedMessage) string {
+	var b strings.Builder
+	b.WriteString(archivedHeader(m))
+	b.WriteString("\n")
+	for _, tc := range m.Message.ExtractToolCalls() {
+		data, _ := json.Marshal(tc.Arguments)
+		fmt.Fprintf(&b, "tool call %s %s\n", tc.Name, data)
+	}
+	b.WriteString(m.Message.ExtractText())
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// excerpt returns up to maxChars runes of text around the first query term
+// found, or the start of text when none occurs verbatim.
+func excerpt(text, query string, maxChars int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= maxChars {
+		return string(runes)
+	}
+	lower := strings.ToLower(string(runes))
+	start := 0
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if i := strings.Index(lower, term); i >= 0 {
+			start = max(0, utf8.RuneCountInString(lower[:i])-maxChars/4)
+			break
+		}
+	}
+	start = min(start, len(runes)-maxChars)
+	end := start + maxChars
+	out := string(runes[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(runes) {
+		out += "…"
+	}
+	return out
+}
+
+// intArg reads an integer argument that JSON decoding delivered as float64.
+func intArg(args map[string]any, key string) int {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+func recallText(text string) []agentctx.ContentBlock {
+	return []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: text}}
+}
@@ -0,0 +1,52 @@
+package compact
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func recallOutput(t *testing.T, tool *RecallTool, args map[string]any) string {
+	t.Helper()
+	blocks, err := tool.Execute(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Execute(%v): %v", args, err)
+	}
+	return blocks[0].(agentctx.TextContent).Text
+}
+
+func TestRecallTool(t *testing.T) {
+	dir := t.TempDir()
+	tool := NewRecallTool(func() string { return dir })
+
+	if out := recallOutput(t, tool, map[string]any{"query": "anything"}); !strings.Contains(out, "nothing has been compacted") {
+		t.Errorf("expected empty-archive notice, got %q", out)
+	}
+
+	writeTestArchive(t, dir,
+		archivedToolCall("c1", "read", map[string]any{"path": "docs/design.md"}),
+		archivedToolResult("c1", "read", strings.Repeat("intro ", 200)+"the retry budget is 3 attempts"),
+	)
+
+	out := recallOutput(t, tool, map[string]any{"query": "retry budget"})
+	if !strings.Contains(out, "[1:2] toolResult read") || !strings.Contains(out, "docs/design.md") {
+		t.Errorf("search result should name the ID, tool and args, got %q", out)
+	}
+	if !strings.Contains(out, "retry budget is 3") {
+		t.Errorf("excerpt should surround the match, got %q", out)
+	}
+
+	out = recallOutput(t, tool, map[string]any{"id": "1:2"})
+	if !strings.Contains(out, "intro intro") || !strings.HasSuffix(out, "3 attempts") {
+		t.Errorf("id lookup should return the full message, got %q", out)
+	}
+
+	if _, err := tool.Execute(context.Background(), map[string]any{"id": "9:9"}); err == nil {
+		t.Error("expected error for unknown id")
+	}
+	if _, err := tool.Execute(context.Background(), map[string]any{}); err == nil {
+		t.Error("expected error without query or id")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"log/slog"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/tiancaiamao/ai/pkg/compact"
 	"github.com/tiancaiamao/ai/pkg/llm"
 	"github.com/tiancaiamao/ai/pkg/logger"
+	"github.com/tiancaiamao/ai/pkg/session"
 )
 
 // Config represents the application configuration.
@@ -33,6 +35,18 @@ type Config struct {
 	// Tool output configuration
 	ToolOutput *ToolOutputConfig `json:"toolOutput,omitempty"`
 
+	// ask_user tool configuration
+	AskUser *AskUserConfig `json:"askUser,omitempty"`
+
+	// Long-term memory configuration (nil = enabled with defaults)
+	Memory *MemoryConfig `json:"memory,omitempty"`
+
+	// Session retention policy for "ai sessions gc" and automatic GC
+	Retention *RetentionConfig `json:"retention,omitempty"`
+
+	// Generated session titles (nil = enabled with defaults)
+	Titles *TitlesConfig `json:"titles,omitempty"`
+
 	// Logging configuration
 	Log *LogConfig `json:"log,omitempty"`
 }
@@ -64,6 +78,84 @@ type ToolOutputConfig struct {
 	MaxChars int `json:"maxChars,omitempty"` // Maximum characters to keep (0 = default)
 }
 
+// AskUserConfig controls how long the ask_user tool waits for an answer.
+type AskUserConfig struct {
+	Timeout  int    `json:"timeout,omitempty"`  // Seconds to wait (0 = default, negative = wait forever)
+	Fallback string `json:"fallback,omitempty"` // Instruction returned to the model on timeout
+}
+
+// MemoryConfig controls the long-term memory tools and index. Zero sizes
+// use the pkg/memory defaults.
+type MemoryConfig struct {
+	Disabled   bool `json:"disabled,omitempty"`   // Do not register the memory tools or inject the index
+	MaxEntries int  `json:"maxEntries,omitempty"` // Memories per store (default 200)
+	MaxBytes   int  `json:"maxBytes,omitempty"`   // Content bytes per store (default 64 KiB)
+	IndexChars int  `json:"indexChars,omitempty"` // Size of the index in the context prefix (default 4000)
+}
+
+// TitlesConfig controls the title and tags a model gives a session after its
+// first completed turn.
+type TitlesConfig struct {
+	Disabled bool   `json:"disabled,omitempty"` // Never generate titles
+	Model    string `json:"model,omitempty"`    // "provider/id" (default: compactor.model; titles are off without either)
+}
+
+// Offline reports whether AI_OFFLINE is set. Offline, the agent makes no
+// model calls beyond the agent's own turns, such as session titles.
+func Offline() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("AI_OFFLINE")))
+	return v != "" && v != "0" && v != "false"
+}
+
+// RetentionConfig is the garbage-collection policy for sessions, runs and
+// traces. Zero ages and sizes turn a rule off; empty sessions are always
+// collected.
+type RetentionConfig struct {
+	MaxAgeDays        int  `json:"maxAgeDays,omitempty"`        // Sessions not written, and runs finished, this many days ago
+	MaxTotalMB        int  `json:"maxTotalMB,omitempty"`        // Then the oldest sessions until all sessions fit
+	KeepNamed         bool `json:"keepNamed"`                   // Never collect sessions the user named (default true)
+	KeepForked        bool `json:"keepForked"`                  // Never collect sessions that were forked from (default true)
+	ArchiveMaxAgeDays int  `json:"archiveMaxAgeDays,omitempty"` // Compaction archives older than this many days
+	Auto              bool `json:"auto,omitempty"`              // Collect when an agent starts
+	AutoIntervalHours int  `json:"autoIntervalHours,omitempty"` // At most this often across agents (default 24)
+}
+
+const defaultAutoGCIntervalHours = 24
+
+// DefaultRetentionConfig returns the default retention policy: only empty
+// sessions are collected, and only on demand.
+func DefaultRetentionConfig() *RetentionConfig {
+	return &RetentionConfig{KeepNamed: true, KeepForked: true}
+}
+
+// Policy returns the session.GCPolicy of the configuration.
+func (c *RetentionConfig) Policy() session.GCPolicy {
+	if c == nil {
+		c = DefaultRetentionConfig()
+	}
+	const day = 24 * time.Hour
+	return session.GCPolicy{
+		MaxAge:        time.Duration(c.MaxAgeDays) * day,
+		MaxTotalBytes: int64(c.MaxTotalMB) << 20,
+		KeepNamed:     c.KeepNamed,
+		KeepForked:    c.KeepForked,
+		ArchiveMaxAge: time.Duration(c.ArchiveMaxAgeDays) * day,
+	}
+}
+
+// AutoInterval returns how often automatic GC may run.
+func (c *RetentionConfig) AutoInterval() time.Duration {
+	if c == nil || c.AutoIntervalHours <= 0 {
+		return defaultAutoGCIntervalHours * time.Hour
+	}
+	return time.Duration(c.AutoIntervalHours) * time.Hour
+}
+
+const (
+	defaultAskUserTimeout  = 600
+	defaultAskUserFallback = "Proceed with your best judgement and state the assumption you made."
+)
+
 const (
 	defaultToolOutputMaxChars = 10_000
 	maxToolOutputMaxChars     = 30_000
@@ -97,6 +189,38 @@ func normalizeToolOutputConfig(cfg *ToolOutputConfig) *ToolOutputConfig {
 	return cfg
 }
 
+// DefaultAskUserConfig returns default ask_user configuration.
+func DefaultAskUserConfig() *AskUserConfig {
+	return &AskUserConfig{
+		Timeout:  defaultAskUserTimeout,
+		Fallback: defaultAskUserFallback,
+	}
+}
+
+func normalizeAskUserConfig(cfg *AskUserConfig) *AskUserConfig {
+	if cfg == nil {
+		return DefaultAskUserConfig()
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultAskUserTimeout
+	}
+	if strings.TrimSpace(cfg.Fallback) == "" {
+		cfg.Fallback = defaultAskUserFallback
+	}
+	return cfg
+}
+
+// TimeoutDuration returns the wait timeout; zero means wait forever.
+func (c *AskUserConfig) TimeoutDuration() time.Duration {
+	if c == nil {
+		return defaultAskUserTimeout * time.Second
+	}
+	if c.Timeout < 0 {
+		return 0
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
+
 // DefaultLogConfig returns default logging configuration.
 func DefaultLogConfig() *LogConfig {
 	homeDir, _ := os.UserHomeDir()
@@ -141,6 +265,7 @@ func LoadConfig(configPath string) (*Config, error) {
 	cfg.Model.MaxTokens = getEnvInt("ZAI_MAX_TOKENS", cfg.Model.MaxTokens)
 
 	cfg.ToolOutput = normalizeToolOutputConfig(cfg.ToolOutput)
+	cfg.AskUser = normalizeAskUserConfig(cfg.AskUser)
 
 	return cfg, nil
 }
@@ -230,6 +355,8 @@ func DefaultConfig() *Config {
 		Compactor:     compact.DefaultConfig(),
 		Concurrency:   DefaultConcurrencyConfig(),
 		ToolOutput:    DefaultToolOutputConfig(),
+		AskUser:       DefaultAskUserConfig(),
+		Retention:     DefaultRetentionConfig(),
 		Log:           DefaultLogConfig(),
 	}
 }
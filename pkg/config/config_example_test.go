@@ -73,6 +73,15 @@ func TestConfigExampleFile(t *testing.T) {
 		t.Errorf("MaxChars mismatch: got %d, want %d", cfg.ToolOutput.MaxChars, defaultToolOutput.MaxChars)
 	}
 
+	// Verify ask_user config
+	if cfg.AskUser == nil {
+		t.Fatal("AskUser config should not be nil")
+	}
+	defaultAskUser := DefaultAskUserConfig()
+	if cfg.AskUser.Timeout != defaultAskUser.Timeout || cfg.AskUser.Fallback != defaultAskUser.Fallback {
+		t.Errorf("AskUser mismatch: got %+v, want %+v", *cfg.AskUser, *defaultAskUser)
+	}
+
 	// Verify log config
 	if cfg.Log == nil {
 		t.Fatal("Log config should not be nil")
@@ -98,6 +107,7 @@ func TestConfigDefaultsMatchCode(t *testing.T) {
 		{"Concurrency.MaxConcurrentTools", DefaultConcurrencyConfig().MaxConcurrentTools, 5},
 		{"Concurrency.QueueTimeout", DefaultConcurrencyConfig().QueueTimeout, 60},
 		{"ToolOutput.MaxChars", DefaultToolOutputConfig().MaxChars, 10000},
+		{"AskUser.Timeout", DefaultAskUserConfig().Timeout, 600},
 		{"Log.Level", DefaultLogConfig().Level, "info"},
 	}
 
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tiancaiamao/ai/pkg/compact"
 )
@@ -432,3 +434,53 @@ func TestCompactorDefaults(t *testing.T) {
 		t.Errorf("Expected ToolSummaryAutomation off, got %q", compactorConfig.ToolSummaryAutomation)
 	}
 }
+
+func TestRetentionConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	os.WriteFile(configPath, []byte(`{"retention": {"maxAgeDays": 30, "maxTotalMB": 512, "keepForked": false}}`), 0644)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	policy := cfg.Retention.Policy()
+	if policy.MaxAge != 30*24*time.Hour || policy.MaxTotalBytes != 512<<20 {
+		t.Errorf("policy = %+v", policy)
+	}
+	if !policy.KeepNamed || policy.KeepForked {
+		t.Errorf("keepNamed should default to true and keepForked be overridden: %+v", policy)
+	}
+	if got := cfg.Retention.AutoInterval(); got != 24*time.Hour {
+		t.Errorf("AutoInterval = %v, want 24h", got)
+	}
+
+	var nilRetention *RetentionConfig
+	if policy := nilRetention.Policy(); policy.MaxAge != 0 || !policy.KeepNamed {
+		t.Errorf("nil policy = %+v", policy)
+	}
+}
+
+func TestRedactedJSON(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Model.BaseURL = "https://user:pw@api.example.com/v1?api_key=sk-123"
+	cfg.Log = &LogConfig{Level: "debug", File: "/tmp/ai.log"}
+
+	data, err := cfg.RedactedJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if strings.Contains(out, "sk-123") || strings.Contains(out, "user:pw") {
+		t.Errorf("secrets left in:\n%s", out)
+	}
+	if !strings.Contains(out, "api.example.com/v1") || !strings.Contains(out, "/tmp/ai.log") {
+		t.Errorf("non-secret values lost:\n%s", out)
+	}
+
+	v := redactValue(map[string]any{"apiKey": "sk-1", "authToken": "t", "maxTokens": 5.0, "nested": []any{map[string]any{"password": "p"}}})
+	m := v.(map[string]any)
+	if m["apiKey"] != redacted || m["authToken"] != redacted || m["maxTokens"] != 5.0 || m["nested"].([]any)[0].(map[string]any)["password"] != redacted {
+		t.Errorf("redactValue = %v", v)
+	}
+}
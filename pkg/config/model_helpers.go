@@ -119,6 +119,9 @@ func ApplyModelLimitsFromSpec(model llm.Model, spec ModelSpec) llm.Model {
 	if spec.SupportsVision {
 		model.SupportsVision = true
 	}
+	if model.Cost == nil {
+		model.Cost = spec.Cost
+	}
 	return model
 }
 
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/tiancaiamao/ai/pkg/llm"
 	"github.com/tiancaiamao/ai/pkg/modelselect"
 )
 
@@ -20,7 +21,8 @@ type ModelSpec struct {
 	Input          []string
 	ContextWindow  int
 	MaxTokens      int
-	SupportsVision bool // true when Input includes image/vision
+	SupportsVision bool           // true when Input includes image/vision
+	Cost           *llm.ModelCost // dollars per million tokens (nil = unknown)
 }
 
 type modelsFile struct {
@@ -34,14 +36,15 @@ type providerConfig struct {
 }
 
 type modelConfig struct {
-	ID            string   `json:"id"`
-	Name          string   `json:"name,omitempty"`
-	BaseURL       string   `json:"baseUrl,omitempty"`
-	API           string   `json:"api,omitempty"`
-	Reasoning     bool     `json:"reasoning,omitempty"`
-	Input         []string `json:"input,omitempty"`
-	ContextWindow int      `json:"contextWindow,omitempty"`
-	MaxTokens     int      `json:"maxTokens,omitempty"`
+	ID            string         `json:"id"`
+	Name          string         `json:"name,omitempty"`
+	BaseURL       string         `json:"baseUrl,omitempty"`
+	API           string         `json:"api,omitempty"`
+	Reasoning     bool           `json:"reasoning,omitempty"`
+	Input         []string       `json:"input,omitempty"`
+	ContextWindow int            `json:"contextWindow,omitempty"`
+	MaxTokens     int            `json:"maxTokens,omitempty"`
+	Cost          *llm.ModelCost `json:"cost,omitempty"`
 }
 
 // GetDefaultModelsPath returns the default models file path.
@@ -101,6 +104,7 @@ func LoadModelSpecs(path string) ([]ModelSpec, error) {
 				ContextWindow:  model.ContextWindow,
 				MaxTokens:      model.MaxTokens,
 				SupportsVision: supportsVision(model.Input),
+				Cost:           model.Cost,
 			})
 		}
 	}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces secret values in RedactedJSON.
+const redacted = "[REDACTED]"
+
+// secretKeyWords mark a JSON field as secret when its lowercase name
+// contains one of them.
+var secretKeyWords = []string{"key", "token", "secret", "password", "passwd", "auth", "credential", "cookie"}
+
+// RedactedJSON returns the config as indented JSON with secrets removed, for
+// sharing: fields whose names look secret are replaced, and URLs lose their
+// user info and query string.
+func (c *Config) RedactedJSON() ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(redactValue(v), "", "  ")
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if s, ok := field.(string); ok && s != "" && isSecretKey(k) {
+				v[k] = redacted
+				continue
+			}
+			v[k] = redactValue(field)
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+		return v
+	case string:
+		return redactURL(v)
+	default:
+		return v
+	}
+}
+
+func isSecretKey(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretKeyWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL strips credentials from s if it is an absolute URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.User == nil && u.RawQuery == "") {
+		return s
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.String()
+}
@@ -2,7 +2,8 @@ package context
 
 // AgentState represents system-maintained metadata about the agent state.
 // Most fields are recomputed from RecentMessages every turn
-// (see injectRuntimeMeta); persistence is not required.
+// (see injectRuntimeMeta); persistence is not required. Todos is the
+// exception: it is owned by the todo tool and persisted as session entries.
 type AgentState struct {
 	// Workspace
 	WorkspaceRoot     string
@@ -17,6 +18,10 @@ type AgentState struct {
 	// ToolCallsSinceLastTrigger drives the LLMDecide ask interval.
 	ToolCallsSinceLastTrigger int
 
+	// Todos is the agent's task list, maintained by the todo tool.
+	// It lives outside RecentMessages so it survives compaction.
+	Todos []TodoItem
+
 	// Runtime metadata (cached snapshot, rebuilt on band heartbeat)
 	RuntimeMetaTurns    int
 	RuntimeMetaSnapshot string
@@ -0,0 +1,175 @@
+package context
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// TokenBreakdown reports estimated tokens of a request by category. Like
+// EstimateTokens it counts ~4 characters per token; hidden messages count 0.
+type TokenBreakdown struct {
+	SystemPrompt      int `json:"systemPrompt"`
+	Tools             int `json:"tools"`             // tool schemas
+	Prefix            int `json:"prefix"`            // skills + AGENTS.md
+	CompactionSummary int `json:"compactionSummary"` // summary messages
+	UserMessages      int `json:"userMessages"`      // prompts typed by the user
+	Injected          int `json:"injected"`          // other user-role messages: hooks, runtime state, pinned results
+	AssistantText     int `json:"assistantText"`
+	Thinking          int `json:"thinking"`
+	ToolCalls         int `json:"toolCalls"` // tool names and arguments
+	ToolResults       int `json:"toolResults"`
+	Total             int `json:"total"`
+
+	ByTool  []TokenShare    `json:"byTool"`  // tool results per tool, largest first
+	ByPath  []TokenShare    `json:"byPath"`  // tool results per "path" argument, largest first
+	Largest []MessageTokens `json:"largest"` // largest messages, largest first
+}
+
+// TokenShare is the token count of a group of tool results.
+type TokenShare struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+	Count  int    `json:"count"`
+}
+
+// MessageTokens is the token estimate of one message.
+type MessageTokens struct {
+	Index    int    `json:"index"` // index in the messages passed to BreakdownTokens
+	EntryID  string `json:"entryId,omitempty"`
+	Role     string `json:"role"`
+	Kind     string `json:"kind,omitempty"`
+	ToolName string `json:"toolName,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Tokens   int    `json:"tokens"`
+	Preview  string `json:"preview"`
+}
+
+// breakdownPreviewRunes is the length of MessageTokens.Preview.
+const breakdownPreviewRunes = 80
+
+// BreakdownTokens estimates the tokens of systemPrompt, tools, the context
+// prefix and messages by category, and lists the topN largest messages.
+func BreakdownTokens(systemPrompt, prefix string, tools []Tool, messages []AgentMessage, topN int) TokenBreakdown {
+	b := TokenBreakdown{
+		SystemPrompt: len(systemPrompt) / 4,
+		Tools:        EstimateToolsTokens(tools),
+		Prefix:       len(prefix) / 4,
+	}
+	byTool := map[string]*TokenShare{}
+	byPath := map[string]*TokenShare{}
+	args := toolCallArgs(messages)
+	var chars struct{ summary, user, injected, text, thinking, calls, results int }
+	var largest []MessageTokens
+
+	for i, msg := range messages {
+		if !msg.IsAgentVisible() {
+			continue
+		}
+		n := estimateMessageChars(msg)
+		kind := ""
+		if msg.Metadata != nil {
+			kind = msg.Metadata.Kind
+		}
+		path, _ := args[msg.ToolCallID]["path"].(string)
+		switch msg.Role {
+		case "user":
+			switch kind {
+			case "compactionSummary", "sessionDigest":
+				chars.summary += n
+			case "", "user":
+				chars.user += n
+			default:
+				chars.injected += n
+			}
+		case "assistant":
+			for _, block := range msg.Content {
+				switch c := block.(type) {
+				case TextContent:
+					chars.text += len(c.Text)
+				case ThinkingContent:
+					chars.thinking += len(c.Thinking)
+				case ToolCallContent:
+					chars.calls += len(c.Name)
+					if c.Arguments != nil {
+						if data, err := json.Marshal(c.Arguments); err == nil {
+							chars.calls += len(data)
+						}
+					}
+				}
+			}
+		case "toolResult":
+			chars.results += n
+			addShare(byTool, msg.ToolName, n)
+			if path != "" {
+				addShare(byPath, path, n)
+			}
+		}
+
+		if msg.Role != "toolResult" {
+			path = ""
+		}
+		largest = append(largest, MessageTokens{
+			Index:    i,
+			EntryID:  msg.EntryID,
+			Role:     msg.Role,
+			Kind:     kind,
+			ToolName: msg.ToolName,
+			Path:     path,
+			Tokens:   EstimateMessageTokens(msg),
+			Preview:  preview(msg.ExtractText()),
+		})
+	}
+
+	b.CompactionSummary = chars.summary / 4
+	b.UserMessages = chars.user / 4
+	b.Injected = chars.injected / 4
+	b.AssistantText = chars.text / 4
+	b.Thinking = chars.thinking / 4
+	b.ToolCalls = chars.calls / 4
+	b.ToolResults = chars.results / 4
+	b.Total = b.SystemPrompt + b.Tools + b.Prefix + b.CompactionSummary + b.UserMessages +
+		b.Injected + b.AssistantText + b.Thinking + b.ToolCalls + b.ToolResults
+	b.ByTool = sortedShares(byTool)
+	b.ByPath = sortedShares(byPath)
+
+	sort.SliceStable(largest, func(i, j int) bool { return largest[i].Tokens > largest[j].Tokens })
+	b.Largest = largest[:min(max(topN, 0), len(largest))]
+	return b
+}
+
+// addShare adds chars of one tool result to the share named name. Tokens
+// holds characters until sortedShares converts them.
+func addShare(shares map[string]*TokenShare, name string, chars int) {
+	s, ok := shares[name]
+	if !ok {
+		s = &TokenShare{Name: name}
+		shares[name] = s
+	}
+	s.Tokens += chars
+	s.Count++
+}
+
+// sortedShares converts character counts to tokens, largest first.
+func sortedShares(shares map[string]*TokenShare) []TokenShare {
+	out := make([]TokenShare, 0, len(shares))
+	for _, s := range shares {
+		out = append(out, TokenShare{Name: s.Name, Tokens: s.Tokens / 4, Count: s.Count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Tokens != out[j].Tokens {
+			return out[i].Tokens > out[j].Tokens
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// preview returns text on one line, cut to breakdownPreviewRunes.
+func preview(text string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= breakdownPreviewRunes {
+		return string(runes)
+	}
+	return string(runes[:breakdownPreviewRunes]) + "..."
+}
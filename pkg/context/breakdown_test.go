@@ -0,0 +1,52 @@
+package context
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBreakdownTokens(t *testing.T) {
+	call := NewAssistantMessage()
+	call.Content = []ContentBlock{
+		ThinkingContent{Type: "thinking", Thinking: strings.Repeat("t", 400)},
+		TextContent{Type: "text", Text: strings.Repeat("a", 80)},
+		ToolCallContent{ID: "c1", Type: "toolCall", Name: "read", Arguments: map[string]any{"path": "big.go"}},
+		ToolCallContent{ID: "c2", Type: "toolCall", Name: "read", Arguments: map[string]any{"path": "small.go"}},
+		ToolCallContent{ID: "c3", Type: "toolCall", Name: "bash", Arguments: map[string]any{"command": "ls"}},
+	}
+	prompt := NewUserMessage(strings.Repeat("u", 40))
+	prompt.EntryID = "e1"
+	archived := NewToolResultMessage("c0", "read", []ContentBlock{TextContent{Type: "text", Text: strings.Repeat("h", 4000)}}, false).
+		WithVisibility(false, true)
+	messages := []AgentMessage{
+		NewCompactionSummaryMessage(strings.Repeat("s", 200)),
+		prompt,
+		call,
+		NewToolResultMessage("c1", "read", []ContentBlock{TextContent{Type: "text", Text: strings.Repeat("b", 2000)}}, false),
+		NewToolResultMessage("c2", "read", []ContentBlock{TextContent{Type: "text", Text: strings.Repeat("m", 400)}}, false),
+		NewToolResultMessage("c3", "bash", []ContentBlock{TextContent{Type: "text", Text: strings.Repeat("x", 800)}}, false),
+		NewUserMessage("runtime").WithKind("runtime_state"),
+		archived,
+	}
+
+	b := BreakdownTokens(strings.Repeat("p", 400), strings.Repeat("k", 120), nil, messages, 2)
+
+	if b.SystemPrompt != 100 || b.Prefix != 30 || b.Tools != 0 {
+		t.Fatalf("unexpected fixed parts: %+v", b)
+	}
+	if b.UserMessages != 10 || b.Thinking != 100 || b.AssistantText != 20 || b.ToolResults != 800 || b.Injected != 1 {
+		t.Fatalf("unexpected message categories: %+v", b)
+	}
+	if b.CompactionSummary < 50 || b.ToolCalls == 0 {
+		t.Fatalf("summary and tool calls not counted: %+v", b)
+	}
+	if len(b.ByTool) != 2 || b.ByTool[0].Name != "read" || b.ByTool[0].Tokens != 600 || b.ByTool[0].Count != 2 {
+		t.Fatalf("unexpected byTool: %+v", b.ByTool)
+	}
+	if len(b.ByPath) != 2 || b.ByPath[0].Name != "big.go" || b.ByPath[1].Name != "small.go" {
+		t.Fatalf("unexpected byPath: %+v", b.ByPath)
+	}
+	if len(b.Largest) != 2 || b.Largest[0].Index != 3 || b.Largest[0].Path != "big.go" || b.Largest[1].ToolName != "bash" {
+		t.Fatalf("unexpected largest: %+v", b.Largest)
+	}
+}
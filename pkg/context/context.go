@@ -122,18 +122,6 @@ func (c *AgentContext) EstimateTokenPercent() float64 {
 	return EstimateTokenPercent(c.EstimateTokens(), c.AgentState.TokensLimit)
 }
 
-// CountStaleOutputs counts tool result messages older than maxAge turns.
-func (c *AgentContext) CountStaleOutputs(maxAge int) int {
-	count := 0
-	currentTurn := c.AgentState.TotalTurns
-	for _, msg := range c.RecentMessages {
-		if msg.Role == "toolResult" && currentTurn-msg.TruncatedAt > maxAge {
-			count++
-		}
-	}
-	return count
-}
-
 // AddTool adds a tool to the context.
 func (c *AgentContext) AddTool(tool Tool) {
 	if tool == nil {
@@ -51,24 +51,6 @@ func TestAgentContextEstimateTokensAndPercent(t *testing.T) {
 	}
 }
 
-func TestCountStaleOutputs(t *testing.T) {
-	ctx := NewAgentContext("")
-	ctx.AgentState.TotalTurns = 10
-	ctx.RecentMessages = []AgentMessage{
-		{Role: "toolResult", TruncatedAt: 9}, // currentTurn - 9 = 1, not stale for maxAge=0
-		{Role: "toolResult", TruncatedAt: 5}, // 10 - 5 = 5, stale for maxAge=2
-		{Role: "toolResult", TruncatedAt: 1}, // 10 - 1 = 9, stale
-		{Role: "user", TruncatedAt: 0},       // not a tool result
-	}
-
-	if got := ctx.CountStaleOutputs(2); got != 2 {
-		t.Fatalf("expected 2 stale outputs, got %d", got)
-	}
-	if got := ctx.CountStaleOutputs(0); got != 3 {
-		t.Fatalf("expected 3 stale outputs with maxAge=0, got %d", got)
-	}
-}
-
 func TestAddAndGetTool(t *testing.T) {
 	ctx := NewAgentContext("")
 
@@ -15,7 +15,11 @@ import (
 // handling. OpenAI-compatible APIs expect tool message content to be a string,
 // not an array. When a tool result contains image content, we inject the
 // image into the preceding user message and keep only text in the tool message.
+//
+// Repeated and superseded tool outputs are replaced by references to the
+// later output (see DedupToolOutputs); messages itself is not modified.
 func ConvertMessagesToLLM(messages []AgentMessage) []llm.LLMMessage {
+	messages = DedupToolOutputs(messages)
 	llmMessages := make([]llm.LLMMessage, 0, len(messages))
 
 	// pendingImages accumulates image content parts from tool results.
@@ -0,0 +1,102 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// dedupMinChars is the smallest tool output worth replacing. Shorter outputs
+// save too few tokens to pay for the prompt-cache miss the rewrite causes.
+const dedupMinChars = 500
+
+// supersedableTools re-read state without changing it: a later call with the
+// same arguments makes an earlier output obsolete even if the content differs.
+var supersedableTools = map[string]bool{"read": true, "grep": true, "find": true, "ls": true}
+
+// DedupToolOutputs returns messages with every tool output that a later
+// output repeats (same text) or supersedes (same read-only call) replaced by
+// a one-line reference to the later result. messages is not modified.
+//
+// Replaced results keep their role and ToolCallID, so tool-call pairing is
+// unchanged. Pinned, hidden and image-carrying results, and results shorter
+// than dedupMinChars, are left alone.
+func DedupToolOutputs(messages []AgentMessage) []AgentMessage {
+	type later struct {
+		index int
+		text  string
+	}
+	byHash := map[string][]later{}
+	byCall := map[string]int{}
+	args := toolCallArgs(messages)
+
+	var out []AgentMessage
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role != "toolResult" || !msg.IsAgentVisible() || hasImage(msg) {
+			continue
+		}
+		text := msg.ExtractText()
+		hash := msg.OutputHash()
+		call := callSignature(msg.ToolName, args[msg.ToolCallID])
+
+		reference := ""
+		if len(text) >= dedupMinChars && !msg.IsPinned() {
+			for _, l := range byHash[hash] {
+				if l.text == text {
+					reference = fmt.Sprintf("[Same content as the later %s result (tool call %s); that output is still current.]",
+						messages[l.index].ToolName, messages[l.index].ToolCallID)
+					break
+				}
+			}
+			if j, ok := byCall[call]; ok && reference == "" && supersedableTools[msg.ToolName] {
+				reference = fmt.Sprintf("[Superseded by the later %s result with the same arguments (tool call %s).]",
+					msg.ToolName, messages[j].ToolCallID)
+			}
+		}
+
+		if reference != "" {
+			if out == nil {
+				out = append([]AgentMessage(nil), messages...)
+			}
+			replaced := msg
+			replaced.Content = []ContentBlock{TextContent{Type: "text", Text: reference}}
+			out[i] = replaced
+			continue
+		}
+		if hash != "" {
+			byHash[hash] = append(byHash[hash], later{index: i, text: text})
+		}
+		if call != "" && !msg.IsError {
+			if _, ok := byCall[call]; !ok {
+				byCall[call] = i
+			}
+		}
+	}
+	if out == nil {
+		return messages
+	}
+	return out
+}
+
+// callSignature identifies a tool call by name and arguments, or "" when the
+// arguments are unknown.
+func callSignature(toolName string, args map[string]any) string {
+	if toolName == "" || args == nil {
+		return ""
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	return toolName + " " + string(data)
+}
+
+// hasImage reports whether msg carries image content.
+func hasImage(msg AgentMessage) bool {
+	for _, block := range msg.Content {
+		if _, ok := block.(ImageContent); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package context
+
+import (
+	"strings"
+	"testing"
+)
+
+func dedupCall(id, name, path string) AgentMessage {
+	m := NewAssistantMessage()
+	m.Content = []ContentBlock{ToolCallContent{ID: id, Type: "toolCall", Name: name, Arguments: map[string]any{"path": path}}}
+	return m
+}
+
+func dedupResult(id, name, text string) AgentMessage {
+	return NewToolResultMessage(id, name, []ContentBlock{TextContent{Type: "text", Text: text}}, false)
+}
+
+func TestDedupToolOutputs_SameContent(t *testing.T) {
+	body := strings.Repeat("func main() {}\n", 50)
+	messages := []AgentMessage{
+		NewUserMessage("look at main.go"),
+		dedupCall("c1", "read", "main.go"),
+		dedupResult("c1", "read", body),
+		dedupCall("c2", "bash", "cat main.go"),
+		dedupResult("c2", "bash", body),
+		dedupCall("c3", "read", "main.go"),
+		dedupResult("c3", "read", body),
+	}
+
+	out := DedupToolOutputs(messages)
+	for _, i := range []int{2, 4} {
+		if text := out[i].ExtractText(); !strings.Contains(text, "Same content as the later read result (tool call c3)") {
+			t.Fatalf("message %d not replaced: %q", i, text)
+		}
+		if out[i].ToolCallID != messages[i].ToolCallID || out[i].Role != "toolResult" {
+			t.Fatalf("message %d lost its tool call pairing: %+v", i, out[i])
+		}
+	}
+	if out[6].ExtractText() != body {
+		t.Fatal("the latest output must be kept")
+	}
+	if messages[2].ExtractText() != body {
+		t.Fatal("DedupToolOutputs modified its input")
+	}
+
+	// Every tool message survives sanitizeToolCallProtocol.
+	tools := 0
+	for _, m := range ConvertMessagesToLLM(messages) {
+		if m.Role == "tool" {
+			tools++
+		}
+	}
+	if tools != 3 {
+		t.Fatalf("expected 3 tool messages after conversion, got %d", tools)
+	}
+}
+
+func TestDedupToolOutputs_Superseded(t *testing.T) {
+	before := strings.Repeat("old line\n", 100)
+	after := strings.Repeat("new line\n", 100)
+	messages := []AgentMessage{
+		dedupCall("c1", "read", "main.go"),
+		dedupResult("c1", "read", before),
+		dedupCall("c2", "bash", "go test"),
+		dedupResult("c2", "bash", strings.Repeat("FAIL\n", 100)),
+		dedupCall("c3", "bash", "go test"),
+		dedupResult("c3", "bash", strings.Repeat("ok\n", 200)),
+		dedupCall("c4", "read", "main.go"),
+		dedupResult("c4", "read", after),
+	}
+	out := DedupToolOutputs(messages)
+	if !strings.Contains(out[1].ExtractText(), "Superseded by the later read result with the same arguments (tool call c4)") {
+		t.Fatalf("expected superseded reference, got %q", out[1].ExtractText())
+	}
+	// bash is not read-only: a rerun with different output is kept.
+	if !strings.HasPrefix(out[3].ExtractText(), "FAIL") {
+		t.Fatalf("bash output should be kept, got %q", out[3].ExtractText())
+	}
+}
+
+func TestDedupToolOutputs_LeavesSmallAndPinnedOutputs(t *testing.T) {
+	body := strings.Repeat("x", dedupMinChars)
+	p := PriorityPinned
+	messages := []AgentMessage{
+		dedupCall("c1", "read", "a"),
+		dedupResult("c1", "read", "short"),
+		dedupCall("c2", "read", "b"),
+		dedupResult("c2", "read", body).WithPriority(&p),
+		dedupCall("c3", "read", "a"),
+		dedupResult("c3", "read", "short"),
+		dedupCall("c4", "read", "b"),
+		dedupResult("c4", "read", body),
+	}
+	out := DedupToolOutputs(messages)
+	if &out[0] != &messages[0] {
+		t.Fatal("expected the input slice back when nothing is replaced")
+	}
+}
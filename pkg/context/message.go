@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/tiancaiamao/ai/pkg/llm"
 )
 
 // ContentBlock represents a block of content in a message.
@@ -67,6 +69,33 @@ type Cost struct {
 	Total      float64 `json:"total"`
 }
 
+// UsageCost prices usage with the model's per-million-token prices. Cached
+// input tokens are part of InputTokens and are charged at the cache price.
+func UsageCost(price *llm.ModelCost, usage *Usage) Cost {
+	if price == nil || usage == nil {
+		return Cost{}
+	}
+	cacheRead, cacheWrite := price.CacheRead, price.CacheWrite
+	if cacheRead == 0 {
+		cacheRead = price.Input
+	}
+	if cacheWrite == 0 {
+		cacheWrite = price.Input
+	}
+	input := usage.InputTokens - usage.CacheRead - usage.CacheWrite
+	if input < 0 {
+		input = 0
+	}
+	cost := Cost{
+		Input:      float64(input) * price.Input / 1e6,
+		Output:     float64(usage.OutputTokens) * price.Output / 1e6,
+		CacheRead:  float64(usage.CacheRead) * cacheRead / 1e6,
+		CacheWrite: float64(usage.CacheWrite) * cacheWrite / 1e6,
+	}
+	cost.Total = cost.Input + cost.Output + cost.CacheRead + cost.CacheWrite
+	return cost
+}
+
 // MessageMetadata controls visibility and routing hints for a message.
 type MessageMetadata struct {
 	AgentVisible *bool    `json:"agentVisible,omitempty"`
@@ -75,6 +104,16 @@ type MessageMetadata struct {
 	Kind         string   `json:"kind,omitempty"`
 }
 
+// Message priorities for MessageMetadata.Priority. An unset priority is
+// PriorityNormal. Compaction evicts lower priorities first and never
+// summarizes or archives a message at or above PriorityPinThreshold.
+const (
+	PriorityLow          = 0.25
+	PriorityNormal       = 0.5
+	PriorityPinned       = 1.0
+	PriorityPinThreshold = 0.9
+)
+
 // AgentMessage represents a message in the conversation.
 type AgentMessage struct {
 	// Common fields
@@ -154,6 +193,18 @@ func NewCompactionSummaryMessage(summary string) AgentMessage {
 	}
 }
 
+// NewSessionDigestMessage creates the session digest message: the summaries
+// of older compactions merged into one. Like a compaction summary, it is
+// never summarized again as conversation.
+func NewSessionDigestMessage(digest string) AgentMessage {
+	return AgentMessage{
+		Role:      "user",
+		Content:   []ContentBlock{TextContent{Type: "text", Text: fmt.Sprintf("[Session digest]\n\n%s", digest)}},
+		Timestamp: time.Now().UnixMilli(),
+		Metadata:  &MessageMetadata{Kind: "sessionDigest"},
+	}
+}
+
 // ExtractText extracts all text content from a message.
 func (m *AgentMessage) ExtractText() string {
 	var b strings.Builder
@@ -245,6 +296,39 @@ func (m AgentMessage) WithKind(kind string) AgentMessage {
 	return copyMsg
 }
 
+// GetPriority returns the message priority, or PriorityNormal when unset.
+func (m AgentMessage) GetPriority() float64 {
+	if m.Metadata == nil || m.Metadata.Priority == nil {
+		return PriorityNormal
+	}
+	return *m.Metadata.Priority
+}
+
+// IsPinned reports whether compaction must keep the message verbatim.
+func (m AgentMessage) IsPinned() bool {
+	return m.GetPriority() >= PriorityPinThreshold
+}
+
+// WithPriority returns a copy with the given priority. A nil priority
+// resets it to the default.
+func (m AgentMessage) WithPriority(priority *float64) AgentMessage {
+	copyMsg := m
+	if copyMsg.Metadata == nil && priority == nil {
+		return copyMsg
+	}
+	meta := MessageMetadata{}
+	if copyMsg.Metadata != nil {
+		meta = *copyMsg.Metadata
+	}
+	if priority != nil {
+		p := *priority
+		priority = &p
+	}
+	meta.Priority = priority
+	copyMsg.Metadata = &meta
+	return copyMsg
+}
+
 func (m *AgentMessage) ensureMetadata() {
 	if m.Metadata == nil {
 		m.Metadata = &MessageMetadata{}
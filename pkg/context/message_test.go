@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"github.com/tiancaiamao/ai/pkg/llm"
 )
 
 // ContentBlock markers are 0% covered — quick smoke tests for each type.
@@ -258,3 +260,40 @@ func TestAgentMessageUnmarshalJSONEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestMessagePriority(t *testing.T) {
+	msg := NewUserMessage("hello")
+	if msg.GetPriority() != PriorityNormal || msg.IsPinned() {
+		t.Fatalf("default priority = %v, pinned = %v", msg.GetPriority(), msg.IsPinned())
+	}
+
+	p := PriorityPinned
+	pinned := msg.WithKind("user").WithPriority(&p)
+	p = PriorityLow // WithPriority copies the value
+	if !pinned.IsPinned() || pinned.GetPriority() != PriorityPinned {
+		t.Fatalf("expected pinned message, got priority %v", pinned.GetPriority())
+	}
+	if pinned.Metadata.Kind != "user" {
+		t.Fatalf("WithPriority dropped kind: %+v", pinned.Metadata)
+	}
+	if msg.IsPinned() {
+		t.Fatal("WithPriority modified the original message")
+	}
+
+	reset := pinned.WithPriority(nil)
+	if reset.IsPinned() || !pinned.IsPinned() {
+		t.Fatal("WithPriority(nil) should reset only the copy")
+	}
+}
+
+func TestUsageCost(t *testing.T) {
+	price := &llm.ModelCost{Input: 3, Output: 15, CacheRead: 0.3}
+	cost := UsageCost(price, &Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CacheRead: 500_000})
+	// 500k uncached input at $3, 500k cached at $0.30, 100k output at $15.
+	if want := 1.5 + 0.15 + 1.5; cost.Total < want-1e-9 || cost.Total > want+1e-9 {
+		t.Errorf("cost = %+v, want total %v", cost, want)
+	}
+	if cost := UsageCost(nil, &Usage{InputTokens: 1000}); cost.Total != 0 {
+		t.Errorf("unpriced cost = %+v", cost)
+	}
+}
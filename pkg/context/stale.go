@@ -0,0 +1,131 @@
+package context
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Tool outputs covered by StalePolicy. Investigative outputs describe the
+// workspace at the time they ran; modification outputs confirm a change that
+// later work usually already reflects.
+var (
+	investigativeTools = map[string]bool{"read": true, "grep": true, "find": true, "ls": true, "bash": true}
+	modificationTools  = map[string]bool{"edit": true, "write": true}
+)
+
+// StalePolicy decides when a tool output is likely stale. Ages are counted
+// in messages: an output's age is the number of messages after it.
+type StalePolicy struct {
+	// InvestigativeAge is the age after which read/grep/find/ls/bash
+	// outputs are stale. Zero disables the age check for them.
+	InvestigativeAge int
+	// ModificationAge is the age after which edit/write outputs are stale.
+	// Zero disables the age check for them.
+	ModificationAge int
+	// WorkingDir resolves relative paths for the on-disk check.
+	WorkingDir string
+}
+
+// minAge is the smallest enabled age, or 0 when both are disabled.
+func (p StalePolicy) minAge() int {
+	switch {
+	case p.InvestigativeAge <= 0:
+		return p.ModificationAge
+	case p.ModificationAge <= 0:
+		return p.InvestigativeAge
+	default:
+		return min(p.InvestigativeAge, p.ModificationAge)
+	}
+}
+
+// StaleOutputs returns the reason each likely-stale tool result in
+// c.RecentMessages is stale, keyed by index. Outputs of read and grep on a
+// file that changed on disk since they ran are stale at any age. It only
+// reads the messages.
+func (c *AgentContext) StaleOutputs(policy StalePolicy) map[int]string {
+	checkDisk := c.hasFileReads()
+	// The oldest message is len-1 messages old.
+	if !checkDisk && (policy.minAge() <= 0 || len(c.RecentMessages)-1 <= policy.minAge()) {
+		return nil
+	}
+
+	args := toolCallArgs(c.RecentMessages)
+	stale := map[int]string{}
+	for i, msg := range c.RecentMessages {
+		if msg.Role != "toolResult" || !msg.IsAgentVisible() {
+			continue
+		}
+		if checkDisk && (msg.ToolName == "read" || msg.ToolName == "grep") {
+			if path := policy.resolve(args[msg.ToolCallID]); path != "" && changedSince(path, msg.Timestamp) {
+				stale[i] = fmt.Sprintf("%s changed on disk since this output", path)
+				continue
+			}
+		}
+		maxAge := 0
+		switch {
+		case investigativeTools[msg.ToolName]:
+			maxAge = policy.InvestigativeAge
+		case modificationTools[msg.ToolName]:
+			maxAge = policy.ModificationAge
+		}
+		if age := len(c.RecentMessages) - 1 - i; maxAge > 0 && age > maxAge {
+			stale[i] = fmt.Sprintf("%d messages old", age)
+		}
+	}
+	return stale
+}
+
+// hasFileReads reports whether any visible read or grep output exists.
+func (c *AgentContext) hasFileReads() bool {
+	for _, msg := range c.RecentMessages {
+		if msg.Role == "toolResult" && (msg.ToolName == "read" || msg.ToolName == "grep") && msg.IsAgentVisible() {
+			return true
+		}
+	}
+	return false
+}
+
+// toolCallArgs maps tool call IDs to their arguments.
+func toolCallArgs(messages []AgentMessage) map[string]map[string]any {
+	args := map[string]map[string]any{}
+	for _, msg := range messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		for _, tc := range msg.ExtractToolCalls() {
+			args[tc.ID] = tc.Arguments
+		}
+	}
+	return args
+}
+
+// resolve returns the absolute file path named by a read or grep call, or
+// "" if it names none.
+func (p StalePolicy) resolve(args map[string]any) string {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return ""
+	}
+	if !filepath.IsAbs(path) {
+		if p.WorkingDir == "" {
+			return ""
+		}
+		path = filepath.Join(p.WorkingDir, path)
+	}
+	return path
+}
+
+// changedSince reports whether the regular file at path was modified after
+// the Unix millisecond timestamp ts. Directories never count: their mtime
+// does not change when a file inside is edited.
+func changedSince(path string, ts int64) bool {
+	if ts == 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return info.ModTime().UnixMilli() > ts
+}
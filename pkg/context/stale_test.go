@@ -0,0 +1,68 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func staleTestMessages(n int, path string, readAt int64) []AgentMessage {
+	call := NewAssistantMessage()
+	call.Content = []ContentBlock{ToolCallContent{ID: "call-1", Type: "toolCall", Name: "read", Arguments: map[string]any{"path": path}}}
+	result := NewToolResultMessage("call-1", "read", []ContentBlock{TextContent{Type: "text", Text: "package main"}}, false)
+	result.Timestamp = readAt
+	messages := []AgentMessage{call, result}
+	for i := 0; i < n; i++ {
+		messages = append(messages, NewUserMessage("more"))
+	}
+	return messages
+}
+
+func TestStaleOutputs_Age(t *testing.T) {
+	policy := StalePolicy{InvestigativeAge: 5, ModificationAge: 10}
+
+	ctx := NewAgentContext("")
+	ctx.RecentMessages = staleTestMessages(3, "/does/not/exist.go", 1)
+	if stale := ctx.StaleOutputs(policy); len(stale) != 0 {
+		t.Fatalf("expected no stale outputs yet, got %v", stale)
+	}
+
+	ctx.RecentMessages = staleTestMessages(8, "/does/not/exist.go", 1)
+	stale := ctx.StaleOutputs(policy)
+	if !strings.Contains(stale[1], "8 messages old") {
+		t.Fatalf("expected read output to be stale by age, got %v", stale)
+	}
+	// Ages come from positions; the persisted truncation turn is left alone.
+	if got := ctx.RecentMessages[1].TruncatedAt; got != 0 {
+		t.Fatalf("TruncatedAt = %d, want 0", got)
+	}
+}
+
+func TestStaleOutputs_FileChangedOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	readAt := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path, readAt, readAt); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewAgentContext("")
+	ctx.RecentMessages = staleTestMessages(0, "main.go", readAt.UnixMilli())
+	policy := StalePolicy{InvestigativeAge: 20, WorkingDir: dir}
+	if stale := ctx.StaleOutputs(policy); len(stale) != 0 {
+		t.Fatalf("unchanged file should not be stale, got %v", stale)
+	}
+
+	if err := os.WriteFile(path, []byte("package main // edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := ctx.StaleOutputs(policy)
+	if !strings.Contains(stale[1], "changed on disk") {
+		t.Fatalf("expected changed-on-disk staleness, got %v", stale)
+	}
+}
@@ -0,0 +1,86 @@
+package context
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Todo item statuses.
+const (
+	TodoStatusPending    = "pending"
+	TodoStatusInProgress = "in_progress"
+	TodoStatusCompleted  = "completed"
+	TodoStatusCancelled  = "cancelled"
+)
+
+// TodoItem is a single entry of the agent's task list.
+type TodoItem struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	Status  string `json:"status"`
+}
+
+// IsValidTodoStatus reports whether status is a known todo status.
+func IsValidTodoStatus(status string) bool {
+	switch status {
+	case TodoStatusPending, TodoStatusInProgress, TodoStatusCompleted, TodoStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CloneTodos returns a copy of items that shares no backing array with it.
+// Returns nil for an empty list.
+func CloneTodos(items []TodoItem) []TodoItem {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]TodoItem, len(items))
+	copy(out, items)
+	return out
+}
+
+// todoStatusMarker returns the checkbox marker used when rendering a status.
+func todoStatusMarker(status string) string {
+	switch status {
+	case TodoStatusCompleted:
+		return "[x]"
+	case TodoStatusInProgress:
+		return "[~]"
+	case TodoStatusCancelled:
+		return "[-]"
+	default:
+		return "[ ]"
+	}
+}
+
+// FormatTodoList renders items as one checkbox line per item, e.g.
+// "[x] 1. write parser". Returns "" for an empty list.
+func FormatTodoList(items []TodoItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, item := range items {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s %s. %s", todoStatusMarker(item.Status), item.ID, item.Content)
+	}
+	return b.String()
+}
+
+// TodoCounts returns the number of completed items and the total.
+// Cancelled items are excluded from both counts.
+func TodoCounts(items []TodoItem) (done, total int) {
+	for _, item := range items {
+		switch item.Status {
+		case TodoStatusCancelled:
+			continue
+		case TodoStatusCompleted:
+			done++
+		}
+		total++
+	}
+	return done, total
+}
@@ -0,0 +1,47 @@
+package context
+
+import "testing"
+
+func TestFormatTodoList(t *testing.T) {
+	items := []TodoItem{
+		{ID: "1", Content: "write parser", Status: TodoStatusCompleted},
+		{ID: "2", Content: "add tests", Status: TodoStatusInProgress},
+		{ID: "3", Content: "update docs", Status: TodoStatusPending},
+		{ID: "4", Content: "drop legacy flag", Status: TodoStatusCancelled},
+	}
+	want := "[x] 1. write parser\n[~] 2. add tests\n[ ] 3. update docs\n[-] 4. drop legacy flag"
+	if got := FormatTodoList(items); got != want {
+		t.Fatalf("FormatTodoList() = %q, want %q", got, want)
+	}
+	if got := FormatTodoList(nil); got != "" {
+		t.Fatalf("FormatTodoList(nil) = %q, want empty", got)
+	}
+
+	done, total := TodoCounts(items)
+	if done != 1 || total != 3 {
+		t.Fatalf("TodoCounts() = %d/%d, want 1/3", done, total)
+	}
+}
+
+func TestCloneTodos(t *testing.T) {
+	if CloneTodos(nil) != nil {
+		t.Fatal("expected nil clone for empty list")
+	}
+	items := []TodoItem{{ID: "1", Content: "a", Status: TodoStatusPending}}
+	clone := CloneTodos(items)
+	clone[0].Status = TodoStatusCompleted
+	if items[0].Status != TodoStatusPending {
+		t.Fatal("clone shares backing array with original")
+	}
+}
+
+func TestIsValidTodoStatus(t *testing.T) {
+	for _, status := range []string{TodoStatusPending, TodoStatusInProgress, TodoStatusCompleted, TodoStatusCancelled} {
+		if !IsValidTodoStatus(status) {
+			t.Fatalf("expected %q to be valid", status)
+		}
+	}
+	if IsValidTodoStatus("done") {
+		t.Fatal("expected unknown status to be invalid")
+	}
+}
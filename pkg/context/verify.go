@@ -0,0 +1,41 @@
+package context
+
+import "fmt"
+
+// VerifyCheck is the outcome of one verification command.
+type VerifyCheck struct {
+	Command    string `json:"command"`
+	Passed     bool   `json:"passed"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	// Output is the (truncated) combined output, kept only for failed checks.
+	Output string `json:"output,omitempty"`
+}
+
+// VerifyResult summarizes the verification of an agent run.
+type VerifyResult struct {
+	Passed bool `json:"passed"`
+	// Attempts is the number of check rounds that ran.
+	Attempts    int `json:"attempts"`
+	MaxAttempts int `json:"maxAttempts"`
+	// Checks are the results of the last round.
+	Checks []VerifyCheck `json:"checks"`
+}
+
+// Summary returns a one-line description such as
+// "verify failed: 1/2 checks failed (attempt 1/3)".
+func (r *VerifyResult) Summary() string {
+	if r == nil {
+		return ""
+	}
+	failed := 0
+	for _, c := range r.Checks {
+		if !c.Passed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return fmt.Sprintf("verify passed: %d/%d checks (attempt %d/%d)", len(r.Checks), len(r.Checks), r.Attempts, r.MaxAttempts)
+	}
+	return fmt.Sprintf("verify failed: %d/%d checks failed (attempt %d/%d)", failed, len(r.Checks), r.Attempts, r.MaxAttempts)
+}
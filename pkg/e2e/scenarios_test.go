@@ -319,13 +319,20 @@ func TestE2E_SlashCommands(t *testing.T) {
 	rs.rpcAck(t, "set_thinking_level", "low")
 	rs.rpcAck(t, "set_trace_events", "off")
 
-	// ---- Phase 7: Known unsupported command ----
-	rs.rpcErr(t, "export_html", "", "not supported")
-
-	// ---- Phase 8: Tool turns (build context) ----
+	// ---- Phase 7: Tool turns (build context) ----
 	rs.promptAndWait(t, `Use the write tool to create a file named notes.md in the current directory containing 40 lines about the Go programming language. After it finishes, reply with the single word ok.`)
 	rs.promptAndWait(t, `Use the edit tool to append a section about error handling to notes.md. After it finishes, reply with the single word ok.`)
 
+	// ---- Phase 8: Export the tool turns ----
+	for _, format := range []string{"html", "md", "json"} {
+		exported := rs.rpcAck(t, "export", format)
+		path, _ := exported["path"].(string)
+		if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "notes.md") {
+			t.Fatalf("export %s: %v %v", format, exported, err)
+		}
+	}
+	rs.rpcErr(t, "export", "pdf", "unknown export format")
+
 	// ---- Phase 9: Session lifecycle (new / fork / rewind / resume) ----
 	// Do this BEFORE large prompts / compact: compact compresses the tree
 	// and invalidates entry IDs, so fork/rewind must run on a stable tree.
@@ -17,6 +17,16 @@ type Model struct {
 	MaxTokens      int    `json:"maxTokens,omitempty"`
 	Reasoning      bool   `json:"reasoning,omitempty"` // model supports thinking/reasoning control via API
 	SupportsVision bool   `json:"-"`                   // model supports image input (from models.json "input")
+	// Cost holds the model's prices from models.json (nil = unknown).
+	Cost *ModelCost `json:"cost,omitempty"`
+}
+
+// ModelCost is a model's price in dollars per million tokens.
+type ModelCost struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cacheRead,omitempty"`  // 0 = the input price
+	CacheWrite float64 `json:"cacheWrite,omitempty"` // 0 = the input price
 }
 
 // LLMContext represents the context for an LLM request.
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+// Limits of the transcript sent to the extraction model, in characters.
+const (
+	extractMessageChars    = 2000
+	extractTranscriptChars = 40000
+)
+
+const extractPrompt = `You maintain the long-term memory of a coding agent. Below are the memories it already has and the transcript of its latest run.
+
+List facts from the run that will still be useful in a future session:
+- user preferences and corrections ("scope": "user")
+- project conventions, commands, layout and pitfalls ("scope": "project")
+
+Skip task progress, anything already remembered, guesses, and anything obvious from reading the code. Each fact must stand alone in one or two sentences. Most runs have nothing worth remembering.
+
+Reply with only a JSON array, e.g. [{"scope": "project", "content": "..."}], or [] for none.`
+
+// Proposal is a memory suggested by Extract.
+type Proposal struct {
+	Scope   string `json:"scope"`
+	Content string `json:"content"`
+}
+
+// Extract asks model which facts from messages are worth remembering.
+// index is the current memory index, so known facts are not proposed again.
+func Extract(ctx context.Context, model llm.Model, apiKey string, messages []agentctx.AgentMessage, index string) ([]Proposal, error) {
+	transcript := Transcript(messages)
+	if transcript == "" {
+		return nil, nil
+	}
+	if index == "" {
+		index = "(none)"
+	}
+	llmCtx := llm.LLMContext{
+		Messages: []llm.LLMMessage{{
+			Role:    "user",
+			Content: fmt.Sprintf("%s\n\n## Memories\n%s\n\n## Transcript\n%s", extractPrompt, index, transcript),
+		}},
+		ThinkingLevel: "off",
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	stream := llm.StreamLLM(ctx, model, llmCtx, apiKey, time.Minute)
+	var response strings.Builder
+	for event := range stream.Iterator(ctx) {
+		if event.Done {
+			break
+		}
+		switch e := event.Value.(type) {
+		case llm.LLMTextDeltaEvent:
+			response.WriteString(e.Delta)
+		case llm.LLMErrorEvent:
+			return nil, e.Error
+		}
+	}
+	return ParseProposals(response.String())
+}
+
+// ParseProposals reads the JSON array of an extraction reply, ignoring text
+// around it and entries with an unknown scope or no content.
+func ParseProposals(reply string) ([]Proposal, error) {
+	start := strings.Index(reply, "[")
+	end := strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in extraction reply")
+	}
+	var raw []Proposal
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("parse extraction reply: %w", err)
+	}
+	var proposals []Proposal
+	for _, p := range raw {
+		p.Content = strings.TrimSpace(p.Content)
+		if p.Content == "" || (p.Scope != ScopeProject && p.Scope != ScopeUser) {
+			continue
+		}
+		proposals = append(proposals, p)
+	}
+	return proposals, nil
+}
+
+// Transcript renders the agent-visible text of messages for the extraction
+// prompt, newest messages kept when it is too long.
+func Transcript(messages []agentctx.AgentMessage) string {
+	var parts []string
+	size := 0
+	for i := len(messages) - 1; i >= 0 && size < extractTranscriptChars; i-- {
+		msg := messages[i]
+		if !msg.IsAgentVisible() {
+			continue
+		}
+		body := strings.TrimSpace(msg.ExtractText())
+		for _, tc := range msg.ExtractToolCalls() {
+			args, _ := json.Marshal(tc.Arguments)
+			body += fmt.Sprintf("\n(tool call %s %s)", tc.Name, oneLine(string(args), 300))
+		}
+		body = strings.TrimSpace(body)
+		if body == "" {
+			continue
+		}
+		role := msg.Role
+		if msg.ToolName != "" {
+			role += " " + msg.ToolName
+		}
+		part := fmt.Sprintf("[%s]\n%s", role, truncateChars(body, extractMessageChars))
+		parts = append(parts, part)
+		size += len(part)
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func truncateChars(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
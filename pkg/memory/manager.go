@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultIndexChars bounds the memory index injected into the context prefix.
+const defaultIndexChars = 4000
+
+// indexEntryChars bounds one memory in the index.
+const indexEntryChars = 300
+
+// Manager holds the user store and the project stores under one root.
+type Manager struct {
+	root       string
+	cwd        func() string
+	budget     Budget
+	indexChars int
+	user       *Store
+
+	mu       sync.Mutex
+	projects map[string]*Store
+}
+
+// NewManager opens the stores under root. cwd returns the project
+// directory; it is called on every operation so workspace changes are
+// picked up. indexChars bounds Index; zero uses the default.
+func NewManager(root string, cwd func() string, budget Budget, indexChars int) *Manager {
+	if indexChars <= 0 {
+		indexChars = defaultIndexChars
+	}
+	return &Manager{
+		root:       root,
+		cwd:        cwd,
+		budget:     budget,
+		indexChars: indexChars,
+		user:       NewStore(ScopeUser, UserDir(root), budget),
+		projects:   map[string]*Store{},
+	}
+}
+
+// Store returns the store of scope; "" means the project store.
+func (m *Manager) Store(scope string) (*Store, error) {
+	switch scope {
+	case "", ScopeProject:
+		return m.project(), nil
+	case ScopeUser:
+		return m.user, nil
+	}
+	return nil, fmt.Errorf("unknown memory scope %q (want %s or %s)", scope, ScopeProject, ScopeUser)
+}
+
+// project returns the store of the current project. Stores are cached so
+// writes from one process share a mutex.
+func (m *Manager) project() *Store {
+	dir := ProjectDir(m.root, m.cwd())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.projects[dir]
+	if !ok {
+		s = NewStore(ScopeProject, dir, m.budget)
+		m.projects[dir] = s
+	}
+	return s
+}
+
+// Search searches both stores and returns at most limit hits, best first.
+func (m *Manager) Search(query string, limit int) ([]Hit, error) {
+	var hits []Hit
+	for _, s := range []*Store{m.project(), m.user} {
+		h, err := s.Search(query)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, h...)
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Updated.After(hits[j].Updated)
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// Index renders the accepted memories of both stores, newest first, for the
+// context prefix. Memories past the size limit are left to memory_search.
+// Returns "" when there are none.
+func (m *Manager) Index() (string, error) {
+	var b strings.Builder
+	omitted := 0
+	for _, s := range []*Store{m.project(), m.user} {
+		memories, err := s.List()
+		if err != nil {
+			return "", err
+		}
+		header := false
+		for _, mem := range memories {
+			if mem.Proposed() {
+				continue
+			}
+			line := fmt.Sprintf("- [%s] %s\n", mem.ID, oneLine(mem.Content, indexEntryChars))
+			if b.Len()+len(line) > m.indexChars {
+				omitted++
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&b, "%s memories:\n", titleScope(s.scope))
+				header = true
+			}
+			b.WriteString(line)
+		}
+	}
+	if b.Len() == 0 && omitted == 0 {
+		return "", nil
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "(%d more; use memory_search)\n", omitted)
+	}
+	return "<memory>\nFacts remembered from earlier sessions. Use memory_write to add or correct one, memory_delete to remove one that is wrong.\n\n" +
+		b.String() + "</memory>", nil
+}
+
+func titleScope(scope string) string {
+	if scope == ScopeUser {
+		return "User"
+	}
+	return "Project"
+}
+
+// oneLine joins text onto one line and cuts it to maxChars runes.
+func oneLine(text string, maxChars int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= maxChars {
+		return string(runes)
+	}
+	return string(runes[:maxChars]) + "..."
+}
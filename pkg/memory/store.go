@@ -0,0 +1,374 @@
+// Package memory stores facts the agent should remember across sessions.
+//
+// Memories live under ~/.ai/memory in two scopes: user memories apply to
+// every project, project memories to one working directory. Each scope is
+// one JSON file that is re-read on every operation, so concurrent sessions
+// see each other's writes. Changes run under a flock on the store
+// directory, so two Stores on the same file do not lose each other's
+// writes.
+package memory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tiancaiamao/ai/pkg/session/search"
+)
+
+// Memory scopes.
+const (
+	ScopeProject = "project"
+	ScopeUser    = "user"
+)
+
+// Memory sources.
+const (
+	// SourceAgent marks a memory written with memory_write.
+	SourceAgent = "agent"
+	// SourceProposed marks a memory proposed by the memory_extract
+	// middleware. Proposed memories are searchable but stay out of the
+	// index until accepted.
+	SourceProposed = "proposed"
+)
+
+const (
+	storeFileName = "memories.json"
+	lockFileName  = ".memories.lock"
+	// dedupSimilarity is the word-set overlap above which a new memory
+	// replaces an existing one instead of being added.
+	dedupSimilarity = 0.8
+)
+
+// Budget limits the size of one store. Zero fields use the defaults.
+type Budget struct {
+	MaxEntries int // default 200
+	MaxBytes   int // total content bytes, default 64 KiB
+}
+
+const (
+	defaultMaxEntries = 200
+	defaultMaxBytes   = 64 * 1024
+)
+
+func (b Budget) normalize() Budget {
+	if b.MaxEntries <= 0 {
+		b.MaxEntries = defaultMaxEntries
+	}
+	if b.MaxBytes <= 0 {
+		b.MaxBytes = defaultMaxBytes
+	}
+	return b
+}
+
+// Memory is one remembered fact.
+type Memory struct {
+	ID      string    `json:"id"`
+	Content string    `json:"content"`
+	Tags    []string  `json:"tags,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Proposed reports whether m awaits acceptance.
+func (m Memory) Proposed() bool {
+	return m.Source == SourceProposed
+}
+
+// Store is the memory file of one scope.
+type Store struct {
+	scope  string
+	path   string
+	budget Budget
+	mu     sync.Mutex
+}
+
+// NewStore returns the store of scope kept in dir.
+func NewStore(scope, dir string, budget Budget) *Store {
+	return &Store{scope: scope, path: filepath.Join(dir, storeFileName), budget: budget.normalize()}
+}
+
+// Scope returns the scope of s.
+func (s *Store) Scope() string {
+	return s.scope
+}
+
+// UserDir returns the directory of the user store under root.
+func UserDir(root string) string {
+	return filepath.Join(root, ScopeUser)
+}
+
+// ProjectDir returns the directory of the project store for cwd under root.
+// The directory name is the base name of cwd plus a hash of the full path,
+// so two checkouts named alike get separate stores.
+func ProjectDir(root, cwd string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(cwd)))
+	return filepath.Join(root, "projects", filepath.Base(cwd)+"-"+hex.EncodeToString(sum[:4]))
+}
+
+// List returns all memories, newest first.
+func (s *Store) List() ([]Memory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	memories, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	sortNewest(memories)
+	return memories, nil
+}
+
+// Write adds content as a memory. If an existing memory says the same thing
+// (same words, or a word overlap of at least 80%), it is updated instead and
+// updated is true. Writing fails when the store would exceed its budget.
+func (s *Store) Write(content string, tags []string, source string) (m Memory, updated bool, err error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Memory{}, false, errors.New("memory content is empty")
+	}
+	err = s.update(func(memories []Memory) ([]Memory, error) {
+		m, updated = merge(memories, content, tags, source)
+		if !updated {
+			memories = append(memories, m)
+		}
+		return memories, s.checkBudget(memories)
+	})
+	if err != nil {
+		return Memory{}, false, err
+	}
+	return m, updated, nil
+}
+
+// merge updates the memory in memories that says the same as content and
+// returns it with updated true, or returns a new memory that is not added.
+func merge(memories []Memory, content string, tags []string, source string) (m Memory, updated bool) {
+	now := time.Now().UTC()
+	index := -1
+	words := wordSet(content)
+	best := 0.0
+	for i, existing := range memories {
+		if sim := similarity(words, wordSet(existing.Content)); sim >= dedupSimilarity && sim > best {
+			index, best = i, sim
+		}
+	}
+	if index >= 0 {
+		m = memories[index]
+		m.Content = content
+		for _, tag := range tags {
+			if !slices.Contains(m.Tags, tag) {
+				m.Tags = append(m.Tags, tag)
+			}
+		}
+		// A write by the agent confirms a proposal.
+		if source != SourceProposed {
+			m.Source = source
+		}
+		m.Updated = now
+		memories[index] = m
+		return m, true
+	}
+	return Memory{ID: newID(memories), Content: content, Tags: tags, Source: source, Created: now, Updated: now}, false
+}
+
+// Accept turns the proposed memory id into a regular one.
+func (s *Store) Accept(id string) (Memory, error) {
+	var m Memory
+	err := s.update(func(memories []Memory) ([]Memory, error) {
+		for i := range memories {
+			if memories[i].ID == id {
+				memories[i].Source = SourceAgent
+				memories[i].Updated = time.Now().UTC()
+				m = memories[i]
+				return memories, nil
+			}
+		}
+		return nil, fmt.Errorf("%s memory %q not found", s.scope, id)
+	})
+	if err != nil {
+		return Memory{}, err
+	}
+	return m, nil
+}
+
+// Delete removes memory id.
+func (s *Store) Delete(id string) error {
+	return s.update(func(memories []Memory) ([]Memory, error) {
+		for i := range memories {
+			if memories[i].ID == id {
+				return slices.Delete(memories, i, i+1), nil
+			}
+		}
+		return nil, fmt.Errorf("%s memory %q not found", s.scope, id)
+	})
+}
+
+// Hit is a search result.
+type Hit struct {
+	Memory
+	Scope string
+	Score int // number of query words found
+}
+
+// Search returns the memories that contain any word of query, best first.
+// An empty query returns all memories, newest first.
+func (s *Store) Search(query string) ([]Hit, error) {
+	memories, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	terms := search.Tokens(query)
+	var hits []Hit
+	for _, m := range memories {
+		words := wordSet(m.Content + " " + strings.Join(m.Tags, " "))
+		score := 0
+		for _, term := range terms {
+			if words[term] {
+				score++
+			}
+		}
+		if score > 0 || len(terms) == 0 {
+			hits = append(hits, Hit{Memory: m, Scope: s.scope, Score: score})
+		}
+	}
+	return hits, nil
+}
+
+func (s *Store) checkBudget(memories []Memory) error {
+	size := 0
+	for _, m := range memories {
+		size += len(m.Content)
+	}
+	if len(memories) > s.budget.MaxEntries || size > s.budget.MaxBytes {
+		return fmt.Errorf("%s memory budget exceeded (%d/%d entries, %d/%d bytes): delete or merge memories first",
+			s.scope, len(memories), s.budget.MaxEntries, size, s.budget.MaxBytes)
+	}
+	return nil
+}
+
+// update loads the memories, changes them with change and saves the
+// result, all under s.mu and the store flock.
+func (s *Store) update(change func([]Memory) ([]Memory, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.withLock(func() error {
+		memories, err := s.load()
+		if err != nil {
+			return err
+		}
+		memories, err = change(memories)
+		if err != nil {
+			return err
+		}
+		return s.save(memories)
+	})
+}
+
+// withLock runs run under an exclusive flock on the store directory.
+func (s *Store) withLock(run func() error) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create memory dir: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}()
+	return run()
+}
+
+// load reads the store file; a missing file is an empty store.
+// Must be called with s.mu held.
+func (s *Store) load() ([]Memory, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s memories: %w", s.scope, err)
+	}
+	var memories []Memory
+	if err := json.Unmarshal(data, &memories); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	return memories, nil
+}
+
+// save writes memories atomically using write-to-temp + rename.
+// Must be called with s.mu and the store flock held.
+func (s *Store) save(memories []Memory) error {
+	data, err := json.MarshalIndent(memories, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".memories-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// newID returns "m<N>" one above the highest numeric ID in memories.
+func newID(memories []Memory) string {
+	next := 1
+	for _, m := range memories {
+		var n int
+		if _, err := fmt.Sscanf(m.ID, "m%d", &n); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return fmt.Sprintf("m%d", next)
+}
+
+func sortNewest(memories []Memory) {
+	sort.SliceStable(memories, func(i, j int) bool { return memories[i].Updated.After(memories[j].Updated) })
+}
+
+func wordSet(text string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range search.Tokens(text) {
+		set[w] = true
+	}
+	return set
+}
+
+// similarity is the Jaccard index of two word sets.
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStore_WriteDedupDelete(t *testing.T) {
+	s := NewStore(ScopeProject, t.TempDir(), Budget{})
+
+	m1, updated, err := s.Write("Run tests with make test, not go test", []string{"testing"}, SourceAgent)
+	if err != nil || updated {
+		t.Fatalf("Write: %v, updated=%v", err, updated)
+	}
+	// Same words in another case and order: update, not add.
+	m2, updated, err := s.Write("run tests with MAKE TEST, not go test.", []string{"make"}, SourceAgent)
+	if err != nil || !updated || m2.ID != m1.ID {
+		t.Fatalf("expected dedup into %s, got %s updated=%v err=%v", m1.ID, m2.ID, updated, err)
+	}
+	if len(m2.Tags) != 2 {
+		t.Fatalf("tags not merged: %v", m2.Tags)
+	}
+	if _, _, err := s.Write("The API server listens on port 8080", nil, SourceAgent); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.List()
+	if err != nil || len(all) != 2 {
+		t.Fatalf("List = %d memories, err %v", len(all), err)
+	}
+	hits, err := s.Search("port")
+	if err != nil || len(hits) != 1 || !strings.Contains(hits[0].Content, "8080") {
+		t.Fatalf("Search(port) = %+v, err %v", hits, err)
+	}
+
+	if err := s.Delete(m1.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(m1.ID); err == nil {
+		t.Fatal("expected error deleting a missing memory")
+	}
+	if all, _ := s.List(); len(all) != 1 {
+		t.Fatalf("expected 1 memory after delete, got %d", len(all))
+	}
+}
+
+func TestStore_Budget(t *testing.T) {
+	s := NewStore(ScopeUser, t.TempDir(), Budget{MaxEntries: 1})
+	if _, _, err := s.Write("prefers tabs", nil, SourceAgent); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Write("answers in German", nil, SourceAgent); err == nil || !strings.Contains(err.Error(), "budget") {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+	// Updating an existing memory does not grow the store.
+	if _, _, err := s.Write("prefers tabs.", nil, SourceAgent); err != nil {
+		t.Fatalf("update within budget failed: %v", err)
+	}
+}
+
+func TestStore_ConcurrentStoresKeepAllWrites(t *testing.T) {
+	// memory_extract builds its own Manager: two Stores share one file.
+	dir := t.TempDir()
+	stores := []*Store{NewStore(ScopeProject, dir, Budget{}), NewStore(ScopeProject, dir, Budget{})}
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range 10 {
+				if _, _, err := s.Write(fmt.Sprintf("fact%d%d from store%d", i, n, i), nil, SourceAgent); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if all, err := stores[0].List(); err != nil || len(all) != 20 {
+		t.Fatalf("List = %d memories, err %v; want 20", len(all), err)
+	}
+}
+
+func TestManager_IndexSkipsProposals(t *testing.T) {
+	root := t.TempDir()
+	m := NewManager(root, func() string { return "/work/repo" }, Budget{}, 0)
+	if index, err := m.Index(); err != nil || index != "" {
+		t.Fatalf("empty index = %q, %v", index, err)
+	}
+
+	project, _ := m.Store(ScopeProject)
+	user, _ := m.Store(ScopeUser)
+	if _, _, err := project.Write("migrations live in db/migrate", nil, SourceAgent); err != nil {
+		t.Fatal(err)
+	}
+	proposal, _, err := user.Write("likes short commit messages", nil, SourceProposed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := m.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(index, "Project memories:\n- [m1] migrations live in db/migrate") {
+		t.Fatalf("index missing project memory:\n%s", index)
+	}
+	if strings.Contains(index, "commit messages") {
+		t.Fatalf("proposal leaked into index:\n%s", index)
+	}
+	if _, err := user.Accept(proposal.ID); err != nil {
+		t.Fatal(err)
+	}
+	if index, _ := m.Index(); !strings.Contains(index, "User memories:\n- [m1] likes short commit messages") {
+		t.Fatalf("accepted memory not indexed:\n%s", index)
+	}
+
+	// Another project has its own store.
+	other := NewManager(root, func() string { return "/work/other" }, Budget{}, 0)
+	hits, err := other.Search("migrations", 0)
+	if err != nil || len(hits) != 0 {
+		t.Fatalf("project memory visible from another project: %+v", hits)
+	}
+}
+
+func TestParseProposals(t *testing.T) {
+	reply := "Here you go:\n```json\n" +
+		`[{"scope":"project","content":" use pnpm "},{"scope":"team","content":"x"},{"scope":"user","content":""}]` +
+		"\n```"
+	got, err := ParseProposals(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Content != "use pnpm" {
+		t.Fatalf("ParseProposals = %+v", got)
+	}
+	if _, err := ParseProposals("nothing to remember"); err == nil {
+		t.Fatal("expected error without a JSON array")
+	}
+}
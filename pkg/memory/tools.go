@@ -0,0 +1,216 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+var scopeParam = map[string]any{
+	"type":        "string",
+	"enum":        []string{ScopeProject, ScopeUser},
+	"description": "project: facts about this repository (default). user: the user's preferences across all projects",
+}
+
+// WriteTool implements memory_write.
+type WriteTool struct {
+	manager *Manager
+}
+
+// NewWriteTool creates the memory_write tool.
+func NewWriteTool(manager *Manager) *WriteTool {
+	return &WriteTool{manager: manager}
+}
+
+// Name returns the tool name.
+func (t *WriteTool) Name() string {
+	return "memory_write"
+}
+
+// Description returns the tool description.
+func (t *WriteTool) Description() string {
+	return "Remember a fact across sessions: a user preference, a project convention, a non-obvious command or pitfall. Write one self-contained fact per call. A fact that repeats an existing memory updates it instead of adding a duplicate. Do not store task progress; use todo for that."
+}
+
+// Parameters returns the JSON Schema for the tool parameters.
+func (t *WriteTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"content": map[string]any{
+				"type":        "string",
+				"description": "The fact to remember, in one or two sentences",
+			},
+			"scope": scopeParam,
+			"tags": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Optional keywords to find the memory by",
+			},
+		},
+		"required": []string{"content"},
+	}
+}
+
+// Execute writes the memory.
+func (t *WriteTool) Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error) {
+	scope, _ := args["scope"].(string)
+	store, err := t.manager.Store(scope)
+	if err != nil {
+		return nil, err
+	}
+	content, _ := args["content"].(string)
+	m, updated, err := store.Write(content, stringList(args["tags"]), SourceAgent)
+	if err != nil {
+		return nil, err
+	}
+	verb := "Saved"
+	if updated {
+		verb = "Updated existing"
+	}
+	return text(fmt.Sprintf("%s %s memory [%s].", verb, store.Scope(), m.ID)), nil
+}
+
+// SearchTool implements memory_search.
+type SearchTool struct {
+	manager *Manager
+}
+
+// NewSearchTool creates the memory_search tool.
+func NewSearchTool(manager *Manager) *SearchTool {
+	return &SearchTool{manager: manager}
+}
+
+// Name returns the tool name.
+func (t *SearchTool) Name() string {
+	return "memory_search"
+}
+
+// Description returns the tool description.
+func (t *SearchTool) Description() string {
+	return "Search the facts remembered across sessions, in both the project and user scope, by keyword. An empty query lists the newest memories."
+}
+
+// Parameters returns the JSON Schema for the tool parameters.
+func (t *SearchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "Keywords to search for",
+			},
+			"limit": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of results (default %d, max %d)", defaultSearchLimit, maxSearchLimit),
+			},
+		},
+	}
+}
+
+// Execute searches both stores.
+func (t *SearchTool) Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error) {
+	query, _ := args["query"].(string)
+	limit := defaultSearchLimit
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = min(int(v), maxSearchLimit)
+	}
+	hits, err := t.manager.Search(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		if strings.TrimSpace(query) == "" {
+			return text("No memories yet."), nil
+		}
+		return text(fmt.Sprintf("No memories match %q.", query)), nil
+	}
+	var b strings.Builder
+	for _, h := range hits {
+		fmt.Fprintf(&b, "[%s] (%s", h.ID, h.Scope)
+		if h.Proposed() {
+			b.WriteString(", proposed")
+		}
+		fmt.Fprintf(&b, ", %s) %s", h.Updated.Format("2006-01-02"), h.Content)
+		if len(h.Tags) > 0 {
+			fmt.Fprintf(&b, " #%s", strings.Join(h.Tags, " #"))
+		}
+		b.WriteString("\n")
+	}
+	return text(strings.TrimRight(b.String(), "\n")), nil
+}
+
+// DeleteTool implements memory_delete.
+type DeleteTool struct {
+	manager *Manager
+}
+
+// NewDeleteTool creates the memory_delete tool.
+func NewDeleteTool(manager *Manager) *DeleteTool {
+	return &DeleteTool{manager: manager}
+}
+
+// Name returns the tool name.
+func (t *DeleteTool) Name() string {
+	return "memory_delete"
+}
+
+// Description returns the tool description.
+func (t *DeleteTool) Description() string {
+	return "Delete a remembered fact that is wrong or obsolete, by the ID shown in the memory index or memory_search."
+}
+
+// Parameters returns the JSON Schema for the tool parameters.
+func (t *DeleteTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Memory ID, e.g. m12",
+			},
+			"scope": scopeParam,
+		},
+		"required": []string{"id"},
+	}
+}
+
+// Execute deletes the memory.
+func (t *DeleteTool) Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error) {
+	scope, _ := args["scope"].(string)
+	store, err := t.manager.Store(scope)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := args["id"].(string)
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	if err := store.Delete(id); err != nil {
+		return nil, err
+	}
+	return text(fmt.Sprintf("Deleted %s memory [%s].", store.Scope(), id)), nil
+}
+
+func stringList(v any) []string {
+	items, _ := v.([]any)
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			out = append(out, strings.TrimSpace(s))
+		}
+	}
+	return out
+}
+
+func text(s string) []agentctx.ContentBlock {
+	return []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: s}}
+}
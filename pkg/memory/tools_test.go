@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+type executor interface {
+	Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error)
+}
+
+func toolText(t *testing.T, tool executor, args map[string]any) string {
+	t.Helper()
+	blocks, err := tool.Execute(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blocks[0].(agentctx.TextContent).Text
+}
+
+func TestMemoryTools(t *testing.T) {
+	m := NewManager(t.TempDir(), func() string { return "/work/repo" }, Budget{}, 0)
+	ctx := context.Background()
+	write, search, del := NewWriteTool(m), NewSearchTool(m), NewDeleteTool(m)
+
+	out := toolText(t, write, map[string]any{"content": "prefers table-driven tests", "scope": "user", "tags": []any{"go"}})
+	if out != "Saved user memory [m1]." {
+		t.Fatalf("write: %q", out)
+	}
+	out = toolText(t, write, map[string]any{"content": "Prefers table-driven tests."})
+	if out != "Saved project memory [m1]." {
+		t.Fatalf("scopes must not dedup against each other: %q", out)
+	}
+	if _, err := write.Execute(ctx, map[string]any{"content": "x", "scope": "team"}); err == nil {
+		t.Fatal("expected error for unknown scope")
+	}
+
+	out = toolText(t, search, map[string]any{"query": "go"})
+	if !strings.Contains(out, "[m1] (user, ") || !strings.Contains(out, "#go") || strings.Contains(out, "project") {
+		t.Fatalf("search by tag: %q", out)
+	}
+
+	out = toolText(t, del, map[string]any{"id": "m1", "scope": "user"})
+	if out != "Deleted user memory [m1]." {
+		t.Fatalf("delete: %q", out)
+	}
+	out = toolText(t, search, map[string]any{"query": "tests"})
+	if !strings.Contains(out, "(project, ") || strings.Contains(out, "(user, ") {
+		t.Fatalf("search after delete: %q", out)
+	}
+}
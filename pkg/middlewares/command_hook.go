@@ -0,0 +1,333 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tiancaiamao/ai/pkg/agent"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+const commandHookName = "command_hook"
+
+// Hook points a command_hook can subscribe to via the "events" param.
+const (
+	commandHookBeforeModel  = "before_model"
+	commandHookBeforeTool   = "before_tool"
+	commandHookAfterTool    = "after_tool"
+	commandHookAfterAgent   = "after_agent"
+	commandHookSessionStart = "session_start"
+)
+
+const defaultCommandHookTimeout = 10 * time.Second
+
+// Failure policies: what happens when the script fails, times out or prints
+// a decision that cannot be parsed.
+const (
+	// commandHookFailAllow logs the failure and lets the agent continue.
+	commandHookFailAllow = "allow"
+	// commandHookFailDeny treats the failure as a deny: before_tool blocks the
+	// call and after_tool replaces the result with an error.
+	commandHookFailDeny = "deny"
+)
+
+// commandHookPayload is written as JSON to the script's stdin.
+type commandHookPayload struct {
+	Event      string         `json:"event"`
+	SessionID  string         `json:"session_id,omitempty"`
+	Cwd        string         `json:"cwd,omitempty"`
+	ToolName   string         `json:"tool_name,omitempty"`
+	ToolArgs   map[string]any `json:"tool_args,omitempty"`
+	ToolResult *string        `json:"tool_result,omitempty"`
+	IsError    bool           `json:"is_error,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	// LastMessage is the text of the newest message (before_model only).
+	LastMessage string `json:"last_message,omitempty"`
+}
+
+// commandHookDecision is read as JSON from the script's stdout. Empty
+// stdout means "allow, no changes".
+type commandHookDecision struct {
+	Decision string         `json:"decision,omitempty"` // "allow" (default) or "deny"
+	Reason   string         `json:"reason,omitempty"`
+	ToolArgs map[string]any `json:"tool_args,omitempty"` // before_tool: replacement arguments
+	Result   *string        `json:"result,omitempty"`    // after_tool: replacement result text
+	Messages []string       `json:"messages,omitempty"`  // before_model/session_start: user messages to inject
+}
+
+// commandHook runs an external script at the configured hook points.
+type commandHook struct {
+	command   string
+	events    map[string]bool
+	tools     map[string]bool
+	timeout   time.Duration
+	onFailure string
+}
+
+// newCommandHook parses params into a commandHook.
+func newCommandHook(params map[string]any) (*commandHook, error) {
+	command, _ := params["command"].(string)
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+	h := &commandHook{
+		command:   command,
+		events:    map[string]bool{},
+		timeout:   defaultCommandHookTimeout,
+		onFailure: commandHookFailAllow,
+	}
+
+	events := extractStringSlice(params, "events")
+	if len(events) == 0 {
+		events = []string{commandHookBeforeModel, commandHookBeforeTool, commandHookAfterTool, commandHookAfterAgent, commandHookSessionStart}
+	}
+	for _, e := range events {
+		switch e {
+		case commandHookBeforeModel, commandHookBeforeTool, commandHookAfterTool, commandHookAfterAgent, commandHookSessionStart:
+			h.events[e] = true
+		default:
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+	}
+
+	if tools := extractStringSlice(params, "tools"); len(tools) > 0 {
+		h.tools = make(map[string]bool, len(tools))
+		for _, t := range tools {
+			h.tools[t] = true
+		}
+	}
+
+	switch v := params["timeout"].(type) {
+	case nil:
+	case int:
+		h.timeout = time.Duration(v) * time.Second
+	case float64:
+		h.timeout = time.Duration(v * float64(time.Second))
+	default:
+		return nil, fmt.Errorf("timeout must be a number of seconds")
+	}
+	if h.timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive")
+	}
+
+	if v, ok := params["on_failure"].(string); ok && v != "" {
+		if v != commandHookFailAllow && v != commandHookFailDeny {
+			return nil, fmt.Errorf("on_failure must be %q or %q", commandHookFailAllow, commandHookFailDeny)
+		}
+		h.onFailure = v
+	}
+	return h, nil
+}
+
+// matchesTool reports whether the hook applies to toolName.
+func (h *commandHook) matchesTool(toolName string) bool {
+	return h.tools == nil || h.tools[toolName]
+}
+
+// run executes the script with payload on stdin and parses its decision.
+func (h *commandHook) run(hctx agent.HookContext, payload commandHookPayload) (commandHookDecision, error) {
+	var decision commandHookDecision
+	if cfg := hctx.Config; cfg != nil {
+		if cfg.GetSessionID != nil {
+			payload.SessionID = cfg.GetSessionID()
+		}
+		if cfg.GetWorkingDir != nil {
+			payload.Cwd = cfg.GetWorkingDir()
+		}
+	}
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return decision, err
+	}
+
+	ctx := hctx.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(cmdCtx, "/bin/sh", "-c", h.command)
+	cmd.Dir = payload.Cwd
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Kill the whole process group so a hung script cannot outlive its timeout.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if cmdCtx.Err() == context.DeadlineExceeded {
+			return decision, fmt.Errorf("%s hook timed out after %s", payload.Event, h.timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return decision, fmt.Errorf("%s hook failed: %w: %s", payload.Event, err, msg)
+		}
+		return decision, fmt.Errorf("%s hook failed: %w", payload.Event, err)
+	}
+
+	out := bytes.TrimSpace(stdout.Bytes())
+	if len(out) == 0 {
+		return decision, nil
+	}
+	if err := json.Unmarshal(out, &decision); err != nil {
+		return decision, fmt.Errorf("%s hook printed invalid JSON: %w", payload.Event, err)
+	}
+	switch decision.Decision {
+	case "", "allow", "deny":
+	default:
+		return decision, fmt.Errorf("%s hook returned unknown decision %q", payload.Event, decision.Decision)
+	}
+	return decision, nil
+}
+
+// injectedMessages converts decision messages into user messages of kind
+// "hook", so they are not mistaken for prompts.
+func injectedMessages(texts []string) []agentctx.AgentMessage {
+	var msgs []agentctx.AgentMessage
+	for _, text := range texts {
+		if strings.TrimSpace(text) != "" {
+			msgs = append(msgs, agentctx.NewUserMessage(text).WithKind("hook"))
+		}
+	}
+	return msgs
+}
+
+// beforeModel is the BeforeModelHook implementation.
+func (h *commandHook) beforeModel(hctx agent.HookContext, messages []agentctx.AgentMessage) ([]agentctx.AgentMessage, error) {
+	payload := commandHookPayload{Event: commandHookBeforeModel}
+	if len(messages) > 0 {
+		payload.LastMessage = messages[len(messages)-1].ExtractText()
+	}
+	decision, err := h.run(hctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return injectedMessages(decision.Messages), nil
+}
+
+// beforeTool is the BeforeToolHook implementation.
+func (h *commandHook) beforeTool(hctx agent.HookContext, toolName string, args map[string]any) (agent.BeforeToolDecision, error) {
+	if !h.matchesTool(toolName) {
+		return agent.BeforeToolDecision{}, nil
+	}
+	decision, err := h.run(hctx, commandHookPayload{
+		Event:    commandHookBeforeTool,
+		ToolName: toolName,
+		ToolArgs: args,
+	})
+	if err != nil {
+		if h.onFailure == commandHookFailDeny {
+			return agent.BeforeToolDecision{Deny: true, Reason: err.Error()}, nil
+		}
+		return agent.BeforeToolDecision{}, err
+	}
+	return agent.BeforeToolDecision{
+		Deny:   decision.Decision == "deny",
+		Reason: decision.Reason,
+		Args:   decision.ToolArgs,
+	}, nil
+}
+
+// afterTool is the AfterToolHook implementation. A deny decision turns the
+// result into an error carrying the hook's reason.
+func (h *commandHook) afterTool(hctx agent.HookContext, toolName string, result agentctx.AgentMessage) (agentctx.AgentMessage, error) {
+	if !h.matchesTool(toolName) {
+		return result, nil
+	}
+	text := result.ExtractText()
+	decision, err := h.run(hctx, commandHookPayload{
+		Event:      commandHookAfterTool,
+		ToolName:   toolName,
+		ToolResult: &text,
+		IsError:    result.IsError,
+	})
+	if err != nil {
+		if h.onFailure == commandHookFailDeny {
+			return replaceResult(result, "Tool result withheld: "+err.Error(), true), nil
+		}
+		return result, err
+	}
+	if decision.Decision == "deny" {
+		reason := decision.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return replaceResult(result, "Tool result withheld by hook: "+reason, true), nil
+	}
+	if decision.Result != nil {
+		return replaceResult(result, *decision.Result, result.IsError), nil
+	}
+	return result, nil
+}
+
+// replaceResult swaps the content of a tool result for a single text block.
+func replaceResult(result agentctx.AgentMessage, text string, isError bool) agentctx.AgentMessage {
+	result.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: text}}
+	result.IsError = isError
+	return result
+}
+
+// afterAgent is the AfterAgentHook implementation. Its decision is ignored.
+func (h *commandHook) afterAgent(hctx agent.HookContext) {
+	if _, err := h.run(hctx, commandHookPayload{Event: commandHookAfterAgent}); err != nil {
+		slog.Warn("[Hook] command_hook after_agent failed", "command", h.command, "error", err)
+	}
+}
+
+// sessionStart is the SessionStartHook implementation.
+func (h *commandHook) sessionStart(hctx agent.HookContext, source string) ([]agentctx.AgentMessage, error) {
+	decision, err := h.run(hctx, commandHookPayload{Event: commandHookSessionStart, Source: source})
+	if err != nil {
+		return nil, err
+	}
+	return injectedMessages(decision.Messages), nil
+}
+
+// commandHookFactory adapts newCommandHook to one hook point. It returns a
+// nil hook when the point is not in the configured events.
+func commandHookFactory[H any](event string, pick func(*commandHook) H) func(map[string]any) (H, error) {
+	return func(params map[string]any) (H, error) {
+		var zero H
+		h, err := newCommandHook(params)
+		if err != nil {
+			return zero, err
+		}
+		if !h.events[event] {
+			return zero, nil
+		}
+		return pick(h), nil
+	}
+}
+
+func init() {
+	Register(MiddlewareSpec{
+		Name: commandHookName,
+		BeforeModel: commandHookFactory(commandHookBeforeModel, func(h *commandHook) agent.BeforeModelHook {
+			return h.beforeModel
+		}),
+		BeforeTool: commandHookFactory(commandHookBeforeTool, func(h *commandHook) agent.BeforeToolHook {
+			return h.beforeTool
+		}),
+		AfterTool: commandHookFactory(commandHookAfterTool, func(h *commandHook) agent.AfterToolHook {
+			return h.afterTool
+		}),
+		AfterAgent: commandHookFactory(commandHookAfterAgent, func(h *commandHook) agent.AfterAgentHook {
+			return h.afterAgent
+		}),
+		SessionStart: commandHookFactory(commandHookSessionStart, func(h *commandHook) agent.SessionStartHook {
+			return h.sessionStart
+		}),
+	})
+}
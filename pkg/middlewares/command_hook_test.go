@@ -0,0 +1,150 @@
+package middlewares
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tiancaiamao/ai/pkg/agent"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func commandHookContext(t *testing.T) agent.HookContext {
+	dir := t.TempDir()
+	return agent.HookContext{
+		Ctx:      context.Background(),
+		AgentCtx: &agentctx.AgentContext{},
+		Config: &agent.LoopConfig{
+			GetWorkingDir: func() string { return dir },
+			GetSessionID:  func() string { return "sess-1" },
+		},
+	}
+}
+
+func buildCommandHook(t *testing.T, params map[string]any) *agent.HookRegistry {
+	t.Helper()
+	reg, err := BuildHooks([]MiddlewareEntry{{Name: commandHookName, Params: params}})
+	if err != nil {
+		t.Fatalf("BuildHooks: %v", err)
+	}
+	return reg
+}
+
+func TestCommandHookEventsSelectHookPoints(t *testing.T) {
+	reg := buildCommandHook(t, map[string]any{
+		"command": "true",
+		"events":  []any{"before_tool", "session_start"},
+	})
+	if len(reg.BeforeToolHooks) != 1 || len(reg.SessionStartHooks) != 1 {
+		t.Fatalf("expected before_tool and session_start hooks, got %+v", reg)
+	}
+	if len(reg.BeforeModelHooks) != 0 || len(reg.AfterToolHooks) != 0 || len(reg.AfterAgentHooks) != 0 {
+		t.Fatalf("unexpected hooks registered: %+v", reg)
+	}
+}
+
+func TestCommandHookInvalidParams(t *testing.T) {
+	for name, params := range map[string]map[string]any{
+		"missing command": {},
+		"unknown event":   {"command": "true", "events": []any{"on_boot"}},
+		"bad timeout":     {"command": "true", "timeout": "soon"},
+		"bad on_failure":  {"command": "true", "on_failure": "retry"},
+	} {
+		if _, err := BuildHooks([]MiddlewareEntry{{Name: commandHookName, Params: params}}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestCommandHookBeforeToolPayloadAndDeny(t *testing.T) {
+	hctx := commandHookContext(t)
+	payloadFile := filepath.Join(t.TempDir(), "payload.json")
+	reg := buildCommandHook(t, map[string]any{
+		"command": `cat > ` + payloadFile + `; echo '{"decision":"deny","reason":"no pushes"}'`,
+		"events":  []any{"before_tool"},
+		"tools":   []any{"bash"},
+	})
+
+	d := reg.RunBeforeTool(hctx, "bash", map[string]any{"command": "git push"})
+	if !d.Deny || d.Reason != "no pushes" {
+		t.Fatalf("expected deny, got %+v", d)
+	}
+	payload, err := os.ReadFile(payloadFile)
+	if err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	for _, want := range []string{`"event":"before_tool"`, `"session_id":"sess-1"`, `"tool_name":"bash"`, `"command":"git push"`} {
+		if !strings.Contains(string(payload), want) {
+			t.Errorf("payload %s missing %s", payload, want)
+		}
+	}
+
+	// Tools outside the filter never reach the script.
+	if d := reg.RunBeforeTool(hctx, "read", map[string]any{"path": "x"}); d.Deny {
+		t.Fatalf("read should not be screened, got %+v", d)
+	}
+}
+
+func TestCommandHookBeforeToolRewritesArgs(t *testing.T) {
+	reg := buildCommandHook(t, map[string]any{
+		"command": `echo '{"tool_args":{"command":"ls -la"}}'`,
+		"events":  []any{"before_tool"},
+	})
+	d := reg.RunBeforeTool(commandHookContext(t), "bash", map[string]any{"command": "ls"})
+	if d.Deny || d.Args["command"] != "ls -la" {
+		t.Fatalf("expected rewritten args, got %+v", d)
+	}
+}
+
+func TestCommandHookFailurePolicy(t *testing.T) {
+	hctx := commandHookContext(t)
+
+	allow := buildCommandHook(t, map[string]any{"command": "exit 3", "events": []any{"before_tool"}})
+	if d := allow.RunBeforeTool(hctx, "bash", map[string]any{}); d.Deny {
+		t.Fatalf("on_failure=allow should not deny, got %+v", d)
+	}
+
+	deny := buildCommandHook(t, map[string]any{
+		"command":    "sleep 5",
+		"events":     []any{"before_tool", "after_tool"},
+		"timeout":    0.2,
+		"on_failure": "deny",
+	})
+	d := deny.RunBeforeTool(hctx, "bash", map[string]any{})
+	if !d.Deny || !strings.Contains(d.Reason, "timed out") {
+		t.Fatalf("expected timeout deny, got %+v", d)
+	}
+	out := deny.RunAfterTool(hctx, "bash", makeToolResult("bash", "secret"))
+	if !out.IsError || strings.Contains(out.ExtractText(), "secret") {
+		t.Fatalf("expected withheld error result, got %+v", out)
+	}
+}
+
+func TestCommandHookAfterToolReplacesResult(t *testing.T) {
+	reg := buildCommandHook(t, map[string]any{
+		"command": `echo '{"result":"redacted"}'`,
+		"events":  []any{"after_tool"},
+	})
+	out := reg.RunAfterTool(commandHookContext(t), "bash", makeToolResult("bash", "token=abc"))
+	if out.ExtractText() != "redacted" || out.ToolName != "bash" {
+		t.Fatalf("expected replaced result, got %+v", out)
+	}
+}
+
+func TestCommandHookInjectsMessages(t *testing.T) {
+	hctx := commandHookContext(t)
+	reg := buildCommandHook(t, map[string]any{
+		"command": `echo '{"messages":["remember the style guide"]}'`,
+		"events":  []any{"before_model", "session_start"},
+	})
+
+	msgs := reg.RunSessionStart(hctx, "resume")
+	if len(msgs) != 1 || msgs[0].Role != "user" || msgs[0].ExtractText() != "remember the style guide" {
+		t.Fatalf("unexpected session start messages: %+v", msgs)
+	}
+	if n := reg.RunBeforeModel(hctx, nil); n != 1 || len(hctx.AgentCtx.RecentMessages) != 1 {
+		t.Fatalf("expected one injected message, got %d", n)
+	}
+}
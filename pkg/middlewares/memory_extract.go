@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/tiancaiamao/ai/pkg/agent"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/memory"
+)
+
+const (
+	memoryExtractName = "memory_extract"
+	// defaultMemoryExtractMinMessages skips runs too short to teach anything.
+	defaultMemoryExtractMinMessages = 6
+)
+
+// memoryExtract asks the model, after each run, which facts of the run are
+// worth remembering and stores them as proposed memories.
+type memoryExtract struct {
+	root        string
+	budget      memory.Budget
+	minMessages int
+}
+
+// newMemoryExtract parses params: dir (default ~/.ai/memory), max_entries
+// and max_bytes (the store budget), and min_messages (default 6). A host
+// passes the root and budget of its own memory store, so extraction writes
+// where the memory tools read. It returns nil when disabled is true.
+func newMemoryExtract(params map[string]any) (*memoryExtract, error) {
+	if disabled, _ := params["disabled"].(bool); disabled {
+		return nil, nil
+	}
+	h := &memoryExtract{minMessages: defaultMemoryExtractMinMessages}
+	if dir, _ := params["dir"].(string); dir != "" {
+		h.root = dir
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("resolve memory dir: %w", err)
+		}
+		h.root = filepath.Join(home, ".ai", "memory")
+	}
+	for name, dst := range map[string]*int{
+		"min_messages": &h.minMessages,
+		"max_entries":  &h.budget.MaxEntries,
+		"max_bytes":    &h.budget.MaxBytes,
+	} {
+		switch v := params[name].(type) {
+		case nil:
+		case int:
+			*dst = v
+		case float64:
+			*dst = int(v)
+		default:
+			return nil, fmt.Errorf("%s must be a number", name)
+		}
+	}
+	return h, nil
+}
+
+// afterAgent is the AfterAgentHook implementation.
+func (h *memoryExtract) afterAgent(hctx agent.HookContext) {
+	if hctx.AgentCtx == nil || hctx.Config == nil || hctx.Config.GetWorkingDir == nil {
+		return
+	}
+	run := lastRun(hctx.AgentCtx.RecentMessages)
+	if len(run) < h.minMessages {
+		return
+	}
+	model, apiKey := hctx.Config.Model, hctx.Config.APIKey
+	if hctx.Config.GetModel != nil {
+		model = hctx.Config.GetModel()
+	}
+	if hctx.Config.GetAPIKey != nil {
+		apiKey = hctx.Config.GetAPIKey()
+	}
+
+	manager := memory.NewManager(h.root, hctx.Config.GetWorkingDir, h.budget, 0)
+	index, err := manager.Index()
+	if err != nil {
+		slog.Warn("[Hook] memory_extract: read memories", "error", err)
+		return
+	}
+	proposals, err := memory.Extract(hctx.Ctx, model, apiKey, run, index)
+	if err != nil {
+		slog.Warn("[Hook] memory_extract failed", "error", err)
+		return
+	}
+	for _, p := range proposals {
+		store, err := manager.Store(p.Scope)
+		if err != nil {
+			continue
+		}
+		if _, _, err := store.Write(p.Content, nil, memory.SourceProposed); err != nil {
+			slog.Warn("[Hook] memory_extract: store proposal", "scope", p.Scope, "error", err)
+			return
+		}
+	}
+	if len(proposals) > 0 {
+		slog.Info("[Hook] memory_extract proposed memories", "count", len(proposals))
+	}
+}
+
+// lastRun returns the messages from the last user prompt on.
+func lastRun(messages []agentctx.AgentMessage) []agentctx.AgentMessage {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role == "user" && (msg.Metadata == nil || msg.Metadata.Kind == "" || msg.Metadata.Kind == "user") {
+			return messages[i:]
+		}
+	}
+	return messages
+}
+
+func init() {
+	Register(MiddlewareSpec{
+		Name: memoryExtractName,
+		AfterAgent: func(params map[string]any) (agent.AfterAgentHook, error) {
+			h, err := newMemoryExtract(params)
+			if err != nil || h == nil {
+				return nil, err
+			}
+			return h.afterAgent, nil
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func TestNewMemoryExtract(t *testing.T) {
+	h, err := newMemoryExtract(map[string]any{"dir": "/tmp/mem", "min_messages": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.root != "/tmp/mem" || h.minMessages != 3 {
+		t.Fatalf("unexpected hook %+v", h)
+	}
+	h, err = newMemoryExtract(map[string]any{"dir": "/tmp/mem", "max_entries": 50, "max_bytes": float64(4096)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.budget.MaxEntries != 50 || h.budget.MaxBytes != 4096 {
+		t.Fatalf("unexpected budget %+v", h.budget)
+	}
+	if h, err := newMemoryExtract(map[string]any{"disabled": true}); h != nil || err != nil {
+		t.Fatalf("disabled: %+v, %v", h, err)
+	}
+	if _, err := newMemoryExtract(map[string]any{"min_messages": "many"}); err == nil {
+		t.Fatal("expected error for non-numeric min_messages")
+	}
+}
+
+func TestLastRun(t *testing.T) {
+	injected := agentctx.NewUserMessage("runtime state").WithKind("runtime_state")
+	msgs := []agentctx.AgentMessage{
+		agentctx.NewUserMessage("first"),
+		agentctx.NewAssistantMessage(),
+		agentctx.NewUserMessage("second"),
+		agentctx.NewAssistantMessage(),
+		injected,
+		agentctx.NewAssistantMessage(),
+	}
+	if run := lastRun(msgs); len(run) != 4 || run[0].ExtractText() != "second" {
+		t.Fatalf("lastRun started at %q with %d messages", run[0].ExtractText(), len(run))
+	}
+}
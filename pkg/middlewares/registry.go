@@ -17,14 +17,23 @@ type AfterToolFactory func(params map[string]any) (agent.AfterToolHook, error)
 // AfterAgentFactory creates an AfterAgentHook from params.
 type AfterAgentFactory func(params map[string]any) (agent.AfterAgentHook, error)
 
+// BeforeToolFactory creates a BeforeToolHook from params.
+type BeforeToolFactory func(params map[string]any) (agent.BeforeToolHook, error)
+
+// SessionStartFactory creates a SessionStartHook from params.
+type SessionStartFactory func(params map[string]any) (agent.SessionStartHook, error)
+
 // MiddlewareSpec describes a registered middleware.
-// Any combination of the three factory fields may be set;
-// unset factories are ignored during hook construction.
+// Any combination of the factory fields may be set;
+// unset factories, and factories that return a nil hook, are ignored
+// during hook construction.
 type MiddlewareSpec struct {
-	Name        string
-	BeforeModel BeforeModelFactory
-	AfterTool   AfterToolFactory
-	AfterAgent  AfterAgentFactory
+	Name         string
+	BeforeModel  BeforeModelFactory
+	AfterTool    AfterToolFactory
+	AfterAgent   AfterAgentFactory
+	BeforeTool   BeforeToolFactory
+	SessionStart SessionStartFactory
 }
 
 var (
@@ -67,6 +76,9 @@ func buildAfterToolHooks(entries []MiddlewareEntry) ([]agent.AfterToolHook, erro
 		if err != nil {
 			return nil, fmt.Errorf("middleware %q AfterTool init: %w", e.Name, err)
 		}
+		if h == nil {
+			continue
+		}
 		hooks = append(hooks, h)
 	}
 	return hooks, nil
@@ -84,6 +96,9 @@ func buildBeforeModelHooks(entries []MiddlewareEntry) ([]agent.BeforeModelHook,
 		if err != nil {
 			return nil, fmt.Errorf("middleware %q BeforeModel init: %w", e.Name, err)
 		}
+		if h == nil {
+			continue
+		}
 		hooks = append(hooks, h)
 	}
 	return hooks, nil
@@ -101,6 +116,49 @@ func buildAfterAgentHooks(entries []MiddlewareEntry) ([]agent.AfterAgentHook, er
 		if err != nil {
 			return nil, fmt.Errorf("middleware %q AfterAgent init: %w", e.Name, err)
 		}
+		if h == nil {
+			continue
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// buildBeforeToolHooks constructs BeforeToolHook instances.
+func buildBeforeToolHooks(entries []MiddlewareEntry) ([]agent.BeforeToolHook, error) {
+	var hooks []agent.BeforeToolHook
+	for _, e := range entries {
+		spec := Lookup(e.Name)
+		if spec == nil || spec.BeforeTool == nil {
+			continue
+		}
+		h, err := spec.BeforeTool(e.Params)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %q BeforeTool init: %w", e.Name, err)
+		}
+		if h == nil {
+			continue
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// buildSessionStartHooks constructs SessionStartHook instances.
+func buildSessionStartHooks(entries []MiddlewareEntry) ([]agent.SessionStartHook, error) {
+	var hooks []agent.SessionStartHook
+	for _, e := range entries {
+		spec := Lookup(e.Name)
+		if spec == nil || spec.SessionStart == nil {
+			continue
+		}
+		h, err := spec.SessionStart(e.Params)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %q SessionStart init: %w", e.Name, err)
+		}
+		if h == nil {
+			continue
+		}
 		hooks = append(hooks, h)
 	}
 	return hooks, nil
@@ -135,6 +193,18 @@ func BuildHooks(entries []MiddlewareEntry) (*agent.HookRegistry, error) {
 	}
 	reg.AfterAgentHooks = aa
 
+	bt, err := buildBeforeToolHooks(entries)
+	if err != nil {
+		return nil, err
+	}
+	reg.BeforeToolHooks = bt
+
+	ss, err := buildSessionStartHooks(entries)
+	if err != nil {
+		return nil, err
+	}
+	reg.SessionStartHooks = ss
+
 	return reg, nil
 }
 
@@ -17,9 +17,15 @@ var promptTemplate string
 //go:embed "compact_summarize.md"
 var compactSummarizePrompt string
 
+//go:embed "compact_digest.md"
+var compactDigestPrompt string
+
 //go:embed "compact_check.md"
 var compactCheckPrompt string
 
+//go:embed "branch_summary.md"
+var branchSummaryPrompt string
+
 // CompactorBasePrompt returns a baseline system prompt used by the compactor
 // for token estimation in CalculateDynamicThreshold. This string is NOT sent
 // to the LLM as a system prompt — the compactor reuses the agent's system prompt
@@ -33,6 +39,18 @@ func CompactSummarizePrompt() string {
 	return compactSummarizePrompt
 }
 
+// CompactDigestPrompt returns the prompt that merges segment summaries into
+// the session digest.
+func CompactDigestPrompt() string {
+	return compactDigestPrompt
+}
+
+// BranchSummaryPrompt returns the prompt that summarizes another branch of
+// the conversation for /merge-branch.
+func BranchSummaryPrompt() string {
+	return branchSummaryPrompt
+}
+
 // ToolInfo describes a tool for prompt generation.
 type ToolInfo interface {
 	Name() string
@@ -16,6 +16,18 @@ func TestCompactSummarizePrompt(t *testing.T) {
 	}
 }
 
+func TestCompactDigestPrompt(t *testing.T) {
+	if !strings.Contains(CompactDigestPrompt(), "session digest") {
+		t.Error("CompactDigestPrompt should ask for a session digest")
+	}
+}
+
+func TestBranchSummaryPrompt(t *testing.T) {
+	if !strings.Contains(BranchSummaryPrompt(), "another branch") {
+		t.Error("BranchSummaryPrompt should ask for a summary of another branch")
+	}
+}
+
 func TestCompactCheckPrompt(t *testing.T) {
 	p := CompactCheckPrompt()
 	if strings.TrimSpace(p) == "" {
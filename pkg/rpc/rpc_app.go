@@ -16,6 +16,7 @@ import (
 	"github.com/tiancaiamao/ai/pkg/config"
 	agentctx "github.com/tiancaiamao/ai/pkg/context"
 	"github.com/tiancaiamao/ai/pkg/llm"
+	"github.com/tiancaiamao/ai/pkg/memory"
 	"github.com/tiancaiamao/ai/pkg/session"
 	"github.com/tiancaiamao/ai/pkg/skill"
 	"github.com/tiancaiamao/ai/pkg/tools"
@@ -60,10 +61,24 @@ type rpcApp struct {
 	// --- Workspace & Tools ---
 	ws       *tools.Workspace
 	registry *tools.Registry
+	askUser  *tools.AskUserTool
+	memory   *memory.Manager // nil when disabled in config
+	// middlewareDefaults are host params for agent.yaml middlewares, such
+	// as the memory store memory_extract writes to.
+	middlewareDefaults map[string]map[string]any
 
 	// --- Compaction ---
 	compactor       *compact.Compactor
 	compactorConfig *compact.Config
+	// compactionStrategy is the agent.yaml compaction strategy; see
+	// loopCompactor.
+	compactionStrategy string
+	// compactionModel is the resolved compactor.model; nil means compaction
+	// calls use the agent's model.
+	compactionModel *resolvedCompactionModel
+	// titleModel is the resolved titles.model; nil means session titles
+	// use the compaction model, or are off without one.
+	titleModel *resolvedCompactionModel
 
 	// --- Tracing ---
 	traceOutputPath string
@@ -109,6 +124,13 @@ type rpcApp struct {
 	showTools             bool
 	showPrefix            bool
 	busyMode              string
+	titleTried            map[string]bool // sessions titleAfterAgent has handled
+	// compactionUsage meters compaction calls per session ID. It is kept
+	// here, not on the compactor, which is rebuilt on model and session
+	// switches.
+	compactionUsage map[string]*compact.UsageMeter
+	// titleUsage meters title calls per session ID.
+	titleUsage map[string]*compact.UsageMeter
 }
 
 // parseJSONArgs attempts to unmarshal args as JSON into target.
@@ -143,7 +165,13 @@ func (app *rpcApp) initEventEmitter() (chan struct{}, chan struct{}) {
 			// Session persistence is handled incrementally:
 			// - message_end/tool_execution_end → sessionWriter.Append (per message)
 			// - compaction_end → sess.AppendCompaction (snapshot + entry)
+			// - agent_end with a verify result → sess.AppendVerify
 			// No Replace needed — messages.jsonl is append-only.
+			if event.Verify != nil && app.sess != nil {
+				if _, err := app.sess.AppendVerify(event.Verify); err != nil {
+					slog.Error("Failed to persist verify entry", "error", err)
+				}
+			}
 		}
 		if event.Type == "compaction_start" {
 			app.stateMu.Lock()
@@ -392,6 +420,11 @@ func (app *rpcApp) handlePrompt(cmd RPCCommand) (any, error) {
 		return handler(args)
 	}
 
+	// A plain message while ask_user is waiting is the answer, not a steer.
+	if app.askUser != nil && len(app.askUser.Pending()) > 0 {
+		return app.answerQuestion("", message)
+	}
+
 	app.stateMu.Lock()
 	streaming := app.isStreaming
 	mode := app.steeringMode
@@ -440,7 +473,10 @@ func (app *rpcApp) registerHandlers(
 
 	// === Slash command handlers (topic-specific registration) ===
 	app.registerSessionHandlers()
+	app.registerBranchHandlers()
 	app.registerMessageHandlers()
+	app.registerContextHandlers()
+	app.registerMemoryHandlers()
 	app.registerConfigHandlers(validToolSummaryAutomations, validSteeringModes, validFollowUpModes, validThinkingLevels)
 	app.registerHelpHandlers()
 }
@@ -0,0 +1,139 @@
+package rpc
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/tiancaiamao/ai/pkg/compact"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+// --- Branch handlers: /branches, /diff-branch, /merge-branch ---
+//
+// A branch is a leaf of the session tree, in this session or in a session
+// forked from the same conversation. Branches are named by their index in
+// /branches, their leaf entry ID, "<sessionId>:<leafId>", or a session ID
+// or name (that session's latest leaf).
+
+func (app *rpcApp) listBranches() ([]session.BranchInfo, error) {
+	branches, err := session.ListBranches(app.sess, app.sessionMgr)
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("no branches: the session has no messages")
+	}
+	return branches, nil
+}
+
+func (app *rpcApp) handleBranches(args string) (any, error) {
+	_ = args
+	branches, err := app.listBranches()
+	if err != nil {
+		return nil, err
+	}
+	return &BranchesResult{Branches: branches}, nil
+}
+
+// handleDiffBranch compares two branches. Accepts "<A> [B]" or JSON
+// {"a": "...", "b": "..."}; B defaults to the current branch.
+func (app *rpcApp) handleDiffBranch(args string) (any, error) {
+	var jsonData struct {
+		A string `json:"a"`
+		B string `json:"b"`
+	}
+	refs := strings.Fields(args)
+	if app.parseJSONArgs(args, &jsonData) {
+		refs = []string{jsonData.A}
+		if jsonData.B != "" {
+			refs = append(refs, jsonData.B)
+		}
+	}
+	if len(refs) == 0 || refs[0] == "" || len(refs) > 2 {
+		return nil, fmt.Errorf("usage: /diff-branch <A> [B]  (B defaults to the current branch; use /branches to list them)")
+	}
+	branches, err := app.listBranches()
+	if err != nil {
+		return nil, err
+	}
+	a, err := session.ResolveBranch(branches, refs[0])
+	if err != nil {
+		return nil, err
+	}
+	b := branches[0]
+	if len(refs) == 2 {
+		if b, err = session.ResolveBranch(branches, refs[1]); err != nil {
+			return nil, err
+		}
+	}
+	return session.DiffBranches(a, b), nil
+}
+
+// handleMergeBranch summarizes another branch after it diverged from the
+// current one and appends the summary, with the files that branch changed,
+// to the current branch as a branch summary. Accepts "<ref>" or JSON
+// {"branch": "..."}.
+func (app *rpcApp) handleMergeBranch(args string) (any, error) {
+	var jsonData struct {
+		Branch string `json:"branch"`
+	}
+	ref := strings.TrimSpace(args)
+	if app.parseJSONArgs(args, &jsonData) {
+		ref = jsonData.Branch
+	}
+	if ref == "" {
+		return nil, fmt.Errorf("usage: /merge-branch <branch>  (use /branches to list them)")
+	}
+	if err := app.checkIdle(); err != nil {
+		return nil, err
+	}
+	branches, err := app.listBranches()
+	if err != nil {
+		return nil, err
+	}
+	from, err := session.ResolveBranch(branches, ref)
+	if err != nil {
+		return nil, err
+	}
+	if from.Current {
+		return nil, fmt.Errorf("branch %s is the current branch", ref)
+	}
+	messages := from.MessagesAfter(from.ForkPoint)
+	summary := app.summarizeMessages("merge_branch_summary", messages, func(c *compact.Compactor) summaryFunc {
+		return c.GenerateBranchSummary
+	})
+	if summary == "" {
+		return nil, fmt.Errorf("nothing to merge: branch %s has no messages after the fork point", ref)
+	}
+	files := session.FileChanges(messages)
+	text := strings.TrimSpace(summary)
+	if len(files) > 0 {
+		text += "\n\nFiles changed on that branch:\n" + session.FormatFileChanges(files)
+	}
+
+	msg, err := app.sess.AppendBranchSummary(from.Ref, text)
+	if err != nil {
+		return nil, err
+	}
+	app.ag.EditMessages(func(messages []agentctx.AgentMessage) []agentctx.AgentMessage {
+		return append(messages, msg)
+	})
+	slog.Info("Merged branch", "from", from.Ref, "entryId", msg.EntryID, "files", len(files))
+	return &MergeBranchResult{Merged: from.Ref, EntryID: msg.EntryID, Summary: text, Files: files}, nil
+}
+
+func (app *rpcApp) registerBranchHandlers() {
+	app.server.RegisterSlash("branches", "List the branches of this conversation, including forked sessions", func(args string) (any, error) {
+		return app.handleBranches(args)
+	})
+
+	app.server.RegisterSlash("diff-branch", "Compare two branches: /diff-branch <A> [B]", func(args string) (any, error) {
+		return app.handleDiffBranch(args)
+	})
+
+	app.server.RegisterSlash("merge-branch", "Bring another branch's conclusions into the current one as a summary", func(args string) (any, error) {
+		return app.handleMergeBranch(args)
+	})
+}
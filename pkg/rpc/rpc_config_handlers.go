@@ -9,6 +9,7 @@ import (
 	"github.com/tiancaiamao/ai/pkg/agent"
 	"github.com/tiancaiamao/ai/pkg/compact"
 	"github.com/tiancaiamao/ai/pkg/config"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
 	"github.com/tiancaiamao/ai/pkg/llm"
 	traceevent "github.com/tiancaiamao/ai/pkg/traceevent"
 )
@@ -28,7 +29,7 @@ func (app *rpcApp) getSessionStats() (*SessionStats, error) {
 	activeWindowTokens := agent.EstimateConversationTokens(app.ag.GetMessages())
 	tokens.ActiveWindowTokens = activeWindowTokens + tokens.SystemPromptTokens + tokens.SystemToolsTokens
 
-	return &SessionStats{
+	stats := &SessionStats{
 		SessionFile:       app.sess.GetPath(),
 		SessionID:         app.sessionID,
 		UserMessages:      userCount,
@@ -42,7 +43,51 @@ func (app *rpcApp) getSessionStats() (*SessionStats, error) {
 		Cost:           cost,
 		Workspace:      app.ws.GetGitRoot(),
 		CurrentWorkdir: app.ws.GetCWD(),
-	}, nil
+	}
+	// Compaction and title calls are not session messages: add their cost.
+	if usage := app.usageMeter(app.sessionID).Usage(); usage.Calls > 0 {
+		stats.CompactionUsage = &usage
+		stats.Cost += usage.Cost
+	}
+	if usage := app.titleMeter(app.sessionID).Usage(); usage.Calls > 0 {
+		stats.TitleUsage = &usage
+		stats.Cost += usage.Cost
+	}
+	return stats, nil
+}
+
+// defaultBreakdownTop is how many of the largest messages a context
+// breakdown lists when the caller does not say.
+const defaultBreakdownTop = 10
+
+// contextBreakdown estimates what the current context is made of. Message
+// indices match /messages, so the largest ones can be pinned or forked at.
+func (app *rpcApp) contextBreakdown(topN int) *ContextBreakdown {
+	actx := app.ag.GetContext()
+	return &ContextBreakdown{
+		TokenBreakdown: agentctx.BreakdownTokens(app.systemPrompt, app.agentContextPrefix, actx.Tools, app.ag.GetMessages(), topN),
+		ContextWindow:  app.currentContextWindow,
+	}
+}
+
+// handleContextBreakdown parses "[N]" or {"top": N} for the breakdown.
+func (app *rpcApp) handleContextBreakdown(args string) (any, error) {
+	var jsonData struct {
+		Top int `json:"top"`
+	}
+	topN := defaultBreakdownTop
+	if app.parseJSONArgs(args, &jsonData) {
+		if jsonData.Top > 0 {
+			topN = jsonData.Top
+		}
+	} else if arg := strings.TrimSpace(args); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("usage: /context --breakdown [N]  (N = number of largest messages to list)")
+		}
+		topN = n
+	}
+	return map[string]any{"breakdown": app.contextBreakdown(topN)}, nil
 }
 
 func (app *rpcApp) getCurrentAILogPath() string {
@@ -107,6 +152,7 @@ func (app *rpcApp) handleModelSet(args string) (any, error) {
 		MaxTokens:      spec.MaxTokens,
 		Reasoning:      spec.Reasoning,
 		SupportsVision: spec.SupportsVision,
+		Cost:           spec.Cost,
 	}
 	app.apiKey = newAPIKey
 
@@ -121,9 +167,12 @@ func (app *rpcApp) handleModelSet(args string) (any, error) {
 
 	// Recreate compactor with new model
 	app.compactor = compact.NewCompactor(app.compactorConfig, app.model, app.apiKey, app.systemPrompt, spec.ContextWindow, app.sess.GetDir())
+	app.compactionModel.apply(app.compactor)
+	app.compactor.SetUsageMeter(app.usageMeter(app.sessionID))
 	app.compactor.SetAgentContextPrefix(app.agentContextPrefix)
 	app.compactor.SetThinkingLevel(app.currentThinkingLevel)
-	app.sessionComp.Update(app.compactor)
+	app.compactor.SetStalePolicy(app.stalePolicy(), app.ws.GetCWD)
+	app.sessionComp.Update(app.loopCompactor())
 	app.ag.SetCompactor(app.sessionComp)
 	app.ag.SetContextWindow(spec.ContextWindow)
 
@@ -392,10 +441,19 @@ func (app *rpcApp) handleShowSettings() (any, error) {
 		ThinkingLevel:  app.currentThinkingLevel,
 		BusyMode:       app.busyMode,
 		AutoCompaction: app.autoCompactionEnabled,
-		Compaction:     compact.BuildCompactionState(app.compactorConfig, app.compactor),
+		Compaction:     app.compactionState(),
 	}), nil
 }
 
+// compactionState snapshots the compaction settings and strategy.
+func (app *rpcApp) compactionState() *compact.CompactionState {
+	state := compact.BuildCompactionState(app.compactorConfig, app.compactor)
+	if state != nil {
+		state.Strategy = app.compactionStrategy
+	}
+	return state
+}
+
 func (app *rpcApp) handleSetAutoRetry(value string) (any, error) {
 	val := ParseBoolFromInput(value, "enabled")
 	app.ag.SetAutoRetry(val)
@@ -585,8 +643,10 @@ func (app *rpcApp) registerConfigHandlers(validToolSummaryAutomations, validStee
 		return app.handleShow(args)
 	})
 
-	app.server.RegisterSlash("context", "Show current state, session stats, and available models", func(args string) (any, error) {
-		_ = args
+	app.server.RegisterSlash("context", "Show current state, session stats, and available models (--breakdown [N]: tokens by category)", func(args string) (any, error) {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(args), "--breakdown"); ok {
+			return app.handleContextBreakdown(rest)
+		}
 		stateH, _ := app.server.GetSlashHandler("session")
 		statsH, _ := app.server.GetSlashHandler("get_session_stats")
 		modelsH, _ := app.server.GetSlashHandler("model")
@@ -602,9 +662,14 @@ func (app *rpcApp) registerConfigHandlers(validToolSummaryAutomations, validStee
 			"state":  stateResult,
 			"stats":  statsResult,
 			"models": modelsResult,
+			"pinned": app.pinnedContext(),
 		}, nil
 	})
 
+	app.server.RegisterHiddenSlash("get_context_breakdown", "Get context token breakdown (internal)", func(args string) (any, error) {
+		return app.handleContextBreakdown(args)
+	})
+
 	// get_session_stats
 	app.server.RegisterHiddenSlash("get_session_stats", "Get session stats (internal)", func(args string) (any, error) {
 		return app.getSessionStats()
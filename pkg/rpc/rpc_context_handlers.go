@@ -0,0 +1,270 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/tiancaiamao/ai/pkg/compact"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+	traceevent "github.com/tiancaiamao/ai/pkg/traceevent"
+)
+
+// --- Context edit handlers: /drop, /collapse, /replace ---
+//
+// Each edit is recorded as a context_edit session entry before it is applied
+// to the agent's messages, so it survives resume and fork. Hidden messages
+// stay in the session and remain visible to the user.
+
+// checkIdle rejects context edits while the agent runs: the loop owns the
+// messages until the turn ends.
+func (app *rpcApp) checkIdle() error {
+	app.stateMu.Lock()
+	streaming := app.isStreaming
+	app.stateMu.Unlock()
+	if streaming {
+		return fmt.Errorf("agent is busy")
+	}
+	return nil
+}
+
+// applyContextEdit persists edit and applies it to the agent's messages.
+func (app *rpcApp) applyContextEdit(edit *session.ContextEdit) (string, error) {
+	if _, err := session.ApplyContextEdit(app.ag.GetMessages(), "", edit); err != nil {
+		return "", err
+	}
+	entryID, err := app.sess.AppendContextEdit(edit)
+	if err != nil {
+		return "", fmt.Errorf("persist %s: %w", edit.Op, err)
+	}
+	var applyErr error
+	app.ag.EditMessages(func(messages []agentctx.AgentMessage) []agentctx.AgentMessage {
+		edited, err := session.ApplyContextEdit(messages, entryID, edit)
+		applyErr = err
+		return edited
+	})
+	return entryID, applyErr
+}
+
+// handleDrop hides a message from the agent. Accepts "<index|entryId>" or
+// JSON {"entryId": "..."}.
+func (app *rpcApp) handleDrop(args string) (any, error) {
+	var jsonData struct {
+		EntryID string `json:"entryId"`
+	}
+	target := strings.TrimSpace(args)
+	if app.parseJSONArgs(args, &jsonData) {
+		target = jsonData.EntryID
+	}
+	if target == "" {
+		return nil, fmt.Errorf("usage: /drop <index|entryId>  (use /messages to see indices)")
+	}
+	if err := app.checkIdle(); err != nil {
+		return nil, err
+	}
+	messages := app.ag.GetMessages()
+	index, ok := findMessage(messages, target)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", target)
+	}
+	msg := messages[index]
+	entryID, err := app.applyContextEdit(&session.ContextEdit{
+		Op:      session.ContextEditDrop,
+		Targets: []session.MessageRef{session.NewMessageRef(msg)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"index":       index,
+		"entryId":     msg.EntryID,
+		"editEntryId": entryID,
+		"tokensFreed": agentctx.EstimateMessageTokens(msg),
+	}, nil
+}
+
+// handleReplace replaces the content of a tool result. Accepts
+// "<index|entryId> <text>" or JSON {"entryId": "...", "text": "..."}.
+func (app *rpcApp) handleReplace(args string) (any, error) {
+	var jsonData struct {
+		EntryID string `json:"entryId"`
+		Text    string `json:"text"`
+	}
+	target, text, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if app.parseJSONArgs(args, &jsonData) {
+		target, text = jsonData.EntryID, jsonData.Text
+	}
+	text = strings.TrimSpace(text)
+	if target == "" || text == "" {
+		return nil, fmt.Errorf("usage: /replace <index|entryId> <new content>")
+	}
+	if err := app.checkIdle(); err != nil {
+		return nil, err
+	}
+	messages := app.ag.GetMessages()
+	index, ok := findMessage(messages, target)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", target)
+	}
+	msg := messages[index]
+	if msg.Role != "toolResult" {
+		return nil, fmt.Errorf("message %s is a %s message; only tool results can be replaced", target, msg.Role)
+	}
+	entryID, err := app.applyContextEdit(&session.ContextEdit{
+		Op:      session.ContextEditReplace,
+		Targets: []session.MessageRef{session.NewMessageRef(msg)},
+		Text:    text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"index":        index,
+		"entryId":      msg.EntryID,
+		"editEntryId":  entryID,
+		"tokensBefore": agentctx.EstimateMessageTokens(msg),
+		"tokensAfter":  (len(text) + 3) / 4,
+	}, nil
+}
+
+// handleCollapse replaces a range of messages with a summary. Accepts
+// "<from> <to> [summary]" or JSON {"from": "...", "to": "...", "summary": "..."}.
+// Without a summary, one is generated by the compaction model.
+func (app *rpcApp) handleCollapse(args string) (any, error) {
+	var jsonData struct {
+		From    string `json:"from"`
+		To      string `json:"to"`
+		Summary string `json:"summary"`
+	}
+	fields := strings.SplitN(strings.TrimSpace(args), " ", 3)
+	for len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	from, to, summary := fields[0], fields[1], fields[2]
+	if app.parseJSONArgs(args, &jsonData) {
+		from, to, summary = jsonData.From, jsonData.To, jsonData.Summary
+	}
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("usage: /collapse <from> <to> [summary]  (indices or entry IDs; use /messages to see indices)")
+	}
+	if err := app.checkIdle(); err != nil {
+		return nil, err
+	}
+	messages := app.ag.GetMessages()
+	first, ok := findMessage(messages, from)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", from)
+	}
+	last, ok := findMessage(messages, to)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", to)
+	}
+	if last < first {
+		first, last = last, first
+	}
+	first, last = expandToToolPairs(messages, first, last)
+
+	collapsed := messages[first : last+1]
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		summary = app.summarizeRange(collapsed)
+	}
+	if summary == "" {
+		return nil, fmt.Errorf("nothing to collapse: no agent-visible messages in range")
+	}
+
+	tokens := 0
+	for _, msg := range collapsed {
+		tokens += agentctx.EstimateMessageTokens(msg)
+	}
+	entryID, err := app.applyContextEdit(&session.ContextEdit{
+		Op: session.ContextEditCollapse,
+		Targets: []session.MessageRef{
+			session.NewMessageRef(messages[first]),
+			session.NewMessageRef(messages[last]),
+		},
+		Text: summary,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"from":         first,
+		"to":           last,
+		"editEntryId":  entryID,
+		"tokensBefore": tokens,
+		"tokensAfter":  (len(summary) + 3) / 4,
+		"summary":      summary,
+	}, nil
+}
+
+// expandToToolPairs widens [first, last] so that no tool call is separated
+// from its results: a range may not start on a tool result or end before the
+// results of its last tool call.
+func expandToToolPairs(messages []agentctx.AgentMessage, first, last int) (int, int) {
+	for first > 0 && messages[first].Role == "toolResult" {
+		first--
+	}
+	for last+1 < len(messages) && messages[last+1].Role == "toolResult" {
+		last++
+	}
+	return first, last
+}
+
+// summarizeRange asks the compaction model to summarize messages, falling
+// back to the extractive digest. Returns "" if no message is agent-visible.
+func (app *rpcApp) summarizeRange(messages []agentctx.AgentMessage) string {
+	return app.summarizeMessages("collapse_summary", messages, func(c *compact.Compactor) summaryFunc {
+		return c.GenerateSummary
+	})
+}
+
+// summaryFunc is the signature of the Compactor summary methods.
+type summaryFunc func(ctx context.Context, messages []agentctx.AgentMessage, systemPrompt, contextPrefix string, tools []agentctx.Tool) (string, error)
+
+// summarizeMessages summarizes the agent-visible messages with the
+// compactor method chosen by generate, in a detached trace span, falling
+// back to the extractive digest.
+func (app *rpcApp) summarizeMessages(spanName string, messages []agentctx.AgentMessage, generate func(*compact.Compactor) summaryFunc) string {
+	var visible []agentctx.AgentMessage
+	for _, msg := range messages {
+		if msg.IsAgentVisible() {
+			visible = append(visible, msg)
+		}
+	}
+	if len(visible) == 0 {
+		return ""
+	}
+	if app.compactor == nil || app.compactionStrategy == compact.StrategyExtractive {
+		return compact.ExtractiveSummary(visible)
+	}
+	var summary string
+	err := runDetachedTraceSpan(spanName, traceevent.CategoryEvent, nil,
+		func(ctx context.Context, span *traceevent.Span) error {
+			actx := app.ag.GetContext()
+			var err error
+			summary, err = generate(app.compactor)(ctx, visible, actx.SystemPrompt, app.agentContextPrefix, actx.Tools)
+			return err
+		})
+	if err != nil {
+		slog.Warn("Summary generation failed, using extractive summary", "span", spanName, "error", err)
+		return compact.ExtractiveSummary(visible)
+	}
+	return summary
+}
+
+func (app *rpcApp) registerContextHandlers() {
+	app.server.RegisterSlash("drop", "Hide a message from the agent (kept in the session)", func(args string) (any, error) {
+		return app.handleDrop(args)
+	})
+
+	app.server.RegisterSlash("collapse", "Replace a range of messages with a summary (generated if omitted)", func(args string) (any, error) {
+		return app.handleCollapse(args)
+	})
+
+	app.server.RegisterSlash("replace", "Replace the content of a tool result", func(args string) (any, error) {
+		return app.handleReplace(args)
+	})
+}
@@ -5,9 +5,13 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/tiancaiamao/ai/pkg/compact"
 	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
 	"github.com/tiancaiamao/ai/pkg/skill"
+	"github.com/tiancaiamao/ai/pkg/tools"
 )
 
 // --- sessionCompactor ---
@@ -63,6 +67,30 @@ func TestSessionCompactorDelegation(t *testing.T) {
 	}
 }
 
+func TestLoopCompactor(t *testing.T) {
+	app := &rpcApp{}
+	if app.loopCompactor() != nil {
+		t.Error("expected no loop compactor without a compactor")
+	}
+
+	app.compactor = compact.NewCompactor(compact.DefaultConfig(), llm.Model{}, "", "", 200000, t.TempDir())
+	fallback, ok := app.loopCompactor().(*compact.FallbackCompactor)
+	if !ok {
+		t.Fatalf("default strategy: got %T, want *compact.FallbackCompactor", app.loopCompactor())
+	}
+	if fallback.Primary != app.compactor {
+		t.Error("fallback compactor does not run the LLM compactor first")
+	}
+	if _, ok := fallback.Fallback.(*compact.ExtractiveCompactor); !ok {
+		t.Errorf("fallback: got %T, want *compact.ExtractiveCompactor", fallback.Fallback)
+	}
+
+	app.compactionStrategy = compact.StrategyExtractive
+	if _, ok := app.loopCompactor().(*compact.ExtractiveCompactor); !ok {
+		t.Errorf("extractive strategy: got %T, want *compact.ExtractiveCompactor", app.loopCompactor())
+	}
+}
+
 // --- expandSkillCommands ---
 
 func TestExpandSkillCommandsNilResult(t *testing.T) {
@@ -151,6 +179,46 @@ func TestHandleAbortSlashNotStreaming(t *testing.T) {
 	}
 }
 
+func TestHandleAnswerRoutesToPendingQuestion(t *testing.T) {
+	asked := make(chan tools.UserQuestion, 2)
+	app := &rpcApp{askUser: tools.NewAskUserTool(time.Minute, "fallback", func(q tools.UserQuestion) { asked <- q })}
+
+	if _, err := app.handleAnswerSlash(""); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("empty answer should fail with usage error, got %v", err)
+	}
+	if _, err := app.handleAnswerSlash("yes"); err == nil || !strings.Contains(err.Error(), "no pending question") {
+		t.Errorf("answer without question should fail, got %v", err)
+	}
+
+	results := make(chan string, 2)
+	for _, question := range []string{"first?", "second?"} {
+		go func() {
+			res, err := app.askUser.Execute(context.Background(), map[string]any{"question": question})
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- res[0].(agentctx.TextContent).Text
+		}()
+		<-asked
+	}
+
+	// Answer the second question explicitly by id, then the first as a plain prompt.
+	second := app.askUser.Pending()[1].ID
+	if _, err := app.handleAnswerSlash(second + " by id"); err != nil {
+		t.Fatalf("answer by id: %v", err)
+	}
+	if got := <-results; got != "User answered: by id" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+	if _, err := app.handlePrompt(RPCCommand{Type: "prompt", Message: "plain reply"}); err != nil {
+		t.Fatalf("plain prompt while question pending: %v", err)
+	}
+	if got := <-results; got != "User answered: plain reply" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+}
+
 func TestHandleRewindUsage(t *testing.T) {
 	app := &rpcApp{}
 	if _, err := app.handleRewind(""); err == nil || !strings.Contains(err.Error(), "usage") {
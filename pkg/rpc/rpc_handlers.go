@@ -10,6 +10,7 @@ import (
 
 	"github.com/tiancaiamao/ai/pkg/agent"
 	"github.com/tiancaiamao/ai/pkg/config"
+	"github.com/tiancaiamao/ai/pkg/session"
 )
 
 // Global channel for signal-triggered agent abort.
@@ -26,15 +27,24 @@ func AgentAbort() {
 	})
 }
 
-func RunRPC(sessionPath string, debugAddr string, input io.Reader, output io.Writer, customSystemPrompt string, maxTurns int, timeout time.Duration, role string, modelOverride string, runID string) error {
+func RunRPC(sessionPath string, debugAddr string, input io.Reader, output io.Writer, customSystemPrompt string, maxTurns int, timeout time.Duration, role string, modelOverride string, runID string, readOnly bool, forceTakeover bool) error {
+	return RunRPCWithStore(nil, sessionPath, debugAddr, input, output, customSystemPrompt, maxTurns, timeout, role, modelOverride, runID, readOnly, forceTakeover)
+}
+
+// RunRPCWithStore is RunRPC with sessions kept in store. sessionPath is then
+// a session ID. A nil store keeps sessions as files under ~/.ai/sessions.
+func RunRPCWithStore(store session.SessionStore, sessionPath string, debugAddr string, input io.Reader, output io.Writer, customSystemPrompt string, maxTurns int, timeout time.Duration, role string, modelOverride string, runID string, readOnly bool, forceTakeover bool) error {
 	// --- Construct rpcApp (config, model, session, tools, compactor, skills) ---
 	app, err := newRPCApp(sessionPath, rpcAppSetupParams{
+		store:              store,
 		customSystemPrompt: customSystemPrompt,
 		maxTurns:           maxTurns,
 		debugAddr:          debugAddr,
 		role:               role,
 		modelOverride:      modelOverride,
 		runID:              runID,
+		readOnly:           readOnly,
+		forceTakeover:      forceTakeover,
 	})
 	if err != nil {
 		return err
@@ -52,10 +62,16 @@ func RunRPC(sessionPath string, debugAddr string, input io.Reader, output io.Wri
 	}
 
 	// --- Pre-config: sessionWriter, sessionComp, executor, toolOutputConfig ---
-	sessionWriter := newSessionWriter(256)
+	// A takeover is reported as an error event, so the TUI and
+	// `ai send --wait` show that the session is no longer saved.
+	sessionWriter := newSessionWriter(256, func(err error) {
+		if app.server != nil {
+			app.server.EmitEvent(agent.NewErrorEvent(err))
+		}
+	})
 	defer sessionWriter.Close()
 	sessionComp := &sessionCompactor{
-		compactor: app.compactor,
+		compactor: app.loopCompactor(),
 	}
 	app.sessionWriter = sessionWriter
 	app.sessionComp = sessionComp
@@ -76,8 +92,7 @@ func RunRPC(sessionPath string, debugAddr string, input io.Reader, output io.Wri
 	app.toolOutputConfig = toolOutputConfig
 
 	// Build LoopConfig with all settings
-	// Note: proactiveCompactor and sessionComp both wrap the same underlying *compact.Compactor
-	// We only need one; sessionComp provides thread-safe swapping capability
+	// sessionComp provides thread-safe swapping of the loop compactor.
 	loopCfg := app.cfg.ToLoopConfig(
 		config.WithCompactor(sessionComp),
 		config.WithContextWindow(app.currentContextWindow),
@@ -95,11 +110,11 @@ func RunRPC(sessionPath string, debugAddr string, input io.Reader, output io.Wri
 	loopCfg.GetStartupPath = app.ws.GetInitialCWD
 	loopCfg.RunID = app.runID
 	loopCfg.AgentContextPrefix = app.agentContextPrefix
-	loopCfg.GetSessionDir = func() string {
-		if app.sess != nil {
-			return app.sess.GetDir()
-		}
-		return ""
+	loopCfg.GetSessionDir = app.sessionDir
+	loopCfg.GetSessionID = func() string {
+		app.stateMu.Lock()
+		defer app.stateMu.Unlock()
+		return app.sessionID
 	}
 
 	// Set max turns limit if specified
@@ -110,7 +125,15 @@ func RunRPC(sessionPath string, debugAddr string, input io.Reader, output io.Wri
 
 	// Apply agent config hooks if available
 	if app.agentConfig != nil {
-		loopCfg.Hooks = app.agentConfig.BuildHooks()
+		loopCfg.Hooks = app.agentConfig.BuildHooksWithDefaults(app.middlewareDefaults)
+		loopCfg.Verify = app.agentConfig.BuildVerify()
+		loopCfg.Stale = app.agentConfig.BuildStale()
+	}
+	if app.titlesEnabled() {
+		if loopCfg.Hooks == nil {
+			loopCfg.Hooks = &agent.HookRegistry{}
+		}
+		loopCfg.Hooks.AfterAgentHooks = append(loopCfg.Hooks.AfterAgentHooks, app.titleAfterAgent)
 	}
 
 	app.loopCfg = loopCfg
@@ -120,6 +143,7 @@ func RunRPC(sessionPath string, debugAddr string, input io.Reader, output io.Wri
 	defer ag.Shutdown()
 	ag.SetThinkingLevel(app.cfg.ThinkingLevel)
 	app.ag = ag
+	app.runSessionStartHooks("startup")
 
 	slog.Info("Auto-compact enabled", "maxMessages", app.compactorConfig.MaxMessages, "maxTokens", app.compactorConfig.MaxTokens)
 	slog.Info("Concurrency control enabled", "maxConcurrentTools", concurrencyConfig.MaxConcurrentTools)
@@ -40,6 +40,40 @@ func (app *rpcApp) handleSteerSlash(args string) (any, error) {
 	return map[string]any{"status": "steered"}, nil
 }
 
+// handleAnswerSlash answers a pending ask_user question. Accepts
+// "/answer [id] <text>" or JSON {"id": "...", "answer": "..."}.
+func (app *rpcApp) handleAnswerSlash(args string) (any, error) {
+	var data struct {
+		ID     string `json:"id"`
+		Answer string `json:"answer"`
+	}
+	if !app.parseJSONArgs(args, &data) {
+		data.Answer = strings.TrimSpace(args)
+		if id, rest, ok := strings.Cut(data.Answer, " "); ok && app.isPendingQuestion(id) {
+			data.ID, data.Answer = id, rest
+		}
+	}
+	if strings.TrimSpace(data.Answer) == "" {
+		return nil, fmt.Errorf("usage: /answer [id] <text>")
+	}
+	if app.askUser == nil {
+		return nil, fmt.Errorf("no pending question")
+	}
+	return app.answerQuestion(data.ID, data.Answer)
+}
+
+func (app *rpcApp) isPendingQuestion(id string) bool {
+	if app.askUser == nil {
+		return false
+	}
+	for _, q := range app.askUser.Pending() {
+		if q.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (app *rpcApp) handleFollowUpSlash(args string) (any, error) {
 	message := strings.TrimSpace(args)
 	if message == "" {
@@ -111,6 +145,11 @@ func (app *rpcApp) registerHelpHandlers() {
 		return app.handleSteerSlash(args)
 	})
 
+	// /answer
+	app.server.RegisterSlash("answer", "Answer a pending ask_user question", func(args string) (any, error) {
+		return app.handleAnswerSlash(args)
+	})
+
 	// /abort
 	app.server.RegisterSlash("abort", "Abort the current agent execution", func(args string) (any, error) {
 		return app.handleAbortSlash(args)
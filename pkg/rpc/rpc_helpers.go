@@ -1,13 +1,22 @@
 package rpc
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/tiancaiamao/ai/pkg/agent"
+	"github.com/tiancaiamao/ai/pkg/agentconfig"
+	"github.com/tiancaiamao/ai/pkg/config"
 	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
 	"github.com/tiancaiamao/ai/pkg/prompt"
 	"github.com/tiancaiamao/ai/pkg/session"
 	"github.com/tiancaiamao/ai/pkg/skill"
+	"github.com/tiancaiamao/ai/pkg/tools"
 )
 
 func (app *rpcApp) buildSystemPrompt(currentSess *session.Session) string {
@@ -51,6 +60,18 @@ func (app *rpcApp) buildAgentContextPrefix() string {
 		parts = append(parts, instructions)
 	}
 
+	// Long-term memory index. Built once per context so the prefix stays
+	// cache-stable; memories written during the session are in the tool
+	// results until the next rebuild.
+	if app.memory != nil {
+		index, err := app.memory.Index()
+		if err != nil {
+			slog.Warn("Failed to build memory index", "error", err)
+		} else if index != "" {
+			parts = append(parts, index)
+		}
+	}
+
 	if len(parts) == 0 {
 		return ""
 	}
@@ -83,6 +104,7 @@ func (app *rpcApp) createBaseContext() *agentctx.AgentContext {
 	if app.compactor != nil {
 		app.compactor.SetAgentContextPrefix(app.agentContextPrefix)
 		app.compactor.SetThinkingLevel(app.currentThinkingLevel)
+		app.compactor.SetStalePolicy(app.stalePolicy(), app.ws.GetCWD)
 	}
 	ctx := agentctx.NewAgentContext(app.systemPrompt)
 	ctx.AgentContextPrefix = app.agentContextPrefix
@@ -91,10 +113,149 @@ func (app *rpcApp) createBaseContext() *agentctx.AgentContext {
 	}
 	if app.sess != nil {
 		ctx.RecentMessages = app.sess.GetMessages()
+		ctx.AgentState.Todos = app.sess.GetTodos()
 	}
 	return ctx
 }
 
+// runSessionStartHooks runs the SessionStart hooks for the current session
+// and appends the messages they return to the agent context. Like BeforeModel
+// output, these messages are not written to the session file: the hooks run
+// again whenever the session is reopened.
+func (app *rpcApp) runSessionStartHooks(source string) {
+	if app.ag == nil || app.loopCfg == nil || app.loopCfg.Hooks == nil {
+		return
+	}
+	agentCtx := app.ag.GetContext()
+	msgs := app.loopCfg.Hooks.RunSessionStart(agent.HookContext{
+		Ctx:      context.Background(),
+		AgentCtx: agentCtx,
+		Config:   app.loopCfg,
+	}, source)
+	for _, msg := range msgs {
+		agentCtx.AddMessage(msg)
+	}
+	if len(msgs) > 0 {
+		slog.Info("SessionStart hooks injected messages", "source", source, "count", len(msgs))
+	}
+}
+
+// sessionDir returns the current session directory, or "" before a session is open.
+func (app *rpcApp) sessionDir() string {
+	if app.sess == nil {
+		return ""
+	}
+	return app.sess.GetDir()
+}
+
+// setTodos stores the todo tool's list on the running agent, under the
+// agent's context lock.
+func (app *rpcApp) setTodos(todos []agentctx.TodoItem) {
+	if app.ag != nil {
+		app.ag.SetTodos(todos)
+	}
+}
+
+// persistTodos records a todo list change in the current session.
+func (app *rpcApp) persistTodos(todos []agentctx.TodoItem) {
+	if app.sess == nil {
+		return
+	}
+	if _, err := app.sess.AppendTodos(todos); err != nil {
+		slog.Warn("Failed to persist todo list", "error", err)
+	}
+}
+
+// newTaskTool builds the in-process subagent tool bound to this app.
+func (app *rpcApp) newTaskTool() *agent.TaskTool {
+	concurrency := app.cfg.Concurrency
+	if concurrency == nil {
+		concurrency = config.DefaultConcurrencyConfig()
+	}
+	return agent.NewTaskTool(agent.TaskToolConfig{
+		ParentConfig: func() *agent.LoopConfig {
+			if app.ag == nil {
+				return nil
+			}
+			return app.ag.LoopConfigSnapshot()
+		},
+		ResolveRole:        app.resolveTaskRole,
+		ResolveModel:       app.resolveTaskModel,
+		Emit:               app.emitSubagentEvent,
+		MaxConcurrentTools: concurrency.MaxConcurrentTools,
+		QueueTimeout:       concurrency.QueueTimeout,
+	})
+}
+
+// resolveTaskRole loads ~/.ai/roles/<name>/agent.yaml for a task subagent.
+func (app *rpcApp) resolveTaskRole(name string) (agent.TaskRole, error) {
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return agent.TaskRole{}, fmt.Errorf("invalid role name %q", name)
+	}
+	roleCfg, err := agentconfig.Load(filepath.Join(app.agentDir, "roles", name, "agent.yaml"))
+	if err != nil {
+		return agent.TaskRole{}, err
+	}
+	systemPrompt, err := roleCfg.ResolveSystemPrompt()
+	if err != nil {
+		return agent.TaskRole{}, err
+	}
+	return agent.TaskRole{
+		SystemPrompt: systemPrompt,
+		Tools:        roleCfg.GetEnabledTools(),
+		Model:        roleCfg.Model,
+	}, nil
+}
+
+// resolveTaskModel resolves a model override for a task subagent without
+// touching the app's active model.
+func (app *rpcApp) resolveTaskModel(name string) (llm.Model, string, error) {
+	cfg := *app.cfg
+	applyModelOverride(&cfg, name)
+	model, apiKey, _, err := resolveModelAndKey(&cfg)
+	return model, apiKey, err
+}
+
+// emitSubagentEvent forwards a task subagent event to RPC clients. Child
+// events are display-only: they are not persisted to the parent session.
+func (app *rpcApp) emitSubagentEvent(event agent.AgentEvent) {
+	if app.server == nil {
+		return
+	}
+	if event.EventAt == 0 {
+		event.EventAt = time.Now().UnixNano()
+	}
+	stripImageDataFromEvent(&event)
+	app.server.EmitEvent(event)
+}
+
+// emitUserQuestion notifies RPC clients that ask_user is waiting for an answer.
+func (app *rpcApp) emitUserQuestion(q tools.UserQuestion) {
+	slog.Info("[AskUser] waiting for answer", "id", q.ID, "question", q.Question)
+	if app.server == nil {
+		return
+	}
+	app.server.EmitEvent(map[string]any{
+		"type":           "user_question",
+		"id":             q.ID,
+		"toolCallId":     q.ToolCallID,
+		"question":       q.Question,
+		"options":        q.Options,
+		"timeoutSeconds": q.TimeoutSeconds,
+		"eventAt":        time.Now().UnixNano(),
+	})
+}
+
+// answerQuestion delivers an answer to a pending ask_user question.
+func (app *rpcApp) answerQuestion(id, answer string) (any, error) {
+	q, err := app.askUser.Answer(id, answer)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("[AskUser] answered", "id", q.ID)
+	return map[string]any{"status": "answered", "id": q.ID}, nil
+}
+
 func (app *rpcApp) setAgentContext(ctx *agentctx.AgentContext) {
 	app.ag.SetContext(ctx)
 }
@@ -115,3 +276,15 @@ func (app *rpcApp) expandSkillCommands(text string) string {
 }
 
 // appendCompactionHint is defined in pkg/agent/loop_state.go.
+
+// stalePolicy returns the stale-output policy from agent.yaml's
+// context_management block, or nil when the annotation is disabled.
+func (app *rpcApp) stalePolicy() *agentctx.StalePolicy {
+	if app.agentConfig == nil {
+		return nil
+	}
+	if cfg := app.agentConfig.BuildStale(); cfg != nil {
+		return &cfg.Policy
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tiancaiamao/ai/pkg/memory"
+)
+
+// MemoryItem is one long-term memory in a /memory response.
+type MemoryItem struct {
+	ID       string   `json:"id"`
+	Scope    string   `json:"scope"`
+	Content  string   `json:"content"`
+	Tags     []string `json:"tags,omitempty"`
+	Proposed bool     `json:"proposed,omitempty"`
+	Updated  string   `json:"updated"`
+}
+
+// handleMemory lists, searches, accepts and deletes long-term memories:
+//
+//	/memory                      list all memories
+//	/memory search <query>       keyword search
+//	/memory accept [user] <id>   accept a proposed memory
+//	/memory delete [user] <id>   delete a memory
+//
+// accept and delete act on the project scope unless "user" is given.
+func (app *rpcApp) handleMemory(args string) (any, error) {
+	if app.memory == nil {
+		return nil, fmt.Errorf("long-term memory is disabled in config")
+	}
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	switch sub {
+	case "", "list", "search":
+		query := ""
+		if sub == "search" {
+			query = rest
+		}
+		hits, err := app.memory.Search(query, 0)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]MemoryItem, 0, len(hits))
+		for _, h := range hits {
+			items = append(items, MemoryItem{
+				ID:       h.ID,
+				Scope:    h.Scope,
+				Content:  h.Content,
+				Tags:     h.Tags,
+				Proposed: h.Proposed(),
+				Updated:  h.Updated.Format("2006-01-02 15:04"),
+			})
+		}
+		return map[string]any{"memories": items}, nil
+	case "accept", "delete":
+		scope := memory.ScopeProject
+		if s, id, ok := strings.Cut(rest, " "); ok && (s == memory.ScopeUser || s == memory.ScopeProject) {
+			scope, rest = s, strings.TrimSpace(id)
+		}
+		if rest == "" {
+			return nil, fmt.Errorf("usage: /memory %s [user] <id>", sub)
+		}
+		store, err := app.memory.Store(scope)
+		if err != nil {
+			return nil, err
+		}
+		if sub == "accept" {
+			if _, err := store.Accept(rest); err != nil {
+				return nil, err
+			}
+			return map[string]any{"message": fmt.Sprintf("Accepted %s memory [%s]; it is in the index from the next session.", scope, rest)}, nil
+		}
+		if err := store.Delete(rest); err != nil {
+			return nil, err
+		}
+		return map[string]any{"message": fmt.Sprintf("Deleted %s memory [%s].", scope, rest)}, nil
+	}
+	return nil, fmt.Errorf("usage: /memory [list | search <query> | accept [user] <id> | delete [user] <id>]")
+}
+
+func (app *rpcApp) registerMemoryHandlers() {
+	app.server.RegisterSlash("memory", "List, search, accept or delete long-term memories", func(args string) (any, error) {
+		return app.handleMemory(args)
+	})
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tiancaiamao/ai/pkg/agent"
+	"github.com/tiancaiamao/ai/pkg/session/export"
 	traceevent "github.com/tiancaiamao/ai/pkg/traceevent"
 )
 
@@ -52,7 +56,7 @@ func (app *rpcApp) handleCompact(args string) (any, error) {
 		func(ctx context.Context, span *traceevent.Span) error {
 			span.AddField("before_messages", beforeCount)
 
-			result, err := app.compactor.Compact(ctx, agentCtx)
+			result, err := app.loopCompactor().Compact(ctx, agentCtx)
 			if err != nil {
 				slog.Info("Compact failed:", "value", err)
 				return err
@@ -122,9 +126,74 @@ func (app *rpcApp) handleGetLastAssistantText(args string) (any, error) {
 	return "", nil
 }
 
-func (app *rpcApp) handleExportHTML(args string) (any, error) {
-	slog.Info("Received export_html", "outputPath", args)
-	return "", fmt.Errorf("export_html is not supported")
+// handleExport writes the current branch, or the branch ending at --leaf, to
+// a file. Accepts "[format] [path] [--leaf <entryId>]" or JSON
+// {"format": "...", "path": "...", "leafId": "..."}. The format defaults to
+// the path extension, then HTML; the path defaults to
+// <session dir>/exports/<session id>-<time>.<extension>.
+func (app *rpcApp) handleExport(args string) (any, error) {
+	slog.Info("Received export", "args", args)
+	var req struct {
+		Format string `json:"format"`
+		Path   string `json:"path"`
+		LeafID string `json:"leafId"`
+	}
+	if !app.parseJSONArgs(args, &req) {
+		fields := strings.Fields(args)
+		for i := 0; i < len(fields); i++ {
+			switch f := fields[i]; {
+			case f == "--leaf" && i+1 < len(fields):
+				i++
+				req.LeafID = fields[i]
+			case req.Format == "" && req.Path == "" && !strings.ContainsAny(f, "./"):
+				// A bare word is a format; a path has a dot or slash.
+				req.Format = f
+			case req.Path == "":
+				req.Path = f
+			default:
+				return nil, fmt.Errorf("usage: /export [html|md|json|openai|anthropic|sharegpt] [path] [--leaf <entryId>]")
+			}
+		}
+	}
+	if app.sess == nil {
+		return nil, fmt.Errorf("no active session")
+	}
+
+	if req.Format == "" {
+		req.Format = export.FormatForPath(req.Path)
+	}
+	format, err := export.ParseFormat(req.Format)
+	if err != nil {
+		return nil, err
+	}
+	t, err := export.FromSession(app.sess, req.LeafID)
+	if err != nil {
+		return nil, err
+	}
+
+	path := req.Path
+	if path == "" {
+		if app.sessionDir() == "" {
+			return nil, fmt.Errorf("session is not saved; give an output path")
+		}
+		name := fmt.Sprintf("%s-%s.%s", t.SessionID, time.Now().Format("20060102-150405"), export.Extension(format))
+		path = filepath.Join(app.sessionDir(), "exports", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := export.Render(f, t, format); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &ExportResult{Path: path, Format: format, Entries: len(t.Entries), Turns: len(t.Turns)}, nil
 }
 
 // registerMessageHandlers registers message-related slash commands.
@@ -137,8 +206,15 @@ func (app *rpcApp) registerMessageHandlers() {
 		return app.handleCompact(args)
 	})
 
-	app.server.RegisterSlash("export_html", "Export the current session as HTML", func(args string) (any, error) {
-		return app.handleExportHTML(args)
+	app.server.RegisterSlash("export", "Export the session: /export [html|md|json|openai|anthropic|sharegpt] [path] [--leaf <entryId>]", func(args string) (any, error) {
+		return app.handleExport(args)
+	})
+
+	app.server.RegisterHiddenSlash("export_html", "Export the session as HTML (alias of /export html)", func(args string) (any, error) {
+		if strings.HasPrefix(strings.TrimSpace(args), "{") {
+			return app.handleExport(args)
+		}
+		return app.handleExport(strings.TrimSpace("html " + args))
 	})
 
 	app.server.RegisterHiddenSlash("get_last_assistant_text", "Get the last assistant text response (internal)", func(args string) (any, error) {
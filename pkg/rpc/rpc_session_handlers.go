@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -11,20 +12,64 @@ import (
 	"github.com/tiancaiamao/ai/pkg/compact"
 	agentctx "github.com/tiancaiamao/ai/pkg/context"
 	"github.com/tiancaiamao/ai/pkg/session"
+	"github.com/tiancaiamao/ai/pkg/session/search"
 	traceevent "github.com/tiancaiamao/ai/pkg/traceevent"
 )
 
 // --- Session management handlers --@
 
+// lockSession makes this process the owner of sess before switching to it.
+func (app *rpcApp) lockSession(sess *session.Session) error {
+	if app.sess != nil && app.sess.GetDir() == sess.GetDir() {
+		// Reloading the current session: hand our own lock over.
+		app.sess.Unlock()
+	}
+	err := sess.Lock(session.NewSessionOwner(app.runID), false)
+	var locked *session.SessionLockedError
+	if errors.As(err, &locked) {
+		return fmt.Errorf("%w; stop that run first, or start with --read-only or --force-takeover", err)
+	}
+	return err
+}
+
+// setCurrent records id, the session lockSession just locked as newSess,
+// as the current session. On failure newSess is unlocked again, and a
+// reloaded current session gets its lock back.
+func (app *rpcApp) setCurrent(newSess *session.Session, id string) error {
+	err := app.sessionMgr.SetCurrent(id)
+	if err == nil {
+		return nil
+	}
+	if newSess == app.sess {
+		return err
+	}
+	newSess.Unlock()
+	if app.sess != nil && app.sess.GetDir() == newSess.GetDir() {
+		if lockErr := app.sess.Lock(session.NewSessionOwner(app.runID), false); lockErr != nil {
+			slog.Warn("Failed to lock the current session again", "error", lockErr)
+		}
+	}
+	return err
+}
+
 func (app *rpcApp) setSession(newSess *session.Session, newID, newName string) {
+	// Under stateMu, so a background title write (titleSession) finishes
+	// before the old session is released.
+	app.stateMu.Lock()
+	if app.sess != nil && app.sess != newSess {
+		app.sess.Unlock()
+	}
 	app.sess = newSess
+	app.stateMu.Unlock()
 
 	// Rebuild compactor with the new session directory so that
 	// archive files are written to the correct session dir.
 	app.compactor = compact.NewCompactor(app.compactorConfig, app.model, app.apiKey, app.systemPrompt, app.model.ContextWindow, newSess.GetDir())
+	app.compactionModel.apply(app.compactor)
+	app.compactor.SetUsageMeter(app.usageMeter(newID))
 	app.compactor.SetAgentContextPrefix(app.agentContextPrefix)
 	app.compactor.SetThinkingLevel(app.currentThinkingLevel)
-	app.sessionComp.Update(app.compactor)
+	app.sessionComp.Update(app.loopCompactor())
 
 	app.setAgentContext(app.createBaseContext())
 
@@ -36,6 +81,12 @@ func (app *rpcApp) setSession(newSess *session.Session, newID, newName string) {
 		}
 	}
 
+	if app.runID != "" {
+		if err := app.sessionMgr.AddSessionRun(newID, app.runID); err != nil {
+			slog.Warn("Failed to record run in session meta", "run", app.runID, "error", err)
+		}
+	}
+
 	app.stateMu.Lock()
 	app.sessionID = newID
 	app.sessionName = newName
@@ -69,9 +120,12 @@ func (app *rpcApp) handleNewSession(args string) (any, error) {
 		return nil, err
 	}
 
+	if err := app.lockSession(newSess); err != nil {
+		return nil, err
+	}
 	newSessionID := newSess.GetID()
 
-	if err := app.sessionMgr.SetCurrent(newSessionID); err != nil {
+	if err := app.setCurrent(newSess, newSessionID); err != nil {
 		return nil, err
 	}
 	if err := app.sessionMgr.SaveCurrent(); err != nil {
@@ -79,6 +133,7 @@ func (app *rpcApp) handleNewSession(args string) (any, error) {
 	}
 
 	app.setSession(newSess, newSessionID, name)
+	app.runSessionStartHooks("new")
 
 	slog.Info("Created new session", "name", name, "id", newSessionID)
 	app.server.EmitEvent(map[string]any{"type": "session_switch", "session": newSessionID, "sessionName": name})
@@ -122,7 +177,14 @@ func (app *rpcApp) handleResume(args string) (any, error) {
 			}
 		}
 		if targetID == "" {
-			return nil, fmt.Errorf("session not found: %s", arg)
+			matches := session.MatchSessions(sessions, arg)
+			switch {
+			case len(matches) == 0:
+				return nil, fmt.Errorf("session not found: %s", arg)
+			case len(matches) > 1:
+				return nil, ambiguousSessionError(arg, matches)
+			}
+			targetID = matches[0].ID
 		}
 	}
 
@@ -130,8 +192,11 @@ func (app *rpcApp) handleResume(args string) (any, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load session %s: %w", targetID, err)
 	}
+	if err := app.lockSession(newSess); err != nil {
+		return nil, err
+	}
 
-	if err := app.sessionMgr.SetCurrent(targetID); err != nil {
+	if err := app.setCurrent(newSess, targetID); err != nil {
 		return nil, err
 	}
 	if err := app.sessionMgr.SaveCurrent(); err != nil {
@@ -140,12 +205,29 @@ func (app *rpcApp) handleResume(args string) (any, error) {
 
 	newSessionName := resolveSessionName(app.sessionMgr, targetID)
 	app.setSession(newSess, targetID, newSessionName)
+	app.runSessionStartHooks("resume")
 
 	slog.Info("Switched to session", "id", targetID, "name", newSessionName)
 	app.server.EmitEvent(map[string]any{"type": "session_switch", "session": targetID, "sessionName": newSessionName})
 	return map[string]any{"sessionId": targetID, "sessionName": newSessionName}, nil
 }
 
+// ambiguousSessionError lists the sessions a /resume query matched equally
+// well, newest first.
+func ambiguousSessionError(query string, matches []session.SessionMeta) error {
+	const maxListed = 5
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d sessions match %q:", len(matches), query)
+	for i, m := range matches {
+		if i == maxListed {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(matches)-maxListed)
+			break
+		}
+		fmt.Fprintf(&b, "\n  %s  %s", m.ID, m.Title)
+	}
+	return errors.New(b.String())
+}
+
 func (app *rpcApp) handleRewind(args string) (any, error) {
 	var jsonData struct {
 		EntryID string `json:"entryId"`
@@ -235,31 +317,145 @@ func resolveMessageIndex(ag messageIndexResolver, sess *session.Session, arg str
 	return "", false
 }
 
+// findMessage returns the index in messages of arg, which is either a
+// /messages index or an entry ID.
+func findMessage(messages []agentctx.AgentMessage, arg string) (int, bool) {
+	if idx, err := strconv.Atoi(arg); err == nil {
+		return idx, idx >= 0 && idx < len(messages)
+	}
+	for i, msg := range messages {
+		if msg.EntryID != "" && msg.EntryID == arg {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// handlePin pins a message so compaction keeps it verbatim, or with
+// pin=false resets it to the default priority. The JSON form also accepts an
+// explicit priority, e.g. {"entryId":"abc","priority":0.25} to have a
+// message evicted early.
+func (app *rpcApp) handlePin(args string, pin bool) (any, error) {
+	command := "unpin"
+	if pin {
+		command = "pin"
+	}
+	var jsonData struct {
+		EntryID  string   `json:"entryId"`
+		Priority *float64 `json:"priority"`
+	}
+	target := strings.TrimSpace(args)
+	var priority *float64
+	if app.parseJSONArgs(args, &jsonData) {
+		target = jsonData.EntryID
+		priority = jsonData.Priority
+	}
+	if target == "" {
+		return nil, fmt.Errorf("usage: /%s <index|entryId>  (use /messages to see indices)", command)
+	}
+	if priority == nil && pin {
+		p := agentctx.PriorityPinned
+		priority = &p
+	}
+	if !pin {
+		priority = nil
+	}
+	if app.sess == nil {
+		return nil, fmt.Errorf("no active session")
+	}
+
+	app.stateMu.Lock()
+	streaming := app.isStreaming
+	app.stateMu.Unlock()
+	if streaming {
+		return nil, fmt.Errorf("agent is busy")
+	}
+
+	index, ok := findMessage(app.ag.GetMessages(), target)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", target)
+	}
+	msg, ok := app.ag.SetMessagePriority(index, priority)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", target)
+	}
+	if _, err := app.sess.AppendPin(msg, priority); err != nil {
+		slog.Warn("Failed to persist pin", "entryId", msg.EntryID, "error", err)
+	}
+	return map[string]any{
+		"index":    index,
+		"entryId":  msg.EntryID,
+		"priority": msg.GetPriority(),
+		"pinned":   msg.IsPinned(),
+	}, nil
+}
+
+// pinnedContext lists the messages compaction will keep verbatim.
+func (app *rpcApp) pinnedContext() PinnedContext {
+	pinned := PinnedContext{
+		Instructions: app.agentContextPrefix != "",
+		Messages:     []PinnedMessage{},
+	}
+	for i, msg := range app.ag.GetMessages() {
+		if !msg.IsPinned() || !msg.IsAgentVisible() {
+			continue
+		}
+		kind := ""
+		if msg.Metadata != nil {
+			kind = msg.Metadata.Kind
+		}
+		pinned.Messages = append(pinned.Messages, PinnedMessage{
+			Index:    i,
+			EntryID:  msg.EntryID,
+			Role:     msg.Role,
+			Kind:     kind,
+			Preview:  truncateText(strings.Join(strings.Fields(msg.ExtractText()), " "), 80),
+			Priority: msg.GetPriority(),
+		})
+	}
+	return pinned
+}
+
 func (app *rpcApp) handleFork(args string) (any, error) {
 	var jsonData struct {
-		EntryID string `json:"entryId"`
+		SessionID string `json:"sessionId"`
+		EntryID   string `json:"entryId"`
 	}
 	entryID := strings.TrimSpace(args)
+	sessionID := ""
 	if app.parseJSONArgs(args, &jsonData) && jsonData.EntryID != "" {
-		entryID = jsonData.EntryID
+		entryID, sessionID = jsonData.EntryID, jsonData.SessionID
+	} else if sid, eid, ok := strings.Cut(entryID, ":"); ok {
+		// "<sessionId>:<entryId>", as printed by /search.
+		entryID, sessionID = eid, sid
 	}
 
 	if entryID == "" {
-		return nil, fmt.Errorf("usage: /fork <index|entryId>  (use /messages to see indices)")
+		return nil, fmt.Errorf("usage: /fork <index|entryId|sessionId:entryId>  (use /messages to see indices)")
+	}
+
+	source := app.sess
+	if sessionID != "" && sessionID != app.sess.GetID() {
+		var err error
+		if source, err = app.sessionMgr.GetSession(sessionID); err != nil {
+			return nil, fmt.Errorf("load session %s: %w", sessionID, err)
+		}
 	}
 
 	// Lazy loading may not have all entries in byID (e.g., pre-compaction).
 	// Ensure the full session is loaded before resolving indices.
-	if err := app.sess.EnsureFullyLoaded(); err != nil {
+	if err := source.EnsureFullyLoaded(); err != nil {
 		return nil, err
 	}
 
 	// Resolve index-based reference (e.g. "/fork 5" → message at index 5 in /messages).
-	if resolved, ok := resolveMessageIndex(app.ag, app.sess, entryID); ok {
-		entryID = resolved
+	if source == app.sess {
+		if resolved, ok := resolveMessageIndex(app.ag, app.sess, entryID); ok {
+			entryID = resolved
+		}
 	}
 
-	entry, ok := app.sess.GetEntry(entryID)
+	entry, ok := source.GetEntry(entryID)
 	if !ok || entry.Type != session.EntryTypeMessage || entry.Message == nil || entry.Message.Role != "user" {
 		return nil, fmt.Errorf("invalid entryId: %s", entryID)
 	}
@@ -267,14 +463,17 @@ func (app *rpcApp) handleFork(args string) (any, error) {
 	text := entry.Message.ExtractText()
 	name := fmt.Sprintf("fork-%s", time.Now().Format("20060102-150405"))
 	title := "Forked Session"
-	newSess, err := app.sessionMgr.ForkSessionFrom(app.sess, entry.ParentID, name, title)
+	newSess, err := app.sessionMgr.ForkSessionFrom(source, entry.ParentID, name, title)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := app.lockSession(newSess); err != nil {
+		return nil, err
+	}
 	newSessionID := newSess.GetID()
 
-	if err := app.sessionMgr.SetCurrent(newSessionID); err != nil {
+	if err := app.setCurrent(newSess, newSessionID); err != nil {
 		return nil, err
 	}
 	if err := app.sessionMgr.SaveCurrent(); err != nil {
@@ -282,6 +481,7 @@ func (app *rpcApp) handleFork(args string) (any, error) {
 	}
 
 	app.setSession(newSess, newSessionID, name)
+	app.runSessionStartHooks("fork")
 
 	slog.Info("Forked to new session", "name", name, "id", newSessionID)
 	return &ForkResult{Cancelled: false, Text: text}, nil
@@ -289,7 +489,10 @@ func (app *rpcApp) handleFork(args string) (any, error) {
 
 func (app *rpcApp) handleSessionGetState() (any, error) {
 	slog.Info("Received get_state")
-	compactionState := compact.BuildCompactionState(app.compactorConfig, app.compactor)
+	compactionState := app.compactionState()
+	if compactionState != nil {
+		compactionState.Summaries = compact.BuildSummaryLayout(app.ag.GetMessages())
+	}
 	app.stateMu.Lock()
 	currentSessionID := app.sessionID
 	currentSessionName := app.sessionName
@@ -314,6 +517,7 @@ func (app *rpcApp) handleSessionGetState() (any, error) {
 		SessionFile:           app.sess.GetPath(),
 		SessionID:             currentSessionID,
 		SessionName:           currentSessionName,
+		SessionReadOnly:       app.sess.IsReadOnly(),
 		AIPid:                 os.Getpid(),
 		AILogPath:             aiLogPath,
 		AIWorkingDir:          app.ws.GetCWD(),
@@ -339,6 +543,50 @@ func (app *rpcApp) handleGetForkMessages(args string) (any, error) {
 	return map[string]any{"messages": result}, nil
 }
 
+// handleSearch searches the sessions of the current sessions directory.
+// Hits can be resumed with /resume <sessionId> or forked at their turn with
+// /fork <sessionId>:<forkEntryId>.
+func (app *rpcApp) handleSearch(args string) (any, error) {
+	var jsonData struct {
+		Query string `json:"query"`
+		Role  string `json:"role"`
+		Tool  string `json:"tool"`
+		Cwd   string `json:"cwd"`
+		Since string `json:"since"`
+		Until string `json:"until"`
+		Limit int    `json:"limit"`
+	}
+	var q search.Query
+	if app.parseJSONArgs(args, &jsonData) {
+		q = search.Query{Text: jsonData.Query, Role: jsonData.Role, Tool: jsonData.Tool, Cwd: jsonData.Cwd, Limit: jsonData.Limit}
+		var err error
+		if jsonData.Since != "" {
+			if q.Since, err = search.ParseTime(jsonData.Since, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+		if jsonData.Until != "" {
+			if q.Until, err = search.ParseTime(jsonData.Until, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var err error
+		if q, err = search.ParseQuery(strings.Fields(args), time.Now()); err != nil {
+			return nil, fmt.Errorf("%w\nusage: /search <terms> [--role user|assistant|tool|compaction] [--tool name] [--since date] [--until date] [--limit n]", err)
+		}
+	}
+
+	hits, err := session.SearchSessions(q, app.sessionMgr.GetSessionsDir())
+	if err != nil {
+		return nil, err
+	}
+	if hits == nil {
+		hits = []session.SearchHit{}
+	}
+	return &SearchResult{Query: q.Text, Hits: hits}, nil
+}
+
 func (app *rpcApp) handleGetTree(args string) (any, error) {
 	_ = args
 	slog.Info("Received get_tree")
@@ -365,10 +613,22 @@ func (app *rpcApp) registerSessionHandlers() {
 		return app.handleFork(args)
 	})
 
-	app.server.RegisterSlash("resume", "List sessions or resume a session by ID/name", func(args string) (any, error) {
+	app.server.RegisterSlash("search", "Search all sessions: /search <terms> [--role r] [--tool t] [--since d] [--until d] [--limit n]", func(args string) (any, error) {
+		return app.handleSearch(args)
+	})
+
+	app.server.RegisterSlash("resume", "List sessions or resume a session by index, ID, name or title", func(args string) (any, error) {
 		return app.handleResume(args)
 	})
 
+	app.server.RegisterSlash("pin", "Pin a message so compaction never summarizes it", func(args string) (any, error) {
+		return app.handlePin(args, true)
+	})
+
+	app.server.RegisterSlash("unpin", "Reset a pinned message to the default priority", func(args string) (any, error) {
+		return app.handlePin(args, false)
+	})
+
 	app.server.RegisterHiddenSlash("get_fork_messages", "Get messages for a fork point (internal)", func(args string) (any, error) {
 		return app.handleGetForkMessages(args)
 	})
@@ -1,9 +1,12 @@
 package rpc
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/tiancaiamao/ai/pkg/agent"
 	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
 	"github.com/tiancaiamao/ai/pkg/session"
 )
 
@@ -164,3 +167,204 @@ func TestResolveMessageIndex_CompactionIndexMismatch(t *testing.T) {
 		t.Error("sanity check failed: branch[3] has same timestamp as agent[3] — test setup issue")
 	}
 }
+
+func TestFindMessage(t *testing.T) {
+	messages := []agentctx.AgentMessage{
+		{Role: "user", EntryID: "aaa"},
+		{Role: "assistant", EntryID: "bbb"},
+	}
+	if idx, ok := findMessage(messages, "1"); !ok || idx != 1 {
+		t.Errorf("expected (1, true), got (%d, %v)", idx, ok)
+	}
+	if idx, ok := findMessage(messages, "aaa"); !ok || idx != 0 {
+		t.Errorf("expected (0, true), got (%d, %v)", idx, ok)
+	}
+	if _, ok := findMessage(messages, "2"); ok {
+		t.Error("expected false for out-of-range index")
+	}
+	if _, ok := findMessage(messages, "zzz"); ok {
+		t.Error("expected false for unknown entry ID")
+	}
+}
+
+func TestExpandToToolPairs(t *testing.T) {
+	messages := []agentctx.AgentMessage{
+		{Role: "user"},
+		{Role: "assistant"},
+		{Role: "toolResult"},
+		{Role: "toolResult"},
+		{Role: "assistant"},
+		{Role: "toolResult"},
+		{Role: "user"},
+	}
+	for _, tc := range []struct{ first, last, wantFirst, wantLast int }{
+		{0, 0, 0, 0},
+		{0, 1, 0, 3},
+		{3, 4, 1, 5},
+		{2, 6, 1, 6},
+	} {
+		first, last := expandToToolPairs(messages, tc.first, tc.last)
+		if first != tc.wantFirst || last != tc.wantLast {
+			t.Errorf("expandToToolPairs(%d, %d) = (%d, %d), want (%d, %d)",
+				tc.first, tc.last, first, last, tc.wantFirst, tc.wantLast)
+		}
+	}
+}
+
+func TestHandleMergeBranch(t *testing.T) {
+	sm := session.NewSessionManager(t.TempDir())
+	sess, err := sm.CreateSession("main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := sess.AppendMessage(agentctx.NewUserMessage("fix the lexer"))
+	call := agentctx.NewAssistantMessage()
+	call.Content = []agentctx.ContentBlock{agentctx.ToolCallContent{
+		ID: "c1", Type: "toolCall", Name: "edit", Arguments: map[string]any{"path": "lexer.go"},
+	}}
+	result := agentctx.NewToolResultMessage("c1", "edit", []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "ok"}}, false)
+	for _, msg := range []agentctx.AgentMessage{call, result, agentctx.NewUserMessage("the lexer rewrite works")} {
+		if _, err := sess.AppendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := *sess.GetLeafID()
+	if err := sess.Branch(root); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &rpcApp{sess: sess, sessionMgr: sm, ag: agent.NewAgent(llm.Model{}, "", "")}
+	if _, err := app.handleMergeBranch("1"); err == nil {
+		t.Error("merging the current branch: expected error")
+	}
+	res, err := app.handleMergeBranch(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := res.(*MergeBranchResult)
+	if merged.Merged != other || len(merged.Files) != 1 || !strings.Contains(merged.Summary, "Files changed on that branch:\n- lexer.go (1 edit)") {
+		t.Errorf("result = %+v", merged)
+	}
+	messages := app.ag.GetMessages()
+	if len(messages) != 1 || !strings.HasPrefix(messages[0].ExtractText(), session.BranchSummaryPrefix) {
+		t.Errorf("agent messages = %+v", messages)
+	}
+	if entry, ok := sess.GetEntry(merged.EntryID); !ok || entry.Type != session.EntryTypeBranchSummary || entry.FromID != other {
+		t.Errorf("entry = %+v", entry)
+	}
+}
+
+func TestLockSession(t *testing.T) {
+	sm := session.NewSessionManager(t.TempDir())
+	current, err := sm.CreateSession("current", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := sm.CreateSession("held", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := held.Lock(session.NewSessionOwner("other"), false); err != nil {
+		t.Fatal(err)
+	}
+	defer held.Unlock()
+
+	app := &rpcApp{sess: current, sessionMgr: sm, runID: "r1"}
+	if err := app.lockSession(current); err != nil {
+		t.Fatal(err)
+	}
+	target, err := sm.GetSession(held.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.lockSession(target); err == nil || !strings.Contains(err.Error(), "run other") {
+		t.Errorf("resuming a held session: %v", err)
+	}
+
+	// Reloading the current session takes its lock over.
+	reloaded, err := sm.GetSession(current.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.lockSession(reloaded); err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Unlock()
+	if owner, _ := session.ReadSessionOwner(current.GetDir()); owner == nil || owner.RunID != "r1" {
+		t.Errorf("owner = %+v", owner)
+	}
+}
+
+func TestSetCurrent_UnlocksOnFailure(t *testing.T) {
+	sm := session.NewSessionManager(t.TempDir())
+	current, err := sm.CreateSession("current", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := sm.CreateSession("target", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &rpcApp{sess: current, sessionMgr: sm, runID: "r1"}
+	if err := app.lockSession(current); err != nil {
+		t.Fatal(err)
+	}
+	defer current.Unlock()
+
+	if err := app.lockSession(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.setCurrent(target, ""); err == nil {
+		t.Fatal("expected SetCurrent to fail without an id")
+	}
+	if owner, _ := session.ReadSessionOwner(target.GetDir()); owner != nil {
+		t.Errorf("target still locked by %+v", owner)
+	}
+
+	// A failed reload gives the current session its lock back.
+	reloaded, err := sm.GetSession(current.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.lockSession(reloaded); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.setCurrent(reloaded, ""); err == nil {
+		t.Fatal("expected SetCurrent to fail without an id")
+	}
+	if owner, _ := session.ReadSessionOwner(current.GetDir()); owner == nil || owner.RunID != "r1" {
+		t.Errorf("current session owner = %+v", owner)
+	}
+}
+
+func TestLoadOrCreateSession_Store(t *testing.T) {
+	store := session.NewMemoryStore()
+	sess, id, _, sm, err := loadOrCreateSession("", t.TempDir(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Store() != store || sess.GetDir() != "" {
+		t.Fatalf("session not kept in the store: dir %q", sess.GetDir())
+	}
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, resumedID, _, _, err := loadOrCreateSession(id, t.TempDir(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumedID != id {
+		t.Errorf("resumed %q, want %q", resumedID, id)
+	}
+	if messages := resumed.GetMessages(); len(messages) != 1 || messages[0].ExtractText() != "hello" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
+
+func TestHandlePin_NoSession(t *testing.T) {
+	app := &rpcApp{ag: agent.NewAgent(llm.Model{}, "", "")}
+	if _, err := app.handlePin("0", true); err == nil || !strings.Contains(err.Error(), "no active session") {
+		t.Errorf("pin without a session: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,7 +10,9 @@ import (
 
 	"github.com/tiancaiamao/ai/pkg/compact"
 	"github.com/tiancaiamao/ai/pkg/config"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
 	"github.com/tiancaiamao/ai/pkg/llm"
+	"github.com/tiancaiamao/ai/pkg/memory"
 	"github.com/tiancaiamao/ai/pkg/prompt"
 	"github.com/tiancaiamao/ai/pkg/session"
 	"github.com/tiancaiamao/ai/pkg/skill"
@@ -26,6 +29,11 @@ type rpcAppSetupParams struct {
 	modelOverride      string
 	runID              string
 	role               string
+	readOnly           bool // open the session without writing to it
+	forceTakeover      bool // take the session over from the process holding it
+	// store keeps the sessions; nil keeps them as files under
+	// ~/.ai/sessions. With a store, the session path is a session ID.
+	store session.SessionStore
 }
 
 // newRPCApp constructs a fully initialized rpcApp by performing all setup:
@@ -57,10 +65,15 @@ func newRPCApp(sessionPath string, params rpcAppSetupParams) (*rpcApp, error) {
 		return nil, fmt.Errorf("failed to normalize session path: %w", err)
 	}
 
-	sess, sessionID, sessionName, sessionMgr, err := loadOrCreateSession(sessionPath, cwd)
+	sess, sessionID, sessionName, sessionMgr, err := loadOrCreateSession(sessionPath, cwd, params.store)
 	if err != nil {
 		return nil, err
 	}
+	sess, sessionID, sessionName, err = acquireSession(sess, sessionID, sessionName, sessionMgr, sessionPath != "", params)
+	if err != nil {
+		return nil, err
+	}
+	startAutoGC(cfg.Retention, agentDir, sessionID)
 
 	// --- Resume role recovery ---
 	// If no --role specified but session has one recorded, recover it.
@@ -130,6 +143,11 @@ func newRPCApp(sessionPath string, params rpcAppSetupParams) (*rpcApp, error) {
 			slog.Warn("Failed to record role in session meta", "role", params.role, "error", err)
 		}
 	}
+	if params.runID != "" && sessionID != "" {
+		if err := sessionMgr.AddSessionRun(sessionID, params.runID); err != nil {
+			slog.Warn("Failed to record run in session meta", "run", params.runID, "error", err)
+		}
+	}
 
 	// --- Workspace & Tools ---
 	ws, registry, err := createWorkspaceAndRegistry(cwd, cfg)
@@ -208,6 +226,39 @@ func newRPCApp(sessionPath string, params rpcAppSetupParams) (*rpcApp, error) {
 		runID:                 params.runID,
 	}
 
+	compactor.SetUsageMeter(app.usageMeter(sessionID))
+
+	// The todo, task, recall, memory and ask_user tools call back into the app
+	// (session, running agent, RPC output), so they are registered once the
+	// app exists.
+	registry.Register(tools.NewTodoTool(app.setTodos, app.persistTodos))
+	registry.Register(app.newTaskTool())
+	registry.Register(compact.NewRecallTool(app.sessionDir))
+	if memCfg := cfg.Memory; memCfg == nil || !memCfg.Disabled {
+		if memCfg == nil {
+			memCfg = &config.MemoryConfig{}
+		}
+		app.memory = memory.NewManager(filepath.Join(agentDir, "memory"), ws.GetCWD,
+			memory.Budget{MaxEntries: memCfg.MaxEntries, MaxBytes: memCfg.MaxBytes}, memCfg.IndexChars)
+		registry.Register(memory.NewWriteTool(app.memory))
+		registry.Register(memory.NewSearchTool(app.memory))
+		registry.Register(memory.NewDeleteTool(app.memory))
+		// memory_extract proposes into the same store, with the same budget.
+		app.middlewareDefaults = map[string]map[string]any{"memory_extract": {
+			"dir":         filepath.Join(agentDir, "memory"),
+			"max_entries": memCfg.MaxEntries,
+			"max_bytes":   memCfg.MaxBytes,
+		}}
+	} else {
+		app.middlewareDefaults = map[string]map[string]any{"memory_extract": {"disabled": true}}
+	}
+	askUserCfg := cfg.AskUser
+	if askUserCfg == nil {
+		askUserCfg = config.DefaultAskUserConfig()
+	}
+	app.askUser = tools.NewAskUserTool(askUserCfg.TimeoutDuration(), askUserCfg.Fallback, app.emitUserQuestion)
+	registry.Register(app.askUser)
+
 	// Always use LLM-decides compaction (unified context management).
 	decideCfg := compact.DefaultLLMDecideConfig(currentContextWindow)
 	compactorConfig.LLMDecide = &decideCfg
@@ -216,6 +267,30 @@ func newRPCApp(sessionPath string, params rpcAppSetupParams) (*rpcApp, error) {
 		"softThreshold", decideCfg.SoftThreshold,
 		"hardLimit", decideCfg.HardLimit,
 	)
+	if agentCfg != nil {
+		if strategy := agentCfg.CompactionStrategy(); strategy != "" {
+			app.compactionStrategy = strategy
+			slog.Info("Using compaction strategy from agent config", "strategy", strategy)
+		}
+	}
+
+	// compactor.model: agent.yaml overrides config.json.
+	modelRef := compactorConfig.Model
+	if agentCfg != nil && agentCfg.CompactionModel() != nil {
+		modelRef = agentCfg.CompactionModel()
+	}
+	if modelRef != nil && modelRef.Name != "" {
+		resolved, err := resolveCompactionModel(cfg, modelRef)
+		if err != nil {
+			slog.Warn("Compaction model unavailable, using the agent model", "model", modelRef.Name, "error", err)
+		} else {
+			app.compactionModel = resolved
+			resolved.apply(compactor)
+			slog.Info("Using separate compaction model", "model", resolved.model.ID, "provider", resolved.model.Provider,
+				"contextWindow", resolved.model.ContextWindow, "thinkingLevel", resolved.thinkingLevel)
+		}
+	}
+	app.resolveTitleModel()
 
 	return app, nil
 }
@@ -269,24 +344,50 @@ func resolveModelAndKey(cfg *config.Config) (llm.Model, string, config.ModelSpec
 	return model, apiKey, activeSpec, nil
 }
 
-// loadOrCreateSession loads an existing session or creates a new one.
-func loadOrCreateSession(sessionPath string, cwd string) (*session.Session, string, string, *session.SessionManager, error) {
-	sessionsDir, err := session.GetDefaultSessionsDir(cwd)
-	if err != nil {
-		return nil, "", "", nil, fmt.Errorf("failed to get sessions path: %w", err)
+// startAutoGC collects old sessions, runs and traces in the background
+// when the retention policy asks for it, at most once per interval across
+// agents. The session this agent uses is kept.
+func startAutoGC(retention *config.RetentionConfig, agentDir, sessionID string) {
+	if retention == nil || !retention.Auto {
+		return
 	}
+	policy := retention.Policy()
+	policy.Keep = []string{sessionID}
+	go func() {
+		report, err := session.AutoCollectGarbage(agentDir, policy, retention.AutoInterval(), time.Now())
+		if err != nil {
+			slog.Warn("Automatic session GC failed", "error", err)
+			return
+		}
+		if report != nil {
+			slog.Info("Automatic session GC", "removed", len(report.Removed), "bytes", report.Bytes, "errors", len(report.Errors))
+		}
+	}()
+}
 
-	if sessionPath != "" {
-		sessionsDir = filepath.Dir(sessionPath)
+// loadOrCreateSession loads an existing session or creates a new one. A nil
+// store keeps sessions in files, under the directory of sessionPath or the
+// default sessions directory for cwd.
+func loadOrCreateSession(sessionPath string, cwd string, store session.SessionStore) (*session.Session, string, string, *session.SessionManager, error) {
+	if store == nil {
+		sessionsDir, err := session.GetDefaultSessionsDir(cwd)
+		if err != nil {
+			return nil, "", "", nil, fmt.Errorf("failed to get sessions path: %w", err)
+		}
+		if sessionPath != "" {
+			sessionsDir = filepath.Dir(sessionPath)
+		}
+		store = session.NewFileStore(sessionsDir)
 	}
-	sessionMgr := session.NewSessionManager(sessionsDir)
+	sessionMgr := session.NewSessionManagerWithStore(store)
 
 	var sess *session.Session
 	var sessionID string
 	var sessionName string
+	var err error
 
 	if sessionPath != "" {
-		sess, err = session.LoadSession(sessionPath)
+		sess, err = sessionMgr.GetSession(sessionPath)
 		if err != nil {
 			return nil, "", "", nil, fmt.Errorf("failed to load session from %s: %w", sessionPath, err)
 		}
@@ -323,6 +424,43 @@ func loadOrCreateSession(sessionPath string, cwd string) (*session.Session, stri
 	return sess, sessionID, sessionName, sessionMgr, nil
 }
 
+// acquireSession makes this process the owner of sess, or opens it
+// read-only. A session resumed implicitly (no --session) that another
+// process owns is left to it, and a new session is started instead.
+func acquireSession(sess *session.Session, sessionID, sessionName string, sessionMgr *session.SessionManager, explicit bool, params rpcAppSetupParams) (*session.Session, string, string, error) {
+	if params.readOnly {
+		sess.SetReadOnly()
+		slog.Info("Opened session read-only", "id", sessionID)
+		return sess, sessionID, sessionName, nil
+	}
+
+	owner := session.NewSessionOwner(params.runID)
+	err := sess.Lock(owner, params.forceTakeover)
+	var locked *session.SessionLockedError
+	if errors.As(err, &locked) && !explicit {
+		slog.Info("Current session is in use; starting a new one", "id", sessionID, "owner", locked.Owner.String())
+		name := time.Now().Format("20060102-150405")
+		if sess, err = sessionMgr.CreateSession(name, name); err != nil {
+			return nil, "", "", fmt.Errorf("failed to create new session: %w", err)
+		}
+		sessionID, sessionName = sess.GetID(), name
+		if err := sessionMgr.SetCurrent(sessionID); err != nil {
+			slog.Info("Failed to set current session:", "value", err)
+		}
+		if err := sessionMgr.SaveCurrent(); err != nil {
+			slog.Info("Failed to update session metadata:", "value", err)
+		}
+		err = sess.Lock(owner, false)
+	}
+	if errors.As(err, &locked) {
+		return nil, "", "", fmt.Errorf("%w; use --read-only to open it without writing, or --force-takeover to take it over", err)
+	}
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to lock session: %w", err)
+	}
+	return sess, sessionID, sessionName, nil
+}
+
 // createWorkspaceAndRegistry creates the workspace and tool registry.
 func createWorkspaceAndRegistry(cwd string, cfg *config.Config) (*tools.Workspace, *tools.Registry, error) {
 	ws, err := tools.NewWorkspace(cwd)
@@ -363,6 +501,81 @@ func createCompactor(cfg *config.Config, model llm.Model, apiKey string, context
 	return compactor, compactorConfig
 }
 
+// usageMeter returns the compaction usage meter of session id.
+func (app *rpcApp) usageMeter(id string) *compact.UsageMeter {
+	return app.meter(&app.compactionUsage, id)
+}
+
+// titleMeter returns the title usage meter of session id.
+func (app *rpcApp) titleMeter(id string) *compact.UsageMeter {
+	return app.meter(&app.titleUsage, id)
+}
+
+// meter returns the meter of session id in meters, adding it if needed.
+func (app *rpcApp) meter(meters *map[string]*compact.UsageMeter, id string) *compact.UsageMeter {
+	app.stateMu.Lock()
+	defer app.stateMu.Unlock()
+	if *meters == nil {
+		*meters = make(map[string]*compact.UsageMeter)
+	}
+	meter := (*meters)[id]
+	if meter == nil {
+		meter = &compact.UsageMeter{}
+		(*meters)[id] = meter
+	}
+	return meter
+}
+
+// loopCompactor wraps app.compactor for the agent loop and manual
+// compaction: the extractive compactor for roles that pick it in
+// agent.yaml, otherwise the LLM compactor with the extractive one as its
+// fallback.
+func (app *rpcApp) loopCompactor() agentctx.Compactor {
+	if app.compactor == nil {
+		return nil
+	}
+	extractive := compact.NewExtractiveCompactor(app.compactor)
+	if app.compactionStrategy == compact.StrategyExtractive {
+		return extractive
+	}
+	return compact.NewFallbackCompactor(app.compactor, extractive)
+}
+
+// resolvedCompactionModel is a compactor.model resolved through models.json.
+type resolvedCompactionModel struct {
+	model         llm.Model
+	apiKey        string
+	thinkingLevel string
+}
+
+// resolveCompactionModel looks up ref in models.json like --model does and
+// resolves the API key of its provider.
+func resolveCompactionModel(cfg *config.Config, ref *compact.ModelConfig) (*resolvedCompactionModel, error) {
+	c := *cfg
+	applyModelOverride(&c, ref.Name)
+	model := c.GetLLMModel()
+	apiKey, err := config.ResolveAPIKey(model.Provider)
+	if err != nil {
+		return nil, fmt.Errorf("missing API key for %s: %w", model.Provider, err)
+	}
+	spec, err := resolveActiveModelSpec(&c)
+	if err != nil {
+		slog.Info("Compaction model spec fallback", "error", err)
+	}
+	model = applyModelLimitsFromSpec(model, spec)
+	if ref.ContextWindow > 0 {
+		model.ContextWindow = ref.ContextWindow
+	}
+	return &resolvedCompactionModel{model: model, apiKey: apiKey, thinkingLevel: ref.ThinkingLevel}, nil
+}
+
+// apply makes compactor use the compaction model; nil r is a no-op.
+func (r *resolvedCompactionModel) apply(compactor *compact.Compactor) {
+	if r != nil && compactor != nil {
+		compactor.UseModel(r.model, r.apiKey, r.thinkingLevel)
+	}
+}
+
 // loadSkills loads skills from the agent directory and registers find_skill tool.
 func loadSkills(agentDir string, cwd string, registry *tools.Registry, statsPath string) (*skill.LoadResult, *skill.SkillStatsFile) {
 	skillLoader := skill.NewLoader(agentDir)
@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/tiancaiamao/ai/pkg/agent"
+	"github.com/tiancaiamao/ai/pkg/compact"
+	"github.com/tiancaiamao/ai/pkg/config"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+// titlesEnabled reports whether sessions get a generated title after their
+// first completed turn: only with a cheap model to ask (titles.model or
+// compactor.model), and never with titles.disabled or AI_OFFLINE set. The
+// agent's own model is never used, so titles cost no main-model call.
+func (app *rpcApp) titlesEnabled() bool {
+	if config.Offline() || app.titleModel == nil && app.compactionModel == nil {
+		return false
+	}
+	return app.cfg == nil || app.cfg.Titles == nil || !app.cfg.Titles.Disabled
+}
+
+// resolveTitleModel resolves titles.model. Without one, titles use the
+// compaction model.
+func (app *rpcApp) resolveTitleModel() {
+	if app.cfg == nil || app.cfg.Titles == nil || app.cfg.Titles.Model == "" {
+		return
+	}
+	resolved, err := resolveCompactionModel(app.cfg, &compact.ModelConfig{Name: app.cfg.Titles.Model})
+	if err != nil {
+		slog.Warn("Title model unavailable, using the compaction model", "model", app.cfg.Titles.Model, "error", err)
+		return
+	}
+	app.titleModel = resolved
+}
+
+// titleAfterAgent is an AfterAgentHook. The first time a turn of a session
+// without a title completes in this process, it names the session in the
+// background, so the end of the turn is not held up by another model call.
+func (app *rpcApp) titleAfterAgent(hctx agent.HookContext) {
+	if hctx.AgentCtx == nil || !turnCompleted(hctx.AgentCtx.RecentMessages) {
+		return
+	}
+	app.stateMu.Lock()
+	sess, id := app.sess, app.sessionID
+	if sess == nil || id == "" || app.titleTried[id] {
+		app.stateMu.Unlock()
+		return
+	}
+	if app.titleTried == nil {
+		app.titleTried = make(map[string]bool)
+	}
+	app.titleTried[id] = true
+	app.stateMu.Unlock()
+
+	if sess.IsReadOnly() {
+		return
+	}
+	if meta, err := app.sessionMgr.GetMeta(id); err != nil || meta.IsTitled() {
+		return
+	}
+	messages := append([]agentctx.AgentMessage(nil), hctx.AgentCtx.RecentMessages...)
+	go func() {
+		if err := app.titleSession(context.Background(), sess, id, messages); err != nil {
+			slog.Warn("Failed to generate session title", "session", id, "error", err)
+		}
+	}()
+}
+
+// titleSession asks the title model for a title and tags for messages and
+// records them in the session and its metadata. The call's cost is added to
+// the session's title usage. A title that arrives after the agent switched
+// to another session, or after another process took sess over, is dropped:
+// this process no longer owns sess.
+func (app *rpcApp) titleSession(ctx context.Context, sess *session.Session, id string, messages []agentctx.AgentMessage) error {
+	r := app.titleModel
+	if r == nil {
+		r = app.compactionModel
+	}
+	meter := app.titleMeter(id)
+	title, usage, err := session.GenerateTitle(ctx, r.model, r.apiKey, messages)
+	if usage.InputTokens+usage.OutputTokens > 0 {
+		meter.Add(r.model, usage)
+	}
+	if err != nil {
+		return err
+	}
+	// stateMu is held across the writes: setSession releases the old
+	// session under it, so sess stays owned until they are done.
+	app.stateMu.Lock()
+	defer app.stateMu.Unlock()
+	if app.sess != sess || sess.IsReadOnly() {
+		slog.Info("Dropped session title; the session is no longer owned", "session", id, "title", title.Title)
+		return nil
+	}
+	if _, err := sess.AppendSessionInfo("", title.Title, title.Tags...); err != nil {
+		return err
+	}
+	if err := app.sessionMgr.SetSessionTitle(id, title.Title, title.Tags); err != nil {
+		return err
+	}
+	slog.Info("Generated session title", "session", id, "title", title.Title, "tags", strings.Join(title.Tags, ","))
+	return nil
+}
+
+// turnCompleted reports whether the last message is an assistant reply
+// that ended normally, not in an error or abort.
+func turnCompleted(messages []agentctx.AgentMessage) bool {
+	if len(messages) == 0 {
+		return false
+	}
+	last := messages[len(messages)-1]
+	return last.Role == "assistant" && last.StopReason != "error" && last.StopReason != "aborted" &&
+		strings.TrimSpace(last.ExtractText()) != ""
+}
@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tiancaiamao/ai/pkg/config"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func TestTitlesEnabled(t *testing.T) {
+	t.Setenv("AI_OFFLINE", "")
+	app := &rpcApp{cfg: &config.Config{}}
+	if app.titlesEnabled() {
+		t.Error("titles enabled without a title or compaction model")
+	}
+	app.compactionModel = &resolvedCompactionModel{}
+	if !app.titlesEnabled() {
+		t.Error("titles disabled with a compaction model")
+	}
+	app.compactionModel, app.titleModel = nil, &resolvedCompactionModel{}
+	if !app.titlesEnabled() {
+		t.Error("titles disabled with a title model")
+	}
+	app.cfg.Titles = &config.TitlesConfig{Disabled: true}
+	if app.titlesEnabled() {
+		t.Error("titles.disabled ignored")
+	}
+	app.cfg.Titles = nil
+	t.Setenv("AI_OFFLINE", "1")
+	if app.titlesEnabled() {
+		t.Error("titles enabled offline")
+	}
+}
+
+func TestTurnCompleted(t *testing.T) {
+	reply := agentctx.NewAssistantMessage()
+	reply.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "done"}}
+	aborted := reply
+	aborted.StopReason = "aborted"
+	for _, tt := range []struct {
+		messages []agentctx.AgentMessage
+		want     bool
+	}{
+		{nil, false},
+		{[]agentctx.AgentMessage{agentctx.NewUserMessage("hi")}, false},
+		{[]agentctx.AgentMessage{agentctx.NewUserMessage("hi"), agentctx.NewAssistantMessage()}, false},
+		{[]agentctx.AgentMessage{agentctx.NewUserMessage("hi"), aborted}, false},
+		{[]agentctx.AgentMessage{agentctx.NewUserMessage("hi"), reply}, true},
+	} {
+		if got := turnCompleted(tt.messages); got != tt.want {
+			t.Errorf("turnCompleted(%d messages) = %v, want %v", len(tt.messages), got, tt.want)
+		}
+	}
+}
+
+func TestTitleSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"x","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"{\"title\": \"Fix the login bug\", \"tags\": [\"auth\"]}"},"finish_reason":null}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"x","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":1000,"completion_tokens":20,"total_tokens":1020}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	sm := session.NewSessionManager(t.TempDir())
+	sess, err := sm.CreateSession("20260101-120000", "20260101-120000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := sm.CreateSession("20260101-130000", "Fix the login page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &rpcApp{
+		sess: other, sessionMgr: sm,
+		titleModel: &resolvedCompactionModel{
+			model:  llm.Model{ID: "small", Provider: "p", BaseURL: server.URL, API: "openai", Cost: &llm.ModelCost{Input: 1, Output: 5}},
+			apiKey: "k",
+		},
+	}
+	messages := []agentctx.AgentMessage{agentctx.NewUserMessage("login fails with a 500")}
+	// The agent has moved on to another session: the title is dropped.
+	if err := app.titleSession(context.Background(), sess, sess.GetID(), messages); err != nil {
+		t.Fatal(err)
+	}
+	if sess.GetSessionTitle() == "Fix the login bug" {
+		t.Errorf("title %q written to a session that is no longer current", sess.GetSessionTitle())
+	}
+	if meta, err := sm.GetMeta(sess.GetID()); err != nil || meta.IsTitled() {
+		t.Errorf("meta = %+v, %v", meta, err)
+	}
+
+	app.sess = sess
+	if err := app.titleSession(context.Background(), sess, sess.GetID(), messages); err != nil {
+		t.Fatal(err)
+	}
+	if sess.GetSessionTitle() != "Fix the login bug" || strings.Join(sess.GetSessionTags(), ",") != "auth" {
+		t.Errorf("title %q, tags %v", sess.GetSessionTitle(), sess.GetSessionTags())
+	}
+	if meta, err := sm.GetMeta(sess.GetID()); err != nil || meta.Title != "Fix the login bug" || meta.Name != "20260101-120000" {
+		t.Errorf("meta = %+v, %v", meta, err)
+	}
+	// Both calls are paid for, the dropped one included.
+	if usage := app.titleMeter(sess.GetID()).Usage(); usage.Calls != 2 || usage.InputTokens != 2000 || usage.Cost <= 0 {
+		t.Errorf("title usage = %+v", usage)
+	}
+
+	// A session another process took over is not written to.
+	readOnly, err := sm.CreateSession("20260101-140000", "20260101-140000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnly.SetReadOnly()
+	app.sess = readOnly
+	if err := app.titleSession(context.Background(), readOnly, readOnly.GetID(), messages); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := sm.GetMeta(readOnly.GetID()); err != nil || meta.IsTitled() {
+		t.Errorf("read-only session meta = %+v, %v", meta, err)
+	}
+
+	// Both titles contain "login": the query is ambiguous.
+	if _, err := app.handleResume("login"); err == nil || !strings.Contains(err.Error(), "2 sessions match") {
+		t.Errorf("ambiguous resume: %v", err)
+	}
+	if _, err := app.handleResume("kubernetes"); err == nil || !strings.Contains(err.Error(), "session not found") {
+		t.Errorf("unmatched resume: %v", err)
+	}
+}
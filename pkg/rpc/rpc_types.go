@@ -5,6 +5,8 @@ import (
 
 	"github.com/tiancaiamao/ai/pkg/compact"
 	"github.com/tiancaiamao/ai/pkg/config"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
 )
 
 // RPCCommand represents a command received on stdin.
@@ -51,6 +53,7 @@ type SessionState struct {
 	SessionFile           string                   `json:"sessionFile,omitempty"`
 	SessionID             string                   `json:"sessionId,omitempty"`
 	SessionName           string                   `json:"sessionName,omitempty"`
+	SessionReadOnly       bool                     `json:"sessionReadOnly,omitempty"` // opened read-only, or taken over by another run
 	AIPid                 int                      `json:"aiPid,omitempty"`
 	AILogPath             string                   `json:"aiLogPath,omitempty"`
 	AIWorkingDir          string                   `json:"aiWorkingDir,omitempty"`  // Current working directory
@@ -98,6 +101,38 @@ type SessionStats struct {
 	Workspace string `json:"workspace,omitempty"`
 	// CurrentWorkdir is the current working directory path
 	CurrentWorkdir string `json:"currentWorkdir,omitempty"`
+	// CompactionUsage is the usage of compaction calls (summaries and
+	// compact checks) of the session in this process, set once one is
+	// made. Its cost is included in Cost.
+	CompactionUsage *compact.ModelUsage `json:"compactionUsage,omitempty"`
+	// TitleUsage is the usage of the session's title call in this process,
+	// set once it is made. Its cost is included in Cost.
+	TitleUsage *compact.ModelUsage `json:"titleUsage,omitempty"`
+}
+
+// PinnedMessage is a message compaction keeps verbatim, as listed by /context.
+type PinnedMessage struct {
+	Index    int     `json:"index"` // Index in /messages
+	EntryID  string  `json:"entryId,omitempty"`
+	Role     string  `json:"role"`
+	Kind     string  `json:"kind,omitempty"`
+	Preview  string  `json:"preview"`
+	Priority float64 `json:"priority"`
+}
+
+// PinnedContext lists what compaction never summarizes.
+type PinnedContext struct {
+	// Instructions is true when skills or AGENTS.md rules are loaded. They
+	// are sent as a prefix on every request, so they are always pinned.
+	Instructions bool            `json:"instructions"`
+	Messages     []PinnedMessage `json:"messages"`
+}
+
+// ContextBreakdown is the /context --breakdown result: estimated tokens by
+// category, plus the context window they are measured against.
+type ContextBreakdown struct {
+	agentctx.TokenBreakdown
+	ContextWindow int `json:"contextWindow"`
 }
 
 // ForkMessage represents a message candidate for forking.
@@ -162,3 +197,30 @@ type CompactResult struct {
 	TokensBefore     int    `json:"tokensBefore,omitempty"`
 	TokensAfter      int    `json:"tokensAfter,omitempty"`
 }
+
+// ExportResult represents the result of the /export slash command.
+type ExportResult struct {
+	Path    string `json:"path"`
+	Format  string `json:"format"`
+	Entries int    `json:"entries"`
+	Turns   int    `json:"turns"`
+}
+
+// SearchResult represents the result of the /search slash command.
+type SearchResult struct {
+	Query string              `json:"query"`
+	Hits  []session.SearchHit `json:"hits"`
+}
+
+// BranchesResult represents the result of the /branches slash command.
+type BranchesResult struct {
+	Branches []session.BranchInfo `json:"branches"`
+}
+
+// MergeBranchResult represents the result of the /merge-branch slash command.
+type MergeBranchResult struct {
+	Merged  string               `json:"merged"`
+	EntryID string               `json:"entryId"`
+	Summary string               `json:"summary"`
+	Files   []session.FileChange `json:"files"`
+}
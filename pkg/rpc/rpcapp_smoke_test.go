@@ -65,7 +65,7 @@ func runRPCSmoke(t *testing.T, tmpDir string, cmds []string, modelOverride strin
 		respCh <- readResponses(outReader)
 	}()
 
-	_ = RunRPC(tmpDir, "", reader, outWriter, "", 0, 5*time.Second, "", modelOverride, "smoke-test")
+	_ = RunRPC(tmpDir, "", reader, outWriter, "", 0, 5*time.Second, "", modelOverride, "smoke-test", false, false)
 	outWriter.Close()
 
 	all := <-respCh
@@ -217,10 +217,70 @@ func TestRPCAppMessages(t *testing.T) {
 	}
 }
 
-func TestRPCAppExportHTML(t *testing.T) {
-	responses := runRPCSmoke(t, t.TempDir(), []string{`{"type":"export_html"}`}, "")
-	if len(responses) == 0 {
-		t.Fatal("expected export_html response")
+func TestRPCAppExport(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "session.md")
+	responses := runRPCSmoke(t, t.TempDir(), []string{
+		`{"type":"export_html"}`,
+		`{"type":"export","message":"` + out + `"}`,
+		`{"type":"export","message":"pdf"}`,
+	}, "")
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 export responses, got %d", len(responses))
+	}
+	assertCmdSuccess(t, responses[0], "export_html")
+	data, _ := responses[0]["data"].(map[string]any)
+	if path, _ := data["path"].(string); !strings.HasSuffix(path, ".html") {
+		t.Errorf("export_html path = %v", data["path"])
+	} else if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+	assertCmdSuccess(t, responses[1], "export md")
+	if data, _ := responses[1]["data"].(map[string]any); data["format"] != "md" {
+		t.Errorf("export format = %v, want md (from extension)", data["format"])
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Error(err)
+	}
+	if success, _ := responses[2]["success"].(bool); success {
+		t.Error("export pdf: expected failure")
+	}
+}
+
+func TestRPCAppSearch(t *testing.T) {
+	responses := runRPCSmoke(t, t.TempDir(), []string{
+		`{"type":"search","message":"deadlock --role user"}`,
+		`{"type":"search","message":"--role user"}`,
+		`{"type":"fork","message":"no-such-session:e1"}`,
+	}, "")
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(responses))
+	}
+	assertCmdSuccess(t, responses[0], "search")
+	data, _ := responses[0]["data"].(map[string]any)
+	if hits, ok := data["hits"].([]any); !ok || len(hits) != 0 || data["query"] != "deadlock" {
+		t.Errorf("search data = %v", data)
+	}
+	for i, name := range []string{"search without terms", "fork from missing session"} {
+		if success, _ := responses[i+1]["success"].(bool); success {
+			t.Errorf("%s: expected failure", name)
+		}
+	}
+}
+
+func TestRPCAppBranches(t *testing.T) {
+	responses := runRPCSmoke(t, t.TempDir(), []string{
+		`{"type":"branches"}`,
+		`{"type":"diff-branch"}`,
+		`{"type":"merge-branch","message":"1"}`,
+	}, "")
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(responses))
+	}
+	// A new session has no messages, so there are no branches yet.
+	for i, name := range []string{"branches", "diff-branch without refs", "merge-branch"} {
+		if success, _ := responses[i]["success"].(bool); success {
+			t.Errorf("%s: expected failure", name)
+		}
 	}
 }
 
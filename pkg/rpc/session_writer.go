@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"sync"
 
@@ -10,7 +11,7 @@ import (
 	"github.com/tiancaiamao/ai/pkg/session"
 )
 
-// sessionCompactor is a thin mutable wrapper around *compact.Compactor.
+// sessionCompactor is a thin mutable wrapper around the loop compactor.
 // It exists so the loop config can hold a stable Compactor reference
 // that can be swapped on model/session changes without rebuilding the config.
 type sessionCompactor struct {
@@ -55,7 +56,7 @@ func (sc *sessionCompactor) PlantCanary(agentCtx *agentctx.AgentContext) {
 	sc.mu.Lock()
 	comp := sc.compactor
 	sc.mu.Unlock()
-	if c, ok := comp.(*compact.Compactor); ok {
+	if c, ok := comp.(interface{ SetCanaryValue(string) }); ok {
 		val := compact.InsertCanary(agentCtx)
 		c.SetCanaryValue(val)
 	}
@@ -73,11 +74,15 @@ type sessionWriter struct {
 	closed bool
 	ch     chan sessionWriteRequest
 	wg     sync.WaitGroup
+	// onTakenOver is called when another process takes the session over;
+	// the messages after it are no longer saved.
+	onTakenOver func(error)
 }
 
-func newSessionWriter(buffer int) *sessionWriter {
+func newSessionWriter(buffer int, onTakenOver func(error)) *sessionWriter {
 	writer := &sessionWriter{
-		ch: make(chan sessionWriteRequest, buffer),
+		ch:          make(chan sessionWriteRequest, buffer),
+		onTakenOver: onTakenOver,
 	}
 	writer.wg.Add(1)
 	go func() {
@@ -86,7 +91,14 @@ func newSessionWriter(buffer int) *sessionWriter {
 			if req.sess == nil || req.message == nil {
 				continue
 			}
-			if _, err := req.sess.AppendMessage(*req.message); err != nil {
+			_, err := req.sess.AppendMessage(*req.message)
+			switch {
+			case errors.Is(err, session.ErrSessionTakenOver):
+				slog.Warn("Session taken over, no longer saving messages", "error", err)
+				if writer.onTakenOver != nil {
+					writer.onTakenOver(err)
+				}
+			case err != nil:
 				slog.Info("Failed to append session message:", "value", err)
 			}
 		}
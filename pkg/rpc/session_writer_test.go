@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"errors"
+	"path/filepath"
 	"testing"
 
 	agentctx "github.com/tiancaiamao/ai/pkg/context"
@@ -9,7 +11,7 @@ import (
 
 func TestSessionWriterAppend(t *testing.T) {
 	sess := session.NewSession(t.TempDir())
-	writer := newSessionWriter(16)
+	writer := newSessionWriter(16, nil)
 	defer writer.Close()
 
 	writer.Append(sess, agentctx.NewUserMessage("msg-1"))
@@ -23,3 +25,31 @@ func TestSessionWriterAppend(t *testing.T) {
 		t.Fatalf("expected 2 messages, got %d", len(messages))
 	}
 }
+
+func TestSessionWriterReportsTakeover(t *testing.T) {
+	sm := session.NewSessionManager(filepath.Join(t.TempDir(), "--proj--"))
+	sess, err := sm.CreateSession("main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Lock(session.NewSessionOwner("run1"), false); err != nil {
+		t.Fatal(err)
+	}
+	other, err := session.LoadSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Lock(session.NewSessionOwner("run2"), true); err != nil {
+		t.Fatal(err)
+	}
+
+	var reported []error
+	writer := newSessionWriter(16, func(err error) { reported = append(reported, err) })
+	writer.Append(sess, agentctx.NewUserMessage("lost"))
+	writer.Append(sess, agentctx.NewUserMessage("lost too"))
+	writer.Close()
+
+	if len(reported) != 1 || !errors.Is(reported[0], session.ErrSessionTakenOver) {
+		t.Fatalf("reported = %v, want one ErrSessionTakenOver", reported)
+	}
+}
@@ -0,0 +1,491 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// BranchInfo is one line of work: the path from a root entry to a leaf,
+// in the current session or in a session forked from the same tree. Forks
+// copy their entries with the same IDs, so branches of different sessions
+// share the entries before the fork.
+type BranchInfo struct {
+	Index       int    `json:"index"` // 1-based position in ListBranches
+	Ref         string `json:"ref"`   // leaf ID in the current session, else "<sessionId>:<leafId>"
+	SessionID   string `json:"sessionId"`
+	SessionName string `json:"sessionName,omitempty"`
+	LeafID      string `json:"leafId"`
+	Current     bool   `json:"current,omitempty"`
+	Messages    int    `json:"messages"`
+	// ForkPoint is the last entry shared with the current branch, and
+	// Diverged the number of messages after it.
+	ForkPoint string    `json:"forkPoint,omitempty"`
+	Diverged  int       `json:"diverged"`
+	Updated   time.Time `json:"updated"`
+	// Summary is the first user message after the fork point (from the
+	// root for the current branch) and the last assistant reply, shortened.
+	Summary string `json:"summary"`
+
+	path []*SessionEntry
+}
+
+// BranchMessage is a message of a branch, shortened for display.
+type BranchMessage struct {
+	EntryID string   `json:"entryId"`
+	Role    string   `json:"role"`
+	Text    string   `json:"text"`
+	Tools   []string `json:"tools,omitempty"`
+}
+
+// FileChange counts the successful edit and write calls on one file.
+type FileChange struct {
+	Path   string `json:"path"`
+	Edits  int    `json:"edits,omitempty"`
+	Writes int    `json:"writes,omitempty"`
+}
+
+// BranchDiff compares two branches from their last shared entry on.
+type BranchDiff struct {
+	A         BranchInfo      `json:"a"`
+	B         BranchInfo      `json:"b"`
+	ForkPoint string          `json:"forkPoint,omitempty"`
+	OnlyA     []BranchMessage `json:"onlyA"`
+	OnlyB     []BranchMessage `json:"onlyB"`
+	FilesA    []FileChange    `json:"filesA"`
+	FilesB    []FileChange    `json:"filesB"`
+}
+
+// branchSource is a fully loaded session whose leaves are listed.
+type branchSource struct {
+	id, name string
+	entries  []*SessionEntry
+	byID     map[string]*SessionEntry
+	leafID   *string
+	current  bool
+}
+
+// ListBranches lists the branches of the current session, current branch
+// first, followed by the branches of every session in sm connected to it
+// by forks. sm may be nil.
+func ListBranches(current *Session, sm *SessionManager) ([]BranchInfo, error) {
+	if err := current.EnsureFullyLoaded(); err != nil {
+		return nil, err
+	}
+	current.mu.Lock()
+	byID := make(map[string]*SessionEntry, len(current.byID))
+	for id, e := range current.byID {
+		byID[id] = e
+	}
+	sources := []*branchSource{{
+		id:      current.header.ID,
+		entries: append([]*SessionEntry(nil), current.entries...),
+		byID:    byID,
+		leafID:  current.leafID,
+		current: true,
+	}}
+	current.mu.Unlock()
+	if sm != nil {
+		sources[0].name = ResolveSessionName(sm, sources[0].id)
+		family, err := forkFamily(sm, current.parentRef())
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, family...)
+	}
+
+	var branches []BranchInfo
+	for _, src := range sources {
+		branches = append(branches, src.branches()...)
+	}
+	if len(branches) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(branches, func(i, j int) bool { return branches[i].Current && !branches[j].Current })
+
+	onCurrent := make(map[string]bool)
+	for _, e := range branches[0].path {
+		onCurrent[e.ID] = true
+	}
+	listed := branches[:0]
+	for _, b := range branches {
+		start := 0
+		for j, e := range b.path {
+			if onCurrent[e.ID] {
+				b.ForkPoint, start = e.ID, j+1
+			}
+		}
+		after := b.path[start:]
+		b.Diverged = countMessages(after)
+		// A fork without messages of its own adds nothing to compare.
+		if !b.Current && b.Diverged == 0 {
+			continue
+		}
+		b.Index = len(listed) + 1
+		if b.Current {
+			after = b.path
+		}
+		b.Summary = branchSummaryLine(after)
+		listed = append(listed, b)
+	}
+	return listed, nil
+}
+
+// branches returns the leaves of src that carry messages, and the current
+// leaf even when later entries branch off below it.
+func (src *branchSource) branches() []BranchInfo {
+	hasChild := make(map[string]bool, len(src.entries))
+	for _, e := range src.entries {
+		if e.ParentID != nil {
+			hasChild[*e.ParentID] = true
+		}
+	}
+	leaf := ""
+	if src.leafID != nil {
+		leaf = *src.leafID
+	} else if len(src.entries) > 0 {
+		leaf = src.entries[len(src.entries)-1].ID
+	}
+
+	var branches []BranchInfo
+	for _, e := range src.entries {
+		current := src.current && e.ID == leaf
+		if hasChild[e.ID] && !current {
+			continue
+		}
+		path := entryPath(e, src.byID)
+		if countMessages(path) == 0 {
+			continue
+		}
+		b := BranchInfo{
+			Ref:         src.id + ":" + e.ID,
+			SessionID:   src.id,
+			SessionName: src.name,
+			LeafID:      e.ID,
+			Current:     current,
+			Messages:    countMessages(path),
+			path:        path,
+		}
+		if src.current {
+			b.Ref = e.ID
+		}
+		if t, err := time.Parse(time.RFC3339Nano, e.Timestamp); err == nil {
+			b.Updated = t
+		}
+		branches = append(branches, b)
+	}
+	return branches
+}
+
+// entryPath returns the entries from the root to leaf.
+func entryPath(leaf *SessionEntry, byID map[string]*SessionEntry) []*SessionEntry {
+	var path []*SessionEntry
+	seen := make(map[string]bool)
+	for e := leaf; e != nil && !seen[e.ID]; {
+		seen[e.ID] = true
+		path = append(path, e)
+		if e.ParentID == nil {
+			break
+		}
+		e = byID[*e.ParentID]
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// forkFamily loads the sessions of sm connected to the session at path by
+// fork links, in either direction, oldest first. path is the session's
+// parentRef, as fork headers name it.
+func forkFamily(sm *SessionManager, path string) ([]*branchSource, error) {
+	metas, err := sm.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	store := sm.Store()
+	ds, dirs := store.(DirStore)
+	parent := make(map[string]string) // session file -> parent session file
+	meta := make(map[string]SessionMeta)
+	for _, m := range metas {
+		file := m.ID
+		if dirs {
+			file = filepath.Join(ds.SessionDir(m.ID), "messages.jsonl")
+		}
+		meta[file] = m
+		header, err := store.ReadHeader(m.ID)
+		if err == nil && header.ParentSession != "" {
+			parent[file] = header.ParentSession
+		}
+	}
+
+	// Walk up to the root of the fork tree, then collect every session
+	// below it.
+	root := path
+	for seen := map[string]bool{}; parent[root] != "" && !seen[root]; root = parent[root] {
+		seen[root] = true
+	}
+	inFamily := map[string]bool{root: true}
+	for changed := true; changed; {
+		changed = false
+		for child, p := range parent {
+			if inFamily[p] && !inFamily[child] {
+				inFamily[child], changed = true, true
+			}
+		}
+	}
+
+	var family []SessionMeta
+	for file := range inFamily {
+		if m, ok := meta[file]; ok && file != path {
+			family = append(family, m)
+		}
+	}
+	sort.Slice(family, func(i, j int) bool { return family[i].CreatedAt.Before(family[j].CreatedAt) })
+
+	var sources []*branchSource
+	for _, m := range family {
+		sess, err := openSession(store, m.ID, true)
+		if err != nil {
+			continue
+		}
+		sources = append(sources, &branchSource{
+			id:      m.ID,
+			name:    m.Name,
+			entries: sess.entries,
+			byID:    sess.byID,
+		})
+	}
+	return sources, nil
+}
+
+// ResolveBranch finds ref among branches: a 1-based index, a leaf ref, a
+// leaf entry ID, or a session ID or name, meaning that session's latest leaf.
+func ResolveBranch(branches []BranchInfo, ref string) (BranchInfo, error) {
+	ref = strings.TrimSpace(ref)
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(branches) {
+			return BranchInfo{}, fmt.Errorf("branch %d out of range (1-%d)", n, len(branches))
+		}
+		return branches[n-1], nil
+	}
+	for _, b := range branches {
+		if b.Ref == ref || b.LeafID == ref {
+			return b, nil
+		}
+	}
+	var latest *BranchInfo
+	for i, b := range branches {
+		if ref != "" && (b.SessionID == ref || b.SessionName == ref) && (latest == nil || b.Updated.After(latest.Updated)) {
+			latest = &branches[i]
+		}
+	}
+	if latest == nil {
+		return BranchInfo{}, fmt.Errorf("branch not found: %s (use /branches to list them)", ref)
+	}
+	return *latest, nil
+}
+
+// DiffBranches returns the messages and file changes of a and b after
+// their last shared entry.
+func DiffBranches(a, b BranchInfo) *BranchDiff {
+	onA := make(map[string]bool, len(a.path))
+	for _, e := range a.path {
+		onA[e.ID] = true
+	}
+	diff := &BranchDiff{A: a, B: b}
+	startB := 0
+	for i, e := range b.path {
+		if onA[e.ID] {
+			diff.ForkPoint, startB = e.ID, i+1
+		}
+	}
+	startA := 0
+	for i, e := range a.path {
+		if e.ID == diff.ForkPoint {
+			startA = i + 1
+		}
+	}
+	diff.OnlyA, diff.FilesA = branchMessages(a.path[startA:]), FileChanges(pathMessages(a.path[startA:]))
+	diff.OnlyB, diff.FilesB = branchMessages(b.path[startB:]), FileChanges(pathMessages(b.path[startB:]))
+	return diff
+}
+
+// MessagesAfter returns the messages of b after entry id, or all of them
+// when id is not on b.
+func (b BranchInfo) MessagesAfter(id string) []agentctx.AgentMessage {
+	start := 0
+	for i, e := range b.path {
+		if e.ID == id {
+			start = i + 1
+		}
+	}
+	return pathMessages(b.path[start:])
+}
+
+func pathMessages(path []*SessionEntry) []agentctx.AgentMessage {
+	var messages []agentctx.AgentMessage
+	for _, e := range path {
+		switch {
+		case e.Type == EntryTypeMessage && e.Message != nil:
+			msg := *e.Message
+			msg.EntryID = e.ID
+			messages = append(messages, msg)
+		case e.Type == EntryTypeBranchSummary && e.Summary != "":
+			msg := branchSummaryMessage(e.Summary, e.Timestamp)
+			msg.EntryID = e.ID
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func countMessages(path []*SessionEntry) int {
+	n := 0
+	for _, e := range path {
+		if e.Type == EntryTypeMessage || e.Type == EntryTypeBranchSummary {
+			n++
+		}
+	}
+	return n
+}
+
+func branchMessages(path []*SessionEntry) []BranchMessage {
+	messages := []BranchMessage{}
+	for _, e := range path {
+		if e.Type != EntryTypeMessage && e.Type != EntryTypeBranchSummary {
+			continue
+		}
+		role, text := TreeEntryLabel(*e)
+		msg := BranchMessage{EntryID: e.ID, Role: role, Text: truncateText(oneLine(text), 200)}
+		if e.Message != nil {
+			for _, call := range e.Message.ExtractToolCalls() {
+				msg.Tools = append(msg.Tools, call.Name)
+			}
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// branchSummaryLine describes a branch by its first user message and its
+// last assistant reply.
+func branchSummaryLine(path []*SessionEntry) string {
+	var first, last string
+	for _, e := range path {
+		if e.Type != EntryTypeMessage || e.Message == nil {
+			continue
+		}
+		text := oneLine(e.Message.ExtractText())
+		switch {
+		case text == "":
+		case e.Message.Role == "user" && first == "":
+			first = text
+		case e.Message.Role == "assistant":
+			last = text
+		}
+	}
+	switch {
+	case first != "" && last != "":
+		return truncateText(first, 60) + " → " + truncateText(last, 80)
+	case first != "":
+		return truncateText(first, 140)
+	default:
+		return truncateText(last, 140)
+	}
+}
+
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// FileChanges lists the files changed by successful edit and write calls
+// in messages, in the order they were first changed.
+func FileChanges(messages []agentctx.AgentMessage) []FileChange {
+	calls := make(map[string]agentctx.ToolCallContent)
+	changes := []FileChange{}
+	index := make(map[string]int)
+	for i := range messages {
+		msg := &messages[i]
+		switch msg.Role {
+		case "assistant":
+			for _, call := range msg.ExtractToolCalls() {
+				calls[call.ID] = call
+			}
+		case "toolResult":
+			call, ok := calls[msg.ToolCallID]
+			if !ok || msg.IsError || (call.Name != "edit" && call.Name != "write") {
+				continue
+			}
+			path, _ := call.Arguments["path"].(string)
+			if path == "" {
+				continue
+			}
+			n, ok := index[path]
+			if !ok {
+				n = len(changes)
+				index[path] = n
+				changes = append(changes, FileChange{Path: path})
+			}
+			if call.Name == "edit" {
+				changes[n].Edits++
+			} else {
+				changes[n].Writes++
+			}
+		}
+	}
+	return changes
+}
+
+// FormatFileChanges renders changes as a Markdown list, one file per line.
+func FormatFileChanges(changes []FileChange) string {
+	var b strings.Builder
+	for _, c := range changes {
+		var counts []string
+		if c.Edits > 0 {
+			counts = append(counts, plural(c.Edits, "edit"))
+		}
+		if c.Writes > 0 {
+			counts = append(counts, plural(c.Writes, "write"))
+		}
+		fmt.Fprintf(&b, "- %s (%s)\n", c.Path, strings.Join(counts, ", "))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// AppendBranchSummary records what another branch concluded, as a branch
+// summary entry on the current branch. fromRef names that branch. It
+// returns the message the entry adds to the agent context.
+func (s *Session) AppendBranchSummary(fromRef, summary string) (agentctx.AgentMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &SessionEntry{
+		Type:      EntryTypeBranchSummary,
+		ID:        generateEntryID(s.byID),
+		ParentID:  s.leafID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Summary:   summary,
+		FromID:    fromRef,
+	}
+	s.addEntry(entry)
+	msg := branchSummaryMessage(summary, entry.Timestamp)
+	msg.EntryID = entry.ID
+	if err := s.persistEntry(entry); err != nil {
+		return msg, err
+	}
+	s.indexEntryLocked(entry)
+	return msg, nil
+}
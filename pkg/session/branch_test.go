@@ -0,0 +1,127 @@
+package session
+
+import (
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// appendEdit appends a user prompt and an assistant turn that calls tool on
+// path, with its result.
+func appendEdit(t *testing.T, sess *Session, prompt, tool, path string, failed bool) {
+	t.Helper()
+	call := agentctx.NewAssistantMessage()
+	call.Content = []agentctx.ContentBlock{agentctx.ToolCallContent{
+		ID: prompt, Type: "toolCall", Name: tool, Arguments: map[string]any{"path": path},
+	}}
+	result := agentctx.NewToolResultMessage(prompt, tool, []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "ok"}}, failed)
+	reply := agentctx.NewAssistantMessage()
+	reply.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "done: " + prompt}}
+	for _, msg := range []agentctx.AgentMessage{agentctx.NewUserMessage(prompt), call, result, reply} {
+		if _, err := sess.AppendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListBranches(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	sess, err := sm.CreateSession("main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("start")); err != nil {
+		t.Fatal(err)
+	}
+	forkPoint := sess.GetLeafID()
+	appendEdit(t, sess, "try a", "edit", "a.go", false)
+	leafA := *sess.GetLeafID()
+
+	// A second branch in the same session, now current.
+	if err := sess.Branch(*forkPoint); err != nil {
+		t.Fatal(err)
+	}
+	appendEdit(t, sess, "try b", "write", "b.go", false)
+
+	// A fork of the first branch that went further, and an empty fork.
+	fork, err := sm.ForkSessionFrom(sess, &leafA, "fork-a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEdit(t, fork, "try c", "edit", "c.go", true)
+	if _, err := sm.ForkSessionFrom(sess, forkPoint, "empty", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	branches, err := ListBranches(sess, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 3 {
+		t.Fatalf("branches = %+v", branches)
+	}
+	current, other, forked := branches[0], branches[1], branches[2]
+	if !current.Current || current.Messages != 5 || current.Diverged != 0 || current.Summary != "start → done: try b" || current.Ref != *sess.GetLeafID() {
+		t.Errorf("current = %+v", current)
+	}
+	if other.Ref != leafA || other.ForkPoint != *forkPoint || other.Diverged != 4 || other.Summary != "try a → done: try a" {
+		t.Errorf("other = %+v", other)
+	}
+	if forked.SessionName != "fork-a" || forked.Diverged != 8 || forked.Ref != fork.GetID()+":"+*fork.GetLeafID() {
+		t.Errorf("fork = %+v", forked)
+	}
+
+	for ref, want := range map[string]string{"2": leafA, leafA: leafA, "fork-a": forked.Ref, forked.Ref: forked.Ref} {
+		if b, err := ResolveBranch(branches, ref); err != nil || b.Ref != want {
+			t.Errorf("ResolveBranch(%q) = %q, %v", ref, b.Ref, err)
+		}
+	}
+	for _, ref := range []string{"0", "4", "nope"} {
+		if _, err := ResolveBranch(branches, ref); err == nil {
+			t.Errorf("ResolveBranch(%q): expected error", ref)
+		}
+	}
+
+	diff := DiffBranches(forked, other)
+	if diff.ForkPoint != leafA || len(diff.OnlyB) != 0 || len(diff.OnlyA) != 4 || len(diff.FilesA) != 0 {
+		t.Errorf("fork vs its source = %+v", diff)
+	}
+	diff = DiffBranches(other, current)
+	if diff.ForkPoint != *forkPoint || len(diff.OnlyA) != 4 || diff.OnlyA[1].Tools[0] != "edit" {
+		t.Errorf("diff = %+v", diff)
+	}
+	if got := FormatFileChanges(diff.FilesA) + "|" + FormatFileChanges(diff.FilesB); got != "- a.go (1 edit)|- b.go (1 write)" {
+		t.Errorf("files = %q", got)
+	}
+	if got := len(forked.MessagesAfter(*forkPoint)); got != 8 {
+		t.Errorf("MessagesAfter = %d messages, want 8", got)
+	}
+}
+
+func TestAppendBranchSummary(t *testing.T) {
+	sess := NewSession(t.TempDir())
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sess.AppendBranchSummary("s1:e1", "Tried X; it failed.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg.ExtractText(), "Tried X; it failed.") || msg.EntryID != *sess.GetLeafID() {
+		t.Errorf("message = %+v", msg)
+	}
+
+	loaded, err := LoadSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := loaded.GetEntry(msg.EntryID)
+	if !ok || entry.Type != EntryTypeBranchSummary || entry.FromID != "s1:e1" {
+		t.Errorf("entry = %+v", entry)
+	}
+	messages := loaded.GetMessages()
+	if len(messages) != 2 || messages[1].ExtractText() != msg.ExtractText() {
+		t.Errorf("reloaded context = %+v", messages)
+	}
+}
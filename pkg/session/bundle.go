@@ -0,0 +1,450 @@
+package session
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tiancaiamao/ai/pkg/version"
+)
+
+// BundleVersion is the layout version of session bundles.
+const BundleVersion = 1
+
+// A bundle is a gzipped tar archive holding one session and what is needed
+// to debug it elsewhere:
+//
+//	manifest.json          BundleManifest, always the first member
+//	config.json            the resolved config, secrets redacted
+//	session/...            the session directory: messages.jsonl, meta.json,
+//	                       agent_state.json, compactions/
+//	traces/<file>          the session's trace files
+//	runs/<id>/run.json     runs that used the session
+//	runs/<id>/events.jsonl
+const bundleManifestName = "manifest.json"
+
+// BundleManifest describes a packed session.
+type BundleManifest struct {
+	Version     int       `json:"version"`
+	SessionID   string    `json:"sessionId"`
+	SessionName string    `json:"sessionName,omitempty"`
+	Cwd         string    `json:"cwd"`
+	PackedAt    time.Time `json:"packedAt"`
+	// GitCommit and GitVersion identify the binary that created the
+	// session, from its header; PackerCommit the binary that packed it.
+	GitCommit    string `json:"gitCommit,omitempty"`
+	GitVersion   string `json:"gitVersion,omitempty"`
+	PackerCommit string `json:"packerCommit,omitempty"`
+	// Model is the configured model; Models the provider/model pairs that
+	// answered in the session.
+	Model  string   `json:"model,omitempty"`
+	Models []string `json:"models,omitempty"`
+	Files  []string `json:"files"`
+	Traces []string `json:"traces,omitempty"`
+	Runs   []string `json:"runs,omitempty"`
+}
+
+// PackOptions selects what goes into a bundle besides the session itself.
+type PackOptions struct {
+	AIDir  string   // directory holding traces/ and runs/; empty leaves them out
+	Runs   []string // runs to include besides those recorded in meta.json
+	Config []byte   // redacted config JSON, stored as config.json
+	Model  string   // configured model, "provider/id"
+}
+
+// bundleFile is one archive member.
+type bundleFile struct {
+	name string
+	data []byte
+	mode os.FileMode
+}
+
+// PackSession writes the session in sessionDir, with its trace files and
+// runs, to w as a bundle. The session files are read under the session file
+// lock, so the bundle holds a consistent snapshot.
+func PackSession(w io.Writer, sessionDir string, opts PackOptions) (*BundleManifest, error) {
+	var files []bundleFile
+	s := &Session{sessionDir: sessionDir, persist: true}
+	err := s.withFileWriteLock(func() error {
+		var err error
+		files, err = readSessionFiles(sessionDir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(sessionDir, "messages.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	header, err := readHeaderFromFile(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read session header: %w", err)
+	}
+	manifest := &BundleManifest{
+		Version:      BundleVersion,
+		SessionID:    header.ID,
+		Cwd:          header.Cwd,
+		PackedAt:     time.Now().UTC(),
+		GitCommit:    header.GitCommit,
+		GitVersion:   header.GitVersion,
+		PackerCommit: version.GitCommit,
+		Model:        opts.Model,
+	}
+	runs := append([]string(nil), opts.Runs...)
+	for _, file := range files {
+		manifest.Files = append(manifest.Files, file.name)
+		if file.name == "session/meta.json" {
+			var meta SessionMeta
+			if json.Unmarshal(file.data, &meta) == nil {
+				manifest.SessionName = meta.Name
+				runs = append(runs, meta.Runs...)
+			}
+		}
+	}
+	if sess, err := loadSessionFull(sessionDir); err == nil {
+		manifest.Models = sessionModels(sess.entries)
+	}
+
+	if opts.Config != nil {
+		files = append(files, bundleFile{name: "config.json", data: opts.Config, mode: 0600})
+	}
+	if opts.AIDir != "" {
+		traces, err := readTraceFiles(filepath.Join(opts.AIDir, "traces"), filepath.Base(sessionDir))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range traces {
+			manifest.Traces = append(manifest.Traces, path.Base(file.name))
+		}
+		files = append(files, traces...)
+
+		seen := make(map[string]bool)
+		for _, id := range runs {
+			if seen[id] || !filepath.IsLocal(id) {
+				continue
+			}
+			seen[id] = true
+			runFiles, err := readRunFiles(filepath.Join(opts.AIDir, "runs", id), id)
+			if err != nil {
+				return nil, err
+			}
+			if len(runFiles) > 0 {
+				manifest.Runs = append(manifest.Runs, id)
+				files = append(files, runFiles...)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files = append([]bundleFile{{name: bundleManifestName, data: data, mode: 0644}}, files...)
+	if err := writeBundle(w, files, manifest.PackedAt); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readSessionFiles reads the files of a session directory, leaving out
+// lock and temporary files, fsck backups and exports.
+func readSessionFiles(sessionDir string) ([]bundleFile, error) {
+	var files []bundleFile
+	err := filepath.WalkDir(sessionDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sessionDir, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel == "exports" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := d.Name()
+		if !d.Type().IsRegular() || strings.HasSuffix(name, ".lock") || strings.Contains(name, ".tmp") || strings.HasSuffix(name, ".bak") {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, bundleFile{name: path.Join("session", filepath.ToSlash(rel)), data: data, mode: 0644})
+		return nil
+	})
+	return files, err
+}
+
+// readTraceFiles reads the trace files of a session, named
+// pid<pid>-sess<session>.*.
+func readTraceFiles(tracesDir, sessionID string) ([]bundleFile, error) {
+	entries, err := os.ReadDir(tracesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var files []bundleFile
+	for _, e := range entries {
+		if id, ok := traceSessionID(e.Name()); !ok || id != sessionID || !e.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(tracesDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bundleFile{name: "traces/" + e.Name(), data: data, mode: 0644})
+	}
+	return files, nil
+}
+
+// readRunFiles reads run.json and events.jsonl of a run, if it exists.
+func readRunFiles(runDir, id string) ([]bundleFile, error) {
+	var files []bundleFile
+	for _, name := range []string{"run.json", "events.jsonl"} {
+		data, err := os.ReadFile(filepath.Join(runDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bundleFile{name: path.Join("runs", id, name), data: data, mode: 0644})
+	}
+	return files, nil
+}
+
+// sessionModels returns the provider/model pairs of the assistant messages.
+func sessionModels(entries []*SessionEntry) []string {
+	seen := make(map[string]bool)
+	var models []string
+	for _, e := range entries {
+		if e.Message == nil || e.Message.Role != "assistant" || e.Message.Model == "" {
+			continue
+		}
+		model := e.Message.Model
+		if e.Message.Provider != "" {
+			model = e.Message.Provider + "/" + model
+		}
+		if !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+func writeBundle(w io.Writer, files []bundleFile, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		hdr := &tar.Header{
+			Name:    file.name,
+			Mode:    int64(file.mode),
+			Size:    int64(len(file.data)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// UnpackOptions says where an unpacked session goes.
+type UnpackOptions struct {
+	// SessionsDir is the project sessions directory that receives the
+	// session, normally GetDefaultSessionsDir(Cwd).
+	SessionsDir string
+	// Cwd replaces the bundle's working directory in the session, so it
+	// can be resumed here. Empty keeps the original paths.
+	Cwd string
+	// AIDir receives traces/ and runs/; empty leaves them out. Existing
+	// traces and runs are kept.
+	AIDir string
+}
+
+// UnpackResult reports what UnpackSession wrote.
+type UnpackResult struct {
+	Manifest   *BundleManifest `json:"manifest"`
+	SessionDir string          `json:"sessionDir"`
+	Traces     []string        `json:"traces,omitempty"`
+	Runs       []string        `json:"runs,omitempty"`
+	// Rewritten counts the paths moved from the bundle's cwd to Cwd.
+	Rewritten int `json:"rewritten"`
+}
+
+// UnpackSession extracts a bundle written by PackSession. The session keeps
+// its ID and must not exist yet. Paths under the bundle's cwd are rewritten
+// to opts.Cwd in the session, meta and run files.
+func UnpackSession(r io.Reader, opts UnpackOptions) (*UnpackResult, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a session bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != bundleManifestName {
+		return nil, fmt.Errorf("not a session bundle: %s is missing", bundleManifestName)
+	}
+	var manifest BundleManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("read %s: %w", bundleManifestName, err)
+	}
+	if manifest.Version > BundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than supported (%d)", manifest.Version, BundleVersion)
+	}
+	if manifest.SessionID == "" || !filepath.IsLocal(manifest.SessionID) || strings.ContainsAny(manifest.SessionID, `/\`) {
+		return nil, fmt.Errorf("bundle has an invalid session ID %q", manifest.SessionID)
+	}
+
+	result := &UnpackResult{Manifest: &manifest, SessionDir: filepath.Join(opts.SessionsDir, manifest.SessionID)}
+	if _, err := os.Stat(result.SessionDir); err == nil {
+		return nil, fmt.Errorf("session %s already exists: %s", manifest.SessionID, result.SessionDir)
+	}
+	if err := os.MkdirAll(opts.SessionsDir, 0755); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(opts.SessionsDir, ".unpack-"+manifest.SessionID+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	rewrite := func(data []byte) []byte { return data }
+	if opts.Cwd != "" && manifest.Cwd != "" && opts.Cwd != manifest.Cwd {
+		rewrite = func(data []byte) []byte {
+			data, n := rewritePaths(data, manifest.Cwd, opts.Cwd)
+			result.Rewritten += n
+			return data
+		}
+	}
+
+	// Traces and runs are written once the session is in place.
+	var later []bundleFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) {
+			return nil, fmt.Errorf("bundle member %q escapes the target directory", hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		top, rest, _ := strings.Cut(hdr.Name, "/")
+		switch {
+		case top == "session" && rest != "":
+			if ext := path.Ext(rest); ext == ".json" || ext == ".jsonl" {
+				data = rewrite(data)
+			}
+			if err := writeBundleFile(filepath.Join(tmpDir, filepath.FromSlash(rest)), data); err != nil {
+				return nil, err
+			}
+		case top == "runs" && strings.HasSuffix(rest, "/run.json"):
+			later = append(later, bundleFile{name: hdr.Name, data: rewrite(data)})
+		case top == "traces" || top == "runs":
+			later = append(later, bundleFile{name: hdr.Name, data: data})
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "messages.jsonl")); err != nil {
+		return nil, fmt.Errorf("bundle holds no messages.jsonl")
+	}
+	if err := os.Rename(tmpDir, result.SessionDir); err != nil {
+		return nil, err
+	}
+	if sess, err := loadSessionFull(result.SessionDir); err == nil {
+		sess.indexEntries()
+	}
+
+	if opts.AIDir == "" {
+		return result, nil
+	}
+	runs := make(map[string]bool)
+	for _, file := range later {
+		target := filepath.Join(opts.AIDir, filepath.FromSlash(file.name))
+		top, rest, _ := strings.Cut(file.name, "/")
+		if top == "runs" {
+			id, _, _ := strings.Cut(rest, "/")
+			if _, seen := runs[id]; !seen {
+				// A run that is already here is kept as it is.
+				_, err := os.Stat(filepath.Join(opts.AIDir, "runs", id))
+				runs[id] = os.IsNotExist(err)
+				if runs[id] {
+					result.Runs = append(result.Runs, id)
+				}
+			}
+			if !runs[id] {
+				continue
+			}
+		} else if _, err := os.Stat(target); err == nil {
+			continue
+		} else {
+			result.Traces = append(result.Traces, rest)
+		}
+		if err := writeBundleFile(target, file.data); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func writeBundleFile(target string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0644)
+}
+
+// rewritePaths replaces the directory from, as a whole path component, with
+// to in JSON text, and returns the number of replacements.
+func rewritePaths(data []byte, from, to string) ([]byte, int) {
+	from, to = strings.TrimRight(from, "/"), strings.TrimRight(to, "/")
+	if from == "" {
+		return data, 0
+	}
+	fromJSON, toJSON := jsonStringBody(from), jsonStringBody(to)
+	re := regexp.MustCompile(regexp.QuoteMeta(fromJSON) + `([^A-Za-z0-9._-]|$)`)
+	n := 0
+	data = re.ReplaceAllFunc(data, func(m []byte) []byte {
+		n++
+		return append([]byte(toJSON), m[len(fromJSON):]...)
+	})
+	return data, n
+}
+
+// jsonStringBody returns s encoded as a JSON string, without the quotes.
+func jsonStringBody(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
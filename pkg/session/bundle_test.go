@@ -0,0 +1,148 @@
+package session
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func TestPackUnpackSession(t *testing.T) {
+	aiDir := t.TempDir()
+	sm := NewSessionManager(filepath.Join(aiDir, "sessions", "--home-alice-proj--"))
+	sess, err := sm.CreateSession("bad run", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.header.Cwd = "/home/alice/proj"
+	if err := sess.rewriteFile(); err != nil {
+		t.Fatal(err)
+	}
+	call := agentctx.NewAssistantMessage()
+	call.Model, call.Provider = "glm-5", "zai"
+	call.Content = []agentctx.ContentBlock{agentctx.ToolCallContent{
+		ID: "c1", Type: "toolCall", Name: "read", Arguments: map[string]any{"path": "/home/alice/proj/main.go"},
+	}}
+	for _, msg := range []agentctx.AgentMessage{agentctx.NewUserMessage("see /home/alice/project and /home/alice/proj"), call} {
+		if _, err := sess.AppendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sess.AppendCompaction("summary", []agentctx.AgentMessage{agentctx.NewUserMessage("kept")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.AddSessionRun(sess.GetID(), "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(sess.GetPath()+".lock", nil, 0644)
+	os.MkdirAll(filepath.Join(sess.GetDir(), "exports"), 0755)
+	os.WriteFile(filepath.Join(sess.GetDir(), "exports", "s.html"), []byte("<html>"), 0644)
+
+	for name, data := range map[string]string{
+		"traces/pid7-sess" + sess.GetID() + ".0.perfetto.json": "[]",
+		"traces/pid8-sessother.0.perfetto.json":                "[]",
+		"runs/abc123/run.json":                                 `{"id":"abc123","cwd":"/home/alice/proj/sub"}`,
+		"runs/abc123/events.jsonl":                             `{"type":"server_start"}` + "\n",
+		"runs/def456/events.jsonl":                             "{}\n",
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(aiDir, name)), 0755)
+		os.WriteFile(filepath.Join(aiDir, name), []byte(data), 0644)
+	}
+
+	var bundle bytes.Buffer
+	manifest, err := PackSession(&bundle, sess.GetDir(), PackOptions{AIDir: aiDir, Config: []byte(`{"model":{}}`), Model: "zai/glm-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.SessionID != sess.GetID() || manifest.SessionName != "bad run" || manifest.Cwd != "/home/alice/proj" ||
+		len(manifest.Traces) != 1 || strings.Join(manifest.Runs, ",") != "abc123" || strings.Join(manifest.Models, ",") != "zai/glm-5" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	files := strings.Join(manifest.Files, " ")
+	if !strings.Contains(files, "session/messages.jsonl") || !strings.Contains(files, "session/compactions/compaction_00001.jsonl") ||
+		strings.Contains(files, ".lock") || strings.Contains(files, "exports") {
+		t.Errorf("files = %s", files)
+	}
+
+	target := t.TempDir()
+	opts := UnpackOptions{SessionsDir: filepath.Join(target, "sessions", "--home-bob-work--"), Cwd: "/home/bob/work", AIDir: target}
+	result, err := UnpackSession(bytes.NewReader(bundle.Bytes()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Traces) != 1 || strings.Join(result.Runs, ",") != "abc123" || result.Rewritten < 3 {
+		t.Errorf("result = %+v", result)
+	}
+
+	loaded, err := LoadSession(result.SessionDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GetID() != sess.GetID() || loaded.header.Cwd != "/home/bob/work" {
+		t.Errorf("header = %+v", loaded.header)
+	}
+	data, _ := os.ReadFile(loaded.GetPath())
+	if !strings.Contains(string(data), "/home/bob/work/main.go") || !strings.Contains(string(data), "/home/alice/project") {
+		t.Errorf("paths not rewritten:\n%s", data)
+	}
+	// The history after the compaction comes from the packed snapshot.
+	if messages := loaded.GetMessages(); len(messages) != 1 || messages[0].ExtractText() != "kept" {
+		t.Errorf("messages = %+v", messages)
+	}
+	if run, err := os.ReadFile(filepath.Join(target, "runs", "abc123", "run.json")); err != nil || !strings.Contains(string(run), "/home/bob/work/sub") {
+		t.Errorf("run.json = %s, %v", run, err)
+	}
+	if report, err := CheckSession(result.SessionDir); err != nil || len(report.Issues) != 0 {
+		t.Errorf("fsck after unpack = %+v, %v", report, err)
+	}
+
+	if _, err := UnpackSession(bytes.NewReader(bundle.Bytes()), opts); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second unpack: %v", err)
+	}
+}
+
+func TestUnpackSession_Rejects(t *testing.T) {
+	bundle := func(files ...bundleFile) *bytes.Buffer {
+		var buf bytes.Buffer
+		if err := writeBundle(&buf, files, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+	manifest := bundleFile{name: bundleManifestName, data: []byte(`{"version":1,"sessionId":"s1"}`)}
+	opts := UnpackOptions{SessionsDir: t.TempDir()}
+
+	for name, in := range map[string]*bytes.Buffer{
+		"not gzip":       bytes.NewBufferString("plain text"),
+		"no manifest":    bundle(bundleFile{name: "session/messages.jsonl", data: []byte("{}")}),
+		"newer version":  bundle(bundleFile{name: bundleManifestName, data: []byte(`{"version":99,"sessionId":"s1"}`)}),
+		"bad session ID": bundle(bundleFile{name: bundleManifestName, data: []byte(`{"version":1,"sessionId":"../x"}`)}),
+		"escaping path":  bundle(manifest, bundleFile{name: "session/../../evil", data: []byte("x")}),
+		"no messages":    bundle(manifest),
+	} {
+		if _, err := UnpackSession(in, opts); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if entries, _ := os.ReadDir(opts.SessionsDir); len(entries) != 0 {
+		t.Errorf("rejected bundles left %d entries behind", len(entries))
+	}
+}
+
+func TestRewritePaths(t *testing.T) {
+	for _, tc := range []struct{ in, from, to, want string }{
+		{`{"cwd":"/a/b"}`, "/a/b", "/c", `{"cwd":"/c"}`},
+		{`"/a/b/x.go /a/bc /a/b.d /a/b"`, "/a/b/", "/c", `"/c/x.go /a/bc /a/b.d /c"`},
+		{`"C:\\w\\p\\f"`, `C:\w\p`, "/c", `"/c\\f"`},
+		{`"/a/b"`, "", "/c", `"/a/b"`},
+	} {
+		got, _ := rewritePaths([]byte(tc.in), tc.from, tc.to)
+		if string(got) != tc.want {
+			t.Errorf("rewritePaths(%s, %q, %q) = %s, want %s", tc.in, tc.from, tc.to, got, tc.want)
+		}
+	}
+}
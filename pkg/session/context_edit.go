@@ -0,0 +1,163 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// Context edit operations.
+const (
+	// ContextEditDrop hides one message from the agent.
+	ContextEditDrop = "drop"
+	// ContextEditCollapse hides a range of messages from the agent and puts
+	// a summary in their place.
+	ContextEditCollapse = "collapse"
+	// ContextEditReplace replaces the content of one tool result.
+	ContextEditReplace = "replace"
+)
+
+// CollapsedKind is the metadata kind of the summary message a collapse inserts.
+const CollapsedKind = "collapsed"
+
+// ContextEdit is a manual change to the messages the agent sees. Hidden
+// messages stay visible to the user, so the change can be reviewed.
+type ContextEdit struct {
+	Op string `json:"op"`
+	// Targets is the message for drop and replace, or the first and last
+	// message of the range for collapse.
+	Targets []MessageRef `json:"targets"`
+	// Text is the summary for collapse or the new content for replace.
+	Text string `json:"text,omitempty"`
+}
+
+// validate checks that edit has the targets and text its operation needs.
+func (e *ContextEdit) validate() error {
+	switch e.Op {
+	case ContextEditDrop:
+		if len(e.Targets) != 1 {
+			return fmt.Errorf("drop needs one target, got %d", len(e.Targets))
+		}
+	case ContextEditReplace:
+		if len(e.Targets) != 1 {
+			return fmt.Errorf("replace needs one target, got %d", len(e.Targets))
+		}
+	case ContextEditCollapse:
+		if len(e.Targets) != 2 {
+			return fmt.Errorf("collapse needs a first and last target, got %d", len(e.Targets))
+		}
+		if e.Text == "" {
+			return fmt.Errorf("collapse needs a summary")
+		}
+	default:
+		return fmt.Errorf("unknown context edit op %q", e.Op)
+	}
+	for _, target := range e.Targets {
+		if target.EntryID == "" && target.Timestamp == 0 {
+			return fmt.Errorf("message has no entry id or timestamp")
+		}
+	}
+	return nil
+}
+
+// ApplyContextEdit returns messages with edit applied. entryID is the ID of
+// the edit's session entry; it becomes the entry ID of a collapse summary,
+// so applying the same collapse twice inserts one summary. messages is not
+// modified.
+func ApplyContextEdit(messages []agentctx.AgentMessage, entryID string, edit *ContextEdit) ([]agentctx.AgentMessage, error) {
+	if err := edit.validate(); err != nil {
+		return messages, err
+	}
+	find := func(ref MessageRef) int {
+		for i, msg := range messages {
+			if ref.matches(msg) {
+				return i
+			}
+		}
+		return -1
+	}
+	first := find(edit.Targets[0])
+	if first < 0 {
+		return messages, fmt.Errorf("%s target %s not found", edit.Op, edit.Targets[0].EntryID)
+	}
+	out := append([]agentctx.AgentMessage(nil), messages...)
+
+	switch edit.Op {
+	case ContextEditDrop:
+		out[first] = hideFromAgent(out[first])
+	case ContextEditReplace:
+		msg := out[first]
+		msg.Content = []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: edit.Text}}
+		out[first] = msg
+	case ContextEditCollapse:
+		last := find(edit.Targets[1])
+		if last < first {
+			return messages, fmt.Errorf("collapse range end %s not found after its start", edit.Targets[1].EntryID)
+		}
+		for _, msg := range out {
+			if entryID != "" && msg.EntryID == entryID {
+				return messages, nil
+			}
+		}
+		for i := first; i <= last; i++ {
+			out[i] = hideFromAgent(out[i])
+		}
+		summary := agentctx.NewUserMessage(fmt.Sprintf("[Collapsed %d messages]\n\n%s", last-first+1, edit.Text)).
+			WithKind(CollapsedKind)
+		summary.EntryID = entryID
+		// One millisecond before the range: the summary sorts first and never
+		// matches a role+timestamp reference to the first collapsed message.
+		summary.Timestamp = out[first].Timestamp - 1
+		out = append(out[:first], append([]agentctx.AgentMessage{summary}, out[first:]...)...)
+	}
+	return out, nil
+}
+
+// hideFromAgent returns a copy of msg the agent no longer sees. The metadata
+// is copied because WithVisibility writes through a shared pointer.
+func hideFromAgent(msg agentctx.AgentMessage) agentctx.AgentMessage {
+	if msg.Metadata != nil {
+		meta := *msg.Metadata
+		msg.Metadata = &meta
+	}
+	return msg.WithVisibility(false, true)
+}
+
+// applyContextEdits applies the context edit entries on path, oldest first.
+// An edit whose target is gone (e.g. summarized by compaction) is skipped.
+func applyContextEdits(path []*SessionEntry, messages []agentctx.AgentMessage) []agentctx.AgentMessage {
+	for _, entry := range path {
+		if entry.Type != EntryTypeContextEdit || entry.Edit == nil {
+			continue
+		}
+		edited, err := ApplyContextEdit(messages, entry.ID, entry.Edit)
+		if err != nil {
+			slog.Debug("[session] Skipping context edit", "entryId", entry.ID, "error", err)
+			continue
+		}
+		messages = edited
+	}
+	return messages
+}
+
+// AppendContextEdit records edit and returns its entry ID. The edit is
+// applied to the messages whenever the session is rebuilt.
+func (s *Session) AppendContextEdit(edit *ContextEdit) (string, error) {
+	if err := edit.validate(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &SessionEntry{
+		Type:      EntryTypeContextEdit,
+		ID:        generateEntryID(s.byID),
+		ParentID:  s.leafID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Edit:      edit,
+	}
+	s.addEntry(entry)
+	return entry.ID, s.persistEntry(entry)
+}
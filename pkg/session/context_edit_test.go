@@ -0,0 +1,135 @@
+package session
+
+import (
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// appendConversation appends messages with increasing timestamps and returns
+// them with their entry IDs set.
+func appendConversation(t *testing.T, sess *Session, msgs ...agentctx.AgentMessage) []agentctx.AgentMessage {
+	t.Helper()
+	for i := range msgs {
+		msgs[i].Timestamp = int64(1000 * (i + 1))
+		id, err := sess.AppendMessage(msgs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[i].EntryID = id
+	}
+	return msgs
+}
+
+func TestContextEdits_SurviveReload(t *testing.T) {
+	dir := t.TempDir()
+	sess := NewSession(dir)
+
+	result := agentctx.NewToolResultMessage("call-1", "read", []agentctx.ContentBlock{
+		agentctx.TextContent{Type: "text", Text: strings.Repeat("line\n", 100)},
+	}, false)
+	msgs := appendConversation(t, sess,
+		agentctx.NewUserMessage("task"),
+		agentctx.NewUserMessage("noise"),
+		result,
+		agentctx.NewUserMessage("old question"),
+		agentctx.NewUserMessage("old answer"),
+		agentctx.NewUserMessage("latest"),
+	)
+
+	edits := []*ContextEdit{
+		{Op: ContextEditDrop, Targets: []MessageRef{NewMessageRef(msgs[1])}},
+		{Op: ContextEditReplace, Targets: []MessageRef{NewMessageRef(msgs[2])}, Text: "100 lines of nothing"},
+		{Op: ContextEditCollapse, Targets: []MessageRef{NewMessageRef(msgs[3]), NewMessageRef(msgs[4])}, Text: "asked and answered"},
+	}
+	for _, edit := range edits {
+		if _, err := sess.AppendContextEdit(edit); err != nil {
+			t.Fatalf("AppendContextEdit(%s): %v", edit.Op, err)
+		}
+	}
+
+	reloaded, err := LoadSession(dir)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	got := reloaded.GetMessages()
+	if len(got) != 7 {
+		t.Fatalf("expected 6 messages plus one collapse summary, got %d", len(got))
+	}
+	var visible []string
+	for _, msg := range got {
+		if msg.IsAgentVisible() {
+			visible = append(visible, msg.ExtractText())
+		}
+	}
+	want := []string{"task", "100 lines of nothing", "[Collapsed 2 messages]\n\nasked and answered", "latest"}
+	if strings.Join(visible, "|") != strings.Join(want, "|") {
+		t.Fatalf("visible messages = %q, want %q", visible, want)
+	}
+	if !got[1].IsUserVisible() {
+		t.Fatal("dropped message should stay visible to the user")
+	}
+	if msgs[1].Metadata != nil && !msgs[1].IsAgentVisible() {
+		t.Fatal("drop modified the caller's message")
+	}
+}
+
+func TestApplyContextEdit_CollapseIsIdempotent(t *testing.T) {
+	msgs := []agentctx.AgentMessage{agentctx.NewUserMessage("a"), agentctx.NewUserMessage("b")}
+	msgs[0].EntryID, msgs[1].EntryID = "a", "b"
+	edit := &ContextEdit{Op: ContextEditCollapse, Targets: []MessageRef{NewMessageRef(msgs[0]), NewMessageRef(msgs[1])}, Text: "ab"}
+
+	once, err := ApplyContextEdit(msgs, "edit", edit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := ApplyContextEdit(once, "edit", edit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(once) != 3 || len(twice) != 3 {
+		t.Fatalf("expected one summary, got %d then %d messages", len(once), len(twice))
+	}
+	if kind := once[0].Metadata.Kind; kind != CollapsedKind || once[0].EntryID != "edit" {
+		t.Fatalf("summary kind %q entry %q", kind, once[0].EntryID)
+	}
+}
+
+func TestApplyContextEdit_Invalid(t *testing.T) {
+	msg := agentctx.NewUserMessage("a")
+	msg.EntryID = "a"
+	ref := NewMessageRef(msg)
+	for name, edit := range map[string]*ContextEdit{
+		"unknown op":         {Op: "rewrite", Targets: []MessageRef{ref}},
+		"drop no target":     {Op: ContextEditDrop},
+		"collapse no text":   {Op: ContextEditCollapse, Targets: []MessageRef{ref, ref}},
+		"collapse one bound": {Op: ContextEditCollapse, Targets: []MessageRef{ref}, Text: "x"},
+		"missing target":     {Op: ContextEditDrop, Targets: []MessageRef{{EntryID: "gone"}}},
+	} {
+		if _, err := ApplyContextEdit([]agentctx.AgentMessage{msg}, "", edit); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestContextEdits_KeptByFork(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	src, err := sm.CreateSession("orig", "Original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := appendConversation(t, src, agentctx.NewUserMessage("keep"), agentctx.NewUserMessage("drop me"))
+	if _, err := src.AppendContextEdit(&ContextEdit{Op: ContextEditDrop, Targets: []MessageRef{NewMessageRef(msgs[1])}}); err != nil {
+		t.Fatal(err)
+	}
+
+	fork, err := sm.ForkSessionFrom(src, src.GetLeafID(), "fork", "Fork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fork.GetMessages()
+	if len(got) != 2 || got[1].IsAgentVisible() {
+		t.Fatalf("fork lost the drop: %+v", got)
+	}
+}
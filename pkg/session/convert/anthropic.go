@@ -0,0 +1,226 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// anthropicMessage is one message of an Anthropic messages request.
+// Content is a string or an array of blocks.
+type anthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// thinking
+	Thinking string `json:"thinking,omitempty"`
+	// tool_use
+	ID    string         `json:"id,omitempty"`
+	Name  string         `json:"name,omitempty"`
+	Input map[string]any `json:"input,omitempty"`
+	// tool_result; Content is a string or an array of text and image blocks.
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	// image
+	Source *anthropicSource `json:"source,omitempty"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+func encodeAnthropic(w io.Writer, messages []agentctx.AgentMessage) error {
+	var out []anthropicMessage
+	var blocks []anthropicBlock
+	role := ""
+	flush := func() error {
+		if len(blocks) == 0 {
+			return nil
+		}
+		data, err := json.Marshal(blocks)
+		if err != nil {
+			return err
+		}
+		out = append(out, anthropicMessage{Role: role, Content: data})
+		blocks = nil
+		return nil
+	}
+
+	for _, msg := range messages {
+		// Tool results go in a user message; consecutive results share one.
+		merge := msg.Role == "toolResult" && role == "user" && len(blocks) > 0 && blocks[len(blocks)-1].Type == "tool_result"
+		if !merge {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		switch msg.Role {
+		case "user":
+			role = "user"
+			blocks = append(blocks, anthropicBlocks(msg.Content)...)
+		case "assistant":
+			role = "assistant"
+			blocks = append(blocks, anthropicBlocks(msg.Content)...)
+		case "toolResult":
+			role = "user"
+			content, err := json.Marshal(anthropicBlocks(msg.Content))
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: content, IsError: msg.IsError})
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if out == nil {
+		out = []anthropicMessage{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Messages []anthropicMessage `json:"messages"`
+	}{out})
+}
+
+func anthropicBlocks(content []agentctx.ContentBlock) []anthropicBlock {
+	blocks := []anthropicBlock{}
+	for _, c := range content {
+		switch c := c.(type) {
+		case agentctx.TextContent:
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: c.Text})
+		case agentctx.ThinkingContent:
+			blocks = append(blocks, anthropicBlock{Type: "thinking", Thinking: c.Thinking})
+		case agentctx.ToolCallContent:
+			input := c.Arguments
+			if input == nil {
+				input = map[string]any{}
+			}
+			blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: c.ID, Name: c.Name, Input: input})
+		case agentctx.ImageContent:
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicSource{Type: "base64", MediaType: c.MimeType, Data: c.Data}})
+		}
+	}
+	return blocks
+}
+
+func decodeAnthropic(data []byte) ([]agentctx.AgentMessage, error) {
+	raws, err := splitMessages(data)
+	if err != nil {
+		return nil, err
+	}
+	toolNames := map[string]string{}
+	var messages []agentctx.AgentMessage
+	for i, raw := range raws {
+		var in anthropicMessage
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		blocks, err := anthropicContent(in.Content)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+
+		switch in.Role {
+		case "system":
+			continue
+		case "assistant":
+			var content []agentctx.ContentBlock
+			for _, b := range blocks {
+				if b.Type == "tool_use" {
+					toolNames[b.ID] = b.Name
+				}
+				if c := agentBlock(b); c != nil {
+					content = append(content, c)
+				}
+			}
+			messages = append(messages, newAssistant(content))
+		case "user":
+			// A user message holds tool results and text; split them,
+			// keeping the order.
+			var content []agentctx.ContentBlock
+			for _, b := range blocks {
+				if b.Type != "tool_result" {
+					if c := agentBlock(b); c != nil {
+						content = append(content, c)
+					}
+					continue
+				}
+				if len(content) > 0 {
+					messages = append(messages, newUser(content))
+					content = nil
+				}
+				result, err := anthropicContent(b.Content)
+				if err != nil {
+					return nil, fmt.Errorf("message %d: tool result %s: %w", i+1, b.ToolUseID, err)
+				}
+				var resultContent []agentctx.ContentBlock
+				for _, rb := range result {
+					if c := agentBlock(rb); c != nil {
+						resultContent = append(resultContent, c)
+					}
+				}
+				messages = append(messages, agentctx.NewToolResultMessage(b.ToolUseID, toolNames[b.ToolUseID], resultContent, b.IsError))
+			}
+			if len(content) > 0 {
+				messages = append(messages, newUser(content))
+			}
+		default:
+			return nil, fmt.Errorf("message %d: unsupported role %q", i+1, in.Role)
+		}
+	}
+	return messages, nil
+}
+
+// anthropicContent decodes string or block content.
+func anthropicContent(raw json.RawMessage) ([]anthropicBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []anthropicBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []anthropicBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, fmt.Errorf("content: %w", err)
+	}
+	return blocks, nil
+}
+
+// agentBlock converts a text, thinking, tool_use or image block. Redacted
+// thinking and other block types are dropped.
+func agentBlock(b anthropicBlock) agentctx.ContentBlock {
+	switch b.Type {
+	case "text":
+		return textBlock(b.Text)
+	case "thinking":
+		return agentctx.ThinkingContent{Type: "thinking", Thinking: b.Thinking}
+	case "tool_use":
+		input := b.Input
+		if input == nil {
+			input = map[string]any{}
+		}
+		return agentctx.ToolCallContent{ID: b.ID, Type: "toolCall", Name: b.Name, Arguments: input}
+	case "image":
+		if b.Source == nil {
+			return nil
+		}
+		if b.Source.Type == "base64" {
+			return imageBlock(b.Source.MediaType, b.Source.Data)
+		}
+		return textBlock("[image: " + b.Source.URL + "]")
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Package convert translates agent messages to and from the message
+// formats of other tools: OpenAI chat messages, Anthropic messages and
+// ShareGPT agent trajectories.
+// Tool calls stay paired with their results by call ID, and images are
+// carried as base64 data in both directions.
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// Message formats.
+const (
+	// FormatOpenAI is OpenAI chat messages, one JSON message per line.
+	// Decoding also accepts a JSON array or an object with "messages".
+	FormatOpenAI = "openai"
+	// FormatAnthropic is an Anthropic messages request body:
+	// {"messages": [...]} with content blocks.
+	FormatAnthropic = "anthropic"
+	// FormatShareGPT is a ShareGPT conversation record, as used by agent
+	// trajectory datasets: {"conversations": [{"from", "value"}, ...]}.
+	// Tool call IDs and thinking are not kept.
+	FormatShareGPT = "sharegpt"
+	// FormatTranscript is the JSON transcript of package export. This
+	// package only detects it; package export decodes it.
+	FormatTranscript = "json"
+)
+
+// Encode writes messages to w in format. Messages hidden from the user are
+// left out.
+func Encode(w io.Writer, format string, messages []agentctx.AgentMessage) error {
+	visible := make([]agentctx.AgentMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.IsUserVisible() {
+			visible = append(visible, msg)
+		}
+	}
+	switch format {
+	case FormatOpenAI:
+		return encodeOpenAI(w, visible)
+	case FormatAnthropic:
+		return encodeAnthropic(w, visible)
+	case FormatShareGPT:
+		return encodeShareGPT(w, visible)
+	}
+	return fmt.Errorf("unknown message format %q", format)
+}
+
+// Decode parses data in format into agent messages. System messages are
+// dropped: the agent builds its own system prompt.
+func Decode(data []byte, format string) ([]agentctx.AgentMessage, error) {
+	switch format {
+	case FormatOpenAI:
+		return decodeOpenAI(data)
+	case FormatAnthropic:
+		return decodeAnthropic(data)
+	case FormatShareGPT:
+		return decodeShareGPT(data)
+	}
+	return nil, fmt.Errorf("unknown message format %q", format)
+}
+
+// Detect guesses the format of data: FormatTranscript for an export
+// transcript, FormatShareGPT for records with "conversations",
+// FormatAnthropic when there are Anthropic content blocks or a top-level
+// system prompt, and FormatOpenAI otherwise.
+func Detect(data []byte) string {
+	data = bytes.TrimSpace(data)
+	var messages []json.RawMessage
+	if len(data) > 0 && data[0] == '{' {
+		var top struct {
+			Version       int               `json:"version"`
+			Entries       json.RawMessage   `json:"entries"`
+			System        json.RawMessage   `json:"system"`
+			Messages      []json.RawMessage `json:"messages"`
+			Conversations json.RawMessage   `json:"conversations"`
+		}
+		if err := json.Unmarshal(data, &top); err != nil {
+			// More than one object: JSONL, of ShareGPT records or of
+			// OpenAI messages.
+			if bytes.Contains(data, []byte(`"conversations"`)) {
+				return FormatShareGPT
+			}
+			return FormatOpenAI
+		}
+		switch {
+		case top.Version > 0 && top.Entries != nil:
+			return FormatTranscript
+		case top.Conversations != nil:
+			return FormatShareGPT
+		case top.System != nil:
+			return FormatAnthropic
+		}
+		messages = top.Messages
+	} else if err := json.Unmarshal(data, &messages); err != nil {
+		return FormatOpenAI
+	}
+
+	for _, raw := range messages {
+		var msg struct {
+			Content       json.RawMessage `json:"content"`
+			Conversations json.RawMessage `json:"conversations"`
+		}
+		if json.Unmarshal(raw, &msg) != nil {
+			continue
+		}
+		if msg.Conversations != nil {
+			return FormatShareGPT
+		}
+		var blocks []struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(msg.Content, &blocks) != nil {
+			continue
+		}
+		for _, b := range blocks {
+			switch b.Type {
+			case "tool_use", "tool_result", "thinking", "image":
+				return FormatAnthropic
+			}
+		}
+	}
+	return FormatOpenAI
+}
+
+// splitMessages parses a JSON array, an object with "messages", or JSONL
+// into raw messages.
+func splitMessages(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no messages")
+	}
+	var messages []json.RawMessage
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, err
+		}
+		return messages, nil
+	}
+	var top struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &top); err == nil && top.Messages != nil {
+		return top.Messages, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("message %d: %w", len(messages)+1, err)
+		}
+		messages = append(messages, raw)
+	}
+	return messages, nil
+}
+
+// parseArguments decodes tool call arguments. Arguments that are not a JSON
+// object are kept as a string under "raw".
+func parseArguments(s string) map[string]any {
+	args := map[string]any{}
+	if s == "" {
+		return args
+	}
+	if err := json.Unmarshal([]byte(s), &args); err != nil {
+		return map[string]any{"raw": s}
+	}
+	return args
+}
+
+func newUser(content []agentctx.ContentBlock) agentctx.AgentMessage {
+	msg := agentctx.NewUserMessage("")
+	msg.Content = content
+	return msg
+}
+
+func newAssistant(content []agentctx.ContentBlock) agentctx.AgentMessage {
+	msg := agentctx.NewAssistantMessage()
+	msg.Content = content
+	return msg
+}
+
+func textBlock(text string) agentctx.TextContent {
+	return agentctx.TextContent{Type: "text", Text: text}
+}
+
+func imageBlock(mimeType, data string) agentctx.ImageContent {
+	return agentctx.ImageContent{Type: "image", MimeType: mimeType, Data: data}
+}
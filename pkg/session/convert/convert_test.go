@@ -0,0 +1,228 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// conversation has thinking, parallel tool calls, an image tool result, an
+// error result and a hidden message.
+func conversation() []agentctx.AgentMessage {
+	call := func(id, name string, args map[string]any) agentctx.ToolCallContent {
+		return agentctx.ToolCallContent{ID: id, Type: "toolCall", Name: name, Arguments: args}
+	}
+	return []agentctx.AgentMessage{
+		agentctx.NewUserMessage("look at the screenshot"),
+		newAssistant([]agentctx.ContentBlock{
+			agentctx.ThinkingContent{Type: "thinking", Thinking: "read both"},
+			textBlock("Reading."),
+			call("c1", "read", map[string]any{"path": "shot.png"}),
+			call("c2", "bash", map[string]any{"command": "false"}),
+		}),
+		agentctx.NewToolResultMessage("c1", "read", []agentctx.ContentBlock{textBlock("image:"), imageBlock("image/png", "iVBORw0KGgo=")}, false),
+		agentctx.NewToolResultMessage("c2", "bash", []agentctx.ContentBlock{textBlock("exit 1")}, true),
+		agentctx.NewUserMessage("hidden").WithVisibility(true, false),
+		newAssistant([]agentctx.ContentBlock{textBlock("done")}),
+	}
+}
+
+// shape summarizes messages for comparison: role, tool fields and content.
+func shape(messages []agentctx.AgentMessage) []string {
+	var out []string
+	for _, msg := range messages {
+		s := msg.Role
+		if msg.Role == "toolResult" {
+			s += "(" + msg.ToolCallID + "," + msg.ToolName + ")"
+		}
+		for _, c := range msg.Content {
+			switch c := c.(type) {
+			case agentctx.TextContent:
+				s += " text:" + c.Text
+			case agentctx.ThinkingContent:
+				s += " thinking:" + c.Thinking
+			case agentctx.ToolCallContent:
+				args, _ := json.Marshal(c.Arguments)
+				s += " call:" + c.ID + ":" + c.Name + string(args)
+			case agentctx.ImageContent:
+				s += " image:" + c.MimeType + ":" + c.Data
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := shape(append(conversation()[:4:4], conversation()[5]))
+	for _, format := range []string{FormatOpenAI, FormatAnthropic} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, format, conversation()); err != nil {
+			t.Fatal(err)
+		}
+		if got := Detect(buf.Bytes()); got != format {
+			t.Errorf("Detect(%s) = %s", format, got)
+		}
+		messages, err := Decode(buf.Bytes(), format)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", format, err, buf.String())
+		}
+		if got := shape(messages); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s round trip:\n got %q\nwant %q\n%s", format, got, want, buf.String())
+		}
+		if format == FormatAnthropic && !messages[3].IsError {
+			t.Error("anthropic: is_error lost")
+		}
+	}
+}
+
+func TestEncodeOpenAI(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, FormatOpenAI, conversation()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("lines = %d, want 5:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []string{
+		`{"role":"user","content":"look at the screenshot"}`,
+		`{"role":"assistant","content":"Reading.","reasoning_content":"read both","tool_calls":[{"id":"c1","type":"function","function":{"name":"read","arguments":"{\"path\":\"shot.png\"}"}},{"id":"c2","type":"function","function":{"name":"bash","arguments":"{\"command\":\"false\"}"}}]}`,
+		`{"role":"tool","content":[{"type":"text","text":"image:"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}}],"tool_call_id":"c1","name":"read"}`,
+	} {
+		if lines[i] != want {
+			t.Errorf("line %d:\n got %s\nwant %s", i, lines[i], want)
+		}
+	}
+}
+
+func TestEncodeAnthropic_MergesToolResults(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, FormatAnthropic, conversation()); err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Messages []struct {
+			Role    string           `json:"role"`
+			Content []anthropicBlock `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, m := range body.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, " "); got != "user assistant user assistant" {
+		t.Fatalf("roles = %q", got)
+	}
+	results := body.Messages[2].Content
+	if len(results) != 2 || results[0].ToolUseID != "c1" || results[1].ToolUseID != "c2" || !results[1].IsError {
+		t.Errorf("tool results = %+v", results)
+	}
+}
+
+func TestDecodeOpenAI_TraceFile(t *testing.T) {
+	// The trace file layout of the evolve pipeline.
+	trace := `{
+  "trace_id": "agent_001-rollout-0",
+  "messages": [
+    {"role": "system", "content": "You are a coding agent..."},
+    {"role": "user", "content": "Debug a User API issue"},
+    {"role": "assistant", "content": null, "tool_calls": [
+      {"id": "call_1", "type": "function", "function": {"name": "read", "arguments": "{\"path\":\"user.py\"}"}}
+    ]},
+    {"role": "tool", "tool_call_id": "call_1", "content": "class User:"}
+  ]
+}`
+	if got := Detect([]byte(trace)); got != FormatOpenAI {
+		t.Errorf("Detect = %s", got)
+	}
+	messages, err := Decode([]byte(trace), FormatOpenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"user text:Debug a User API issue",
+		`assistant call:call_1:read{"path":"user.py"}`,
+		"toolResult(call_1,read) text:class User:",
+	}
+	if got := shape(messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	for _, tt := range []struct{ format, data string }{
+		{FormatOpenAI, `{"role":"tool","content":"x"}`},
+		{FormatOpenAI, `{"role":"critic","content":"x"}`},
+		{FormatAnthropic, `{"messages":[{"role":"user","content":7}]}`},
+		{FormatOpenAI, ``},
+		{FormatShareGPT, `{"conversations":[{"from":"observation","value":"x"}]}`},
+		{FormatShareGPT, `{"conversations":[{"from":"function_call","value":"ls"}]}`},
+		{FormatShareGPT, `[{"conversations":[]},{"conversations":[]}]`},
+		{"xml", `<x/>`},
+	} {
+		if _, err := Decode([]byte(tt.data), tt.format); err == nil {
+			t.Errorf("Decode(%s, %q): expected error", tt.format, tt.data)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for data, want := range map[string]string{
+		`{"version":1,"sessionId":"s","entries":[]}`:                                  FormatTranscript,
+		`{"system":"be brief","messages":[{"role":"user","content":"hi"}]}`:           FormatAnthropic,
+		`[{"role":"user","content":[{"type":"image","source":{}}]}]`:                  FormatAnthropic,
+		`{"role":"user","content":"a"}` + "\n" + `{"role":"assistant","content":"b"}`: FormatOpenAI,
+		`[{"role":"user","content":"hi"}]`:                                            FormatOpenAI,
+		`{"conversations":[{"from":"human","value":"hi"}]}`:                           FormatShareGPT,
+		`{"conversations":[]}` + "\n" + `{"conversations":[]}`:                        FormatShareGPT,
+	} {
+		if got := Detect([]byte(data)); got != want {
+			t.Errorf("Detect(%s) = %s, want %s", data, got, want)
+		}
+	}
+}
+
+func TestShareGPT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, FormatShareGPT, conversation()); err != nil {
+		t.Fatal(err)
+	}
+	var record shareGPTRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	var from []string
+	for _, turn := range record.Conversations {
+		from = append(from, turn.From)
+	}
+	if got := strings.Join(from, ","); got != "human,gpt,function_call,function_call,observation,observation,gpt" {
+		t.Fatalf("turns = %s", got)
+	}
+	if Detect(buf.Bytes()) != FormatShareGPT {
+		t.Fatalf("Detect = %s", Detect(buf.Bytes()))
+	}
+
+	// Observations pair with the calls in order; IDs are made up.
+	got, err := Decode(buf.Bytes(), FormatShareGPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"user text:look at the screenshot",
+		`assistant text:Reading. call:call_3:read{"path":"shot.png"} call:call_4:bash{"command":"false"}`,
+		"toolResult(call_3,read) text:image:\n[image: image/png]",
+		"toolResult(call_4,bash) text:exit 1",
+		"assistant text:done",
+	}
+	if !reflect.DeepEqual(shape(got), want) {
+		t.Fatalf("decoded:\n%s\nwant:\n%s", strings.Join(shape(got), "\n"), strings.Join(want, "\n"))
+	}
+}
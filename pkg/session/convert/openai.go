@@ -0,0 +1,196 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// openAIMessage is one OpenAI chat message. Content is a string, an array
+// of parts, or null. Thinking goes in reasoning_content, as DeepSeek and
+// other OpenAI-compatible providers do.
+type openAIMessage struct {
+	Role             string           `json:"role"`
+	Content          json.RawMessage  `json:"content"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+	ToolCalls        []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID       string           `json:"tool_call_id,omitempty"`
+	Name             string           `json:"name,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+func encodeOpenAI(w io.Writer, messages []agentctx.AgentMessage) error {
+	enc := json.NewEncoder(w)
+	for _, msg := range messages {
+		out := openAIMessage{Role: msg.Role}
+		var texts []string
+		var parts []openAIPart
+		var thinking []string
+		for _, content := range msg.Content {
+			switch c := content.(type) {
+			case agentctx.TextContent:
+				texts = append(texts, c.Text)
+				parts = append(parts, openAIPart{Type: "text", Text: c.Text})
+			case agentctx.ImageContent:
+				part := openAIPart{Type: "image_url", ImageURL: &struct {
+					URL string `json:"url"`
+				}{URL: "data:" + c.MimeType + ";base64," + c.Data}}
+				parts = append(parts, part)
+			case agentctx.ThinkingContent:
+				thinking = append(thinking, c.Thinking)
+			case agentctx.ToolCallContent:
+				args, err := json.Marshal(c.Arguments)
+				if err != nil {
+					return fmt.Errorf("tool call %s: %w", c.ID, err)
+				}
+				call := openAIToolCall{ID: c.ID, Type: "function"}
+				call.Function.Name = c.Name
+				call.Function.Arguments = string(args)
+				out.ToolCalls = append(out.ToolCalls, call)
+			}
+		}
+
+		switch msg.Role {
+		case "user", "assistant":
+		case "toolResult":
+			out.Role = "tool"
+			out.ToolCallID = msg.ToolCallID
+			out.Name = msg.ToolName
+		default:
+			continue
+		}
+		out.ReasoningContent = strings.Join(thinking, "\n")
+
+		// Plain text is a string; images need the array form.
+		var content any = strings.Join(texts, "\n")
+		if len(parts) > len(texts) {
+			content = parts
+		} else if len(texts) == 0 && len(out.ToolCalls) > 0 {
+			content = nil
+		}
+		data, err := json.Marshal(content)
+		if err != nil {
+			return err
+		}
+		out.Content = data
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeOpenAI(data []byte) ([]agentctx.AgentMessage, error) {
+	raws, err := splitMessages(data)
+	if err != nil {
+		return nil, err
+	}
+	toolNames := map[string]string{}
+	var messages []agentctx.AgentMessage
+	for i, raw := range raws {
+		var in openAIMessage
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		content, err := openAIContent(in.Content)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+
+		switch in.Role {
+		case "system", "developer":
+			continue
+		case "user":
+			messages = append(messages, newUser(content))
+		case "assistant":
+			var blocks []agentctx.ContentBlock
+			if in.ReasoningContent != "" {
+				blocks = append(blocks, agentctx.ThinkingContent{Type: "thinking", Thinking: in.ReasoningContent})
+			}
+			blocks = append(blocks, content...)
+			for j, call := range in.ToolCalls {
+				if call.ID == "" {
+					call.ID = fmt.Sprintf("call_%d_%d", i+1, j+1)
+				}
+				toolNames[call.ID] = call.Function.Name
+				blocks = append(blocks, agentctx.ToolCallContent{
+					ID:        call.ID,
+					Type:      "toolCall",
+					Name:      call.Function.Name,
+					Arguments: parseArguments(call.Function.Arguments),
+				})
+			}
+			messages = append(messages, newAssistant(blocks))
+		case "tool":
+			if in.ToolCallID == "" {
+				return nil, fmt.Errorf("message %d: tool message without tool_call_id", i+1)
+			}
+			name := in.Name
+			if name == "" {
+				name = toolNames[in.ToolCallID]
+			}
+			messages = append(messages, agentctx.NewToolResultMessage(in.ToolCallID, name, content, false))
+		default:
+			return nil, fmt.Errorf("message %d: unsupported role %q", i+1, in.Role)
+		}
+	}
+	return messages, nil
+}
+
+// openAIContent decodes string or array content.
+func openAIContent(raw json.RawMessage) ([]agentctx.ContentBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if text == "" {
+			return nil, nil
+		}
+		return []agentctx.ContentBlock{textBlock(text)}, nil
+	}
+	var parts []openAIPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("content: %w", err)
+	}
+	var blocks []agentctx.ContentBlock
+	for _, p := range parts {
+		switch {
+		case p.Type == "text":
+			blocks = append(blocks, textBlock(p.Text))
+		case p.Type == "image_url" && p.ImageURL != nil:
+			blocks = append(blocks, imageURLBlock(p.ImageURL.URL))
+		}
+	}
+	return blocks, nil
+}
+
+// imageURLBlock turns a data URI into an image. Remote URLs are kept as
+// text: the session only stores image data.
+func imageURLBlock(url string) agentctx.ContentBlock {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mimeType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return imageBlock(mimeType, data)
+		}
+	}
+	return textBlock("[image: " + url + "]")
+}
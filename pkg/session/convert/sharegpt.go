@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// shareGPTRecord is one ShareGPT conversation, the record format of most
+// agent trajectory datasets. Tool calls are function_call turns holding a
+// JSON {"name", "arguments"} object, and their results are the observation
+// turns that follow, in order.
+type shareGPTRecord struct {
+	Conversations []shareGPTTurn `json:"conversations"`
+}
+
+type shareGPTTurn struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+type shareGPTCall struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+func encodeShareGPT(w io.Writer, messages []agentctx.AgentMessage) error {
+	record := shareGPTRecord{Conversations: []shareGPTTurn{}}
+	for _, msg := range messages {
+		var texts []string
+		var calls []agentctx.ToolCallContent
+		for _, content := range msg.Content {
+			switch c := content.(type) {
+			case agentctx.TextContent:
+				texts = append(texts, c.Text)
+			case agentctx.ImageContent:
+				// ShareGPT turns are text only.
+				texts = append(texts, "[image: "+c.MimeType+"]")
+			case agentctx.ToolCallContent:
+				calls = append(calls, c)
+			}
+		}
+		text := strings.Join(texts, "\n")
+
+		switch msg.Role {
+		case "user":
+			record.Conversations = append(record.Conversations, shareGPTTurn{From: "human", Value: text})
+		case "assistant":
+			if text != "" || len(calls) == 0 {
+				record.Conversations = append(record.Conversations, shareGPTTurn{From: "gpt", Value: text})
+			}
+			for _, c := range calls {
+				data, err := json.Marshal(shareGPTCall{Name: c.Name, Arguments: c.Arguments})
+				if err != nil {
+					return fmt.Errorf("tool call %s: %w", c.ID, err)
+				}
+				record.Conversations = append(record.Conversations, shareGPTTurn{From: "function_call", Value: string(data)})
+			}
+		case "toolResult":
+			record.Conversations = append(record.Conversations, shareGPTTurn{From: "observation", Value: text})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(record)
+}
+
+func decodeShareGPT(data []byte) ([]agentctx.AgentMessage, error) {
+	var record shareGPTRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		// A dataset file: an array or JSONL of records.
+		raws, err := splitMessages(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(raws) != 1 {
+			return nil, fmt.Errorf("%d conversations; import one at a time", len(raws))
+		}
+		if err := json.Unmarshal(raws[0], &record); err != nil {
+			return nil, err
+		}
+	}
+	if record.Conversations == nil {
+		return nil, fmt.Errorf("no conversations")
+	}
+
+	var messages []agentctx.AgentMessage
+	// pending holds the calls still waiting for their observation.
+	var pending []agentctx.ToolCallContent
+	for i, turn := range record.Conversations {
+		switch turn.From {
+		case "system":
+			continue
+		case "human", "user":
+			messages = append(messages, newUser([]agentctx.ContentBlock{textBlock(turn.Value)}))
+		case "gpt", "assistant":
+			messages = append(messages, newAssistant([]agentctx.ContentBlock{textBlock(turn.Value)}))
+		case "function_call":
+			var call shareGPTCall
+			if err := json.Unmarshal([]byte(turn.Value), &call); err != nil || call.Name == "" {
+				return nil, fmt.Errorf("turn %d: function_call is not a {\"name\", \"arguments\"} object", i+1)
+			}
+			if call.Arguments == nil {
+				call.Arguments = map[string]any{}
+			}
+			block := agentctx.ToolCallContent{
+				ID:        fmt.Sprintf("call_%d", i+1),
+				Type:      "toolCall",
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			}
+			pending = append(pending, block)
+			// Calls made together share the preceding assistant message.
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+				messages[n-1].Content = append(messages[n-1].Content, block)
+			} else {
+				messages = append(messages, newAssistant([]agentctx.ContentBlock{block}))
+			}
+		case "observation", "tool":
+			if len(pending) == 0 {
+				return nil, fmt.Errorf("turn %d: observation without a function_call", i+1)
+			}
+			call := pending[0]
+			pending = pending[1:]
+			messages = append(messages, agentctx.NewToolResultMessage(call.ID, call.Name,
+				[]agentctx.ContentBlock{textBlock(turn.Value)}, false))
+		default:
+			return nil, fmt.Errorf("turn %d: unsupported speaker %q", i+1, turn.From)
+		}
+	}
+	return messages, nil
+}
@@ -22,6 +22,10 @@ const (
 	EntryTypeCompaction    = "compaction"
 	EntryTypeBranchSummary = "branch_summary"
 	EntryTypeSessionInfo   = "session_info"
+	EntryTypeTodo          = "todo"
+	EntryTypeVerify        = "verify"
+	EntryTypePin           = "pin"
+	EntryTypeContextEdit   = "context_edit"
 )
 
 const (
@@ -68,8 +72,64 @@ type SessionEntry struct {
 
 	FromID string `json:"fromId,omitempty"`
 
-	Name  string `json:"name,omitempty"`
-	Title string `json:"title,omitempty"`
+	Name  string   `json:"name,omitempty"`
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+
+	// Todos is the full todo list as of this entry (EntryTypeTodo).
+	Todos []agentctx.TodoItem `json:"todos,omitempty"`
+
+	// Verify is the verification result of a run (EntryTypeVerify).
+	Verify *agentctx.VerifyResult `json:"verify,omitempty"`
+
+	// Pin changes the priority of an earlier message (EntryTypePin).
+	Pin *PinTarget `json:"pin,omitempty"`
+
+	// Edit drops, collapses or replaces earlier messages (EntryTypeContextEdit).
+	Edit *ContextEdit `json:"edit,omitempty"`
+}
+
+// MessageRef identifies an earlier message. Messages restored from a
+// compaction snapshot can get new entry IDs on reload, so the role and
+// timestamp are recorded as a fallback match.
+type MessageRef struct {
+	EntryID   string `json:"entryId"`
+	Role      string `json:"role,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+// NewMessageRef returns a reference to msg.
+func NewMessageRef(msg agentctx.AgentMessage) MessageRef {
+	return MessageRef{EntryID: msg.EntryID, Role: msg.Role, Timestamp: msg.Timestamp}
+}
+
+// matches reports whether msg is the referenced message.
+func (r MessageRef) matches(msg agentctx.AgentMessage) bool {
+	if r.EntryID != "" && msg.EntryID == r.EntryID {
+		return true
+	}
+	return r.Timestamp != 0 && msg.Timestamp == r.Timestamp && msg.Role == r.Role
+}
+
+// PinTarget identifies the message a pin entry applies to.
+type PinTarget struct {
+	MessageRef
+	// Priority is the new priority; nil resets it to the default.
+	Priority *float64 `json:"priority,omitempty"`
+}
+
+// applyPins applies the pin entries on path, oldest first, to messages.
+func applyPins(path []*SessionEntry, messages []agentctx.AgentMessage) {
+	for _, entry := range path {
+		if entry.Type != EntryTypePin || entry.Pin == nil {
+			continue
+		}
+		for i := range messages {
+			if entry.Pin.matches(messages[i]) {
+				messages[i] = messages[i].WithPriority(entry.Pin.Priority)
+			}
+		}
+	}
 }
 
 func newSessionHeader(id, cwd, parentSession string) SessionHeader {
@@ -120,7 +180,7 @@ func timestampToMillis(ts string) int64 {
 	return parsed.UnixMilli()
 }
 
-func buildSessionContext(entries []*SessionEntry, leafID *string, byID map[string]*SessionEntry, sessionDir string) []agentctx.AgentMessage {
+func buildSessionContext(entries []*SessionEntry, leafID *string, byID map[string]*SessionEntry, snapshot func(ref string) ([]agentctx.AgentMessage, error)) []agentctx.AgentMessage {
 	if len(entries) == 0 {
 		return []agentctx.AgentMessage{}
 	}
@@ -182,13 +242,12 @@ func buildSessionContext(entries []*SessionEntry, leafID *string, byID map[strin
 		// Proposal B: if SnapshotRef is set, load post-compaction messages from
 		// the external snapshot file. This avoids rewriting messages.jsonl and
 		// makes compaction entries simple pointers.
-		if compaction.SnapshotRef != "" && sessionDir != "" {
-			snapshotPath := filepath.Join(sessionDir, compaction.SnapshotRef)
-			if loaded, err := loadSnapshotMessages(snapshotPath); err == nil {
+		if compaction.SnapshotRef != "" && snapshot != nil {
+			if loaded, err := snapshot(compaction.SnapshotRef); err == nil {
 				messages = append(messages, loaded...)
 			} else {
 				slog.Warn("[session] Failed to load compaction snapshot, falling back to summary only",
-					"path", snapshotPath, "error", err)
+					"ref", compaction.SnapshotRef, "error", err)
 				msg := compactionSummaryMessage(compaction)
 				if msg.Role != "" {
 					messages = append(messages, msg)
@@ -220,14 +279,17 @@ func buildSessionContext(entries []*SessionEntry, leafID *string, byID map[strin
 		for i := compactionIndex + 1; i < len(path); i++ {
 			appendMessage(path[i])
 		}
-		return messages
+		applyPins(path, messages)
+		// The snapshot already reflects earlier edits.
+		return applyContextEdits(path[compactionIndex+1:], messages)
 	}
 
 	for _, entry := range path {
 		appendMessage(entry)
 	}
 
-	return messages
+	applyPins(path, messages)
+	return applyContextEdits(path, messages)
 }
 
 func decodeSessionHeader(line []byte) (*SessionHeader, error) {
@@ -0,0 +1,251 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/tiancaiamao/ai/pkg/session/convert"
+	"github.com/tiancaiamao/ai/pkg/truncate"
+)
+
+// Export formats.
+const (
+	FormatHTML      = "html"
+	FormatMarkdown  = "md"
+	FormatJSON      = "json"
+	FormatOpenAI    = convert.FormatOpenAI
+	FormatAnthropic = convert.FormatAnthropic
+	FormatShareGPT  = convert.FormatShareGPT
+)
+
+// ParseFormat returns the format named by s ("html", "md", "markdown",
+// "json", "openai", "anthropic" or "sharegpt"); empty means HTML.
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "html":
+		return FormatHTML, nil
+	case "md", "markdown":
+		return FormatMarkdown, nil
+	case "json":
+		return FormatJSON, nil
+	case "openai":
+		return FormatOpenAI, nil
+	case "anthropic":
+		return FormatAnthropic, nil
+	case "sharegpt":
+		return FormatShareGPT, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want html, md, json, openai, anthropic or sharegpt)", s)
+}
+
+// Extension returns the file extension for format.
+func Extension(format string) string {
+	switch format {
+	case FormatOpenAI:
+		return "jsonl"
+	case FormatAnthropic, FormatShareGPT:
+		return "json"
+	}
+	return format
+}
+
+// FormatForPath returns the format implied by the extension of path, or ""
+// when there is none.
+func FormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return FormatHTML
+	case ".md", ".markdown":
+		return FormatMarkdown
+	case ".json":
+		return FormatJSON
+	case ".jsonl":
+		return FormatOpenAI
+	}
+	return ""
+}
+
+// Render writes t to w in format.
+func Render(w io.Writer, t *Transcript, format string) error {
+	switch format {
+	case FormatHTML:
+		return renderHTML(w, t)
+	case FormatMarkdown:
+		return renderMarkdown(w, t)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	case FormatOpenAI, FormatAnthropic, FormatShareGPT:
+		return convert.Encode(w, format, t.Messages())
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// heading is the page title: the session title, name or ID.
+func (t *Transcript) heading() string {
+	switch {
+	case t.Title != "":
+		return t.Title
+	case t.Name != "":
+		return t.Name
+	}
+	return "Session " + t.SessionID
+}
+
+// toolResults indexes tool result entries by call ID, so renderers can show
+// each result under its call.
+func (t *Transcript) toolResults() map[string]*Entry {
+	results := map[string]*Entry{}
+	for i := range t.Entries {
+		if e := &t.Entries[i]; e.Type == EntryToolResult && e.ToolCallID != "" {
+			results[e.ToolCallID] = e
+		}
+	}
+	return results
+}
+
+// text joins the text blocks of e.
+func (e *Entry) text() string {
+	var parts []string
+	for _, b := range e.Blocks {
+		if b.Type == BlockText {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// callTitle is a one-line label for a tool call, e.g. "read pkg/x.go".
+func callTitle(b Block) string {
+	for _, key := range []string{"path", "command", "pattern", "query", "name", "prompt"} {
+		if v, ok := b.Arguments[key].(string); ok && v != "" {
+			v = strings.Join(strings.Fields(v), " ")
+			if short := truncate.TrimRunes(v, 100); short != v {
+				v = short + "…"
+			}
+			return b.ToolName + " " + v
+		}
+	}
+	return b.ToolName
+}
+
+// callDiff returns a unified diff of an edit or write call, or "". The
+// diff has no hunk header: the call holds text fragments, not the file, so
+// there are no line numbers. Lines both texts share are context lines.
+func callDiff(b Block) string {
+	path, _ := b.Arguments["path"].(string)
+	var oldText, newText string
+	switch b.ToolName {
+	case "edit":
+		oldText, _ = b.Arguments["oldText"].(string)
+		newText, _ = b.Arguments["newText"].(string)
+	case "write":
+		newText, _ = b.Arguments["content"].(string)
+	default:
+		return ""
+	}
+	if oldText == "" && newText == "" {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", path, path)
+	for _, line := range diffLines(splitLines(oldText), splitLines(newText)) {
+		sb.WriteString(line + "\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// maxDiffCells caps the LCS table of diffLines; larger diffs list all old
+// lines as removed and all new lines as added.
+const maxDiffCells = 1 << 22
+
+// diffLines returns the lines of a line diff from a to b, each prefixed
+// with " ", "-" or "+", using the longest common subsequence.
+func diffLines(a, b []string) []string {
+	var out []string
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			out = append(out, "-"+line)
+		}
+		for _, line := range b {
+			out = append(out, "+"+line)
+		}
+		return out
+	}
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	return out
+}
+
+// splitLines splits text into lines without the final newline; "" has none.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// callArgs renders the arguments of a call that has no diff as indented
+// JSON (map keys are sorted by encoding/json).
+func callArgs(b Block) string {
+	if len(b.Arguments) == 0 {
+		return ""
+	}
+	data, err := json.MarshalIndent(b.Arguments, "", "  ")
+	if err != nil {
+		return fmt.Sprint(b.Arguments)
+	}
+	return string(data)
+}
+
+// usageLine formats u, e.g. "in 1200, out 300, cache read 800, $0.0123".
+func usageLine(u Usage) string {
+	s := fmt.Sprintf("in %d, out %d", u.Input, u.Output)
+	if u.CacheRead > 0 {
+		s += fmt.Sprintf(", cache read %d", u.CacheRead)
+	}
+	if u.CacheWrite > 0 {
+		s += fmt.Sprintf(", cache write %d", u.CacheWrite)
+	}
+	return s + fmt.Sprintf(", $%.4f", u.Cost)
+}
+
+// turnEnds reports whether entry i is the last entry of its turn.
+func (t *Transcript) turnEnds(i int) bool {
+	e := t.Entries[i]
+	if e.Turn == 0 {
+		return false
+	}
+	return i == len(t.Entries)-1 || t.Entries[i+1].Turn != e.Turn
+}
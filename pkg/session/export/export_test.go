@@ -0,0 +1,237 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func assistant(provider, model string, usage agentctx.Usage, content ...agentctx.ContentBlock) agentctx.AgentMessage {
+	msg := agentctx.NewAssistantMessage()
+	msg.Provider, msg.Model = provider, model
+	msg.Usage = &usage
+	msg.Content = content
+	return msg
+}
+
+// newTestSession writes a two-turn conversation with an edit call, a
+// thinking block and a compaction.
+func newTestSession(t *testing.T) *session.Session {
+	t.Helper()
+	sess := session.NewSession(t.TempDir())
+	appendMsg := func(msg agentctx.AgentMessage) {
+		if _, err := sess.AppendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	appendMsg(agentctx.NewUserMessage("fix <main.go>"))
+	appendMsg(assistant("zai", "glm-4.6", agentctx.Usage{InputTokens: 100, OutputTokens: 20, Cost: agentctx.Cost{Total: 0.01}},
+		agentctx.ThinkingContent{Type: "thinking", Thinking: "look at the file"},
+		agentctx.ToolCallContent{ID: "call-1", Type: "toolCall", Name: "edit", Arguments: map[string]any{
+			"path": "main.go", "oldText": "return 1", "newText": "return 2",
+		}},
+	))
+	appendMsg(agentctx.NewToolResultMessage("call-1", "edit", []agentctx.ContentBlock{
+		agentctx.TextContent{Type: "text", Text: "edited main.go"},
+	}, false))
+	appendMsg(assistant("zai", "glm-4.6", agentctx.Usage{InputTokens: 150, OutputTokens: 10, CacheRead: 80, Cost: agentctx.Cost{Total: 0.02}},
+		agentctx.TextContent{Type: "text", Text: "done"},
+	))
+	if _, err := sess.AppendCompaction("fixed main.go", nil); err != nil {
+		t.Fatal(err)
+	}
+	appendMsg(agentctx.NewUserMessage("thanks"))
+	appendMsg(assistant("zai", "glm-4.6", agentctx.Usage{InputTokens: 50, OutputTokens: 5, Cost: agentctx.Cost{Total: 0.005}},
+		agentctx.TextContent{Type: "text", Text: "you're welcome"},
+	))
+	hint := agentctx.NewUserMessage("runtime state").WithVisibility(true, false)
+	appendMsg(hint)
+	return sess
+}
+
+func TestFromSession(t *testing.T) {
+	tr, err := FromSession(newTestSession(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, e := range tr.Entries {
+		types = append(types, e.Type)
+	}
+	want := "user assistant tool_result assistant compaction user assistant"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+	if len(tr.Turns) != 2 {
+		t.Fatalf("turns = %d, want 2", len(tr.Turns))
+	}
+	if turn := tr.Turns[0]; turn.Messages != 2 || turn.Usage.Input != 250 || turn.Usage.CacheRead != 80 {
+		t.Errorf("turn 1 = %+v", turn)
+	}
+	if tr.Usage.Output != 35 || tr.Usage.Cost < 0.0349 || tr.Usage.Cost > 0.0351 {
+		t.Errorf("usage = %+v", tr.Usage)
+	}
+	if tr.Entries[1].Model != "zai/glm-4.6" {
+		t.Errorf("model = %q", tr.Entries[1].Model)
+	}
+	if tr.Entries[4].Summary != "fixed main.go" || tr.Entries[4].Turn != 1 {
+		t.Errorf("compaction = %+v", tr.Entries[4])
+	}
+}
+
+func TestFromSession_Leaf(t *testing.T) {
+	sess := newTestSession(t)
+	if _, err := FromSession(sess, "missing"); err == nil {
+		t.Fatal("expected error for unknown leaf")
+	}
+	full, _ := FromSession(sess, "")
+	tr, err := FromSession(sess, full.Entries[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Entries) != 3 || tr.LeafID != full.Entries[2].ID {
+		t.Fatalf("entries = %d, leaf = %s", len(tr.Entries), tr.LeafID)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tr, err := FromSession(newTestSession(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatHTML, []string{
+			"<!DOCTYPE html>",
+			"fix &lt;main.go&gt;",
+			`<details class="thinking"><summary>Thinking</summary>`,
+			"<summary>edit main.go</summary>",
+			`<span class="del">-return 1</span><span class="add">+return 2</span>`,
+			"<summary>Result</summary><pre>edited main.go</pre>",
+			"Context compacted",
+			"Turn 1: 2 assistant messages, in 250, out 30, cache read 80, $0.0300",
+		}},
+		{FormatMarkdown, []string{
+			"## Turn 1",
+			"<summary>🔧 edit main.go</summary>",
+			"```diff\n--- main.go\n+++ main.go\n-return 1\n+return 2\n```",
+			"<summary>Context compacted (0 tokens before)</summary>\n\nfixed main.go",
+			"_Turn 2: 1 assistant messages, in 50, out 5, $0.0050_",
+		}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Render(&buf, tr, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s output missing %q:\n%s", tt.format, want, out)
+			}
+		}
+		if strings.Contains(out, "runtime state") {
+			t.Errorf("%s output contains a hidden message", tt.format)
+		}
+	}
+}
+
+func TestRender_JSON(t *testing.T) {
+	tr, err := FromSession(newTestSession(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, tr, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got Transcript
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != TranscriptVersion || len(got.Entries) != len(tr.Entries) || got.Entries[1].Blocks[1].Arguments["newText"] != "return 2" {
+		t.Errorf("round trip = %+v", got)
+	}
+}
+
+func TestCallDiff(t *testing.T) {
+	edit := Block{Type: BlockToolCall, ToolName: "edit", Arguments: map[string]any{
+		"path":    "main.go",
+		"oldText": "func f() int {\n\treturn 1\n}",
+		"newText": "func f() int {\n\tlog()\n\treturn 2\n}",
+	}}
+	want := "--- main.go\n+++ main.go\n func f() int {\n-\treturn 1\n+\tlog()\n+\treturn 2\n }"
+	if got := callDiff(edit); got != want {
+		t.Errorf("callDiff(edit) =\n%s\nwant\n%s", got, want)
+	}
+	write := Block{Type: BlockToolCall, ToolName: "write", Arguments: map[string]any{"path": "a.txt", "content": "one\ntwo\n"}}
+	if got := callDiff(write); got != "--- a.txt\n+++ a.txt\n+one\n+two" {
+		t.Errorf("callDiff(write) = %q", got)
+	}
+}
+
+func TestCallTitle_TruncatesRunes(t *testing.T) {
+	b := Block{Type: BlockToolCall, ToolName: "bash", Arguments: map[string]any{"command": "echo " + strings.Repeat("é", 200)}}
+	got := callTitle(b)
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, "…") || utf8.RuneCountInString(got) != len("bash ")+100+1 {
+		t.Errorf("callTitle = %q", got)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]string{"": FormatHTML, "HTML": FormatHTML, "markdown": FormatMarkdown, "md": FormatMarkdown, "json": FormatJSON, "sharegpt": FormatShareGPT} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("ParseFormat(pdf): expected error")
+	}
+}
+
+func TestTranscriptMessages(t *testing.T) {
+	tr, err := FromSession(newTestSession(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, tr, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseTranscript(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := parsed.Messages()
+	if len(messages) != 6 {
+		t.Fatalf("messages = %d, want 6 (compaction dropped)", len(messages))
+	}
+	if m := messages[1]; m.Provider != "zai" || m.Model != "glm-4.6" || m.Usage.InputTokens != 100 || len(m.ExtractToolCalls()) != 1 {
+		t.Errorf("assistant = %+v", m)
+	}
+	if m := messages[2]; m.Role != "toolResult" || m.ToolCallID != "call-1" || m.ToolName != "edit" {
+		t.Errorf("tool result = %+v", m)
+	}
+
+	buf.Reset()
+	if err := Render(&buf, tr, FormatOpenAI); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 6 {
+		t.Errorf("openai lines = %d, want 6:\n%s", lines, buf.String())
+	}
+
+	if _, err := ParseTranscript([]byte(`{"version":99}`)); err == nil {
+		t.Error("expected error for unknown version")
+	}
+}
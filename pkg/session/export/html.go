@@ -0,0 +1,174 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// htmlStyle is inlined so the page has no external dependencies.
+const htmlStyle = `
+body { font: 14px/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+header { border-bottom: 1px solid #d0d7de; margin-bottom: 1em; }
+header dl { display: grid; grid-template-columns: max-content 1fr; gap: 0 1em; }
+header dt { color: #656d76; }
+h2.turn { font-size: 1em; color: #656d76; border-top: 1px solid #d0d7de; padding-top: 1em; margin-top: 2em; }
+.msg { margin: .75em 0; padding: .5em .75em; border-radius: 6px; }
+.msg .role { font-weight: 600; font-size: .85em; color: #656d76; }
+.user { background: #ddf4ff; }
+.user.injected { background: #fff8c5; }
+.assistant { background: #f6f8fa; }
+.text { white-space: pre-wrap; word-wrap: break-word; }
+details { margin: .4em 0; border: 1px solid #d0d7de; border-radius: 6px; padding: .25em .5em; background: #fff; }
+details > summary { cursor: pointer; font-family: ui-monospace, Menlo, monospace; font-size: .9em; }
+details.thinking { color: #656d76; font-style: italic; }
+details.error > summary { color: #cf222e; }
+details.compaction { background: #fbefff; }
+pre { white-space: pre-wrap; word-wrap: break-word; font: 12px/1.4 ui-monospace, Menlo, monospace; background: #f6f8fa; padding: .5em; border-radius: 4px; max-height: 40em; overflow: auto; }
+.diff .add { color: #116329; background: #dafbe1; display: block; }
+.diff .del { color: #82071e; background: #ffebe9; display: block; }
+.diff .hdr { color: #656d76; display: block; }
+img { max-width: 100%; border: 1px solid #d0d7de; border-radius: 4px; }
+.usage { font-size: .8em; color: #656d76; text-align: right; }
+`
+
+// renderHTML writes t as one self-contained HTML page: styles are inline,
+// images are data URIs, and tool calls, thinking and compaction summaries
+// are collapsible <details> elements.
+func renderHTML(w io.Writer, t *Transcript) error {
+	bw := bufio.NewWriter(w)
+	results := t.toolResults()
+	shown := map[string]bool{}
+	esc := html.EscapeString
+
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n",
+		esc(t.heading()), htmlStyle)
+	fmt.Fprintf(bw, "<header>\n<h1>%s</h1>\n<dl>\n<dt>Session</dt><dd><code>%s</code></dd>\n", esc(t.heading()), esc(t.SessionID))
+	if t.Created != "" {
+		fmt.Fprintf(bw, "<dt>Created</dt><dd>%s</dd>\n", esc(t.Created))
+	}
+	if t.Cwd != "" {
+		fmt.Fprintf(bw, "<dt>Working directory</dt><dd><code>%s</code></dd>\n", esc(t.Cwd))
+	}
+	fmt.Fprintf(bw, "<dt>Turns</dt><dd>%d</dd>\n<dt>Usage</dt><dd>%s</dd>\n</dl>\n</header>\n", len(t.Turns), esc(usageLine(t.Usage)))
+
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		switch e.Type {
+		case EntryUser:
+			if e.Kind != "" {
+				fmt.Fprintf(bw, "<div class=\"msg user injected\" id=\"%s\"><div class=\"role\">User · %s</div>\n", esc(e.ID), esc(e.Kind))
+			} else {
+				fmt.Fprintf(bw, "<h2 class=\"turn\">Turn %d</h2>\n<div class=\"msg user\" id=\"%s\"><div class=\"role\">User</div>\n", e.Turn, esc(e.ID))
+			}
+			writeHTMLBlocks(bw, e.Blocks)
+			fmt.Fprint(bw, "</div>\n")
+		case EntryAssistant:
+			label := "Assistant"
+			if e.Model != "" {
+				label += " · " + e.Model
+			}
+			fmt.Fprintf(bw, "<div class=\"msg assistant\" id=\"%s\"><div class=\"role\">%s</div>\n", esc(e.ID), esc(label))
+			for _, b := range e.Blocks {
+				switch b.Type {
+				case BlockThinking:
+					fmt.Fprintf(bw, "<details class=\"thinking\"><summary>Thinking</summary><div class=\"text\">%s</div></details>\n", esc(b.Text))
+				case BlockToolCall:
+					writeHTMLCall(bw, b, results[b.ToolCallID])
+					shown[b.ToolCallID] = true
+				default:
+					writeHTMLBlocks(bw, []Block{b})
+				}
+			}
+			if e.Usage != nil {
+				fmt.Fprintf(bw, "<div class=\"usage\">%s</div>\n", esc(usageLine(*e.Usage)))
+			}
+			fmt.Fprint(bw, "</div>\n")
+		case EntryToolResult:
+			if !shown[e.ToolCallID] {
+				writeHTMLResult(bw, e.ToolName+" result", e)
+			}
+		case EntryCompaction:
+			fmt.Fprintf(bw, "<details class=\"compaction\" id=\"%s\"><summary>Context compacted (%d tokens before)</summary><div class=\"text\">%s</div></details>\n",
+				esc(e.ID), e.TokensBefore, esc(e.Summary))
+		case EntryBranchSummary:
+			fmt.Fprintf(bw, "<details class=\"compaction\" id=\"%s\"><summary>Returned from a branch</summary><div class=\"text\">%s</div></details>\n",
+				esc(e.ID), esc(e.Summary))
+		}
+		if t.turnEnds(i) {
+			turn := t.Turns[e.Turn-1]
+			fmt.Fprintf(bw, "<div class=\"usage\">Turn %d: %d assistant messages, %s</div>\n", turn.Turn, turn.Messages, esc(usageLine(turn.Usage)))
+		}
+	}
+	fmt.Fprint(bw, "</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// writeHTMLBlocks writes text and image blocks.
+func writeHTMLBlocks(w io.Writer, blocks []Block) {
+	for _, b := range blocks {
+		switch b.Type {
+		case BlockText:
+			fmt.Fprintf(w, "<div class=\"text\">%s</div>\n", html.EscapeString(b.Text))
+		case BlockImage:
+			if strings.HasPrefix(b.MimeType, "image/") {
+				fmt.Fprintf(w, "<img alt=\"image\" src=\"data:%s;base64,%s\">\n", html.EscapeString(b.MimeType), html.EscapeString(b.Data))
+			}
+		}
+	}
+}
+
+// writeHTMLCall writes a tool call with its result, folded.
+func writeHTMLCall(w io.Writer, b Block, result *Entry) {
+	class := "call"
+	if result != nil && result.IsError {
+		class += " error"
+	}
+	fmt.Fprintf(w, "<details class=\"%s\"><summary>%s</summary>\n", class, html.EscapeString(callTitle(b)))
+	if diff := callDiff(b); diff != "" {
+		fmt.Fprint(w, "<pre class=\"diff\">")
+		for _, line := range strings.Split(diff, "\n") {
+			class := ""
+			switch {
+			case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+				class = "hdr"
+			case strings.HasPrefix(line, "+"):
+				class = "add"
+			case strings.HasPrefix(line, "-"):
+				class = "del"
+			}
+			fmt.Fprintf(w, "<span class=\"%s\">%s</span>", class, html.EscapeString(line))
+		}
+		fmt.Fprint(w, "</pre>\n")
+	} else if args := callArgs(b); args != "" {
+		fmt.Fprintf(w, "<pre>%s</pre>\n", html.EscapeString(args))
+	}
+	if result != nil {
+		writeHTMLResult(w, "Result", result)
+	}
+	fmt.Fprint(w, "</details>\n")
+}
+
+// writeHTMLResult writes a tool result as a folded block.
+func writeHTMLResult(w io.Writer, label string, e *Entry) {
+	class := "result"
+	if e.IsError {
+		class += " error"
+		label = strings.Replace(label, "Result", "Error", 1)
+	}
+	fmt.Fprintf(w, "<details class=\"%s\"><summary>%s</summary><pre>%s</pre>\n", class, html.EscapeString(label), html.EscapeString(e.text()))
+	writeHTMLBlocks(w, imageBlocks(e.Blocks))
+	fmt.Fprint(w, "</details>\n")
+}
+
+func imageBlocks(blocks []Block) []Block {
+	var images []Block
+	for _, b := range blocks {
+		if b.Type == BlockImage {
+			images = append(images, b)
+		}
+	}
+	return images
+}
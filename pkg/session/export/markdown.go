@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// renderMarkdown writes t as Markdown. Thinking, tool calls and compaction
+// summaries are wrapped in <details>, which GitHub and most viewers fold.
+func renderMarkdown(w io.Writer, t *Transcript) error {
+	bw := bufio.NewWriter(w)
+	results := t.toolResults()
+	shown := map[string]bool{}
+
+	fmt.Fprintf(bw, "# %s\n\n", t.heading())
+	fmt.Fprintf(bw, "- Session: `%s`\n", t.SessionID)
+	if t.Created != "" {
+		fmt.Fprintf(bw, "- Created: %s\n", t.Created)
+	}
+	if t.Cwd != "" {
+		fmt.Fprintf(bw, "- Working directory: `%s`\n", t.Cwd)
+	}
+	fmt.Fprintf(bw, "- Usage: %s\n", usageLine(t.Usage))
+
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		switch e.Type {
+		case EntryUser:
+			if e.Kind != "" {
+				fmt.Fprintf(bw, "\n**User (%s)**\n\n%s\n", e.Kind, e.text())
+			} else {
+				fmt.Fprintf(bw, "\n---\n\n## Turn %d\n\n**User**\n\n%s\n", e.Turn, e.text())
+			}
+			writeMarkdownImages(bw, e)
+		case EntryAssistant:
+			label := "Assistant"
+			if e.Model != "" {
+				label += " · " + e.Model
+			}
+			fmt.Fprintf(bw, "\n**%s**\n", label)
+			for _, b := range e.Blocks {
+				switch b.Type {
+				case BlockText:
+					fmt.Fprintf(bw, "\n%s\n", b.Text)
+				case BlockThinking:
+					fmt.Fprintf(bw, "\n<details><summary>Thinking</summary>\n\n%s\n\n</details>\n", b.Text)
+				case BlockToolCall:
+					writeMarkdownCall(bw, b, results[b.ToolCallID])
+					shown[b.ToolCallID] = true
+				}
+			}
+		case EntryToolResult:
+			if !shown[e.ToolCallID] {
+				writeMarkdownResult(bw, e)
+			}
+		case EntryCompaction:
+			fmt.Fprintf(bw, "\n<details><summary>Context compacted (%d tokens before)</summary>\n\n%s\n\n</details>\n", e.TokensBefore, e.Summary)
+		case EntryBranchSummary:
+			fmt.Fprintf(bw, "\n<details><summary>Returned from a branch</summary>\n\n%s\n\n</details>\n", e.Summary)
+		}
+		if t.turnEnds(i) {
+			turn := t.Turns[e.Turn-1]
+			fmt.Fprintf(bw, "\n_Turn %d: %d assistant messages, %s_\n", turn.Turn, turn.Messages, usageLine(turn.Usage))
+		}
+	}
+	return bw.Flush()
+}
+
+func writeMarkdownCall(w io.Writer, b Block, result *Entry) {
+	fmt.Fprintf(w, "\n<details><summary>🔧 %s</summary>\n\n", mdEscape(callTitle(b)))
+	if diff := callDiff(b); diff != "" {
+		writeFenced(w, "diff", diff)
+	} else if args := callArgs(b); args != "" {
+		writeFenced(w, "json", args)
+	}
+	if result != nil {
+		status := "Result"
+		if result.IsError {
+			status = "Error"
+		}
+		fmt.Fprintf(w, "\n%s:\n\n", status)
+		writeFenced(w, "", result.text())
+		writeMarkdownImages(w, result)
+	}
+	fmt.Fprint(w, "\n</details>\n")
+}
+
+func writeMarkdownResult(w io.Writer, e *Entry) {
+	fmt.Fprintf(w, "\n<details><summary>%s result</summary>\n\n", e.ToolName)
+	writeFenced(w, "", e.text())
+	writeMarkdownImages(w, e)
+	fmt.Fprint(w, "\n</details>\n")
+}
+
+// writeMarkdownImages lists images by type and size; embedding base64 in
+// Markdown makes it unreadable.
+func writeMarkdownImages(w io.Writer, e *Entry) {
+	for _, b := range e.Blocks {
+		if b.Type == BlockImage {
+			fmt.Fprintf(w, "\n_[image: %s, %d KB]_\n", b.MimeType, len(b.Data)*3/4/1024)
+		}
+	}
+}
+
+// writeFenced writes text in a code fence longer than any backtick run in it.
+func writeFenced(w io.Writer, lang, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(w, "%s%s\n%s\n%s\n", fence, lang, strings.TrimSuffix(text, "\n"), fence)
+}
+
+// mdEscape keeps a tool call title from opening HTML tags in <summary>.
+func mdEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
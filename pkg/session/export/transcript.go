@@ -0,0 +1,306 @@
+// Package export renders a session branch as a self-contained HTML page,
+// Markdown, or a normalized JSON transcript.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+// TranscriptVersion is the version of the JSON transcript format.
+const TranscriptVersion = 1
+
+// Entry types of a Transcript.
+const (
+	EntryUser          = "user"
+	EntryAssistant     = "assistant"
+	EntryToolResult    = "tool_result"
+	EntryCompaction    = "compaction"
+	EntryBranchSummary = "branch_summary"
+)
+
+// Block types of an Entry.
+const (
+	BlockText     = "text"
+	BlockThinking = "thinking"
+	BlockToolCall = "tool_call"
+	BlockImage    = "image"
+)
+
+// Transcript is one session branch, normalized for rendering. It is also
+// the JSON export format.
+type Transcript struct {
+	Version   int     `json:"version"`
+	SessionID string  `json:"sessionId"`
+	Name      string  `json:"name,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Cwd       string  `json:"cwd,omitempty"`
+	Created   string  `json:"created,omitempty"`
+	LeafID    string  `json:"leafId,omitempty"`
+	Entries   []Entry `json:"entries"`
+	Turns     []Turn  `json:"turns"`
+	Usage     Usage   `json:"usage"`
+}
+
+// Entry is a message or a marker (compaction, branch summary).
+type Entry struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp,omitempty"`
+	// Turn is the 1-based user turn the entry belongs to; 0 before the
+	// first user message.
+	Turn int `json:"turn,omitempty"`
+	// Kind is the message kind for injected user messages (e.g. "steer").
+	Kind   string  `json:"kind,omitempty"`
+	Model  string  `json:"model,omitempty"`
+	Blocks []Block `json:"blocks,omitempty"`
+	Usage  *Usage  `json:"usage,omitempty"`
+
+	// Tool results.
+	ToolCallID string `json:"toolCallId,omitempty"`
+	ToolName   string `json:"toolName,omitempty"`
+	IsError    bool   `json:"isError,omitempty"`
+
+	// Compactions and branch summaries.
+	Summary      string `json:"summary,omitempty"`
+	TokensBefore int    `json:"tokensBefore,omitempty"`
+}
+
+// Block is one content block of a message.
+type Block struct {
+	Type       string         `json:"type"`
+	Text       string         `json:"text,omitempty"`
+	ToolCallID string         `json:"toolCallId,omitempty"`
+	ToolName   string         `json:"toolName,omitempty"`
+	Arguments  map[string]any `json:"arguments,omitempty"`
+	MimeType   string         `json:"mimeType,omitempty"`
+	Data       string         `json:"data,omitempty"` // base64
+}
+
+// Usage is token usage and cost.
+type Usage struct {
+	Input      int     `json:"input"`
+	Output     int     `json:"output"`
+	CacheRead  int     `json:"cacheRead"`
+	CacheWrite int     `json:"cacheWrite"`
+	Cost       float64 `json:"cost"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.Input += o.Input
+	u.Output += o.Output
+	u.CacheRead += o.CacheRead
+	u.CacheWrite += o.CacheWrite
+	u.Cost += o.Cost
+}
+
+// Turn is the usage of the assistant messages answering one user message.
+type Turn struct {
+	Turn     int    `json:"turn"`
+	EntryID  string `json:"entryId"`
+	Messages int    `json:"messages"`
+	Usage    Usage  `json:"usage"`
+}
+
+// FromSession builds the transcript of the branch ending at leafID, or at
+// the current leaf when leafID is empty. sess is fully loaded first: a
+// lazily loaded session only holds the entries after the last compaction.
+func FromSession(sess *session.Session, leafID string) (*Transcript, error) {
+	if err := sess.EnsureFullyLoaded(); err != nil {
+		return nil, err
+	}
+	if leafID != "" {
+		if _, ok := sess.GetEntry(leafID); !ok {
+			return nil, fmt.Errorf("entry %s not found", leafID)
+		}
+	} else if leaf := sess.GetLeafID(); leaf != nil {
+		leafID = *leaf
+	}
+	t := Build(sess.GetHeader(), sess.GetBranch(leafID))
+	t.Name, t.Title = sess.GetSessionName(), sess.GetSessionTitle()
+	return t, nil
+}
+
+// Build normalizes branch, the entries from the root to the leaf.
+// Messages hidden from the user (hints, runtime state) are left out.
+func Build(header session.SessionHeader, branch []session.SessionEntry) *Transcript {
+	t := &Transcript{
+		Version:   TranscriptVersion,
+		SessionID: header.ID,
+		Cwd:       header.Cwd,
+		Created:   header.Timestamp,
+		Entries:   []Entry{},
+		Turns:     []Turn{},
+	}
+	if len(branch) > 0 {
+		t.LeafID = branch[len(branch)-1].ID
+	}
+
+	turn := 0
+	for _, e := range branch {
+		entry := Entry{ID: e.ID, Timestamp: e.Timestamp}
+		switch e.Type {
+		case session.EntryTypeMessage:
+			if e.Message == nil || !e.Message.IsUserVisible() {
+				continue
+			}
+			msg := *e.Message
+			if msg.Timestamp > 0 {
+				entry.Timestamp = time.UnixMilli(msg.Timestamp).UTC().Format(time.RFC3339)
+			}
+			entry.Blocks = blocks(msg)
+			switch msg.Role {
+			case "user":
+				entry.Type = EntryUser
+				if kind := messageKind(msg); kind != "" && kind != "user" {
+					entry.Kind = kind
+				} else {
+					turn++
+					t.Turns = append(t.Turns, Turn{Turn: turn, EntryID: e.ID})
+				}
+			case "assistant":
+				entry.Type = EntryAssistant
+				entry.Model = msg.Model
+				if msg.Provider != "" && msg.Model != "" {
+					entry.Model = msg.Provider + "/" + msg.Model
+				}
+				if u := msg.Usage; u != nil {
+					entry.Usage = &Usage{
+						Input:      u.InputTokens,
+						Output:     u.OutputTokens,
+						CacheRead:  u.CacheRead,
+						CacheWrite: u.CacheWrite,
+						Cost:       u.Cost.Total,
+					}
+					t.Usage.add(*entry.Usage)
+					if turn > 0 {
+						t.Turns[turn-1].Usage.add(*entry.Usage)
+					}
+				}
+				if turn > 0 {
+					t.Turns[turn-1].Messages++
+				}
+			case "toolResult":
+				entry.Type = EntryToolResult
+				entry.ToolCallID = msg.ToolCallID
+				entry.ToolName = msg.ToolName
+				entry.IsError = msg.IsError
+			default:
+				continue
+			}
+		case session.EntryTypeCompaction:
+			entry.Type = EntryCompaction
+			entry.Summary = e.Summary
+			entry.TokensBefore = e.TokensBefore
+		case session.EntryTypeBranchSummary:
+			entry.Type = EntryBranchSummary
+			entry.Summary = e.Summary
+		default:
+			continue
+		}
+		entry.Turn = turn
+		t.Entries = append(t.Entries, entry)
+	}
+	return t
+}
+
+func blocks(msg agentctx.AgentMessage) []Block {
+	var out []Block
+	for _, content := range msg.Content {
+		switch c := content.(type) {
+		case agentctx.TextContent:
+			out = append(out, Block{Type: BlockText, Text: c.Text})
+		case agentctx.ThinkingContent:
+			out = append(out, Block{Type: BlockThinking, Text: c.Thinking})
+		case agentctx.ToolCallContent:
+			out = append(out, Block{Type: BlockToolCall, ToolCallID: c.ID, ToolName: c.Name, Arguments: c.Arguments})
+		case agentctx.ImageContent:
+			out = append(out, Block{Type: BlockImage, MimeType: c.MimeType, Data: c.Data})
+		}
+	}
+	return out
+}
+
+func messageKind(msg agentctx.AgentMessage) string {
+	if msg.Metadata == nil {
+		return ""
+	}
+	return msg.Metadata.Kind
+}
+
+// ParseTranscript decodes a JSON transcript written by Render.
+func ParseTranscript(data []byte) (*Transcript, error) {
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	if t.Version < 1 || t.Version > TranscriptVersion {
+		return nil, fmt.Errorf("unsupported transcript version %d", t.Version)
+	}
+	return &t, nil
+}
+
+// Messages converts the message entries of t back to agent messages.
+// Compaction and branch summary markers are dropped: the messages they
+// summarize are in the transcript.
+func (t *Transcript) Messages() []agentctx.AgentMessage {
+	var messages []agentctx.AgentMessage
+	for _, e := range t.Entries {
+		var msg agentctx.AgentMessage
+		switch e.Type {
+		case EntryUser:
+			msg = agentctx.NewUserMessage("")
+			if e.Kind != "" {
+				msg.Metadata.Kind = e.Kind
+			}
+		case EntryAssistant:
+			msg = agentctx.NewAssistantMessage()
+			msg.Model = e.Model
+			if provider, model, ok := strings.Cut(e.Model, "/"); ok {
+				msg.Provider, msg.Model = provider, model
+			}
+			if u := e.Usage; u != nil {
+				msg.Usage = &agentctx.Usage{
+					InputTokens:  u.Input,
+					OutputTokens: u.Output,
+					CacheRead:    u.CacheRead,
+					CacheWrite:   u.CacheWrite,
+					TotalTokens:  u.Input + u.Output + u.CacheRead + u.CacheWrite,
+					Cost:         agentctx.Cost{Total: u.Cost},
+				}
+			}
+		case EntryToolResult:
+			msg = agentctx.NewToolResultMessage(e.ToolCallID, e.ToolName, nil, e.IsError)
+		default:
+			continue
+		}
+		if ts, err := time.Parse(time.RFC3339, e.Timestamp); err == nil {
+			msg.Timestamp = ts.UnixMilli()
+		}
+		msg.Content = content(e.Blocks)
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func content(blocks []Block) []agentctx.ContentBlock {
+	out := []agentctx.ContentBlock{}
+	for _, b := range blocks {
+		switch b.Type {
+		case BlockText:
+			out = append(out, agentctx.TextContent{Type: "text", Text: b.Text})
+		case BlockThinking:
+			out = append(out, agentctx.ThinkingContent{Type: "thinking", Thinking: b.Text})
+		case BlockToolCall:
+			out = append(out, agentctx.ToolCallContent{ID: b.ToolCallID, Type: "toolCall", Name: b.ToolName, Arguments: b.Arguments})
+		case BlockImage:
+			out = append(out, agentctx.ImageContent{Type: "image", MimeType: b.MimeType, Data: b.Data})
+		}
+	}
+	return out
+}
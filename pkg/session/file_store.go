@@ -0,0 +1,458 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// FileStore keeps each session in a directory under one sessions directory:
+// messages.jsonl, compaction snapshots under compactions/, and meta.json.
+// See docs/session-format.md. FileStore is a DirStore.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns the store for the sessions in sessionsDir.
+func NewFileStore(sessionsDir string) *FileStore {
+	return &FileStore{dir: sessionsDir}
+}
+
+// Dir returns the sessions directory.
+func (fs *FileStore) Dir() string {
+	return fs.dir
+}
+
+// SessionDir returns the directory of session id.
+func (fs *FileStore) SessionDir(id string) string {
+	return filepath.Join(fs.dir, id)
+}
+
+// fileStoreFor returns the store and ID of the session in sessionDir.
+func fileStoreFor(sessionDir string) (*FileStore, string) {
+	sessionDir = filepath.Clean(sessionDir)
+	return NewFileStore(filepath.Dir(sessionDir)), filepath.Base(sessionDir)
+}
+
+func (fs *FileStore) entriesPath(id string) string {
+	return filepath.Join(fs.SessionDir(id), "messages.jsonl")
+}
+
+func (fs *FileStore) ReadHeader(id string) (*SessionHeader, error) {
+	f, err := os.Open(fs.entriesPath(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readHeaderFromFile(f)
+}
+
+// ReadEntries reads the whole file. A file in the legacy format, a JSONL of
+// bare messages, is converted and rewritten in the current format.
+func (fs *FileStore) ReadEntries(id string) (*SessionHeader, []*SessionEntry, error) {
+	filePath := fs.entriesPath(id)
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := splitLines(data)
+	if len(lines) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	var entries []*SessionEntry
+	if header, err := decodeSessionHeader(firstNonEmptyLine(lines)); err == nil && header != nil {
+		for _, line := range lines {
+			if len(line) == 0 || headerLine(line) {
+				continue
+			}
+			entry, err := decodeSessionEntry(line)
+			if err != nil || entry == nil {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		return header, entries, nil
+	}
+
+	// Legacy format: JSONL of AgentMessage objects.
+	byID := make(map[string]*SessionEntry)
+	var parentID *string
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var msg agentctx.AgentMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+		ts := time.Now().UTC().Format(time.RFC3339Nano)
+		if msg.Timestamp != 0 {
+			ts = time.UnixMilli(msg.Timestamp).UTC().Format(time.RFC3339Nano)
+		}
+		entry := &SessionEntry{
+			Type:      EntryTypeMessage,
+			ID:        generateEntryID(byID),
+			ParentID:  parentID,
+			Timestamp: ts,
+			Message:   &msg,
+		}
+		entries = append(entries, entry)
+		byID[entry.ID] = entry
+		parentID = &entry.ID
+	}
+	cwd, _ := os.Getwd()
+	header := newSessionHeader(sessionIDFromFilePath(filePath), cwd, "")
+	// Rewrite file to migrate from legacy format to new format
+	// This is a one-time migration, not a regular rewrite
+	if err := fs.WriteEntries(id, header, entries); err != nil {
+		return nil, nil, err
+	}
+	return &header, entries, nil
+}
+
+// ReadBranch scans the file from its end for the latest compaction entry,
+// so a long session loads without decoding the history before it.
+func (fs *FileStore) ReadBranch(id string) (*SessionHeader, []*SessionEntry, error) {
+	f, err := os.Open(fs.entriesPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	header, err := readHeaderFromFile(f)
+	if err != nil {
+		return fs.ReadEntries(id)
+	}
+	entries, err := readBranchFromEnd(f)
+	if err != nil {
+		return fs.ReadEntries(id)
+	}
+	return header, entries, nil
+}
+
+func (fs *FileStore) AppendEntry(id string, entry *SessionEntry) error {
+	filePath := fs.entriesPath(id)
+	return withFileLock(filePath+".lock", func() error {
+		if info, err := os.Stat(filePath); err != nil || info.Size() == 0 {
+			return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+
+		file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+		return file.Sync()
+	})
+}
+
+// WriteEntries writes a temporary file and renames it over messages.jsonl,
+// so readers see either the old or the new file.
+func (fs *FileStore) WriteEntries(id string, header SessionHeader, entries []*SessionEntry) error {
+	filePath := fs.entriesPath(id)
+	return withFileLock(filePath+".lock", func() error {
+		tmpPath := fmt.Sprintf("%s.tmp-%d-%d", filePath, os.Getpid(), time.Now().UnixNano())
+		file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+			_ = os.Remove(tmpPath)
+		}()
+
+		encoder := json.NewEncoder(file)
+		if err := encoder.Encode(header); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		if err := file.Sync(); err != nil {
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmpPath, filePath)
+	})
+}
+
+func (fs *FileStore) DeleteEntries(id string) error {
+	filePath := fs.entriesPath(id)
+	return withFileLock(filePath+".lock", func() error {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (fs *FileStore) PutSnapshot(id, ref string, messages []agentctx.AgentMessage) error {
+	return saveSnapshotMessages(filepath.Join(fs.SessionDir(id), ref), messages)
+}
+
+func (fs *FileStore) GetSnapshot(id, ref string) ([]agentctx.AgentMessage, error) {
+	return loadSnapshotMessages(filepath.Join(fs.SessionDir(id), ref))
+}
+
+// dirSnapshots reads the snapshots of the session in dir, for
+// buildSessionContext.
+func dirSnapshots(dir string) func(ref string) ([]agentctx.AgentMessage, error) {
+	if dir == "" {
+		return nil
+	}
+	return func(ref string) ([]agentctx.AgentMessage, error) {
+		return loadSnapshotMessages(filepath.Join(dir, ref))
+	}
+}
+
+func (fs *FileStore) PutMeta(id string, meta *SessionMeta) error {
+	metaPath := filepath.Join(fs.SessionDir(id), "meta.json")
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, data, 0644)
+}
+
+// GetMeta reads meta.json, or builds the metadata from the session file
+// when meta.json is missing.
+func (fs *FileStore) GetMeta(id string) (*SessionMeta, error) {
+	sessDir := fs.SessionDir(id)
+	data, err := os.ReadFile(filepath.Join(sessDir, "meta.json"))
+	if err == nil {
+		var meta SessionMeta
+		if err = json.Unmarshal(data, &meta); err == nil {
+			return &meta, nil
+		}
+	}
+
+	// Fallback: build metadata directly from session directory
+	if _, statErr := os.Stat(sessDir); statErr == nil {
+		return metaFromSessionDir(sessDir)
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return nil, err
+}
+
+// List returns the sessions that have a directory holding messages.jsonl or
+// meta.json.
+func (fs *FileStore) List() ([]SessionMeta, error) {
+	// Ensure directory exists
+	if err := os.MkdirAll(fs.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	// Read directory entries
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
+	}
+
+	var sessions []SessionMeta
+	for _, entry := range entries {
+		// Only consider directories (new session format)
+		if !entry.IsDir() {
+			continue
+		}
+
+		meta, err := metaFromSessionDir(filepath.Join(fs.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, *meta)
+	}
+	return sessions, nil
+}
+
+// Delete removes the session directory, and the files of the legacy layout
+// that kept sessions as <id>.jsonl and <id>.meta.json.
+func (fs *FileStore) Delete(id string) error {
+	sessPath := fs.SessionDir(id)
+
+	// Delete session directory (new format) or file (legacy fallback).
+	if info, err := os.Stat(sessPath); err == nil {
+		if info.IsDir() {
+			if err := os.RemoveAll(sessPath); err != nil {
+				return fmt.Errorf("failed to delete session directory: %w", err)
+			}
+		} else if err := os.Remove(sessPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete session file: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat session path: %w", err)
+	}
+
+	legacySessionPath := filepath.Join(fs.dir, id+".jsonl")
+	if err := os.Remove(legacySessionPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete legacy session file: %w", err)
+	}
+
+	legacyMetaPath := filepath.Join(fs.dir, id+".meta.json")
+	if err := os.Remove(legacyMetaPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete legacy metadata file: %w", err)
+	}
+
+	return nil
+}
+
+// metaFromSessionDir creates metadata from an existing session directory.
+func metaFromSessionDir(sessDir string) (*SessionMeta, error) {
+	// Try to load metadata file first
+	id := filepath.Base(sessDir)
+	metaPath := filepath.Join(sessDir, "meta.json")
+	if data, err := os.ReadFile(metaPath); err == nil {
+		var meta SessionMeta
+		if err := json.Unmarshal(data, &meta); err == nil {
+			return &meta, nil
+		}
+	}
+
+	// Lightweight fallback: read header from JSONL file without loading all entries.
+	// The canonical metadata is in meta.json; this path only exists for edge cases
+	// where meta.json is missing (e.g. sessions from older versions).
+	jsonlPath := filepath.Join(sessDir, "messages.jsonl")
+	f, err := os.Open(jsonlPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			info, statErr := os.Stat(sessDir)
+			modTime := time.Now()
+			if statErr == nil {
+				modTime = info.ModTime()
+			}
+			return &SessionMeta{
+				ID: id, Name: id, Title: "Session",
+				CreatedAt: modTime, UpdatedAt: modTime,
+			}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	header, err := readHeaderFromFile(f)
+	if err != nil {
+		// Fallback to full load only if we can't even read the header
+		sess, loadErr := LoadSession(sessDir)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return buildMetaFromSession(sess, id, sessDir)
+	}
+
+	info, statErr := os.Stat(sessDir)
+	modTime := time.Now()
+	if statErr == nil {
+		modTime = info.ModTime()
+	}
+	createdAt := modTime
+	if ts := strings.TrimSpace(header.Timestamp); ts != "" {
+		if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			createdAt = parsed
+		}
+	}
+
+	// Lightweight tail scan for session name/title (no full entry loading)
+	sessName, sessTitle := scanSessionInfoFromTail(f)
+	if sessName == "" {
+		sessName = id
+	}
+	if sessTitle == "" {
+		sessTitle = "Session"
+	}
+
+	return &SessionMeta{
+		ID:           id,
+		Name:         sessName,
+		Title:        sessTitle,
+		CreatedAt:    createdAt,
+		UpdatedAt:    modTime,
+		MessageCount: 0,
+	}, nil
+}
+
+// buildMetaFromSession builds SessionMeta from a fully loaded session.
+func buildMetaFromSession(sess *Session, id string, sessDir string) (*SessionMeta, error) {
+	info, err := os.Stat(sessDir)
+	if err != nil {
+		return nil, err
+	}
+	header := sess.GetHeader()
+	createdAt := info.ModTime()
+	if ts := strings.TrimSpace(header.Timestamp); ts != "" {
+		if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			createdAt = parsed
+		}
+	}
+	name := sess.GetSessionName()
+	if name == "" {
+		name = id
+	}
+	title := sess.GetSessionTitle()
+	if title == "" {
+		title = "Session"
+	}
+	return &SessionMeta{
+		ID:           id,
+		Name:         name,
+		Title:        title,
+		CreatedAt:    createdAt,
+		UpdatedAt:    info.ModTime(),
+		MessageCount: len(sess.GetMessages()),
+	}, nil
+}
+
+// withFileLock runs run under an exclusive flock on lockPath, so that
+// processes sharing a session do not interleave their writes.
+func withFileLock(lockPath string, run func() error) error {
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return err
+	}
+
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	}()
+
+	return run()
+}
@@ -0,0 +1,579 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// Severities of an FsckIssue.
+const (
+	FsckError   = "error"
+	FsckWarning = "warning"
+)
+
+// FsckIssue is one problem found in a session.
+type FsckIssue struct {
+	// Code is a stable identifier: torn_tail, bad_line, missing_newline,
+	// bad_entry, missing_header, extra_header, newer_version, legacy_format,
+	// missing_id, duplicate_entry, duplicate_id, dangling_parent,
+	// forward_parent, bad_snapshot_ref, missing_snapshot, bad_snapshot,
+	// bad_last_compaction, unanswered_tool_call, orphan_tool_result or
+	// lazy_mismatch.
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Line     int    `json:"line,omitempty"` // 1-based line in messages.jsonl
+	EntryID  string `json:"entryId,omitempty"`
+	Message  string `json:"message"`
+	// Repair describes what RepairSession does about the issue; empty when
+	// it cannot be repaired safely.
+	Repair   string `json:"repair,omitempty"`
+	Repaired bool   `json:"repaired,omitempty"`
+}
+
+// FsckReport is the result of checking one session.
+type FsckReport struct {
+	SessionDir string      `json:"sessionDir"`
+	Entries    int         `json:"entries"`
+	Branches   int         `json:"branches"`
+	Issues     []FsckIssue `json:"issues"`
+	// Backup is the copy of messages.jsonl taken before a repair.
+	Backup string `json:"backup,omitempty"`
+}
+
+// Errors returns the number of errors that were not repaired.
+func (r *FsckReport) Errors() int {
+	return r.count(FsckError)
+}
+
+// Warnings returns the number of warnings that were not repaired.
+func (r *FsckReport) Warnings() int {
+	return r.count(FsckWarning)
+}
+
+func (r *FsckReport) count(severity string) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity && !issue.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// CheckSession validates the session in sessionDir without changing it:
+// every line of messages.jsonl, the header, the entry graph, the
+// compaction snapshots, tool-call pairing along every branch, and whether
+// lazy loading shows the same history as a full load.
+func CheckSession(sessionDir string) (*FsckReport, error) {
+	return fsckSession(sessionDir, false)
+}
+
+// RepairSession checks the session like CheckSession and applies the safe
+// repairs: it drops torn and unreadable lines, re-links entries whose
+// parent is missing to the entry before them, restores a missing header
+// and rebuilds missing or unreadable snapshots from the entry chain.
+// messages.jsonl is copied to a backup first. The session file lock is
+// held throughout, so appends by running agents wait. A session owned by a
+// live process is refused with a *SessionLockedError unless force is set:
+// its owner would keep writing from the state it loaded before the repair.
+func RepairSession(sessionDir string, force bool) (*FsckReport, error) {
+	if _, err := os.Stat(filepath.Join(sessionDir, "messages.jsonl")); err != nil {
+		return nil, err
+	}
+	if !force {
+		owner, err := ReadSessionOwner(sessionDir)
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil {
+			return nil, &SessionLockedError{Dir: sessionDir, Owner: *owner}
+		}
+	}
+	var report *FsckReport
+	s := &Session{sessionDir: sessionDir, persist: true}
+	err := s.withFileWriteLock(func() error {
+		var err error
+		report, err = fsckSession(sessionDir, true)
+		return err
+	})
+	return report, err
+}
+
+// fsckLine is one non-empty line of messages.jsonl.
+type fsckLine struct {
+	num    int
+	raw    []byte
+	header *SessionHeader
+	entry  *SessionEntry
+	ignore bool // unreadable; loaders skip it too
+	drop   bool // removed by the repair
+	dirty  bool // re-encoded by the repair
+}
+
+type fsck struct {
+	dir     string
+	repair  bool
+	data    []byte
+	report  *FsckReport
+	lines   []*fsckLine
+	header  *fsckLine
+	entries []*SessionEntry
+	byID    map[string]*SessionEntry
+	changed bool
+}
+
+func fsckSession(sessionDir string, repair bool) (*FsckReport, error) {
+	data, err := os.ReadFile(filepath.Join(sessionDir, "messages.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	c := &fsck{
+		dir:    sessionDir,
+		repair: repair,
+		data:   data,
+		report: &FsckReport{SessionDir: sessionDir, Issues: []FsckIssue{}},
+		byID:   make(map[string]*SessionEntry),
+	}
+	if !c.checkLines() {
+		return c.report, nil
+	}
+	c.checkGraph()
+	c.checkSnapshots()
+	c.checkLastCompaction()
+	c.checkToolPairing()
+	if c.changed {
+		if err := c.write(); err != nil {
+			return c.report, fmt.Errorf("write repaired session: %w", err)
+		}
+	}
+	c.checkLazyLoad()
+	return c.report, nil
+}
+
+// add records issue and, when repairing, applies fix.
+func (c *fsck) add(issue FsckIssue, fix func() error) {
+	if c.repair && fix != nil && issue.Repair != "" {
+		if err := fix(); err != nil {
+			issue.Message += fmt.Sprintf(" (repair failed: %v)", err)
+		} else {
+			issue.Repaired = true
+			c.changed = true
+		}
+	}
+	c.report.Issues = append(c.report.Issues, issue)
+}
+
+func dropLine(line *fsckLine) func() error {
+	return func() error {
+		line.drop = true
+		return nil
+	}
+}
+
+// checkLines parses every line and validates the header. It returns false
+// when the file cannot be checked further.
+func (c *fsck) checkLines() bool {
+	segments := bytes.Split(c.data, []byte("\n"))
+	torn := len(c.data) > 0 && c.data[len(c.data)-1] != '\n'
+	started := false
+	for i, raw := range segments {
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		line := &fsckLine{num: i + 1, raw: raw}
+		c.lines = append(c.lines, line)
+		last := torn && i == len(segments)-1
+
+		if !json.Valid(raw) {
+			line.ignore = true
+			if last {
+				c.add(FsckIssue{Code: "torn_tail", Severity: FsckError, Line: line.num,
+					Message: fmt.Sprintf("last line is cut off after %d bytes", len(raw)),
+					Repair:  "truncate the file before it"}, dropLine(line))
+			} else {
+				c.add(FsckIssue{Code: "bad_line", Severity: FsckError, Line: line.num,
+					Message: "line is not valid JSON",
+					Repair:  "remove the line"}, dropLine(line))
+			}
+			continue
+		}
+		if last {
+			c.add(FsckIssue{Code: "missing_newline", Severity: FsckWarning, Line: line.num,
+				Message: "last line has no newline, so the next append would join it",
+				Repair:  "add the newline"}, func() error { return nil })
+		}
+
+		if header, err := decodeSessionHeader(raw); err == nil && header != nil {
+			line.header = header
+			c.checkHeader(line, started)
+			started = true
+			continue
+		}
+		if !started {
+			started = true
+			if !c.checkFirstEntry(line) {
+				return false
+			}
+		}
+		entry, err := decodeSessionEntry(raw)
+		if err != nil || entry == nil {
+			line.ignore = true
+			reason := "not a session entry"
+			if err != nil {
+				reason = err.Error()
+			}
+			c.add(FsckIssue{Code: "bad_entry", Severity: FsckError, Line: line.num,
+				Message: "unreadable entry: " + reason,
+				Repair:  "remove the line"}, dropLine(line))
+			continue
+		}
+		line.entry = entry
+	}
+	return true
+}
+
+func (c *fsck) checkHeader(line *fsckLine, started bool) {
+	if started {
+		line.ignore = true
+		c.add(FsckIssue{Code: "extra_header", Severity: FsckWarning, Line: line.num,
+			Message: "session header after the start of the file",
+			Repair:  "remove the line"}, dropLine(line))
+		return
+	}
+	c.header = line
+	if line.header.Version > CurrentSessionVersion {
+		c.add(FsckIssue{Code: "newer_version", Severity: FsckWarning, Line: line.num,
+			Message: fmt.Sprintf("session version %d is newer than this binary (%d)", line.header.Version, CurrentSessionVersion)}, nil)
+	}
+}
+
+// checkFirstEntry handles a first readable line that is not a header. It
+// returns false for legacy files, which the loader converts on its own.
+func (c *fsck) checkFirstEntry(line *fsckLine) bool {
+	var probe struct {
+		Type string `json:"type"`
+		Role string `json:"role"`
+	}
+	json.Unmarshal(line.raw, &probe)
+	if probe.Type == "" && probe.Role != "" {
+		c.add(FsckIssue{Code: "legacy_format", Severity: FsckWarning, Line: line.num,
+			Message: "file holds bare messages from an old version; loading the session converts it"}, nil)
+		return false
+	}
+
+	header := newSessionHeader(sessionIDFromDirPath(c.dir), "", "")
+	if entry, err := decodeSessionEntry(line.raw); err == nil && entry != nil && entry.Timestamp != "" {
+		header.Timestamp = entry.Timestamp
+	}
+	headerLine := &fsckLine{header: &header, dirty: true}
+	c.add(FsckIssue{Code: "missing_header", Severity: FsckError, Line: line.num,
+		Message: "file does not start with a session header",
+		Repair:  fmt.Sprintf("insert a header with ID %s (the working directory is unknown)", header.ID)},
+		func() error {
+			c.lines = append([]*fsckLine{headerLine}, c.lines...)
+			c.header = headerLine
+			return nil
+		})
+	return true
+}
+
+func (c *fsck) entryLines() []*fsckLine {
+	var lines []*fsckLine
+	for _, line := range c.lines {
+		if line.entry != nil && !line.ignore && !line.drop {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// checkGraph validates entry IDs and parent links. Entries are appended
+// after their parent, so a parent must appear earlier in the file.
+func (c *fsck) checkGraph() {
+	lines := c.entryLines()
+	later := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		later[line.entry.ID] = true
+	}
+	lineOf := make(map[string]*fsckLine, len(lines))
+
+	var prev *SessionEntry
+	for _, line := range lines {
+		e := line.entry
+		if e.ID == "" {
+			c.add(FsckIssue{Code: "missing_id", Severity: FsckError, Line: line.num,
+				Message: fmt.Sprintf("%s entry has no ID", e.Type),
+				Repair:  "give it a new ID"}, func() error {
+				e.ID = generateEntryID(c.byID)
+				line.dirty = true
+				return nil
+			})
+			if e.ID == "" {
+				continue
+			}
+		}
+		if first, ok := lineOf[e.ID]; ok {
+			if bytes.Equal(first.raw, line.raw) {
+				c.add(FsckIssue{Code: "duplicate_entry", Severity: FsckWarning, Line: line.num, EntryID: e.ID,
+					Message: fmt.Sprintf("same entry as line %d", first.num),
+					Repair:  "remove the line"}, dropLine(line))
+			} else {
+				c.add(FsckIssue{Code: "duplicate_id", Severity: FsckError, Line: line.num, EntryID: e.ID,
+					Message: fmt.Sprintf("entry ID is also used on line %d; loading keeps only this one", first.num)}, nil)
+			}
+			continue
+		}
+
+		if e.ParentID != nil {
+			if _, ok := c.byID[*e.ParentID]; !ok {
+				issue := FsckIssue{Code: "dangling_parent", Severity: FsckError, Line: line.num, EntryID: e.ID,
+					Message: fmt.Sprintf("parent %s does not exist, so history before this entry is lost", *e.ParentID)}
+				if later[*e.ParentID] {
+					issue.Code = "forward_parent"
+					issue.Message = fmt.Sprintf("parent %s comes later in the file", *e.ParentID)
+				}
+				var parentID *string
+				issue.Repair = "make it a root entry"
+				if prev != nil {
+					id := prev.ID
+					parentID = &id
+					issue.Repair = fmt.Sprintf("re-link it to the entry before it (%s)", id)
+				}
+				c.add(issue, func() error {
+					e.ParentID = parentID
+					line.dirty = true
+					return nil
+				})
+			}
+		}
+		lineOf[e.ID] = line
+		c.byID[e.ID] = e
+		c.entries = append(c.entries, e)
+		prev = e
+	}
+
+	hasChild := make(map[string]bool, len(c.entries))
+	for _, e := range c.entries {
+		if e.ParentID != nil {
+			hasChild[*e.ParentID] = true
+		}
+	}
+	c.report.Entries = len(c.entries)
+	for _, e := range c.entries {
+		if !hasChild[e.ID] {
+			c.report.Branches++
+		}
+	}
+}
+
+// checkSnapshots validates the snapshot of every compaction, oldest first,
+// so that a rebuilt snapshot can serve the rebuild of a later one.
+func (c *fsck) checkSnapshots() {
+	for _, e := range c.entries {
+		if e.Type != EntryTypeCompaction || e.SnapshotRef == "" {
+			continue
+		}
+		if !filepath.IsLocal(e.SnapshotRef) {
+			c.add(FsckIssue{Code: "bad_snapshot_ref", Severity: FsckError, EntryID: e.ID,
+				Message: fmt.Sprintf("snapshot path %q is outside the session directory", e.SnapshotRef)}, nil)
+			continue
+		}
+		path := filepath.Join(c.dir, e.SnapshotRef)
+		_, err := loadSnapshotMessages(path)
+		if err == nil {
+			continue
+		}
+		issue := FsckIssue{Code: "bad_snapshot", Severity: FsckError, EntryID: e.ID,
+			Message: fmt.Sprintf("snapshot %s is unreadable (%v), so resuming shows only the summary", e.SnapshotRef, err),
+			Repair:  "rebuild it from the entry chain before the compaction; the old file is kept as .bak"}
+		if errors.Is(err, fs.ErrNotExist) {
+			issue.Code = "missing_snapshot"
+			issue.Message = fmt.Sprintf("snapshot %s is missing, so resuming shows only the summary", e.SnapshotRef)
+			issue.Repair = "rebuild it from the entry chain before the compaction"
+		}
+		c.add(issue, func() error { return c.rebuildSnapshot(e, path) })
+	}
+}
+
+// rebuildSnapshot replaces the snapshot of compaction with the messages on
+// the entry chain before it. The summary is left out because the chain
+// already holds what it summarized; the next compaction shrinks it again.
+func (c *fsck) rebuildSnapshot(compaction *SessionEntry, path string) error {
+	var messages []agentctx.AgentMessage
+	if compaction.ParentID != nil {
+		messages = buildSessionContext(c.entries, compaction.ParentID, c.byID, dirSnapshots(c.dir))
+	}
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".bak"); err != nil {
+			return err
+		}
+	}
+	return saveSnapshotMessages(path, messages)
+}
+
+func (c *fsck) checkLastCompaction() {
+	if c.header == nil || c.header.header.LastCompactionID == "" {
+		return
+	}
+	id := c.header.header.LastCompactionID
+	if e, ok := c.byID[id]; ok && e.Type == EntryTypeCompaction {
+		return
+	}
+	last := ""
+	for _, e := range c.entries {
+		if e.Type == EntryTypeCompaction {
+			last = e.ID
+		}
+	}
+	repair := "clear it"
+	if last != "" {
+		repair = "point it at the last compaction (" + last + ")"
+	}
+	c.add(FsckIssue{Code: "bad_last_compaction", Severity: FsckWarning, Line: c.header.num,
+		Message: fmt.Sprintf("header names compaction %s, which does not exist", id),
+		Repair:  repair}, func() error {
+		c.header.header.LastCompactionID = last
+		c.header.dirty = true
+		return nil
+	})
+}
+
+// checkToolPairing checks, along every branch, that each tool call has a
+// result and each result answers an earlier call. Provider requests drop
+// unpaired calls and results, so these are warnings.
+func (c *fsck) checkToolPairing() {
+	hasChild := make(map[string]bool, len(c.entries))
+	for _, e := range c.entries {
+		if e.ParentID != nil {
+			hasChild[*e.ParentID] = true
+		}
+	}
+	seen := make(map[string]bool)
+	report := func(issue FsckIssue, callID string) {
+		key := issue.Code + "\x00" + issue.EntryID + "\x00" + callID
+		if !seen[key] {
+			seen[key] = true
+			c.add(issue, nil)
+		}
+	}
+	for _, leaf := range c.entries {
+		if hasChild[leaf.ID] {
+			continue
+		}
+		leafID := leaf.ID
+		messages := buildSessionContext(c.entries, &leafID, c.byID, dirSnapshots(c.dir))
+
+		pending := make(map[string]agentctx.ToolCallContent)
+		var pendingEntry string
+		flush := func(where string) {
+			for id, call := range pending {
+				report(FsckIssue{Code: "unanswered_tool_call", Severity: FsckWarning, EntryID: pendingEntry,
+					Message: fmt.Sprintf("%s call %s has no result %s", call.Name, id, where)}, id)
+			}
+			pending = make(map[string]agentctx.ToolCallContent)
+		}
+		for _, msg := range messages {
+			switch msg.Role {
+			case "assistant":
+				flush("before the next assistant message")
+				pendingEntry = msg.EntryID
+				for _, block := range msg.Content {
+					if call, ok := block.(agentctx.ToolCallContent); ok && call.ID != "" {
+						pending[call.ID] = call
+					}
+				}
+			case "toolResult":
+				if _, ok := pending[msg.ToolCallID]; ok {
+					delete(pending, msg.ToolCallID)
+					continue
+				}
+				report(FsckIssue{Code: "orphan_tool_result", Severity: FsckWarning, EntryID: msg.EntryID,
+					Message: fmt.Sprintf("%s result %s answers no earlier call", msg.ToolName, msg.ToolCallID)}, msg.ToolCallID)
+			}
+		}
+		flush("at the end of the branch")
+	}
+}
+
+// checkLazyLoad compares the history a resumed session shows, which comes
+// from the lazy loader, with a full load of the file.
+func (c *fsck) checkLazyLoad() {
+	if c.header == nil {
+		return // without a header on disk the loaders rewrite the file
+	}
+	lazy, err := loadSessionLazy(c.dir)
+	if err != nil {
+		return
+	}
+	full, err := loadSessionFull(c.dir)
+	if err != nil {
+		return
+	}
+	lazyMessages, fullMessages := lazy.GetMessages(), full.GetMessages()
+	if sameHistory(lazyMessages, fullMessages) {
+		return
+	}
+	c.add(FsckIssue{Code: "lazy_mismatch", Severity: FsckWarning,
+		Message: fmt.Sprintf("resuming shows %d messages but the entry chain to the leaf has %d", len(lazyMessages), len(fullMessages))}, nil)
+}
+
+func sameHistory(a, b []agentctx.AgentMessage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Role != b[i].Role || a[i].Timestamp != b[i].Timestamp || a[i].ExtractText() != b[i].ExtractText() {
+			return false
+		}
+	}
+	return true
+}
+
+// write backs up messages.jsonl and replaces it with the repaired lines.
+func (c *fsck) write() error {
+	path := filepath.Join(c.dir, "messages.jsonl")
+	backup := fmt.Sprintf("%s.fsck-%s.bak", path, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backup, c.data, 0644); err != nil {
+		return err
+	}
+	c.report.Backup = backup
+
+	var buf bytes.Buffer
+	for _, line := range c.lines {
+		if line.drop {
+			continue
+		}
+		raw := line.raw
+		if line.dirty {
+			var v any = line.entry
+			if line.header != nil {
+				v = line.header
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			raw = data
+		}
+		buf.Write(raw)
+		buf.WriteByte('\n')
+	}
+
+	tmp := fmt.Sprintf("%s.tmp-%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// newFsckSession writes a session with a tool call, a compaction and a few
+// messages after it.
+func newFsckSession(t *testing.T) *Session {
+	t.Helper()
+	sess := NewSession(t.TempDir())
+	call := agentctx.NewAssistantMessage()
+	call.Content = []agentctx.ContentBlock{agentctx.ToolCallContent{ID: "call-1", Type: "toolCall", Name: "read"}}
+	result := agentctx.NewToolResultMessage("call-1", "read", []agentctx.ContentBlock{agentctx.TextContent{Type: "text", Text: "data"}}, false)
+	for _, msg := range []agentctx.AgentMessage{agentctx.NewUserMessage("first"), call, result} {
+		if _, err := sess.AppendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sess.AppendCompaction("summary", []agentctx.AgentMessage{agentctx.NewUserMessage("kept")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"second", "third"} {
+		if _, err := sess.AppendMessage(agentctx.NewUserMessage(text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sess
+}
+
+// editLines rewrites messages.jsonl through edit.
+func editLines(t *testing.T, sess *Session, edit func(lines []string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(sess.GetPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if err := os.WriteFile(sess.GetPath(), []byte(strings.Join(edit(lines), "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func issueCodes(report *FsckReport) []string {
+	var codes []string
+	for _, issue := range report.Issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+// repairAndRecheck repairs the session and requires a clean check after.
+func repairAndRecheck(t *testing.T, dir string) *FsckReport {
+	t.Helper()
+	report, err := RepairSession(dir, false)
+	if err != nil {
+		t.Fatalf("RepairSession: %v", err)
+	}
+	if report.Errors() != 0 || report.Backup == "" {
+		t.Errorf("repair left %d errors, backup %q: %+v", report.Errors(), report.Backup, report.Issues)
+	}
+	after, err := CheckSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after.Issues) != 0 {
+		t.Errorf("issues after repair: %+v", after.Issues)
+	}
+	return report
+}
+
+func TestCheckSession_Clean(t *testing.T) {
+	sess := newFsckSession(t)
+	report, err := CheckSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 || report.Branches != 1 || report.Entries != 6 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestFsck_TornTail(t *testing.T) {
+	sess := newFsckSession(t)
+	f, _ := os.OpenFile(sess.GetPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"type":"message","id":"abcd","parentId":`)
+	f.Close()
+	before, _ := os.ReadFile(sess.GetPath())
+
+	report, err := CheckSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes := issueCodes(report); len(codes) != 1 || codes[0] != "torn_tail" || report.Errors() != 1 {
+		t.Fatalf("issues = %+v", report.Issues)
+	}
+	if after, _ := os.ReadFile(sess.GetPath()); !bytes.Equal(before, after) {
+		t.Fatal("CheckSession changed the file")
+	}
+
+	report = repairAndRecheck(t, sess.GetDir())
+	if backup, _ := os.ReadFile(report.Backup); !bytes.Equal(backup, before) {
+		t.Error("backup differs from the original file")
+	}
+}
+
+func TestFsck_DanglingParent(t *testing.T) {
+	sess := newFsckSession(t)
+	// Lose the line of the second user message, orphaning the third.
+	editLines(t, sess, func(lines []string) []string {
+		return append(lines[:len(lines)-2], lines[len(lines)-1])
+	})
+
+	report, err := CheckSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := strings.Join(issueCodes(report), " ")
+	if !strings.Contains(codes, "dangling_parent") || !strings.Contains(codes, "lazy_mismatch") {
+		t.Fatalf("issues = %+v", report.Issues)
+	}
+
+	repairAndRecheck(t, sess.GetDir())
+	loaded, err := LoadSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, msg := range loaded.GetMessages() {
+		texts = append(texts, msg.ExtractText())
+	}
+	if got := strings.Join(texts, ","); got != "kept,third" {
+		t.Errorf("history after repair = %q", got)
+	}
+}
+
+func TestFsck_MissingSnapshot(t *testing.T) {
+	sess := newFsckSession(t)
+	snapshot := filepath.Join(sess.GetDir(), "compactions", "compaction_00001.jsonl")
+	if err := os.Remove(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CheckSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes := issueCodes(report); len(codes) != 1 || codes[0] != "missing_snapshot" {
+		t.Fatalf("issues = %+v", report.Issues)
+	}
+
+	repairAndRecheck(t, sess.GetDir())
+	messages, err := loadSnapshotMessages(snapshot)
+	if err != nil || len(messages) != 3 || messages[0].ExtractText() != "first" {
+		t.Errorf("rebuilt snapshot = %d messages, %v", len(messages), err)
+	}
+}
+
+func TestFsck_MissingHeader(t *testing.T) {
+	sess := newFsckSession(t)
+	editLines(t, sess, func(lines []string) []string { return lines[1:] })
+
+	report, err := CheckSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes := issueCodes(report); len(codes) != 1 || codes[0] != "missing_header" {
+		t.Fatalf("issues = %+v", report.Issues)
+	}
+	repairAndRecheck(t, sess.GetDir())
+	if loaded, err := LoadSession(sess.GetDir()); err != nil || loaded.GetID() != filepath.Base(sess.GetDir()) {
+		t.Errorf("reload after repair: %v", err)
+	}
+}
+
+func TestFsck_ToolPairing(t *testing.T) {
+	sess := NewSession(t.TempDir())
+	call := agentctx.NewAssistantMessage()
+	call.Content = []agentctx.ContentBlock{agentctx.ToolCallContent{ID: "call-1", Type: "toolCall", Name: "bash"}}
+	orphan := agentctx.NewToolResultMessage("call-9", "bash", nil, false)
+	for _, msg := range []agentctx.AgentMessage{call, agentctx.NewAssistantMessage(), orphan} {
+		if _, err := sess.AppendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := CheckSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes := strings.Join(issueCodes(report), " "); codes != "unanswered_tool_call orphan_tool_result" || report.Warnings() != 2 || report.Errors() != 0 {
+		t.Errorf("issues = %+v", report.Issues)
+	}
+}
+
+func TestRepairSession_Held(t *testing.T) {
+	sess := newFsckSession(t)
+	if err := sess.Lock(NewSessionOwner("run1"), false); err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Unlock()
+	f, _ := os.OpenFile(sess.GetPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"type":"mess`)
+	f.Close()
+	before, _ := os.ReadFile(sess.GetPath())
+
+	var locked *SessionLockedError
+	if _, err := RepairSession(sess.GetDir(), false); !errors.As(err, &locked) || locked.Owner.RunID != "run1" {
+		t.Fatalf("RepairSession of a held session: %v", err)
+	}
+	if after, _ := os.ReadFile(sess.GetPath()); !bytes.Equal(before, after) {
+		t.Fatal("refused repair changed the file")
+	}
+
+	report, err := RepairSession(sess.GetDir(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Errors() != 0 || !report.Issues[0].Repaired {
+		t.Errorf("forced repair = %+v", report.Issues)
+	}
+}
@@ -0,0 +1,490 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// gcGrace protects sessions and runs touched this recently from every
+// rule: an agent may still be writing them.
+const gcGrace = time.Hour
+
+// GCPolicy says what CollectGarbage removes. Zero durations and sizes turn
+// a rule off; empty sessions are always removed.
+type GCPolicy struct {
+	// MaxAge removes sessions not written for this long, finished runs
+	// older than this and traces of sessions that no longer exist.
+	MaxAge time.Duration
+	// MaxTotalBytes then removes the least recently written sessions
+	// until all sessions fit.
+	MaxTotalBytes int64
+	// KeepNamed keeps sessions given a name by the user.
+	KeepNamed bool
+	// KeepForked keeps sessions that other sessions were forked from.
+	KeepForked bool
+	// ArchiveMaxAge removes compaction archives (compactions/archived_*)
+	// older than this from the sessions that stay.
+	ArchiveMaxAge time.Duration
+	// Keep lists session IDs in use, which are never removed.
+	Keep []string
+	// DryRun reports what would be removed without removing it.
+	DryRun bool
+}
+
+// GCItem is one removed (or, in a dry run, removable) path.
+type GCItem struct {
+	// Kind is "session", "archive", "run", "trace" or "project".
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// GCReport is the result of CollectGarbage.
+type GCReport struct {
+	DryRun   bool     `json:"dryRun"`
+	Removed  []GCItem `json:"removed"`
+	Sessions int      `json:"sessions"` // sessions scanned
+	Bytes    int64    `json:"bytes"`    // bytes removed
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// gcSession is what the policy needs to know about one session.
+type gcSession struct {
+	id, dir, project string
+	updated          time.Time
+	bytes            int64
+	named, empty     bool
+	held             bool // a live process owns it
+	runs             []string
+	parentDir        string
+	protected        bool
+	reason           string
+}
+
+// autoNamePattern matches the names the agent generates for new, forked
+// and default sessions.
+var autoNamePattern = regexp.MustCompile(`^(default|(fork-)?\d{8}-\d{6})$`)
+
+// IsNamed reports whether the user named the session, as opposed to the
+// name generated when it was created.
+func (m SessionMeta) IsNamed() bool {
+	name := strings.TrimSpace(m.Name)
+	return name != "" && name != m.ID && !autoNamePattern.MatchString(name)
+}
+
+// CollectGarbage applies policy to the sessions, runs and traces under
+// aiDir (normally ~/.ai). A removed session takes its traces and the
+// finished runs no kept session used along, and a project directory left
+// without sessions is removed with its search index.
+func CollectGarbage(aiDir string, policy GCPolicy, now time.Time) (*GCReport, error) {
+	report := &GCReport{DryRun: policy.DryRun, Removed: []GCItem{}}
+	sessionsRoot := filepath.Join(aiDir, "sessions")
+	sessions, err := scanGCSessions(sessionsRoot)
+	if err != nil {
+		return nil, err
+	}
+	report.Sessions = len(sessions)
+
+	keep := map[string]bool{}
+	for _, id := range policy.Keep {
+		keep[id] = true
+	}
+	forked := map[string]bool{}
+	for _, s := range sessions {
+		if s.parentDir != "" {
+			forked[s.parentDir] = true
+		}
+	}
+
+	var total int64
+	for _, s := range sessions {
+		total += s.bytes
+		s.protected = keep[s.id] || now.Sub(s.updated) < gcGrace ||
+			(policy.KeepNamed && s.named) || (policy.KeepForked && forked[s.dir]) || s.held
+		switch {
+		case s.protected:
+		case s.empty:
+			s.reason = "no messages"
+		case policy.MaxAge > 0 && now.Sub(s.updated) > policy.MaxAge:
+			s.reason = fmt.Sprintf("not written for %s", formatAge(now.Sub(s.updated)))
+		}
+		if s.reason != "" {
+			total -= s.bytes
+		}
+	}
+	if policy.MaxTotalBytes > 0 && total > policy.MaxTotalBytes {
+		// sessions is sorted oldest first.
+		for _, s := range sessions {
+			if total <= policy.MaxTotalBytes {
+				break
+			}
+			if !s.protected && s.reason == "" {
+				s.reason = fmt.Sprintf("sessions over %s", formatBytes(policy.MaxTotalBytes))
+				total -= s.bytes
+			}
+		}
+	}
+
+	removedIDs := map[string]bool{}
+	existingIDs := map[string]bool{}
+	// keptRuns holds the runs of surviving sessions; a run that also
+	// wrote to one of them is not removed with the others.
+	keptRuns := map[string]bool{}
+	for _, s := range sessions {
+		if s.reason == "" {
+			existingIDs[s.id] = true
+			for _, id := range s.runs {
+				keptRuns[id] = true
+			}
+			if policy.ArchiveMaxAge > 0 {
+				gcArchives(report, s.dir, policy, now)
+			}
+			continue
+		}
+		removedIDs[s.id] = true
+		item := GCItem{Kind: "session", Path: s.dir, Reason: s.reason, Bytes: s.bytes}
+		if !policy.DryRun {
+			if err := NewSessionManager(s.project).DeleteSession(s.id); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				existingIDs[s.id] = true
+				delete(removedIDs, s.id)
+				s.reason = ""
+				continue
+			}
+		}
+		report.add(item)
+	}
+
+	removedRuns := map[string]bool{}
+	for _, s := range sessions {
+		if s.reason == "" {
+			continue
+		}
+		for _, id := range s.runs {
+			if !keptRuns[id] {
+				removedRuns[id] = true
+			}
+		}
+	}
+
+	gcTraces(report, filepath.Join(aiDir, "traces"), removedIDs, existingIDs, policy, now)
+	gcRuns(report, filepath.Join(aiDir, "runs"), removedRuns, policy, now)
+	gcProjects(report, sessions, policy)
+	return report, nil
+}
+
+func (r *GCReport) add(item GCItem) {
+	r.Removed = append(r.Removed, item)
+	r.Bytes += item.Bytes
+}
+
+// remove deletes path unless this is a dry run, and records it.
+func (r *GCReport) remove(item GCItem, dryRun bool) {
+	if !dryRun {
+		if err := os.RemoveAll(item.Path); err != nil {
+			r.Errors = append(r.Errors, err.Error())
+			return
+		}
+	}
+	r.add(item)
+}
+
+// scanGCSessions returns every session under sessionsRoot, least recently
+// written first.
+func scanGCSessions(sessionsRoot string) ([]*gcSession, error) {
+	projects, err := os.ReadDir(sessionsRoot)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*gcSession
+	for _, p := range projects {
+		if !p.IsDir() {
+			continue
+		}
+		project := filepath.Join(sessionsRoot, p.Name())
+		dirs, err := os.ReadDir(project)
+		if err != nil {
+			continue
+		}
+		for _, d := range dirs {
+			if !d.IsDir() {
+				continue
+			}
+			s := &gcSession{id: d.Name(), dir: filepath.Join(project, d.Name()), project: project}
+			s.updated, s.empty, s.parentDir = inspectSessionFile(s.dir)
+			s.bytes = dirSize(s.dir)
+			if owner, _ := ReadSessionOwner(s.dir); owner != nil {
+				s.held = true
+			}
+			if meta, err := metaFromSessionDir(s.dir); err == nil {
+				s.named = meta.IsNamed()
+				s.runs = meta.Runs
+			}
+			sessions = append(sessions, s)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].updated.Before(sessions[j].updated) })
+	return sessions, nil
+}
+
+// inspectSessionFile returns when the session was last written, whether it
+// has no messages, and the directory of the session it was forked from.
+func inspectSessionFile(dir string) (updated time.Time, empty bool, parentDir string) {
+	if info, err := os.Stat(dir); err == nil {
+		updated = info.ModTime()
+	}
+	f, err := os.Open(filepath.Join(dir, "messages.jsonl"))
+	if err != nil {
+		return updated, true, ""
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.ModTime().After(updated) {
+		updated = info.ModTime()
+	}
+	if header, err := readHeaderFromFile(f); err == nil && header.ParentSession != "" {
+		parentDir = filepath.Dir(header.ParentSession)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return updated, false, parentDir
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if bytes.Contains(scanner.Bytes(), []byte(`"type":"`+EntryTypeMessage+`"`)) {
+			return updated, false, parentDir
+		}
+	}
+	return updated, true, parentDir
+}
+
+func gcArchives(report *GCReport, sessionDir string, policy GCPolicy, now time.Time) {
+	paths, _ := filepath.Glob(filepath.Join(sessionDir, "compactions", "archived_*.jsonl"))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || now.Sub(info.ModTime()) <= policy.ArchiveMaxAge {
+			continue
+		}
+		report.remove(GCItem{Kind: "archive", Path: path, Reason: fmt.Sprintf("archived %s ago", formatAge(now.Sub(info.ModTime()))), Bytes: info.Size()}, policy.DryRun)
+	}
+}
+
+// traceSessionID returns the session of a trace file named
+// pid<pid>-sess<session>.<prompt>[...].perfetto.json.
+func traceSessionID(name string) (string, bool) {
+	_, rest, ok := strings.Cut(name, "-sess")
+	if !ok || !strings.HasPrefix(name, "pid") {
+		return "", false
+	}
+	id, _, ok := strings.Cut(rest, ".")
+	return id, ok && id != ""
+}
+
+func gcTraces(report *GCReport, tracesDir string, removed, existing map[string]bool, policy GCPolicy, now time.Time) {
+	files, err := os.ReadDir(tracesDir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		id, ok := traceSessionID(f.Name())
+		info, err := f.Info()
+		if !ok || err != nil || f.IsDir() {
+			continue
+		}
+		reason := ""
+		switch {
+		case removed[id]:
+			reason = "session removed"
+		case policy.MaxAge > 0 && !existing[id] && now.Sub(info.ModTime()) > policy.MaxAge:
+			reason = "session no longer exists"
+		}
+		if reason != "" {
+			report.remove(GCItem{Kind: "trace", Path: filepath.Join(tracesDir, f.Name()), Reason: reason, Bytes: info.Size()}, policy.DryRun)
+		}
+	}
+}
+
+// gcRun is the part of a run's run.json that GC needs.
+type gcRun struct {
+	PID        int    `json:"pid"`
+	Status     string `json:"status"`
+	FinishedAt int64  `json:"finished_at"`
+}
+
+func gcRuns(report *GCReport, runsDir string, removedRuns map[string]bool, policy GCPolicy, now time.Time) {
+	dirs, err := os.ReadDir(runsDir)
+	if err != nil {
+		return
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(runsDir, d.Name())
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		last := info.ModTime()
+		if data, err := os.ReadFile(filepath.Join(dir, "run.json")); err == nil {
+			var run gcRun
+			if json.Unmarshal(data, &run) == nil {
+				if run.Status == "running" && processAlive(run.PID) {
+					continue
+				}
+				if run.FinishedAt > 0 {
+					last = time.Unix(run.FinishedAt, 0)
+				}
+			}
+		}
+		if events, err := os.Stat(filepath.Join(dir, "events.jsonl")); err == nil && events.ModTime().After(last) {
+			last = events.ModTime()
+		}
+		if removedRuns[d.Name()] {
+			report.remove(GCItem{Kind: "run", Path: dir, Reason: "session removed", Bytes: dirSize(dir)}, policy.DryRun)
+			continue
+		}
+		if policy.MaxAge <= 0 || now.Sub(last) < gcGrace || now.Sub(last) <= policy.MaxAge {
+			continue
+		}
+		report.remove(GCItem{Kind: "run", Path: dir, Reason: fmt.Sprintf("finished %s ago", formatAge(now.Sub(last))), Bytes: dirSize(dir)}, policy.DryRun)
+	}
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// gcProjects removes project directories whose sessions were all removed.
+func gcProjects(report *GCReport, sessions []*gcSession, policy GCPolicy) {
+	left := map[string]int{}
+	removedBytes := map[string]int64{}
+	for _, s := range sessions {
+		if s.reason == "" {
+			left[s.project]++
+		} else {
+			left[s.project] += 0
+			removedBytes[s.project] += s.bytes
+		}
+	}
+	for project, n := range left {
+		if n > 0 {
+			continue
+		}
+		if !policy.DryRun {
+			// Another agent may have created a session meanwhile.
+			if dirs, err := os.ReadDir(project); err != nil || hasSubdir(dirs) {
+				continue
+			}
+		}
+		// The sessions are counted already; what is left is the index.
+		size := max(dirSize(project)-removedBytes[project], 0)
+		if !policy.DryRun {
+			size = dirSize(project)
+		}
+		report.remove(GCItem{Kind: "project", Path: project, Reason: "no sessions left", Bytes: size}, policy.DryRun)
+	}
+}
+
+func hasSubdir(entries []os.DirEntry) bool {
+	for _, e := range entries {
+		if e.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func formatAge(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%d hours", int(d/time.Hour))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// gcStampFile records when garbage was last collected automatically.
+const gcStampFile = ".gc-last"
+
+// AutoCollectGarbage runs CollectGarbage when it has not run for interval,
+// across all agents sharing aiDir. It returns a nil report when it skipped.
+func AutoCollectGarbage(aiDir string, policy GCPolicy, interval time.Duration, now time.Time) (*GCReport, error) {
+	path := filepath.Join(aiDir, gcStampFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data))); err == nil && now.Sub(last) < interval {
+			return nil, nil
+		}
+	}
+
+	if err := os.MkdirAll(aiDir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		// Another agent is collecting right now.
+		return nil, nil
+	}
+	defer func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}()
+	// Check again under the lock: another agent may have just finished.
+	if data, err := os.ReadFile(path); err == nil {
+		if last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data))); err == nil && now.Sub(last) < interval {
+			return nil, nil
+		}
+	}
+	if err := f.Truncate(0); err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(now.UTC().Format(time.RFC3339)+"\n"), 0); err != nil {
+		return nil, err
+	}
+	return CollectGarbage(aiDir, policy, now)
+}
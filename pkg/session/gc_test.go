@@ -0,0 +1,219 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// age sets the modification times of a session directory and its files.
+func age(t *testing.T, dir string, when time.Time) {
+	t.Helper()
+	err := filepath.Walk(dir, func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, when, when)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newGCSession(t *testing.T, sm *SessionManager, name string, messages bool) *Session {
+	t.Helper()
+	sess, err := sm.CreateSession(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages {
+		if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sess
+}
+
+func removedPaths(report *GCReport, kind string) []string {
+	var paths []string
+	for _, item := range report.Removed {
+		if item.Kind == kind {
+			paths = append(paths, filepath.Base(item.Path))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestCollectGarbage(t *testing.T) {
+	aiDir := t.TempDir()
+	now := time.Now()
+	old := now.AddDate(0, 0, -40)
+	sm := NewSessionManager(filepath.Join(aiDir, "sessions", "--proj--"))
+
+	stale := newGCSession(t, sm, "20260901-101010", true)
+	named := newGCSession(t, sm, "refactor-parser", true)
+	parent := newGCSession(t, sm, "", true)
+	fork, err := sm.ForkSessionFrom(parent, parent.GetLeafID(), "fork-20260901-101010", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := newGCSession(t, sm, "default", false)
+	inUse := newGCSession(t, sm, "", true)
+	recent := newGCSession(t, sm, "", true)
+	for _, s := range []*Session{stale, named, parent, fork, empty, inUse} {
+		age(t, s.GetDir(), old)
+	}
+	id := func(s *Session) string { return filepath.Base(s.GetDir()) }
+
+	archive := filepath.Join(recent.GetDir(), "compactions", "archived_00001.jsonl")
+	os.MkdirAll(filepath.Dir(archive), 0755)
+	os.WriteFile(archive, []byte("{}\n"), 0644)
+	os.Chtimes(archive, old, old)
+
+	// A project whose only session goes.
+	lone := newGCSession(t, NewSessionManager(filepath.Join(aiDir, "sessions", "--lone--")), "", true)
+	age(t, lone.GetDir(), old)
+
+	traces := filepath.Join(aiDir, "traces")
+	os.MkdirAll(traces, 0755)
+	for _, name := range []string{"pid1-sess" + id(stale) + ".0.perfetto.json", "pid1-sess" + id(recent) + ".0.perfetto.json", "pid2-sessgone.3.perfetto.json"} {
+		os.WriteFile(filepath.Join(traces, name), []byte("[]"), 0644)
+		os.Chtimes(filepath.Join(traces, name), old, old)
+	}
+
+	writeRun := func(name, status string, pid int) {
+		dir := filepath.Join(aiDir, "runs", name)
+		os.MkdirAll(dir, 0755)
+		data, _ := json.Marshal(map[string]any{"id": name, "pid": pid, "status": status, "finished_at": old.Unix()})
+		os.WriteFile(filepath.Join(dir, "run.json"), data, 0644)
+		age(t, dir, old)
+	}
+	writeRun("aaaaaa", "done", 0)
+	writeRun("bbbbbb", "running", os.Getpid())
+
+	policy := GCPolicy{
+		MaxAge:        30 * 24 * time.Hour,
+		KeepNamed:     true,
+		KeepForked:    true,
+		ArchiveMaxAge: 7 * 24 * time.Hour,
+		Keep:          []string{id(inUse)},
+		DryRun:        true,
+	}
+	dry, err := CollectGarbage(aiDir, policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale.GetDir()); err != nil {
+		t.Fatalf("dry run removed a session: %v", err)
+	}
+
+	policy.DryRun = false
+	report, err := CollectGarbage(aiDir, policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != len(dry.Removed) || report.Bytes != dry.Bytes || len(report.Errors) != 0 {
+		t.Errorf("dry run %+v\ndiffers from run %+v", dry, report)
+	}
+
+	wantSessions := []string{id(empty), id(fork), id(lone), id(stale)}
+	sort.Strings(wantSessions)
+	if got := removedPaths(report, "session"); strings.Join(got, " ") != strings.Join(wantSessions, " ") {
+		t.Errorf("removed sessions = %v, want %v", got, wantSessions)
+	}
+	for _, s := range []*Session{named, parent, inUse, recent} {
+		if _, err := os.Stat(s.GetDir()); err != nil {
+			t.Errorf("kept session removed: %v", err)
+		}
+	}
+	if _, err := os.Stat(fork.GetDir()); !os.IsNotExist(err) {
+		t.Errorf("fork not removed: %v", err)
+	}
+	for kind, want := range map[string]string{
+		"archive": "archived_00001.jsonl",
+		"trace":   "pid1-sess" + id(stale) + ".0.perfetto.json pid2-sessgone.3.perfetto.json",
+		"run":     "aaaaaa",
+		"project": "--lone--",
+	} {
+		if got := strings.Join(removedPaths(report, kind), " "); got != want {
+			t.Errorf("removed %s = %q, want %q", kind, got, want)
+		}
+	}
+}
+
+func TestCollectGarbage_MaxTotal(t *testing.T) {
+	aiDir := t.TempDir()
+	now := time.Now()
+	sm := NewSessionManager(filepath.Join(aiDir, "sessions", "--proj--"))
+	var sessions []*Session
+	for i := 0; i < 3; i++ {
+		s := newGCSession(t, sm, "", true)
+		age(t, s.GetDir(), now.AddDate(0, 0, -10+i))
+		sessions = append(sessions, s)
+	}
+	// The oldest session's run goes with it; a run shared with a kept
+	// session stays.
+	for _, run := range []string{"cccccc", "dddddd"} {
+		os.MkdirAll(filepath.Join(aiDir, "runs", run), 0755)
+		if err := sm.AddSessionRun(filepath.Base(sessions[0].GetDir()), run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.AddSessionRun(filepath.Base(sessions[1].GetDir()), "dddddd"); err != nil {
+		t.Fatal(err)
+	}
+	// Sizes differ by a few bytes with the timestamps, so the limit is
+	// exactly what the two newest sessions take.
+	limit := dirSize(sessions[1].GetDir()) + dirSize(sessions[2].GetDir())
+
+	report, err := CollectGarbage(aiDir, GCPolicy{MaxTotalBytes: limit}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := removedPaths(report, "session"); len(got) != 1 || got[0] != filepath.Base(sessions[0].GetDir()) {
+		t.Errorf("removed = %v, want the oldest session", got)
+	}
+	if got := removedPaths(report, "run"); len(got) != 1 || got[0] != "cccccc" {
+		t.Errorf("removed runs = %v, want cccccc", got)
+	}
+	if _, err := os.Stat(filepath.Join(aiDir, "runs", "dddddd")); err != nil {
+		t.Errorf("shared run removed: %v", err)
+	}
+}
+
+func TestSessionMetaIsNamed(t *testing.T) {
+	for name, want := range map[string]bool{
+		"":                     false,
+		"default":              false,
+		"20261018-093000":      false,
+		"fork-20261018-093000": false,
+		"sid":                  false,
+		"parser work":          true,
+	} {
+		if got := (SessionMeta{ID: "sid", Name: name}).IsNamed(); got != want {
+			t.Errorf("IsNamed(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAutoCollectGarbage(t *testing.T) {
+	aiDir := t.TempDir()
+	now := time.Now()
+	report, err := AutoCollectGarbage(aiDir, GCPolicy{}, 24*time.Hour, now)
+	if err != nil || report == nil {
+		t.Fatalf("first run: %v, %v", report, err)
+	}
+	if report, err := AutoCollectGarbage(aiDir, GCPolicy{}, 24*time.Hour, now.Add(time.Hour)); err != nil || report != nil {
+		t.Errorf("within interval: %v, %v", report, err)
+	}
+	if report, err := AutoCollectGarbage(aiDir, GCPolicy{}, 24*time.Hour, now.Add(25*time.Hour)); err != nil || report == nil {
+		t.Errorf("after interval: %v, %v", report, err)
+	}
+}
@@ -169,6 +169,28 @@ func TreeEntryLabel(entry SessionEntry) (string, string) {
 			label = strings.TrimSpace(entry.Title)
 		}
 		return "session info", label
+	case EntryTypeTodo:
+		done, total := agentctx.TodoCounts(entry.Todos)
+		return "todo", fmt.Sprintf("%d/%d done", done, total)
+	case EntryTypeVerify:
+		return "verify", entry.Verify.Summary()
+	case EntryTypePin:
+		if entry.Pin == nil {
+			return "pin", ""
+		}
+		if entry.Pin.Priority == nil {
+			return "unpin", entry.Pin.EntryID
+		}
+		return "pin", fmt.Sprintf("%s (priority %.2f)", entry.Pin.EntryID, *entry.Pin.Priority)
+	case EntryTypeContextEdit:
+		if entry.Edit == nil || len(entry.Edit.Targets) == 0 {
+			return "context edit", ""
+		}
+		targets := entry.Edit.Targets[0].EntryID
+		if len(entry.Edit.Targets) > 1 {
+			targets += ".." + entry.Edit.Targets[len(entry.Edit.Targets)-1].EntryID
+		}
+		return entry.Edit.Op, targets
 	default:
 		return entry.Type, ""
 	}
@@ -107,6 +107,15 @@ func TestTreeEntryLabel(t *testing.T) {
 			wantRole: "session info",
 			wantText: "the title",
 		},
+		{
+			name: "verify result",
+			entry: SessionEntry{Type: EntryTypeVerify, Verify: &agentctx.VerifyResult{
+				Attempts: 2, MaxAttempts: 3,
+				Checks: []agentctx.VerifyCheck{{Command: "go build ./...", Passed: true}, {Command: "go test ./...", ExitCode: 1}},
+			}},
+			wantRole: "verify",
+			wantText: "verify failed: 1/2 checks failed (attempt 2/3)",
+		},
 		{
 			name:     "unknown type",
 			entry:    SessionEntry{Type: "custom"},
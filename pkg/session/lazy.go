@@ -6,7 +6,6 @@ import (
 	"errors"
 	"io"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -25,49 +24,8 @@ func loadSessionLazy(sessionDir string) (*Session, error) {
 		sess.header = newSessionHeader(uuid.NewString(), "", "")
 		return sess, nil
 	}
-
-	filePath := filepath.Join(sessionDir, "messages.jsonl")
-	f, err := os.Open(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			id := sessionIDFromDirPath(sessionDir)
-			cwd, _ := os.Getwd()
-			sess := &Session{
-				sessionDir: sessionDir,
-				entries:    make([]*SessionEntry, 0),
-				byID:       make(map[string]*SessionEntry),
-				persist:    true,
-			}
-			sess.header = newSessionHeader(id, cwd, "")
-			return sess, nil
-		}
-		return nil, err
-	}
-	defer f.Close()
-
-	// Read header first
-	header, err := readHeaderFromFile(f)
-	if err != nil {
-		// Fallback to full load if header parsing fails
-		return loadSessionFull(sessionDir)
-	}
-
-	sess := &Session{
-		sessionDir: sessionDir,
-		entries:    make([]*SessionEntry, 0),
-		byID:       make(map[string]*SessionEntry),
-		header:     *header,
-		persist:    true,
-	}
-
-	// Load from end to find compaction entry
-	if err := loadFromEnd(f, sess); err != nil {
-		// If lazy loading fails, fall back to full load
-		return loadSessionFull(sessionDir)
-	}
-
-	sess.flushed = true
-	return sess, nil
+	store, id := fileStoreFor(sessionDir)
+	return openSession(store, id, false)
 }
 
 // readHeaderFromFile reads the session header from the beginning of the file.
@@ -99,18 +57,19 @@ func readHeaderFromFile(f *os.File) (*SessionHeader, error) {
 	return nil, errors.New("no valid session header found")
 }
 
-// loadFromEnd scans the file from the end to find the most recent compaction entry
-// and loads only the relevant entries.
+// readBranchFromEnd scans the file from the end to find the most recent
+// compaction entry, and returns it followed by the entries after it that the
+// branch is rebuilt from. Without a compaction it returns every entry.
 // Starts with a 256KB tail scan; if no compaction entry is found, progressively
 // doubles the scan window until one is found or the entire file is scanned.
-func loadFromEnd(f *os.File, sess *Session) error {
+func readBranchFromEnd(f *os.File) ([]*SessionEntry, error) {
 	stat, err := f.Stat()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	size := stat.Size()
 	if size == 0 {
-		return nil
+		return nil, nil
 	}
 
 	const minScanSize = 256 * 1024 // 256KB initial scan
@@ -127,13 +86,13 @@ func loadFromEnd(f *os.File, sess *Session) error {
 
 		_, err = f.Seek(startOffset, io.SeekStart)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// Read tail data
 		tailData := make([]byte, size-startOffset)
 		if _, err := io.ReadFull(f, tailData); err != nil && err != io.ErrUnexpectedEOF {
-			return err
+			return nil, err
 		}
 
 		// Split lines, skipping the first line if it's incomplete (we started mid-line)
@@ -180,89 +139,29 @@ func loadFromEnd(f *os.File, sess *Session) error {
 			switch entry.Type {
 			case EntryTypeMessage:
 				recentEntries = append([]*SessionEntry{entry}, recentEntries...)
-			case EntryTypeBranchSummary:
+			case EntryTypeBranchSummary, EntryTypeTodo, EntryTypePin, EntryTypeContextEdit:
 				recentEntries = append([]*SessionEntry{entry}, recentEntries...)
 			}
 		}
 
 		if compactionEntry != nil {
-			// Found compaction entry — process it and remaining recent entries
-			// Load compressed messages from snapshot file
-			if compactionEntry.SnapshotRef != "" && sess.sessionDir != "" {
-				snapshotPath := filepath.Join(sess.sessionDir, compactionEntry.SnapshotRef)
-				loadedMessages, err := loadSnapshotMessages(snapshotPath)
-				if err == nil {
-					// Add compressed messages as entries
-					var parentID *string
-					for i := range loadedMessages {
-						ts := time.Now().UTC().Format(time.RFC3339Nano)
-						if loadedMessages[i].Timestamp != 0 {
-							ts = time.UnixMilli(loadedMessages[i].Timestamp).UTC().Format(time.RFC3339Nano)
-						}
-						entry := &SessionEntry{
-							Type:      EntryTypeMessage,
-							ID:        generateEntryID(sess.byID),
-							ParentID:  parentID,
-							Timestamp: ts,
-							Message:   &loadedMessages[i],
-						}
-						sess.addEntry(entry)
-						pid := entry.ID
-						parentID = &pid
-					}
-				}
-			}
-
-			// Build final entries list
-			if compactionEntry != nil {
-				// Compaction entry's parent is the last compressed message
-				if len(sess.entries) > 0 {
-					lastID := sess.entries[len(sess.entries)-1].ID
-					compactionEntry.ParentID = &lastID
-				} else {
-					compactionEntry.ParentID = nil
-				}
-				sess.addEntry(compactionEntry)
-			}
-
-			// Fix message chain: if the first entry's parent is not in byID, set it to nil
-			// or point to compaction entry if available
-			if len(recentEntries) > 0 {
-				firstEntry := recentEntries[0]
-				if firstEntry.ParentID != nil {
-					_, parentExists := sess.byID[*firstEntry.ParentID]
-					if !parentExists {
-						// Parent not loaded, break the chain here
-						// If we have a compaction entry, link to it; otherwise set to nil
-						if compactionEntry != nil {
-							firstEntry.ParentID = &compactionEntry.ID
-						} else {
-							firstEntry.ParentID = nil
-						}
-					}
-				}
-			}
-
-			for _, entry := range recentEntries {
-				sess.addEntry(entry)
-			}
-
-			return nil
+			return append([]*SessionEntry{compactionEntry}, recentEntries...), nil
 		}
 
 		// No compaction found in this chunk
 		if startOffset == 0 {
 			// Scanned entire file without finding a compaction entry.
-			// Process all remaining lines as a full session load
-			// to avoid re-reading the file in loadSessionFull.
+			// Return all remaining lines as a full session load
+			// to avoid re-reading the file in ReadEntries.
+			var entries []*SessionEntry
 			for _, line := range lines[startIdx:] {
 				entry, err := decodeSessionEntry(line)
 				if err != nil || entry == nil {
 					continue
 				}
-				sess.addEntry(entry)
+				entries = append(entries, entry)
 			}
-			return nil
+			return entries, nil
 		}
 
 		// Double scan size and retry
@@ -270,6 +169,68 @@ func loadFromEnd(f *os.File, sess *Session) error {
 	}
 }
 
+// addBranchEntries adds the entries read by SessionStore.ReadBranch. When
+// they start with a compaction, the messages of its snapshot go first, and
+// the compaction and the entries after it are linked onto them.
+func (s *Session) addBranchEntries(entries []*SessionEntry) {
+	if len(entries) == 0 || entries[0].Type != EntryTypeCompaction {
+		for _, entry := range entries {
+			s.addEntry(entry)
+		}
+		return
+	}
+	compactionEntry, recentEntries := entries[0], entries[1:]
+
+	// Load compressed messages from snapshot file
+	if snapshot := s.snapshotsLocked(); compactionEntry.SnapshotRef != "" && snapshot != nil {
+		loadedMessages, err := snapshot(compactionEntry.SnapshotRef)
+		if err == nil {
+			// Add compressed messages as entries
+			var parentID *string
+			for i := range loadedMessages {
+				ts := time.Now().UTC().Format(time.RFC3339Nano)
+				if loadedMessages[i].Timestamp != 0 {
+					ts = time.UnixMilli(loadedMessages[i].Timestamp).UTC().Format(time.RFC3339Nano)
+				}
+				entry := &SessionEntry{
+					Type:      EntryTypeMessage,
+					ID:        generateEntryID(s.byID),
+					ParentID:  parentID,
+					Timestamp: ts,
+					Message:   &loadedMessages[i],
+				}
+				s.addEntry(entry)
+				pid := entry.ID
+				parentID = &pid
+			}
+		}
+	}
+
+	// Compaction entry's parent is the last compressed message
+	if len(s.entries) > 0 {
+		lastID := s.entries[len(s.entries)-1].ID
+		compactionEntry.ParentID = &lastID
+	} else {
+		compactionEntry.ParentID = nil
+	}
+	s.addEntry(compactionEntry)
+
+	// Fix message chain: if the first entry's parent is not loaded, link it
+	// to the compaction entry
+	if len(recentEntries) > 0 {
+		firstEntry := recentEntries[0]
+		if firstEntry.ParentID != nil {
+			if _, parentExists := s.byID[*firstEntry.ParentID]; !parentExists {
+				firstEntry.ParentID = &compactionEntry.ID
+			}
+		}
+	}
+
+	for _, entry := range recentEntries {
+		s.addEntry(entry)
+	}
+}
+
 // scanSessionInfoFromTail scans the tail of a JSONL file for the most recent
 // SessionInfo entries to extract the session name and title.
 // Lightweight: reads only the last 64KB, doesn't load all entries.
@@ -1,7 +1,6 @@
 package session
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
 )
 
 // SessionMeta contains metadata about a session.
@@ -24,51 +24,55 @@ type SessionMeta struct {
 	Workspace string `json:"workspace,omitempty"`
 	// CurrentWorkdir is the current working directory path
 	CurrentWorkdir string `json:"currentWorkdir,omitempty"`
+	// Tags are keywords for the session, generated with its title.
+	Tags []string `json:"tags,omitempty"`
 	// Role records the agent role used when the session was created.
 	// Empty means no explicit role (embedded default).
 	Role string `json:"role,omitempty"`
+	// Runs lists the IDs of the "ai run" processes that used this session,
+	// so "ai session pack" can include their events.
+	Runs []string `json:"runs,omitempty"`
 }
 
 // SessionManager manages multiple sessions.
 type SessionManager struct {
-	sessionsDir string
+	sessionsDir string // empty unless store is a DirStore
+	store       SessionStore
 	currentID   string
 }
 
-// NewSessionManager creates a new session manager.
+// NewSessionManager creates a new session manager for the sessions kept as
+// files in sessionsDir.
 func NewSessionManager(sessionsDir string) *SessionManager {
 	return &SessionManager{
 		sessionsDir: sessionsDir,
+		store:       NewFileStore(sessionsDir),
 	}
 }
 
-// ListSessions returns all sessions.
-func (sm *SessionManager) ListSessions() ([]SessionMeta, error) {
-	// Ensure directory exists
-	if err := os.MkdirAll(sm.sessionsDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+// NewSessionManagerWithStore creates a session manager for the sessions in
+// store.
+func NewSessionManagerWithStore(store SessionStore) *SessionManager {
+	sm := &SessionManager{store: store}
+	if ds, ok := store.(DirStore); ok {
+		sm.sessionsDir = ds.Dir()
 	}
+	return sm
+}
 
-	// Read directory entries
-	entries, err := os.ReadDir(sm.sessionsDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
+// Store returns the store the sessions are kept in.
+func (sm *SessionManager) Store() SessionStore {
+	if sm.store == nil {
+		return NewFileStore(sm.sessionsDir)
 	}
+	return sm.store
+}
 
-	var sessions []SessionMeta
-	for _, entry := range entries {
-		// Only consider directories (new session format)
-		if !entry.IsDir() {
-			continue
-		}
-
-		// Check if it's a valid session directory (has messages.jsonl or meta.json)
-		sessionDir := filepath.Join(sm.sessionsDir, entry.Name())
-		meta, err := sm.createMetaFromSessionDir(sessionDir)
-		if err != nil {
-			continue
-		}
-		sessions = append(sessions, *meta)
+// ListSessions returns all sessions.
+func (sm *SessionManager) ListSessions() ([]SessionMeta, error) {
+	sessions, err := sm.Store().List()
+	if err != nil {
+		return nil, err
 	}
 
 	// Sort sessions by UpdatedAt time (oldest first)
@@ -82,22 +86,14 @@ func (sm *SessionManager) ListSessions() ([]SessionMeta, error) {
 
 // CreateSession creates a new session with the given name and title.
 func (sm *SessionManager) CreateSession(name, title string) (*Session, error) {
-	// Ensure directory exists
-	if err := os.MkdirAll(sm.sessionsDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
-	}
-
 	// Generate unique ID
 	id := uuid.New().String()
-	sessDir := sm.getSessionPath(id)
-
-	// Create session directory
-	if err := os.MkdirAll(sessDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	if err := sm.makeSessionDir(id); err != nil {
+		return nil, err
 	}
 
 	// Create session
-	sess := NewSession(sessDir)
+	sess := newStoreSession(sm.Store(), id)
 
 	// Store session info inside the session file
 	if _, err := sess.AppendSessionInfo(name, title); err != nil {
@@ -127,20 +123,13 @@ func (sm *SessionManager) ForkSessionFrom(source *Session, leafID *string, name,
 	if source == nil {
 		return nil, fmt.Errorf("source session is nil")
 	}
-	if err := os.MkdirAll(sm.sessionsDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
-	}
-
 	id := uuid.New().String()
-	sessDir := sm.getSessionPath(id)
-
-	// Create session directory
-	if err := os.MkdirAll(sessDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	if err := sm.makeSessionDir(id); err != nil {
+		return nil, err
 	}
 
-	newSess := NewSession(sessDir)
-	newSess.header.ParentSession = source.GetPath()
+	newSess := newStoreSession(sm.Store(), id)
+	newSess.header.ParentSession = source.parentRef()
 
 	branchEntries := []SessionEntry{}
 	if leafID != nil {
@@ -169,6 +158,7 @@ func (sm *SessionManager) ForkSessionFrom(source *Session, leafID *string, name,
 	if err := newSess.rewriteFile(); err != nil {
 		return nil, err
 	}
+	newSess.indexEntries()
 
 	meta := &SessionMeta{
 		ID:           id,
@@ -185,14 +175,53 @@ func (sm *SessionManager) ForkSessionFrom(source *Session, leafID *string, name,
 	return newSess, nil
 }
 
+// ImportSession creates a new session holding messages as one branch, so it
+// can be resumed or forked like any other session.
+func (sm *SessionManager) ImportSession(name, title string, messages []agentctx.AgentMessage) (*Session, error) {
+	sess, err := sm.CreateSession(name, title)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		entry := &SessionEntry{
+			Type:      EntryTypeMessage,
+			ID:        generateEntryID(sess.byID),
+			ParentID:  sess.leafID,
+			Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+			Message:   &msg,
+		}
+		sess.addEntry(entry)
+	}
+	if err := sess.rewriteFile(); err != nil {
+		return nil, err
+	}
+	sess.indexEntries()
+
+	id := sess.GetID()
+	meta := &SessionMeta{
+		ID:           id,
+		Name:         name,
+		Title:        title,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		MessageCount: len(messages),
+	}
+	if err := sm.saveMeta(id, meta); err != nil {
+		return nil, fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return sess, nil
+}
+
 // GetSession retrieves a session by ID.
 func (sm *SessionManager) GetSession(id string) (*Session, error) {
 	id = normalizeSessionID(id)
 	if id == "" {
 		return nil, fmt.Errorf("session id is required")
 	}
-	sessPath := sm.getSessionPath(id)
-	return LoadSession(sessPath)
+	if ds, ok := sm.Store().(DirStore); ok {
+		return LoadSession(ds.SessionDir(id))
+	}
+	return OpenSession(sm.Store(), id)
 }
 
 // GetMeta retrieves session metadata by ID.
@@ -201,18 +230,7 @@ func (sm *SessionManager) GetMeta(id string) (*SessionMeta, error) {
 	if id == "" {
 		return nil, fmt.Errorf("session id is required")
 	}
-	metaPath := sm.getMetaPath(id)
-	meta, err := sm.loadMeta(metaPath)
-	if err == nil {
-		return meta, nil
-	}
-
-	// Fallback: build metadata directly from session directory
-	sessDir := sm.getSessionPath(id)
-	if _, statErr := os.Stat(sessDir); statErr == nil {
-		return sm.createMetaFromSessionDir(sessDir)
-	}
-	return nil, err
+	return sm.Store().GetMeta(id)
 }
 
 // DeleteSession deletes a session by ID.
@@ -227,38 +245,7 @@ func (sm *SessionManager) DeleteSession(id string) error {
 		return fmt.Errorf("cannot delete current session")
 	}
 
-	sessPath := sm.getSessionPath(id)
-	metaPath := sm.getMetaPath(id)
-
-	// Delete session directory (new format) or file (legacy fallback).
-	if info, err := os.Stat(sessPath); err == nil {
-		if info.IsDir() {
-			if err := os.RemoveAll(sessPath); err != nil {
-				return fmt.Errorf("failed to delete session directory: %w", err)
-			}
-		} else if err := os.Remove(sessPath); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to delete session file: %w", err)
-		}
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to stat session path: %w", err)
-	}
-
-	// Delete metadata (for legacy/session-file fallback cases).
-	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete metadata: %w", err)
-	}
-
-	legacySessionPath := filepath.Join(sm.sessionsDir, id+".jsonl")
-	if err := os.Remove(legacySessionPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete legacy session file: %w", err)
-	}
-
-	legacyMetaPath := filepath.Join(sm.sessionsDir, id+".meta.json")
-	if err := os.Remove(legacyMetaPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete legacy metadata file: %w", err)
-	}
-
-	return nil
+	return sm.Store().Delete(id)
 }
 
 // SetCurrent sets the current session ID.
@@ -346,6 +333,23 @@ func (sm *SessionManager) UpdateSessionName(id, name, title string) error {
 	return sm.saveMeta(id, meta)
 }
 
+// SetSessionTitle records a generated title and tags in a session's
+// metadata. The name is left alone.
+func (sm *SessionManager) SetSessionTitle(id, title string, tags []string) error {
+	id = normalizeSessionID(id)
+	if id == "" {
+		return fmt.Errorf("session id is required")
+	}
+	meta, err := sm.GetMeta(id)
+	if err != nil {
+		return err
+	}
+	meta.Title = strings.TrimSpace(title)
+	meta.Tags = tags
+	meta.UpdatedAt = time.Now()
+	return sm.saveMeta(id, meta)
+}
+
 // SetSessionWorkdir persists the current working directory in the session's
 // metadata so that resuming the session restores the workspace CWD.
 func (sm *SessionManager) SetSessionWorkdir(id, workdir string) error {
@@ -377,6 +381,25 @@ func (sm *SessionManager) SetSessionRole(id, role string) error {
 	return sm.saveMeta(id, meta)
 }
 
+// AddSessionRun records in a session's metadata that the run runID used it.
+func (sm *SessionManager) AddSessionRun(id, runID string) error {
+	id = normalizeSessionID(id)
+	if id == "" {
+		return fmt.Errorf("session id is required")
+	}
+	meta, err := sm.GetMeta(id)
+	if err != nil {
+		return err
+	}
+	for _, r := range meta.Runs {
+		if r == runID {
+			return nil
+		}
+	}
+	meta.Runs = append(meta.Runs, runID)
+	return sm.saveMeta(id, meta)
+}
+
 // getSessionPath returns the session directory path for a given ID.
 func (sm *SessionManager) getSessionPath(id string) string {
 	return filepath.Join(sm.sessionsDir, normalizeSessionID(id))
@@ -389,136 +412,22 @@ func (sm *SessionManager) getMetaPath(id string) string {
 
 // saveMeta saves session metadata.
 func (sm *SessionManager) saveMeta(id string, meta *SessionMeta) error {
-	metaPath := sm.getMetaPath(id)
-	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
-		return err
-	}
-	data, err := json.MarshalIndent(meta, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(metaPath, data, 0644)
+	return sm.Store().PutMeta(id, meta)
 }
 
-// loadMeta loads session metadata.
-func (sm *SessionManager) loadMeta(metaPath string) (*SessionMeta, error) {
-	data, err := os.ReadFile(metaPath)
-	if err != nil {
-		return nil, err
-	}
-
-	var meta SessionMeta
-	if err := json.Unmarshal(data, &meta); err != nil {
-		return nil, err
+// makeSessionDir creates the directory of a new session of a DirStore.
+func (sm *SessionManager) makeSessionDir(id string) error {
+	if _, ok := sm.Store().(DirStore); !ok {
+		return nil
 	}
-
-	return &meta, nil
-}
-
-// createMetaFromSessionDir creates metadata from an existing session directory.
-func (sm *SessionManager) createMetaFromSessionDir(sessDir string) (*SessionMeta, error) {
-	// Try to load metadata file first
-	id := filepath.Base(sessDir)
-	metaPath := filepath.Join(sessDir, "meta.json")
-	if data, err := os.ReadFile(metaPath); err == nil {
-		var meta SessionMeta
-		if err := json.Unmarshal(data, &meta); err == nil {
-			return &meta, nil
-		}
-	}
-
-	// Lightweight fallback: read header from JSONL file without loading all entries.
-	// The canonical metadata is in meta.json; this path only exists for edge cases
-	// where meta.json is missing (e.g. sessions from older versions).
-	jsonlPath := filepath.Join(sessDir, "messages.jsonl")
-	f, err := os.Open(jsonlPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			info, statErr := os.Stat(sessDir)
-			modTime := time.Now()
-			if statErr == nil {
-				modTime = info.ModTime()
-			}
-			return &SessionMeta{
-				ID: id, Name: id, Title: "Session",
-				CreatedAt: modTime, UpdatedAt: modTime,
-			}, nil
-		}
-		return nil, err
-	}
-	defer f.Close()
-
-	header, err := readHeaderFromFile(f)
-	if err != nil {
-		// Fallback to full load only if we can't even read the header
-		sess, loadErr := LoadSession(sessDir)
-		if loadErr != nil {
-			return nil, loadErr
-		}
-		return buildMetaFromSession(sess, id, sessDir)
-	}
-
-	info, statErr := os.Stat(sessDir)
-	modTime := time.Now()
-	if statErr == nil {
-		modTime = info.ModTime()
-	}
-	createdAt := modTime
-	if ts := strings.TrimSpace(header.Timestamp); ts != "" {
-		if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
-			createdAt = parsed
-		}
-	}
-
-	// Lightweight tail scan for session name/title (no full entry loading)
-	sessName, sessTitle := scanSessionInfoFromTail(f)
-	if sessName == "" {
-		sessName = id
-	}
-	if sessTitle == "" {
-		sessTitle = "Session"
-	}
-
-	return &SessionMeta{
-		ID:           id,
-		Name:         sessName,
-		Title:        sessTitle,
-		CreatedAt:    createdAt,
-		UpdatedAt:    modTime,
-		MessageCount: 0,
-	}, nil
-}
-
-// buildMetaFromSession builds SessionMeta from a fully loaded session.
-func buildMetaFromSession(sess *Session, id string, sessDir string) (*SessionMeta, error) {
-	info, err := os.Stat(sessDir)
-	if err != nil {
-		return nil, err
-	}
-	header := sess.GetHeader()
-	createdAt := info.ModTime()
-	if ts := strings.TrimSpace(header.Timestamp); ts != "" {
-		if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
-			createdAt = parsed
-		}
-	}
-	name := sess.GetSessionName()
-	if name == "" {
-		name = id
+	// Ensure directory exists
+	if err := os.MkdirAll(sm.sessionsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %w", err)
 	}
-	title := sess.GetSessionTitle()
-	if title == "" {
-		title = "Session"
+	if err := os.MkdirAll(sm.getSessionPath(id), 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
 	}
-	return &SessionMeta{
-		ID:           id,
-		Name:         name,
-		Title:        title,
-		CreatedAt:    createdAt,
-		UpdatedAt:    info.ModTime(),
-		MessageCount: len(sess.GetMessages()),
-	}, nil
+	return nil
 }
 
 // createDefaultSession creates a default session.
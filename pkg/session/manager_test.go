@@ -224,7 +224,7 @@ func TestSessionManagerCreateDefaultSession(t *testing.T) {
 }
 
 func TestCreateMetaFromSessionDir_NoMetaJson(t *testing.T) {
-	// Test that createMetaFromSessionDir can build metadata from the JSONL header
+	// Test that metaFromSessionDir can build metadata from the JSONL header
 	// when meta.json is missing.
 	tempDir, err := os.MkdirTemp("", "ai-session-test-*")
 	if err != nil {
@@ -232,8 +232,6 @@ func TestCreateMetaFromSessionDir_NoMetaJson(t *testing.T) {
 	}
 	defer os.RemoveAll(tempDir)
 
-	sm := NewSessionManager(tempDir)
-
 	// Create a proper session via the manager (this writes meta.json)
 	id := "test-session-dir"
 	sessDir := filepath.Join(tempDir, id)
@@ -247,9 +245,9 @@ func TestCreateMetaFromSessionDir_NoMetaJson(t *testing.T) {
 	// Now delete meta.json to test the fallback path
 	os.Remove(filepath.Join(sessDir, "meta.json"))
 
-	meta, err := sm.createMetaFromSessionDir(sessDir)
+	meta, err := metaFromSessionDir(sessDir)
 	if err != nil {
-		t.Fatalf("createMetaFromSessionDir failed: %v", err)
+		t.Fatalf("metaFromSessionDir failed: %v", err)
 	}
 
 	if meta.ID != id {
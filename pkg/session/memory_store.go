@@ -0,0 +1,222 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// MemoryStore keeps sessions in memory. It suits tests and embedders that
+// persist sessions elsewhere, or not at all. Everything is held JSON
+// encoded, so callers never share memory with the store.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*memorySession
+}
+
+type memorySession struct {
+	header    []byte // nil until the first write
+	entries   [][]byte
+	snapshots map[string][]byte
+	meta      []byte
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*memorySession)}
+}
+
+func (ms *MemoryStore) session(id string) *memorySession {
+	sess, ok := ms.sessions[id]
+	if !ok {
+		sess = &memorySession{snapshots: make(map[string][]byte)}
+		ms.sessions[id] = sess
+	}
+	return sess
+}
+
+func (ms *MemoryStore) ReadHeader(id string) (*SessionHeader, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sess, ok := ms.sessions[id]
+	if !ok || sess.header == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	var header SessionHeader
+	if err := json.Unmarshal(sess.header, &header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func (ms *MemoryStore) ReadEntries(id string) (*SessionHeader, []*SessionEntry, error) {
+	header, err := ms.ReadHeader(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sess := ms.sessions[id]
+	entries := make([]*SessionEntry, 0, len(sess.entries))
+	for _, data := range sess.entries {
+		var entry SessionEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	return header, entries, nil
+}
+
+// ReadBranch returns every entry: there is no file to save reading.
+func (ms *MemoryStore) ReadBranch(id string) (*SessionHeader, []*SessionEntry, error) {
+	return ms.ReadEntries(id)
+}
+
+func (ms *MemoryStore) AppendEntry(id string, entry *SessionEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sess, ok := ms.sessions[id]
+	if !ok || sess.header == nil {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	sess.entries = append(sess.entries, data)
+	return nil
+}
+
+func (ms *MemoryStore) WriteEntries(id string, header SessionHeader, entries []*SessionEntry) error {
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	encoded := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, data)
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sess := ms.session(id)
+	sess.header = headerData
+	sess.entries = encoded
+	return nil
+}
+
+func (ms *MemoryStore) DeleteEntries(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if sess, ok := ms.sessions[id]; ok {
+		sess.header = nil
+		sess.entries = nil
+	}
+	return nil
+}
+
+func (ms *MemoryStore) PutSnapshot(id, ref string, messages []agentctx.AgentMessage) error {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.session(id).snapshots[ref] = data
+	return nil
+}
+
+func (ms *MemoryStore) GetSnapshot(id, ref string) ([]agentctx.AgentMessage, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sess, ok := ms.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	data, ok := sess.snapshots[ref]
+	if !ok {
+		return nil, fmt.Errorf("snapshot %s of session %s not found", ref, id)
+	}
+	var messages []agentctx.AgentMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (ms *MemoryStore) PutMeta(id string, meta *SessionMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.session(id).meta = data
+	return nil
+}
+
+// GetMeta returns the stored metadata, or metadata built from the header of
+// a session that has none.
+func (ms *MemoryStore) GetMeta(id string) (*SessionMeta, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sess, ok := ms.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return sess.getMeta(id)
+}
+
+func (sess *memorySession) getMeta(id string) (*SessionMeta, error) {
+	if sess.meta != nil {
+		var meta SessionMeta
+		if err := json.Unmarshal(sess.meta, &meta); err != nil {
+			return nil, err
+		}
+		return &meta, nil
+	}
+	if sess.header == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	var header SessionHeader
+	if err := json.Unmarshal(sess.header, &header); err != nil {
+		return nil, err
+	}
+	createdAt := time.Now()
+	if parsed, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(header.Timestamp)); err == nil {
+		createdAt = parsed
+	}
+	return &SessionMeta{
+		ID: id, Name: id, Title: "Session",
+		CreatedAt: createdAt, UpdatedAt: createdAt,
+	}, nil
+}
+
+func (ms *MemoryStore) List() ([]SessionMeta, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var sessions []SessionMeta
+	for id, sess := range ms.sessions {
+		meta, err := sess.getMeta(id)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, *meta)
+	}
+	return sessions, nil
+}
+
+func (ms *MemoryStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.sessions, id)
+	return nil
+}
@@ -0,0 +1,260 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ownerLockName is the file in a session directory that the process writing
+// the session keeps flocked for as long as it has the session open. The
+// kernel drops the lock when that process exits, so a crashed owner never
+// leaves a stale lock behind.
+const ownerLockName = "session.lock"
+
+// ErrSessionTakenOver is returned by the first write after another process
+// took the session over with a forced Lock. The session is read-only from
+// then on: entries stay in memory but no longer reach the file.
+var ErrSessionTakenOver = errors.New("session was taken over by another process; continuing read-only")
+
+// SessionOwner identifies the process that holds a session open for writing.
+type SessionOwner struct {
+	PID   int       `json:"pid"`
+	RunID string    `json:"runId,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// NewSessionOwner describes the current process as an owner.
+func NewSessionOwner(runID string) SessionOwner {
+	return SessionOwner{PID: os.Getpid(), RunID: runID, Since: time.Now().UTC()}
+}
+
+func (o SessionOwner) String() string {
+	s := fmt.Sprintf("pid %d", o.PID)
+	if o.RunID != "" {
+		s += ", run " + o.RunID
+	}
+	if !o.Since.IsZero() {
+		s += ", since " + o.Since.Local().Format("2006-01-02 15:04:05")
+	}
+	return s
+}
+
+// SessionLockedError is returned by Lock when another process holds the
+// session.
+type SessionLockedError struct {
+	Dir   string
+	Owner SessionOwner
+}
+
+func (e *SessionLockedError) Error() string {
+	return fmt.Sprintf("session %s is in use by another process (%s)", filepath.Base(e.Dir), e.Owner)
+}
+
+type ownerLock struct {
+	file *os.File
+	path string
+}
+
+// Lock makes this process the owner of the session until Unlock or exit.
+// If another process owns it, Lock returns a *SessionLockedError, unless
+// takeover is set: then the lock file is replaced, and the previous owner
+// turns read-only at its next write.
+func (s *Session) Lock(owner SessionOwner, takeover bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.persist || s.sessionDir == "" || s.owner != nil {
+		return nil
+	}
+	if err := os.MkdirAll(s.sessionDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.sessionDir, ownerLockName)
+	f, err := lockOwnerFile(path, takeover)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(owner)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.WriteAt(append(data, '\n'), 0); err != nil {
+		f.Close()
+		return err
+	}
+	s.owner = &ownerLock{file: f, path: path}
+	s.readOnly = false
+	return nil
+}
+
+func lockOwnerFile(path string, takeover bool) (*os.File, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if !errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, err
+			}
+			if !takeover {
+				owner, _ := readOwnerFile(path)
+				return nil, &SessionLockedError{Dir: filepath.Dir(path), Owner: owner}
+			}
+			// The owner keeps its lock on the unlinked file; a new file
+			// at the same path is free to lock.
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			takeover = false
+			continue
+		}
+		// A takeover may have replaced the file between open and flock.
+		if sameFile(f, path) {
+			return f, nil
+		}
+		f.Close()
+	}
+	return nil, fmt.Errorf("lock %s: replaced while locking", path)
+}
+
+// Unlock gives up ownership of the session. The lock file is left in place,
+// emptied, so that a process waiting on it is not left holding an unlinked
+// file.
+func (s *Session) Unlock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseOwnerLocked()
+}
+
+func (s *Session) releaseOwnerLocked() {
+	if s.owner == nil {
+		return
+	}
+	if sameFile(s.owner.file, s.owner.path) {
+		_ = s.owner.file.Truncate(0)
+	}
+	_ = syscall.Flock(int(s.owner.file.Fd()), syscall.LOCK_UN)
+	_ = s.owner.file.Close()
+	s.owner = nil
+}
+
+// SetReadOnly keeps the session in memory only: appended entries are not
+// written to its file. Use it to open a session another process owns.
+func (s *Session) SetReadOnly() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readOnly = true
+}
+
+// IsReadOnly reports whether writes to the session are skipped, either
+// because it was opened read-only or because it was taken over.
+func (s *Session) IsReadOnly() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readOnly
+}
+
+// writableLocked reports whether entries should reach the session file.
+// Once another process has taken the session over it turns the session
+// read-only and returns ErrSessionTakenOver.
+func (s *Session) writableLocked() (bool, error) {
+	if s.readOnly {
+		return false, nil
+	}
+	if s.owner != nil && !sameFile(s.owner.file, s.owner.path) {
+		s.readOnly = true
+		s.releaseOwnerLocked()
+		return false, ErrSessionTakenOver
+	}
+	return true, nil
+}
+
+// ReadSessionOwner returns the owner of the session in dir, or nil if no
+// live process holds it.
+func ReadSessionOwner(dir string) (*SessionOwner, error) {
+	path := filepath.Join(dir, ownerLockName)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == nil {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return nil, nil
+	} else if !errors.Is(err, syscall.EWOULDBLOCK) {
+		return nil, err
+	}
+	owner, err := readOwnerFile(path)
+	return &owner, err
+}
+
+func readOwnerFile(path string) (SessionOwner, error) {
+	var owner SessionOwner
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return owner, err
+	}
+	if len(data) == 0 {
+		// The owner has locked the file but not written to it yet.
+		return owner, nil
+	}
+	return owner, json.Unmarshal(data, &owner)
+}
+
+// HeldSession is a session that a live process owns.
+type HeldSession struct {
+	ID    string
+	Dir   string
+	Title string // empty unless the session has a title of its own
+	Owner SessionOwner
+}
+
+// ListHeldSessions returns the owned sessions of every project under
+// sessionsRoot (~/.ai/sessions).
+func ListHeldSessions(sessionsRoot string) ([]HeldSession, error) {
+	locks, err := filepath.Glob(filepath.Join(sessionsRoot, "*", "*", ownerLockName))
+	if err != nil {
+		return nil, err
+	}
+	var held []HeldSession
+	for _, lock := range locks {
+		dir := filepath.Dir(lock)
+		owner, err := ReadSessionOwner(dir)
+		if err != nil || owner == nil {
+			continue
+		}
+		h := HeldSession{ID: filepath.Base(dir), Dir: dir, Owner: *owner}
+		if meta, err := metaFromSessionDir(dir); err == nil && meta.IsTitled() {
+			h.Title = meta.Title
+		}
+		held = append(held, h)
+	}
+	return held, nil
+}
+
+func sameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
@@ -0,0 +1,138 @@
+package session
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func TestSessionLock(t *testing.T) {
+	root := t.TempDir()
+	sm := NewSessionManager(filepath.Join(root, "--proj--"))
+	first, err := sm.CreateSession("main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Lock(NewSessionOwner("run1"), false); err != nil {
+		t.Fatal(err)
+	}
+	owner, err := ReadSessionOwner(first.GetDir())
+	if err != nil || owner == nil || owner.RunID != "run1" {
+		t.Fatalf("owner = %+v, %v", owner, err)
+	}
+	if held, err := ListHeldSessions(root); err != nil || len(held) != 1 || held[0].ID != first.GetID() {
+		t.Errorf("held = %+v, %v", held, err)
+	}
+
+	// A second opener is refused, or can read without writing.
+	second, err := LoadSession(first.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locked *SessionLockedError
+	if err := second.Lock(NewSessionOwner("run2"), false); !errors.As(err, &locked) || locked.Owner.RunID != "run1" {
+		t.Fatalf("second Lock: %v", err)
+	}
+	second.SetReadOnly()
+	if _, err := second.AppendMessage(agentctx.NewUserMessage("not saved")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.AppendMessage(agentctx.NewUserMessage("saved")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A forced takeover turns the first owner read-only at its next write.
+	if err := second.Lock(NewSessionOwner("run2"), true); err != nil {
+		t.Fatal(err)
+	}
+	if second.IsReadOnly() {
+		t.Error("owner after takeover is read-only")
+	}
+	if _, err := first.AppendMessage(agentctx.NewUserMessage("lost")); !errors.Is(err, ErrSessionTakenOver) {
+		t.Errorf("write after takeover: %v", err)
+	}
+	if _, err := first.AppendMessage(agentctx.NewUserMessage("lost too")); err != nil || !first.IsReadOnly() {
+		t.Errorf("write when read-only: %v", err)
+	}
+	if owner, _ := ReadSessionOwner(first.GetDir()); owner == nil || owner.RunID != "run2" {
+		t.Errorf("owner after takeover = %+v", owner)
+	}
+
+	second.Unlock()
+	if owner, err := ReadSessionOwner(first.GetDir()); owner != nil || err != nil {
+		t.Errorf("owner after unlock = %+v, %v", owner, err)
+	}
+	loaded, err := LoadSession(first.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages := loaded.GetMessages(); len(messages) != 1 || messages[0].ExtractText() != "saved" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
+
+func TestCollectGarbage_SkipsHeldSessions(t *testing.T) {
+	aiDir := t.TempDir()
+	sm := NewSessionManager(filepath.Join(aiDir, "sessions", "--proj--"))
+	sess, err := sm.CreateSession("20260101-000000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Lock(NewSessionOwner(""), false); err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Unlock()
+
+	report, err := CollectGarbage(aiDir, GCPolicy{}, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != 0 {
+		t.Errorf("removed %+v", report.Removed)
+	}
+}
+
+func TestAppendCompaction_NotWritable(t *testing.T) {
+	sm := NewSessionManager(filepath.Join(t.TempDir(), "--proj--"))
+	first, err := sm.CreateSession("main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Lock(NewSessionOwner("run1"), false); err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadSession(first.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.SetReadOnly()
+	snapshots := func() []string {
+		names, _ := filepath.Glob(filepath.Join(first.GetDir(), "compactions", "compaction_*.jsonl"))
+		return names
+	}
+
+	if id, err := second.AppendCompaction("read-only", nil); id != "" || err != nil {
+		t.Errorf("read-only AppendCompaction = %q, %v", id, err)
+	}
+	if got := snapshots(); len(got) != 0 {
+		t.Errorf("read-only session wrote snapshots %v", got)
+	}
+
+	if err := second.Lock(NewSessionOwner("run2"), true); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Unlock()
+	before := len(first.GetEntries())
+	if id, err := first.AppendCompaction("taken over", nil); id != "" || !errors.Is(err, ErrSessionTakenOver) {
+		t.Errorf("AppendCompaction after takeover = %q, %v", id, err)
+	}
+	if got := snapshots(); len(got) != 0 {
+		t.Errorf("taken-over session wrote snapshots %v", got)
+	}
+	if entries := first.GetEntries(); len(entries) != before {
+		t.Errorf("taken-over session recorded %d entries", len(entries)-before)
+	}
+}
@@ -0,0 +1,89 @@
+package session
+
+import (
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func TestSessionPins_SurviveReload(t *testing.T) {
+	dir := t.TempDir()
+	sess := NewSession(dir)
+
+	first := agentctx.NewUserMessage("task")
+	first.Timestamp = 1000
+	second := agentctx.NewUserMessage("detail")
+	second.Timestamp = 2000
+	id1, err := sess.AppendMessage(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := sess.AppendMessage(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := agentctx.PriorityPinned
+	first.EntryID, second.EntryID = id1, id2
+	if _, err := sess.AppendPin(first, &p); err != nil {
+		t.Fatalf("AppendPin: %v", err)
+	}
+	if _, err := sess.AppendPin(second, &p); err != nil {
+		t.Fatal(err)
+	}
+	// Unpin the second message again.
+	if _, err := sess.AppendPin(second, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadSession(dir)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	msgs := reloaded.GetMessages()
+	if len(msgs) != 2 {
+		t.Fatalf("pin entries leaked into messages: got %d messages", len(msgs))
+	}
+	if !msgs[0].IsPinned() || msgs[1].IsPinned() {
+		t.Fatalf("pinned = %v, %v; want true, false", msgs[0].IsPinned(), msgs[1].IsPinned())
+	}
+}
+
+func TestSessionPins_MatchByTimestampAfterCompaction(t *testing.T) {
+	dir := t.TempDir()
+	sess := NewSession(dir)
+
+	kept := agentctx.NewUserMessage("kept after compaction")
+	kept.Timestamp = 3000
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("old")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.AppendCompaction("summary", []agentctx.AgentMessage{kept}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A lazily loaded snapshot message may carry an entry ID that is not
+	// persisted; the role and timestamp still identify it.
+	kept.EntryID = "not-persisted"
+	p := agentctx.PriorityPinned
+	if _, err := sess.AppendPin(kept, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := reloaded.GetMessages()
+	if len(msgs) != 1 || !msgs[0].IsPinned() {
+		t.Fatalf("expected the snapshot message to be pinned, got %+v", msgs)
+	}
+}
+
+func TestAppendPin_RequiresTarget(t *testing.T) {
+	sess := NewSession(t.TempDir())
+	msg := agentctx.AgentMessage{Role: "user"}
+	if _, err := sess.AppendPin(msg, nil); err == nil {
+		t.Fatal("expected error for a message without entry id or timestamp")
+	}
+}
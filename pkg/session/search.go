@@ -0,0 +1,253 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session/search"
+)
+
+// indexEntryLocked adds a persisted entry to the search index of the
+// sessions directory. Until the first search builds the index there is
+// nothing to keep up to date. Must hold s.mu.
+func (s *Session) indexEntryLocked(entry *SessionEntry) {
+	if !s.persist || s.sessionDir == "" {
+		return
+	}
+	ix := search.Open(filepath.Dir(s.sessionDir))
+	if !ix.Exists() {
+		return
+	}
+	doc, text, ok := searchDoc(sessionIDFromDirPath(s.sessionDir), s.header.Cwd, entry, s.byID)
+	if !ok {
+		return
+	}
+	if err := ix.Add(doc, text); err != nil {
+		slog.Warn("[session] Failed to index entry for search", "entryId", entry.ID, "error", err)
+	}
+}
+
+// indexEntries adds all entries to the search index, for sessions written
+// whole by import and fork.
+func (s *Session) indexEntries() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		s.indexEntryLocked(entry)
+	}
+}
+
+// searchDoc returns the index document and text of a message or
+// compaction entry. Hidden messages are not indexed.
+func searchDoc(sessionID, cwd string, entry *SessionEntry, byID map[string]*SessionEntry) (search.Doc, string, bool) {
+	text, role, tools, ok := entryText(entry)
+	if !ok {
+		return search.Doc{}, "", false
+	}
+	doc := search.Doc{
+		SessionID: sessionID,
+		EntryID:   entry.ID,
+		TurnID:    turnID(entry, byID),
+		Cwd:       cwd,
+		Role:      role,
+		Tools:     tools,
+	}
+	if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+		doc.Time = t.UnixMilli()
+	}
+	return doc, text, true
+}
+
+// entryText returns the searchable text of an entry with its search role
+// and tools.
+func entryText(entry *SessionEntry) (text, role string, tools []string, ok bool) {
+	switch {
+	case entry.Type == EntryTypeCompaction:
+		return entry.Summary, "compaction", nil, true
+	case entry.Type != EntryTypeMessage || entry.Message == nil || !entry.Message.IsUserVisible():
+		return "", "", nil, false
+	}
+
+	msg := entry.Message
+	var b strings.Builder
+	for _, block := range msg.Content {
+		switch c := block.(type) {
+		case agentctx.TextContent:
+			b.WriteString(c.Text)
+		case agentctx.ThinkingContent:
+			b.WriteString(c.Thinking)
+		case agentctx.ToolCallContent:
+			tools = append(tools, c.Name)
+			b.WriteString(c.Name)
+			if args, err := json.Marshal(c.Arguments); err == nil {
+				b.WriteByte(' ')
+				b.Write(args)
+			}
+		default:
+			continue
+		}
+		b.WriteByte('\n')
+	}
+	switch msg.Role {
+	case "toolResult":
+		role = "tool"
+		if msg.ToolName != "" {
+			tools = append(tools, msg.ToolName)
+		}
+	default:
+		role = msg.Role
+	}
+	return b.String(), role, tools, true
+}
+
+// turnID returns the user message that started the turn of entry.
+func turnID(entry *SessionEntry, byID map[string]*SessionEntry) string {
+	for e := entry; e != nil; {
+		if e.Type == EntryTypeMessage && e.Message != nil && e.Message.Role == "user" && e.Message.IsUserVisible() {
+			return e.ID
+		}
+		if e.ParentID == nil {
+			break
+		}
+		e = byID[*e.ParentID]
+	}
+	return ""
+}
+
+// RebuildSearchIndex indexes every session of sessionsDir from scratch.
+func RebuildSearchIndex(sessionsDir string) error {
+	return search.Open(sessionsDir).Rebuild(func(add func(search.Doc, string)) error {
+		dirs, err := os.ReadDir(sessionsDir)
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			if !d.IsDir() {
+				continue
+			}
+			sess, err := loadSessionFull(filepath.Join(sessionsDir, d.Name()))
+			if err != nil {
+				slog.Warn("[session] Skipping unreadable session in search index", "session", d.Name(), "error", err)
+				continue
+			}
+			for _, entry := range sess.entries {
+				if doc, text, ok := searchDoc(d.Name(), sess.header.Cwd, entry, sess.byID); ok {
+					add(doc, text)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// SearchSessions searches the sessions of each sessions directory, building
+// an index on first use, and returns the best hits across them with session
+// names and snippets filled in.
+func SearchSessions(q search.Query, sessionsDirs ...string) ([]SearchHit, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	var hits []SearchHit
+	for _, dir := range sessionsDirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		ix := search.Open(dir)
+		found, err := ix.Search(q)
+		if search.NeedsRebuild(err) {
+			if err := RebuildSearchIndex(dir); err != nil {
+				return nil, fmt.Errorf("build search index: %w", err)
+			}
+			found, err = ix.Search(q)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range found {
+			hits = append(hits, SearchHit{Hit: h, Dir: filepath.Join(dir, h.SessionID)})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Time.After(hits[j].Time)
+	})
+	limit := q.Limit
+	if limit <= 0 {
+		limit = search.DefaultLimit
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	fillSearchHits(hits, q.Terms())
+	return hits, nil
+}
+
+// SearchHit is a search hit with the directory of its session.
+type SearchHit struct {
+	search.Hit
+	Dir string `json:"dir"`
+}
+
+// fillSearchHits reads the snippets and session names of hits from the
+// session files; the index stores neither.
+func fillSearchHits(hits []SearchHit, terms []string) {
+	bySession := map[string][]*SearchHit{}
+	for i := range hits {
+		bySession[hits[i].Dir] = append(bySession[hits[i].Dir], &hits[i])
+	}
+	for dir, group := range bySession {
+		name := ""
+		if meta, err := NewSessionManager(filepath.Dir(dir)).GetMeta(filepath.Base(dir)); err == nil && meta.Name != meta.ID {
+			name = meta.Name
+		}
+		want := map[string]*SearchHit{}
+		for _, h := range group {
+			h.SessionName = name
+			want[h.EntryID] = h
+		}
+		scanEntries(filepath.Join(dir, "messages.jsonl"), want, func(h *SearchHit, entry *SessionEntry) {
+			if text, _, _, ok := entryText(entry); ok {
+				h.Snippet = search.Snippet(text, terms)
+			}
+		})
+	}
+}
+
+// scanEntries calls fn for each entry of the file whose ID is in want.
+func scanEntries(path string, want map[string]*SearchHit, fn func(*SearchHit, *SessionEntry)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() && len(want) > 0 {
+		line := scanner.Bytes()
+		for id, h := range want {
+			// Cheap check before decoding: the entry ID appears in its line.
+			if !bytes.Contains(line, []byte(`"id":"`+id+`"`)) {
+				continue
+			}
+			var entry SessionEntry
+			if err := json.Unmarshal(line, &entry); err != nil || entry.ID != id {
+				continue
+			}
+			fn(h, &entry)
+			delete(want, id)
+			break
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Package search is a full-text index over the sessions of one sessions
+// directory.
+//
+// The index is an inverted index (term → entries) in two files next to the
+// session directories:
+//
+//	.search-index.gob   merged index: documents and postings
+//	.search-index.log   JSON lines appended as sessions grow
+//
+// Appending a message only writes one log line. The next search merges the
+// log into the gob file, dropping the documents of deleted sessions. Both
+// files are changed under a flock on .search-index.lock, so several agents
+// can share a sessions directory.
+package search
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// indexVersion is bumped when the gob layout changes; an index of another
+// version is rebuilt.
+const indexVersion = 1
+
+// errStale is a merged index that cannot be read and must be rebuilt.
+var errStale = errors.New("stale search index")
+
+const (
+	segmentFile = ".search-index.gob"
+	logFile     = ".search-index.log"
+	lockFile    = ".search-index.lock"
+)
+
+// Doc is one indexed session entry.
+type Doc struct {
+	SessionID string `json:"session"`
+	EntryID   string `json:"entry"`
+	// TurnID is the user message that started the entry's turn: where
+	// /fork continues from.
+	TurnID string `json:"turn,omitempty"`
+	Cwd    string `json:"cwd,omitempty"`
+	// Time is Unix milliseconds.
+	Time int64 `json:"time"`
+	// Role is "user", "assistant", "tool" or "compaction".
+	Role string `json:"role"`
+	// Tools are the tools an assistant entry calls or a tool entry reports.
+	Tools []string `json:"tools,omitempty"`
+}
+
+func (d Doc) key() string { return d.SessionID + "/" + d.EntryID }
+
+// Posting is one document containing a term.
+type Posting struct {
+	Doc   int32
+	Count int32
+}
+
+// segment is the merged index.
+type segment struct {
+	Version  int
+	Docs     []Doc
+	Postings map[string][]Posting
+}
+
+// logRecord is one line of the log.
+type logRecord struct {
+	Doc   Doc            `json:"doc"`
+	Terms map[string]int `json:"terms"`
+}
+
+// Index is the search index of one sessions directory.
+type Index struct {
+	dir string
+}
+
+// Open returns the index of sessionsDir. Nothing is read until it is used.
+func Open(sessionsDir string) *Index {
+	return &Index{dir: sessionsDir}
+}
+
+// Exists reports whether the index has been built.
+func (ix *Index) Exists() bool {
+	_, err := os.Stat(filepath.Join(ix.dir, segmentFile))
+	return err == nil
+}
+
+// Add appends a document with the terms of text to the log.
+func (ix *Index) Add(doc Doc, text string) error {
+	line, err := json.Marshal(logRecord{Doc: doc, Terms: Terms(text)})
+	if err != nil {
+		return err
+	}
+	return ix.withLock(func() error {
+		f, err := os.OpenFile(filepath.Join(ix.dir, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// Rebuild replaces the index with the documents walk adds.
+func (ix *Index) Rebuild(walk func(add func(doc Doc, text string)) error) error {
+	seg := &segment{Version: indexVersion, Postings: map[string][]Posting{}}
+	seen := map[string]bool{}
+	err := walk(func(doc Doc, text string) {
+		if !seen[doc.key()] {
+			seen[doc.key()] = true
+			seg.add(doc, Terms(text))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ix.withLock(func() error {
+		// Entries appended after walk read their session are only in the
+		// log. Merging it keeps them; mergeLog skips the ones seg has.
+		if _, err := ix.mergeLog(seg); err != nil {
+			return err
+		}
+		if err := ix.writeSegment(seg); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(ix.dir, logFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
+
+// load merges the log into the segment, writes it back when it changed,
+// and returns it.
+func (ix *Index) load() (*segment, error) {
+	var seg *segment
+	err := ix.withLock(func() error {
+		var err error
+		seg, err = ix.readSegment()
+		if err != nil {
+			return err
+		}
+		merged, err := ix.mergeLog(seg)
+		if err != nil {
+			return err
+		}
+		pruned := seg.prune(func(sessionID string) bool {
+			_, err := os.Stat(filepath.Join(ix.dir, sessionID))
+			return err == nil
+		})
+		if !merged && !pruned {
+			return nil
+		}
+		if err := ix.writeSegment(seg); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(ix.dir, logFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+	return seg, err
+}
+
+func (ix *Index) readSegment() (*segment, error) {
+	f, err := os.Open(filepath.Join(ix.dir, segmentFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var seg segment
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&seg); err != nil {
+		return nil, fmt.Errorf("%w: %v", errStale, err)
+	}
+	if seg.Version != indexVersion {
+		return nil, fmt.Errorf("%w: version %d, want %d", errStale, seg.Version, indexVersion)
+	}
+	if seg.Postings == nil {
+		seg.Postings = map[string][]Posting{}
+	}
+	return &seg, nil
+}
+
+func (ix *Index) writeSegment(seg *segment) error {
+	path := filepath.Join(ix.dir, segmentFile)
+	tmp := fmt.Sprintf("%s.tmp-%d", path, os.Getpid())
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := gob.NewEncoder(w).Encode(seg); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// mergeLog adds the log records that seg does not have yet.
+func (ix *Index) mergeLog(seg *segment) (bool, error) {
+	f, err := os.Open(filepath.Join(ix.dir, logFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool, len(seg.Docs))
+	for _, doc := range seg.Docs {
+		seen[doc.key()] = true
+	}
+	merged := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec logRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn last line from a crashed writer.
+			continue
+		}
+		if seen[rec.Doc.key()] {
+			continue
+		}
+		seen[rec.Doc.key()] = true
+		seg.add(rec.Doc, rec.Terms)
+		merged = true
+	}
+	return merged, scanner.Err()
+}
+
+func (seg *segment) add(doc Doc, terms map[string]int) {
+	id := int32(len(seg.Docs))
+	seg.Docs = append(seg.Docs, doc)
+	for term, count := range terms {
+		seg.Postings[term] = append(seg.Postings[term], Posting{Doc: id, Count: int32(count)})
+	}
+}
+
+// prune drops the documents of sessions that no longer exist and reports
+// whether there were any.
+func (seg *segment) prune(exists func(sessionID string) bool) bool {
+	alive := map[string]bool{}
+	remap := make([]int32, len(seg.Docs))
+	var docs []Doc
+	for i, doc := range seg.Docs {
+		ok, checked := alive[doc.SessionID]
+		if !checked {
+			ok = exists(doc.SessionID)
+			alive[doc.SessionID] = ok
+		}
+		remap[i] = -1
+		if ok {
+			remap[i] = int32(len(docs))
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) == len(seg.Docs) {
+		return false
+	}
+
+	for term, postings := range seg.Postings {
+		kept := postings[:0]
+		for _, p := range postings {
+			if id := remap[p.Doc]; id >= 0 {
+				kept = append(kept, Posting{Doc: id, Count: p.Count})
+			}
+		}
+		if len(kept) == 0 {
+			delete(seg.Postings, term)
+		} else {
+			seg.Postings[term] = kept
+		}
+	}
+	seg.Docs = docs
+	return true
+}
+
+// terms returns the index terms matching a query term: itself, or every
+// term with its prefix when it ends in '*'.
+func (seg *segment) terms(q string) []string {
+	prefix, ok := trimStar(q)
+	if !ok {
+		return []string{q}
+	}
+	var out []string
+	for term := range seg.Postings {
+		if len(term) >= len(prefix) && term[:len(prefix)] == prefix {
+			out = append(out, term)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func trimStar(q string) (string, bool) {
+	if len(q) > 1 && q[len(q)-1] == '*' {
+		return q[:len(q)-1], true
+	}
+	return q, false
+}
+
+func (ix *Index) withLock(run func() error) error {
+	if err := os.MkdirAll(ix.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(ix.dir, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}()
+	return run()
+}
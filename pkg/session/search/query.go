@@ -0,0 +1,268 @@
+package search
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLimit is the number of hits a query returns when it sets no limit.
+const DefaultLimit = 20
+
+// Query is a search: all terms of Text must match, and the filters narrow
+// the entries they may match in.
+type Query struct {
+	// Text is the search terms. A term ending in '*' matches as a prefix.
+	Text string
+	// Cwd keeps sessions whose working directory is Cwd or below it.
+	Cwd string
+	// Since and Until bound the entry time; zero means unbounded.
+	Since time.Time
+	Until time.Time
+	// Role is "user", "assistant", "tool" or "compaction".
+	Role string
+	// Tool keeps entries that call or report this tool.
+	Tool  string
+	Limit int
+}
+
+// Hit is one matching entry.
+type Hit struct {
+	SessionID   string `json:"sessionId"`
+	SessionName string `json:"sessionName,omitempty"`
+	EntryID     string `json:"entryId"`
+	// ForkEntryID is the user message of the hit's turn; /fork takes it as
+	// "<sessionId>:<forkEntryId>".
+	ForkEntryID string    `json:"forkEntryId,omitempty"`
+	Cwd         string    `json:"cwd,omitempty"`
+	Time        time.Time `json:"time"`
+	Role        string    `json:"role"`
+	Tools       []string  `json:"tools,omitempty"`
+	Snippet     string    `json:"snippet,omitempty"`
+	Score       float64   `json:"score"`
+}
+
+// queryTerms splits the query text like Terms, keeping a trailing '*'.
+func queryTerms(text string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, field := range strings.Fields(text) {
+		prefix := strings.HasSuffix(field, "*")
+		var words []string
+		forEachTerm(field, func(term string) { words = append(words, term) })
+		for i, w := range words {
+			if prefix && i == len(words)-1 {
+				w += "*"
+			}
+			if !seen[w] {
+				seen[w] = true
+				out = append(out, w)
+			}
+		}
+	}
+	return out
+}
+
+// Terms returns the terms the query matches on, for highlighting snippets.
+func (q Query) Terms() []string {
+	return queryTerms(q.Text)
+}
+
+// Search returns the best hits of q, highest score first. Entries score
+// by term frequency weighted by how rare the term is; ties go to the newer
+// entry. Snippets and session names are left to the caller, since the
+// index stores no text.
+func (ix *Index) Search(q Query) ([]Hit, error) {
+	terms := queryTerms(q.Text)
+	if len(terms) == 0 {
+		return nil, errors.New("empty search query")
+	}
+	seg, err := ix.load()
+	if err != nil {
+		return nil, err
+	}
+
+	n := float64(len(seg.Docs))
+	var scores map[int32]float64
+	for _, term := range terms {
+		matched := map[int32]float64{}
+		for _, t := range seg.terms(term) {
+			postings := seg.Postings[t]
+			idf := math.Log(1 + n/float64(len(postings)))
+			for _, p := range postings {
+				matched[p.Doc] += float64(p.Count) * idf
+			}
+		}
+		if scores == nil {
+			scores = matched
+			continue
+		}
+		for doc, score := range scores {
+			if m, ok := matched[doc]; ok {
+				scores[doc] = score + m
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+
+	var hits []Hit
+	for id, score := range scores {
+		doc := seg.Docs[id]
+		if !q.matches(doc) {
+			continue
+		}
+		hits = append(hits, Hit{
+			SessionID:   doc.SessionID,
+			EntryID:     doc.EntryID,
+			ForkEntryID: doc.TurnID,
+			Cwd:         doc.Cwd,
+			Time:        time.UnixMilli(doc.Time),
+			Role:        doc.Role,
+			Tools:       doc.Tools,
+			Score:       score,
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Time.After(hits[j].Time)
+	})
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func (q Query) matches(doc Doc) bool {
+	if q.Role != "" && doc.Role != q.Role {
+		return false
+	}
+	if q.Cwd != "" {
+		cwd := filepath.Clean(q.Cwd)
+		if doc.Cwd != cwd && !strings.HasPrefix(doc.Cwd, strings.TrimSuffix(cwd, "/")+"/") {
+			return false
+		}
+	}
+	t := time.UnixMilli(doc.Time)
+	if !q.Since.IsZero() && t.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !t.Before(q.Until) {
+		return false
+	}
+	if q.Tool != "" {
+		for _, tool := range doc.Tools {
+			if tool == q.Tool {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ParseTime parses a filter time: a date (2006-01-02, local midnight),
+// an RFC 3339 time, or an age such as 7d, 12h or 30m before now.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want YYYY-MM-DD, RFC 3339 or an age like 7d)", s)
+}
+
+// ParseQuery parses search arguments: terms mixed with --role, --tool,
+// --cwd, --since, --until and --limit flags.
+func ParseQuery(args []string, now time.Time) (Query, error) {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var q Query
+	var since, until string
+	fs.StringVar(&q.Role, "role", "", "")
+	fs.StringVar(&q.Tool, "tool", "", "")
+	fs.StringVar(&q.Cwd, "cwd", "", "")
+	fs.StringVar(&since, "since", "", "")
+	fs.StringVar(&until, "until", "", "")
+	fs.IntVar(&q.Limit, "limit", 0, "")
+
+	// flag stops at the first term; collect terms and continue after it.
+	var terms []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return q, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		terms = append(terms, args[0])
+		args = args[1:]
+	}
+	q.Text = strings.Join(terms, " ")
+
+	if err := q.setTimes(since, until, now); err != nil {
+		return q, err
+	}
+	if err := q.Validate(); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func (q *Query) setTimes(since, until string, now time.Time) error {
+	var err error
+	if since != "" {
+		if q.Since, err = ParseTime(since, now); err != nil {
+			return err
+		}
+	}
+	if until != "" {
+		if q.Until, err = ParseTime(until, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the role filter and that there is something to search.
+func (q Query) Validate() error {
+	switch q.Role {
+	case "", "user", "assistant", "tool", "compaction":
+	default:
+		return fmt.Errorf("invalid role %q (want user, assistant, tool or compaction)", q.Role)
+	}
+	if len(queryTerms(q.Text)) == 0 {
+		return errors.New("empty search query")
+	}
+	return nil
+}
+
+// NeedsRebuild reports whether err means the index is missing or
+// unreadable and Rebuild would fix it.
+func NeedsRebuild(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, errStale)
+}
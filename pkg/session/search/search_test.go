@@ -0,0 +1,198 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerms(t *testing.T) {
+	got := Terms("Fix the flaky TestParse_Args test; the test_id is 42. 修复缓存 a")
+	want := map[string]int{
+		"fix": 1, "the": 2, "flaky": 1, "testparse_args": 1, "test": 1, "test_id": 1, "is": 1, "42": 1,
+		"修": 1, "复": 1, "缓": 1, "存": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms = %v\nwant %v", got, want)
+	}
+	if terms := Terms(strings.Repeat("x", maxTermLen+1)); len(terms) != 0 {
+		t.Errorf("long token indexed: %v", terms)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 20) + "the Deadlock\nin   scheduler " + strings.Repeat("dolor sit ", 30)
+	got := Snippet(text, []string{"deadlock"})
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "the Deadlock in scheduler") {
+		t.Errorf("Snippet = %q", got)
+	}
+	if got := Snippet("short text", []string{"missing"}); got != "short text" {
+		t.Errorf("Snippet without match = %q", got)
+	}
+}
+
+type indexed struct {
+	doc  Doc
+	text string
+}
+
+func newIndex(t *testing.T, docs ...indexed) *Index {
+	t.Helper()
+	dir := t.TempDir()
+	ix := Open(dir)
+	err := ix.Rebuild(func(add func(Doc, string)) error {
+		for _, d := range docs {
+			os.MkdirAll(filepath.Join(dir, d.doc.SessionID), 0755)
+			add(d.doc, d.text)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix
+}
+
+func entryIDs(hits []Hit) []string {
+	var ids []string
+	for _, h := range hits {
+		ids = append(ids, h.EntryID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	day := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	ix := newIndex(t,
+		indexed{Doc{SessionID: "s1", EntryID: "e1", TurnID: "e1", Cwd: "/src/app", Time: day.UnixMilli(), Role: "user"},
+			"why does the scheduler deadlock"},
+		indexed{Doc{SessionID: "s1", EntryID: "e2", TurnID: "e1", Cwd: "/src/app", Time: day.Add(time.Minute).UnixMilli(), Role: "assistant", Tools: []string{"bash"}},
+			"bash go test ./scheduler deadlock deadlock"},
+		indexed{Doc{SessionID: "s2", EntryID: "e1", TurnID: "e1", Cwd: "/src/lib", Time: day.AddDate(0, 0, 5).UnixMilli(), Role: "user"},
+			"the parser panics"},
+	)
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"ranked by frequency", Query{Text: "deadlock"}, []string{"e2", "e1"}},
+		{"all terms", Query{Text: "scheduler why"}, []string{"e1"}},
+		{"prefix", Query{Text: "dead*"}, []string{"e2", "e1"}},
+		{"role", Query{Text: "deadlock", Role: "user"}, []string{"e1"}},
+		{"tool", Query{Text: "deadlock", Tool: "bash"}, []string{"e2"}},
+		{"cwd", Query{Text: "the", Cwd: "/src/lib/"}, []string{"e1"}},
+		{"since", Query{Text: "the", Since: day.AddDate(0, 0, 1)}, []string{"e1"}},
+		{"until", Query{Text: "deadlock", Until: day.Add(30 * time.Second)}, []string{"e1"}},
+		{"limit", Query{Text: "deadlock", Limit: 1}, []string{"e2"}},
+		{"no match", Query{Text: "deadlock parser"}, nil},
+	}
+	for _, tt := range tests {
+		hits, err := ix.Search(tt.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := entryIDs(hits); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: hits = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAdd_MergesAndPrunes(t *testing.T) {
+	ix := newIndex(t, indexed{Doc{SessionID: "s1", EntryID: "e1", Role: "user"}, "first message"})
+	if !ix.Exists() {
+		t.Fatal("index not built")
+	}
+	for i := 0; i < 2; i++ {
+		// The second add is a duplicate and must not be counted twice.
+		if err := ix.Add(Doc{SessionID: "s1", EntryID: "e2", Role: "assistant"}, "second message"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hits, err := ix.Search(Query{Text: "message"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("hits = %v, want e1 and e2", entryIDs(hits))
+	}
+	if _, err := os.Stat(filepath.Join(ix.dir, logFile)); !os.IsNotExist(err) {
+		t.Errorf("log not merged: %v", err)
+	}
+
+	os.RemoveAll(filepath.Join(ix.dir, "s1"))
+	if hits, err := ix.Search(Query{Text: "message"}); err != nil || len(hits) != 0 {
+		t.Errorf("deleted session still found: %v, %v", entryIDs(hits), err)
+	}
+}
+
+func TestRebuild_KeepsEntriesAddedWhileWalking(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "s1"), 0755)
+	ix := Open(dir)
+	err := ix.Rebuild(func(add func(Doc, string)) error {
+		add(Doc{SessionID: "s1", EntryID: "e1", Role: "user"}, "walked message")
+		// Appended by a running agent after s1 was read.
+		return ix.Add(Doc{SessionID: "s1", EntryID: "e2", Role: "assistant"}, "late message")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := ix.Search(Query{Text: "message"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("hits = %v, want e1 and e2", entryIDs(hits))
+	}
+}
+
+func TestSearch_NeedsRebuild(t *testing.T) {
+	ix := Open(t.TempDir())
+	if _, err := ix.Search(Query{Text: "x1"}); !NeedsRebuild(err) {
+		t.Errorf("missing index: err = %v", err)
+	}
+	os.WriteFile(filepath.Join(ix.dir, segmentFile), []byte("garbage"), 0644)
+	if _, err := ix.Search(Query{Text: "x1"}); !NeedsRebuild(err) {
+		t.Errorf("corrupt index: err = %v", err)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	q, err := ParseQuery([]string{"flaky", "--role", "tool", "test*", "--since", "7d", "--tool=bash", "--limit", "5"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Query{Text: "flaky test*", Role: "tool", Tool: "bash", Since: now.AddDate(0, 0, -7), Limit: 5}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("ParseQuery = %+v\nwant %+v", q, want)
+	}
+	if got := q.Terms(); !reflect.DeepEqual(got, []string{"flaky", "test*"}) {
+		t.Errorf("Terms = %v", got)
+	}
+
+	for _, args := range [][]string{{}, {"--role", "system", "x1"}, {"x1", "--since", "yesterday"}, {"x1", "--bogus"}} {
+		if _, err := ParseQuery(args, now); err == nil {
+			t.Errorf("ParseQuery(%q): expected error", args)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	for in, want := range map[string]time.Time{
+		"2026-10-01":           time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local),
+		"2026-10-01T08:00:00Z": time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC),
+		"2d":                   now.AddDate(0, 0, -2),
+		"90m":                  now.Add(-90 * time.Minute),
+	} {
+		if got, err := ParseTime(in, now); err != nil || !got.Equal(want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+}
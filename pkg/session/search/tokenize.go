@@ -0,0 +1,100 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTermLen drops longer tokens: base64 blobs, hashes and minified code
+// only bloat the index.
+const maxTermLen = 64
+
+// snippetRadius is the runes of context on each side of a snippet match.
+const snippetRadius = 60
+
+// Terms splits text into lowercase index terms with their counts. Words are
+// runs of letters, digits and '_'; ASCII words need two characters. Han,
+// Hiragana, Katakana and Hangul have no spaces between words, so each of
+// their characters is a term.
+func Terms(text string) map[string]int {
+	terms := map[string]int{}
+	forEachTerm(text, func(term string) { terms[term]++ })
+	return terms
+}
+
+// Tokens splits text into terms like Terms, in order and with duplicates.
+// The memory store and the compaction archive search tokenize with it too.
+func Tokens(text string) []string {
+	var tokens []string
+	forEachTerm(text, func(term string) { tokens = append(tokens, term) })
+	return tokens
+}
+
+func forEachTerm(text string, fn func(string)) {
+	start := -1
+	emit := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := text[start:end]
+		start = -1
+		if len(word) < 2 || len(word) > maxTermLen {
+			return
+		}
+		fn(strings.ToLower(word))
+	}
+	for i, r := range text {
+		switch {
+		case isIdeograph(r):
+			emit(i)
+			fn(string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if start < 0 {
+				start = i
+			}
+		default:
+			emit(i)
+		}
+	}
+	emit(len(text))
+}
+
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Snippet returns the text around the first match of any of terms, on one
+// line, or the start of text when none matches.
+func Snippet(text string, terms []string) string {
+	at := 0
+	// Offsets in the lowercased text only apply when lowercasing kept the
+	// byte length, which holds for nearly all text.
+	if lower := strings.ToLower(text); len(lower) == len(text) {
+		first := -1
+		for _, term := range terms {
+			if i := strings.Index(lower, strings.TrimSuffix(term, "*")); i >= 0 && (first < 0 || i < first) {
+				first = i
+			}
+		}
+		at = max(first, 0)
+	}
+
+	start, end := at, at
+	for n := 0; n < snippetRadius && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	for n := 0; n < 2*snippetRadius && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	snippet := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session/search"
+)
+
+func TestSearchSessions(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+	first, err := sm.CreateSession("flaky-tests", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := first.AppendMessage(agentctx.NewUserMessage("why is TestScheduler flaky?"))
+	call := agentctx.NewAssistantMessage()
+	call.Content = []agentctx.ContentBlock{
+		agentctx.ToolCallContent{ID: "c1", Type: "toolCall", Name: "bash", Arguments: map[string]any{"command": "go test -run TestScheduler"}},
+	}
+	callID, _ := first.AppendMessage(call)
+	first.AppendMessage(agentctx.NewUserMessage("hidden TestScheduler hint").WithVisibility(true, false))
+
+	// The first search builds the index from the session files.
+	hits, err := SearchSessions(search.Query{Text: "testscheduler"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("hits = %+v, want the user and assistant messages", hits)
+	}
+	byEntry := map[string]SearchHit{}
+	for _, h := range hits {
+		byEntry[h.EntryID] = h
+	}
+	h := byEntry[callID]
+	if h.SessionName != "flaky-tests" || h.ForkEntryID != userID || h.Role != "assistant" || h.Dir != first.GetDir() {
+		t.Errorf("hit = %+v", h)
+	}
+	if !strings.Contains(h.Snippet, `"command":"go test -run TestScheduler"`) {
+		t.Errorf("snippet = %q", h.Snippet)
+	}
+
+	// Later appends, in this session or a new one, go to the built index.
+	second, err := sm.CreateSession("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.AppendMessage(agentctx.NewUserMessage("TestScheduler passes now"))
+	if _, err := first.AppendCompaction("investigated TestScheduler", nil); err != nil {
+		t.Fatal(err)
+	}
+	hits, err = SearchSessions(search.Query{Text: "testscheduler", Role: "user"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].Snippet != "TestScheduler passes now" || hits[0].SessionID != filepath.Base(second.GetDir()) {
+		t.Fatalf("user hits = %+v", hits)
+	}
+	if hits, _ := SearchSessions(search.Query{Text: "investigated", Role: "compaction"}, dir); len(hits) != 1 {
+		t.Errorf("compaction hits = %+v", hits)
+	}
+	if hits, _ := SearchSessions(search.Query{Text: "testscheduler", Tool: "bash"}, dir); len(hits) != 1 || hits[0].EntryID != callID {
+		t.Errorf("tool hits = %+v", hits)
+	}
+
+	// Deleted sessions drop out of the index.
+	if err := sm.DeleteSession(filepath.Base(second.GetDir())); err != nil {
+		t.Fatal(err)
+	}
+	hits, _ = SearchSessions(search.Query{Text: "passes"}, dir)
+	if len(hits) != 0 {
+		t.Errorf("deleted session hits = %+v", hits)
+	}
+}
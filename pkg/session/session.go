@@ -11,7 +11,6 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -46,6 +45,10 @@ type Session struct {
 	leafID     *string
 	flushed    bool
 	persist    bool
+	readOnly   bool         // writes stay in memory; see SetReadOnly
+	owner      *ownerLock   // held while this process owns the session; see Lock
+	store      SessionStore // nil for a session kept in sessionDir; see storeLocked
+	storeID    string
 }
 
 // ForkMessage represents a user message candidate for forking.
@@ -86,104 +89,107 @@ func LoadSession(sessionDir string) (*Session, error) {
 
 // loadSessionFull loads the entire session file (original LoadSession implementation).
 func loadSessionFull(sessionDir string) (*Session, error) {
-	sess := &Session{
-		sessionDir: sessionDir,
-		entries:    make([]*SessionEntry, 0),
-		byID:       make(map[string]*SessionEntry),
-		persist:    sessionDir != "",
-	}
-
 	if sessionDir == "" {
+		sess := &Session{
+			entries: make([]*SessionEntry, 0),
+			byID:    make(map[string]*SessionEntry),
+		}
 		sess.header = newSessionHeader(uuid.NewString(), "", "")
 		return sess, nil
 	}
+	store, id := fileStoreFor(sessionDir)
+	return openSession(store, id, true)
+}
 
-	filePath := filepath.Join(sessionDir, "messages.jsonl")
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			id := sessionIDFromDirPath(sessionDir)
-			cwd, _ := os.Getwd()
-			sess.header = newSessionHeader(id, cwd, "")
-			return sess, nil
-		}
-		return nil, err
-	}
+// OpenSession loads session id from store, reading only its current branch
+// like LoadSession. A session the store does not have yet starts empty and
+// is written with its first entry.
+func OpenSession(store SessionStore, id string) (*Session, error) {
+	return openSession(store, id, false)
+}
 
-	lines := splitLines(data)
-	if len(lines) == 0 {
-		id := sessionIDFromDirPath(sessionDir)
-		cwd, _ := os.Getwd()
-		sess.header = newSessionHeader(id, cwd, "")
+func openSession(store SessionStore, id string, full bool) (*Session, error) {
+	sess := newStoreSession(store, id)
+	read := store.ReadBranch
+	if full {
+		read = store.ReadEntries
+	}
+	header, entries, err := read(id)
+	if errors.Is(err, ErrSessionNotFound) {
 		return sess, nil
 	}
-
-	firstLine := firstNonEmptyLine(lines)
-	header, headerErr := decodeSessionHeader(firstLine)
-	if headerErr == nil && header != nil {
-		sess.header = *header
-		for _, line := range lines {
-			if len(line) == 0 {
-				continue
-			}
-			if headerLine(line) {
-				continue
-			}
-			entry, err := decodeSessionEntry(line)
-			if err != nil || entry == nil {
-				continue
-			}
+	if err != nil {
+		return nil, err
+	}
+	sess.header = *header
+	if full {
+		for _, entry := range entries {
 			sess.addEntry(entry)
 		}
-		sess.flushed = true
-		return sess, nil
+	} else {
+		sess.addBranchEntries(entries)
 	}
+	sess.flushed = true
+	return sess, nil
+}
 
-	// Legacy format: JSONL of AgentMessage objects.
-	legacyMessages := make([]agentctx.AgentMessage, 0)
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
-		}
-		var msg agentctx.AgentMessage
-		if err := json.Unmarshal(line, &msg); err != nil {
-			continue
-		}
-		legacyMessages = append(legacyMessages, msg)
+// newStoreSession returns an empty session kept in store under id.
+func newStoreSession(store SessionStore, id string) *Session {
+	if ds, ok := store.(DirStore); ok {
+		return NewSession(ds.SessionDir(id))
+	}
+	sess := &Session{
+		entries: make([]*SessionEntry, 0),
+		byID:    make(map[string]*SessionEntry),
+		persist: true,
+		store:   store,
+		storeID: id,
 	}
-
-	id := sessionIDFromFilePath(filePath)
 	cwd, _ := os.Getwd()
 	sess.header = newSessionHeader(id, cwd, "")
-	var parentID *string
-	for _, msg := range legacyMessages {
-		ts := time.Now().UTC().Format(time.RFC3339Nano)
-		if msg.Timestamp != 0 {
-			ts = time.UnixMilli(msg.Timestamp).UTC().Format(time.RFC3339Nano)
-		}
-		entry := &SessionEntry{
-			Type:      EntryTypeMessage,
-			ID:        generateEntryID(sess.byID),
-			ParentID:  parentID,
-			Timestamp: ts,
-			Message:   &msg,
-		}
-		sess.addEntry(entry)
-		parentID = &entry.ID
+	return sess
+}
+
+// storeLocked returns the store and ID the session is kept under: the
+// store it was opened from, or a FileStore for a session directory.
+func (s *Session) storeLocked() (SessionStore, string) {
+	if s.store != nil {
+		return s.store, s.storeID
 	}
-	// Rewrite file to migrate from legacy format to new format
-	// This is a one-time migration, not a regular rewrite
-	if err := sess.rewriteFile(); err != nil {
-		return nil, err
+	if s.sessionDir != "" {
+		return fileStoreFor(s.sessionDir)
 	}
-	return sess, nil
+	return nil, ""
+}
+
+// snapshotsLocked returns the reader of the session's compaction snapshots,
+// or nil if it has none.
+func (s *Session) snapshotsLocked() func(ref string) ([]agentctx.AgentMessage, error) {
+	store, id := s.storeLocked()
+	if store == nil {
+		return nil
+	}
+	return func(ref string) ([]agentctx.AgentMessage, error) {
+		return store.GetSnapshot(id, ref)
+	}
+}
+
+// parentRef is how a fork's header names this session: the path of its
+// file, or its ID outside a FileStore.
+func (s *Session) parentRef() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store != nil {
+		return s.storeID
+	}
+	return s.filePath()
 }
 
 // GetMessages returns the current session context messages.
 func (s *Session) GetMessages() []agentctx.AgentMessage {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return buildSessionContext(s.entries, s.leafID, s.byID, s.sessionDir)
+	return buildSessionContext(s.entries, s.leafID, s.byID, s.snapshotsLocked())
 }
 
 // GetDir returns the session directory path.
@@ -196,13 +202,17 @@ func (s *Session) GetDir() string {
 // AppendCompaction records a compaction event: saves the post-compaction
 // in-memory messages to an external snapshot file, then appends a compaction
 // entry to messages.jsonl referencing that snapshot. This keeps messages.jsonl
-// append-only — history is never rewritten.
+// append-only — history is never rewritten. A read-only or taken-over
+// session records neither.
 func (s *Session) AppendCompaction(summary string, messages []agentctx.AgentMessage) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	var snapshotRef string
-	if s.sessionDir != "" {
+	if store, id := s.storeLocked(); store != nil {
+		if ok, err := s.writableLocked(); !ok {
+			return "", err
+		}
 		// Assign sequential snapshot file name based on existing compaction entries.
 		count := 0
 		for _, e := range s.entries {
@@ -211,13 +221,17 @@ func (s *Session) AppendCompaction(summary string, messages []agentctx.AgentMess
 			}
 		}
 		name := fmt.Sprintf("compaction_%05d.jsonl", count+1)
-		snapshotPath := filepath.Join(s.sessionDir, "compactions", name)
-		if err := saveSnapshotMessages(snapshotPath, messages); err != nil {
+		ref := filepath.Join("compactions", name)
+		if err := store.PutSnapshot(id, ref, messages); err != nil {
 			return "", fmt.Errorf("save compaction snapshot: %w", err)
 		}
-		snapshotRef = filepath.Join("compactions", name)
+		snapshotRef = ref
 	}
 
+	// Lazy loading only reads entries after the latest compaction, so carry
+	// the current todo list forward past it.
+	todos := s.latestTodosLocked()
+
 	entry := &SessionEntry{
 		Type:        EntryTypeCompaction,
 		ID:          generateEntryID(s.byID),
@@ -227,7 +241,16 @@ func (s *Session) AppendCompaction(summary string, messages []agentctx.AgentMess
 		SnapshotRef: snapshotRef,
 	}
 	s.addEntry(entry)
-	return entry.ID, s.persistEntry(entry)
+	if err := s.persistEntry(entry); err != nil {
+		return entry.ID, err
+	}
+	s.indexEntryLocked(entry)
+	if len(todos) > 0 {
+		if _, err := s.appendTodosLocked(todos); err != nil {
+			return entry.ID, fmt.Errorf("carry todos past compaction: %w", err)
+		}
+	}
+	return entry.ID, nil
 }
 
 // GetPath returns the messages.jsonl file path of the session.
@@ -321,12 +344,13 @@ func (s *Session) EnsureFullyLoaded() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if !s.persist || s.sessionDir == "" {
+	store, id := s.storeLocked()
+	if !s.persist || store == nil {
 		return nil
 	}
 
 	// Load full session from disk (non-lazy)
-	full, err := loadSessionFull(s.sessionDir)
+	full, err := openSession(store, id, true)
 	if err != nil {
 		return fmt.Errorf("failed to fully load session: %w", err)
 	}
@@ -356,11 +380,16 @@ func (s *Session) AppendMessage(message agentctx.AgentMessage) (string, error) {
 	}
 
 	s.addEntry(entry)
-	return entry.ID, s.persistEntry(entry)
+	if err := s.persistEntry(entry); err != nil {
+		return entry.ID, err
+	}
+	s.indexEntryLocked(entry)
+	return entry.ID, nil
 }
 
-// AppendSessionInfo appends a session info entry.
-func (s *Session) AppendSessionInfo(name, title string) (string, error) {
+// AppendSessionInfo appends a session info entry. An empty name or title
+// keeps the previous one; tags, if given, replace the previous tags.
+func (s *Session) AppendSessionInfo(name, title string, tags ...string) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -371,12 +400,105 @@ func (s *Session) AppendSessionInfo(name, title string) (string, error) {
 		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
 		Name:      strings.TrimSpace(name),
 		Title:     strings.TrimSpace(title),
+		Tags:      tags,
+	}
+
+	s.addEntry(entry)
+	return entry.ID, s.persistEntry(entry)
+}
+
+// AppendTodos appends a todo entry recording the full todo list.
+func (s *Session) AppendTodos(todos []agentctx.TodoItem) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendTodosLocked(todos)
+}
+
+func (s *Session) appendTodosLocked(todos []agentctx.TodoItem) (string, error) {
+	entry := &SessionEntry{
+		Type:      EntryTypeTodo,
+		ID:        generateEntryID(s.byID),
+		ParentID:  s.leafID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Todos:     agentctx.CloneTodos(todos),
+	}
+	if entry.Todos == nil {
+		// Keep an explicit empty list so a cleared list is not mistaken
+		// for "no todo entry".
+		entry.Todos = []agentctx.TodoItem{}
+	}
+
+	s.addEntry(entry)
+	return entry.ID, s.persistEntry(entry)
+}
+
+// AppendVerify records the verification result of a run.
+func (s *Session) AppendVerify(result *agentctx.VerifyResult) (string, error) {
+	if result == nil {
+		return "", fmt.Errorf("nil verify result")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &SessionEntry{
+		Type:      EntryTypeVerify,
+		ID:        generateEntryID(s.byID),
+		ParentID:  s.leafID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Verify:    result,
 	}
+	s.addEntry(entry)
+	return entry.ID, s.persistEntry(entry)
+}
+
+// AppendPin records a priority change for msg. A priority at or above
+// agentctx.PriorityPinThreshold pins it; nil resets it to the default.
+func (s *Session) AppendPin(msg agentctx.AgentMessage, priority *float64) (string, error) {
+	if msg.EntryID == "" && msg.Timestamp == 0 {
+		return "", fmt.Errorf("message has no entry id or timestamp")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	entry := &SessionEntry{
+		Type:      EntryTypePin,
+		ID:        generateEntryID(s.byID),
+		ParentID:  s.leafID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Pin: &PinTarget{
+			MessageRef: NewMessageRef(msg),
+			Priority:   priority,
+		},
+	}
 	s.addEntry(entry)
 	return entry.ID, s.persistEntry(entry)
 }
 
+// GetTodos returns the todo list recorded by the latest todo entry on the
+// current branch, or nil if there is none.
+func (s *Session) GetTodos() []agentctx.TodoItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latestTodosLocked()
+}
+
+func (s *Session) latestTodosLocked() []agentctx.TodoItem {
+	if s.leafID == nil {
+		return nil
+	}
+	current := s.byID[*s.leafID]
+	for current != nil {
+		if current.Type == EntryTypeTodo {
+			return agentctx.CloneTodos(current.Todos)
+		}
+		if current.ParentID == nil {
+			break
+		}
+		current = s.byID[*current.ParentID]
+	}
+	return nil
+}
+
 // GetSessionName returns the latest session name if available.
 func (s *Session) GetSessionName() string {
 	s.mu.Lock()
@@ -403,6 +525,19 @@ func (s *Session) GetSessionTitle() string {
 	return ""
 }
 
+// GetSessionTags returns the latest session tags if available.
+func (s *Session) GetSessionTags() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		entry := s.entries[i]
+		if entry.Type == EntryTypeSessionInfo && len(entry.Tags) > 0 {
+			return append([]string(nil), entry.Tags...)
+		}
+	}
+	return nil
+}
+
 // GetCompactionCount returns the number of compaction entries along the current branch.
 func (s *Session) GetCompactionCount() int {
 	s.mu.Lock()
@@ -497,19 +632,15 @@ func (s *Session) Clear() error {
 	s.leafID = nil
 	s.header.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
 
-	if s.sessionDir == "" {
+	store, id := s.storeLocked()
+	if store == nil {
 		return nil
 	}
+	if ok, err := s.writableLocked(); !ok {
+		return err
+	}
 
-	filePath := s.filePath()
-	if err := s.withFileWriteLock(func() error {
-		if _, err := os.Stat(filePath); err == nil {
-			if err := os.Remove(filePath); err != nil {
-				return err
-			}
-		}
-		return nil
-	}); err != nil {
+	if err := store.DeleteEntries(id); err != nil {
 		return err
 	}
 	s.flushed = false
@@ -523,128 +654,52 @@ func (s *Session) addEntry(entry *SessionEntry) {
 }
 
 func (s *Session) persistEntry(entry *SessionEntry) error {
-	if !s.persist || s.sessionDir == "" {
+	store, id := s.storeLocked()
+	if !s.persist || store == nil {
 		return nil
 	}
-
-	return s.withFileWriteLock(func() error {
-		return s.persistEntryLocked(entry)
-	})
-}
-
-func (s *Session) persistEntryLocked(entry *SessionEntry) error {
-	if !s.flushed {
-		if err := s.rewriteFileLocked(); err != nil {
-			return err
-		}
-		return nil
-	}
-
-	filePath := s.filePath()
-	if info, err := os.Stat(filePath); err != nil || info.Size() == 0 {
-		if err := s.rewriteFileLocked(); err != nil {
-			return err
-		}
-		return nil
-	}
-
-	data, err := json.Marshal(entry)
-	if err != nil {
+	if ok, err := s.writableLocked(); !ok {
 		return err
 	}
-	data = append(data, '\n')
 
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	if _, err := file.Write(data); err != nil {
-		return err
+	if !s.flushed {
+		return s.rewriteFileLocked(store, id)
 	}
-	if err := file.Sync(); err != nil {
-		return err
+	err := store.AppendEntry(id, entry)
+	if errors.Is(err, ErrSessionNotFound) {
+		// The file was removed or emptied under us; write it whole.
+		return s.rewriteFileLocked(store, id)
 	}
-	return nil
+	return err
 }
 
 func (s *Session) rewriteFile() error {
-	if !s.persist || s.sessionDir == "" {
+	store, id := s.storeLocked()
+	if !s.persist || store == nil {
 		s.flushed = true
 		return nil
 	}
-
-	return s.withFileWriteLock(func() error {
-		return s.rewriteFileLocked()
-	})
-}
-
-func (s *Session) rewriteFileLocked() error {
-	filePath := s.filePath()
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-
-	tmpPath := fmt.Sprintf("%s.tmp-%d-%d", filePath, os.Getpid(), time.Now().UnixNano())
-	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = file.Close()
-		_ = os.Remove(tmpPath)
-	}()
-
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(s.header); err != nil {
+	if ok, err := s.writableLocked(); !ok {
 		return err
 	}
+	return s.rewriteFileLocked(store, id)
+}
 
-	for _, entry := range s.entries {
-		if err := encoder.Encode(entry); err != nil {
-			return err
-		}
-	}
-	if err := file.Sync(); err != nil {
-		return err
-	}
-	if err := file.Close(); err != nil {
-		return err
-	}
-	if err := os.Rename(tmpPath, filePath); err != nil {
+func (s *Session) rewriteFileLocked(store SessionStore, id string) error {
+	if err := store.WriteEntries(id, s.header, s.entries); err != nil {
 		return err
 	}
-
 	s.flushed = true
 	return nil
 }
 
+// withFileWriteLock runs run under the lock that writers of the session
+// file take, so that run sees no partial append.
 func (s *Session) withFileWriteLock(run func() error) error {
 	if !s.persist || s.sessionDir == "" {
 		return run()
 	}
-
-	filePath := s.filePath()
-	lockPath := filePath + ".lock"
-	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
-		return err
-	}
-
-	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
-	if err != nil {
-		return err
-	}
-	defer lockFile.Close()
-
-	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
-		return err
-	}
-	defer func() {
-		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
-	}()
-
-	return run()
+	return withFileLock(s.filePath()+".lock", run)
 }
 
 func (s *Session) getBranchLocked(id string) []SessionEntry {
@@ -720,6 +720,36 @@ func TestForkSessionFrom_BranchOnly(t *testing.T) {
 	}
 }
 
+func TestImportSession(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	messages := []agentctx.AgentMessage{
+		agentctx.NewUserMessage("imported"),
+		agentctx.NewAssistantMessage(),
+	}
+	sess, err := sm.ImportSession("trace", "", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := filepath.Base(sess.GetDir())
+	meta, err := sm.GetMeta(id)
+	if err != nil || meta.Name != "trace" || meta.MessageCount != 2 {
+		t.Fatalf("meta = %+v, %v", meta, err)
+	}
+
+	// Reloaded, the messages form one branch that can be forked.
+	loaded, err := sm.GetSession(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.GetMessages(); len(got) != 2 || got[0].ExtractText() != "imported" {
+		t.Fatalf("messages = %+v", got)
+	}
+	fork, err := sm.ForkSessionFrom(loaded, loaded.GetLeafID(), "fork", "")
+	if err != nil || len(fork.GetMessages()) != 2 {
+		t.Fatalf("fork: %v", err)
+	}
+}
+
 // --- Entry points used by tests but valuable to exercise ---
 
 func TestGenerateEntryID_Collision(t *testing.T) {
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"errors"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// ErrSessionNotFound is returned by a SessionStore for a session it does not
+// have, or that has no entries yet.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore keeps the sessions of one project. Session and
+// SessionManager reach their data only through it, so a session can live in
+// a directory of JSONL files (FileStore), in memory (MemoryStore) or in any
+// other backend that passes the contract tests in pkg/session/storetest.
+//
+// Sessions are identified by ID. A store must be safe for use by several
+// goroutines, and must not share memory with the entries, messages and
+// metadata passed to it or returned from it.
+//
+// Some capabilities need each session in a directory of its own, and only
+// sessions of a store that also implements DirStore have them: the owner
+// lock (Session.Lock), compaction archives and recall, the full-text search
+// index, and fork headers that name their parent by file path. Sessions of
+// other stores skip them; forks there name their parent by ID.
+type SessionStore interface {
+	// ReadHeader returns the session header.
+	ReadHeader(id string) (*SessionHeader, error)
+	// ReadEntries returns the header and every entry, in append order.
+	ReadEntries(id string) (*SessionHeader, []*SessionEntry, error)
+	// ReadBranch returns the header and the entries the session's current
+	// branch is rebuilt from: the latest compaction entry and the entries
+	// after it. A store that cannot read that tail cheaply may return
+	// every entry, as ReadEntries does.
+	ReadBranch(id string) (*SessionHeader, []*SessionEntry, error)
+	// AppendEntry adds entry after the existing ones. It returns
+	// ErrSessionNotFound if the session has no header yet; the caller then
+	// writes it whole with WriteEntries.
+	AppendEntry(id string, entry *SessionEntry) error
+	// WriteEntries replaces the session's header and entries.
+	WriteEntries(id string, header SessionHeader, entries []*SessionEntry) error
+	// DeleteEntries drops the header and entries, keeping the snapshots and
+	// metadata.
+	DeleteEntries(id string) error
+
+	// PutSnapshot stores the messages of a compaction under ref, the
+	// compaction entry's SnapshotRef.
+	PutSnapshot(id, ref string, messages []agentctx.AgentMessage) error
+	// GetSnapshot returns the messages stored under ref.
+	GetSnapshot(id, ref string) ([]agentctx.AgentMessage, error)
+
+	// PutMeta stores the session's metadata.
+	PutMeta(id string, meta *SessionMeta) error
+	// GetMeta returns the session's metadata.
+	GetMeta(id string) (*SessionMeta, error)
+	// List returns the metadata of every session, in no particular order.
+	List() ([]SessionMeta, error)
+	// Delete removes the session with its snapshots and metadata.
+	Delete(id string) error
+}
+
+// DirStore is a SessionStore that keeps each session in a directory under
+// one sessions directory, as FileStore does. SessionManager and Session
+// open its sessions by directory, which gives them the directory-only
+// capabilities listed on SessionStore.
+type DirStore interface {
+	SessionStore
+	// Dir returns the sessions directory.
+	Dir() string
+	// SessionDir returns the directory of session id.
+	SessionDir(id string) string
+}
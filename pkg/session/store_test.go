@@ -0,0 +1,20 @@
+package session_test
+
+import (
+	"testing"
+
+	"github.com/tiancaiamao/ai/pkg/session"
+	"github.com/tiancaiamao/ai/pkg/session/storetest"
+)
+
+func TestFileStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) session.SessionStore {
+		return session.NewFileStore(t.TempDir())
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) session.SessionStore {
+		return session.NewMemoryStore()
+	})
+}
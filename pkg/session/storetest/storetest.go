@@ -0,0 +1,367 @@
+// Package storetest holds the contract tests every session.SessionStore must
+// pass. A backend runs them from its own tests:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) session.SessionStore { return newMyStore(t) })
+//	}
+package storetest
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+// Run runs the contract tests against stores made by newStore, which must
+// return a new, empty store on each call.
+func Run(t *testing.T, newStore func(t *testing.T) session.SessionStore) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store session.SessionStore)
+	}{
+		{"Entries", testEntries},
+		{"AppendNotFound", testAppendNotFound},
+		{"Branch", testBranch},
+		{"DeleteEntries", testDeleteEntries},
+		{"Snapshots", testSnapshots},
+		{"Meta", testMeta},
+		{"ListAndDelete", testListAndDelete},
+		{"NoSharedMemory", testNoSharedMemory},
+		{"Manager", testManager},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func header(id string) session.SessionHeader {
+	return session.SessionHeader{
+		Type:      session.EntryTypeSession,
+		Version:   session.CurrentSessionVersion,
+		ID:        id,
+		Timestamp: "2026-01-02T03:04:05Z",
+		Cwd:       "/work",
+	}
+}
+
+func message(id string, parent *session.SessionEntry, text string) *session.SessionEntry {
+	msg := agentctx.NewUserMessage(text)
+	entry := &session.SessionEntry{
+		Type:      session.EntryTypeMessage,
+		ID:        id,
+		Timestamp: "2026-01-02T03:04:05Z",
+		Message:   &msg,
+	}
+	if parent != nil {
+		entry.ParentID = &parent.ID
+	}
+	return entry
+}
+
+func entryIDs(entries []*session.SessionEntry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testEntries(t *testing.T, store session.SessionStore) {
+	if _, _, err := store.ReadEntries("s1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("ReadEntries of missing session: %v", err)
+	}
+	if _, err := store.ReadHeader("s1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("ReadHeader of missing session: %v", err)
+	}
+
+	m1 := message("m1", nil, "one")
+	m2 := message("m2", m1, "two")
+	if err := store.WriteEntries("s1", header("s1"), []*session.SessionEntry{m1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AppendEntry("s1", m2); err != nil {
+		t.Fatal(err)
+	}
+
+	h, entries, err := store.ReadEntries("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.ID != "s1" || h.Cwd != "/work" {
+		t.Errorf("header = %+v", h)
+	}
+	if got := entryIDs(entries); !equalIDs(got, []string{"m1", "m2"}) {
+		t.Fatalf("entries = %v", got)
+	}
+	if entries[1].ParentID == nil || *entries[1].ParentID != "m1" || entries[1].Message.ExtractText() != "two" {
+		t.Errorf("entry = %+v", entries[1])
+	}
+	if h, err := store.ReadHeader("s1"); err != nil || h.ID != "s1" {
+		t.Errorf("ReadHeader = %+v, %v", h, err)
+	}
+
+	// WriteEntries replaces what was there.
+	if err := store.WriteEntries("s1", header("s1"), []*session.SessionEntry{m2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, entries, err := store.ReadEntries("s1"); err != nil || !equalIDs(entryIDs(entries), []string{"m2"}) {
+		t.Errorf("entries after rewrite = %v, %v", entryIDs(entries), err)
+	}
+}
+
+func testAppendNotFound(t *testing.T, store session.SessionStore) {
+	err := store.AppendEntry("s1", message("m1", nil, "one"))
+	if !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("AppendEntry without header: %v", err)
+	}
+}
+
+func testBranch(t *testing.T, store session.SessionStore) {
+	m1 := message("m1", nil, "one")
+	m2 := message("m2", m1, "two")
+	compaction := &session.SessionEntry{
+		Type:        session.EntryTypeCompaction,
+		ID:          "c1",
+		ParentID:    &m2.ID,
+		Timestamp:   "2026-01-02T03:04:05Z",
+		Summary:     "summary",
+		SnapshotRef: "compactions/compaction_00001.jsonl",
+	}
+	m3 := message("m3", compaction, "three")
+	if err := store.WriteEntries("s1", header("s1"), []*session.SessionEntry{m1, m2, compaction, m3}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, entries, err := store.ReadBranch("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := entryIDs(entries)
+	// Either the tail from the latest compaction or every entry.
+	if !equalIDs(got, []string{"c1", "m3"}) && !equalIDs(got, []string{"m1", "m2", "c1", "m3"}) {
+		t.Errorf("branch = %v", got)
+	}
+	if _, _, err := store.ReadBranch("missing"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("ReadBranch of missing session: %v", err)
+	}
+}
+
+func testDeleteEntries(t *testing.T, store session.SessionStore) {
+	if err := store.WriteEntries("s1", header("s1"), []*session.SessionEntry{message("m1", nil, "one")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutMeta("s1", &session.SessionMeta{ID: "s1", Name: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteEntries("s1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.ReadEntries("s1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("ReadEntries after DeleteEntries: %v", err)
+	}
+	if err := store.AppendEntry("s1", message("m2", nil, "two")); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("AppendEntry after DeleteEntries: %v", err)
+	}
+	if meta, err := store.GetMeta("s1"); err != nil || meta.Name != "kept" {
+		t.Errorf("meta after DeleteEntries = %+v, %v", meta, err)
+	}
+}
+
+func testSnapshots(t *testing.T, store session.SessionStore) {
+	const ref = "compactions/compaction_00001.jsonl"
+	messages := []agentctx.AgentMessage{
+		agentctx.NewUserMessage("question"),
+		agentctx.NewUserMessage("follow-up"),
+	}
+	if err := store.WriteEntries("s1", header("s1"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutSnapshot("s1", ref, messages); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetSnapshot("s1", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ExtractText() != "question" || got[1].ExtractText() != "follow-up" {
+		t.Errorf("snapshot = %+v", got)
+	}
+	if _, err := store.GetSnapshot("s1", "compactions/missing.jsonl"); err == nil {
+		t.Error("GetSnapshot of missing ref succeeded")
+	}
+}
+
+func testMeta(t *testing.T, store session.SessionStore) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	meta := &session.SessionMeta{
+		ID:        "s1",
+		Name:      "name",
+		Title:     "title",
+		CreatedAt: created,
+		UpdatedAt: created,
+		Runs:      []string{"run1"},
+	}
+	if err := store.PutMeta("s1", meta); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetMeta("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "name" || got.Title != "title" || !got.CreatedAt.Equal(created) || len(got.Runs) != 1 {
+		t.Errorf("meta = %+v", got)
+	}
+	if _, err := store.GetMeta("missing"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("GetMeta of missing session: %v", err)
+	}
+}
+
+func testListAndDelete(t *testing.T, store session.SessionStore) {
+	if metas, err := store.List(); err != nil || len(metas) != 0 {
+		t.Fatalf("List of empty store = %+v, %v", metas, err)
+	}
+	for _, id := range []string{"s1", "s2"} {
+		if err := store.WriteEntries(id, header(id), []*session.SessionEntry{message("m1", nil, "one")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.PutMeta(id, &session.SessionMeta{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.PutSnapshot("s1", "compactions/compaction_00001.jsonl", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	metas, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range metas {
+		ids = append(ids, m.ID)
+	}
+	sort.Strings(ids)
+	if !equalIDs(ids, []string{"s1", "s2"}) {
+		t.Fatalf("List = %v", ids)
+	}
+
+	if err := store.Delete("s1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.ReadEntries("s1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("ReadEntries after Delete: %v", err)
+	}
+	if _, err := store.GetMeta("s1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("GetMeta after Delete: %v", err)
+	}
+	if _, err := store.GetSnapshot("s1", "compactions/compaction_00001.jsonl"); err == nil {
+		t.Error("GetSnapshot after Delete succeeded")
+	}
+	if metas, err := store.List(); err != nil || len(metas) != 1 || metas[0].ID != "s2" {
+		t.Errorf("List after Delete = %+v, %v", metas, err)
+	}
+}
+
+func testNoSharedMemory(t *testing.T, store session.SessionStore) {
+	m1 := message("m1", nil, "one")
+	entries := []*session.SessionEntry{m1}
+	if err := store.WriteEntries("s1", header("s1"), entries); err != nil {
+		t.Fatal(err)
+	}
+	m1.Summary = "changed after write"
+	entries[0] = message("other", nil, "other")
+
+	_, got, err := store.ReadEntries("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].ID != "m1" || got[0].Summary != "" {
+		t.Fatalf("stored entry changed with the caller's: %+v", got[0])
+	}
+	got[0].Summary = "changed after read"
+	if _, again, _ := store.ReadEntries("s1"); again[0].Summary != "" {
+		t.Errorf("stored entry changed with a returned one: %+v", again[0])
+	}
+
+	meta := &session.SessionMeta{ID: "s1", Name: "name"}
+	if err := store.PutMeta("s1", meta); err != nil {
+		t.Fatal(err)
+	}
+	meta.Name = "changed"
+	if got, err := store.GetMeta("s1"); err != nil || got.Name != "name" {
+		t.Errorf("stored meta changed with the caller's: %+v, %v", got, err)
+	}
+}
+
+// testManager drives a SessionManager over the store the way the agent does:
+// create, append, compact, reopen, fork, list and delete.
+func testManager(t *testing.T, store session.SessionStore) {
+	sm := session.NewSessionManagerWithStore(store)
+	sess, err := sm.CreateSession("main", "Main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sess.GetID()
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("before compaction")); err != nil {
+		t.Fatal(err)
+	}
+	kept := []agentctx.AgentMessage{agentctx.NewUserMessage("kept")}
+	if _, err := sess.AppendCompaction("summary", kept); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("after compaction")); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := sm.GetSession(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := texts(sess.GetMessages())
+	if got := texts(reopened.GetMessages()); !equalIDs(got, want) {
+		t.Errorf("reopened messages = %v, want %v", got, want)
+	}
+	if meta, err := sm.GetMeta(id); err != nil || meta.Name != "main" {
+		t.Errorf("meta = %+v, %v", meta, err)
+	}
+
+	fork, err := sm.ForkSessionFrom(reopened, nil, "fork", "Fork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metas, err := sm.ListSessions(); err != nil || len(metas) != 2 {
+		t.Fatalf("ListSessions = %+v, %v", metas, err)
+	}
+	if err := sm.DeleteSession(fork.GetID()); err != nil {
+		t.Fatal(err)
+	}
+	if metas, err := sm.ListSessions(); err != nil || len(metas) != 1 || metas[0].ID != id {
+		t.Errorf("ListSessions after delete = %+v, %v", metas, err)
+	}
+}
+
+func texts(messages []agentctx.AgentMessage) []string {
+	var out []string
+	for _, m := range messages {
+		out = append(out, m.ExtractText())
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+const (
+	// maxTitleRunes and maxTags bound what a model reply can put in a
+	// session's metadata.
+	maxTitleRunes = 80
+	maxTags       = 5
+	// titleTranscriptChars is how much of the conversation the model sees.
+	titleTranscriptChars = 6000
+	titleMessageChars    = 1500
+)
+
+const titlePrompt = `Give this coding-agent conversation a title and tags, so the user can find it again in a list of sessions.
+
+- The title names the task, in at most 8 words, in the language of the user. No quotes, no trailing period.
+- Up to 5 tags: short lowercase keywords such as the area of the code, language or tool.
+
+Reply with JSON only: {"title": "...", "tags": ["...", "..."]}`
+
+// SessionTitle is a generated title and tags for a session.
+type SessionTitle struct {
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+// GenerateTitle asks model for a title and tags describing the conversation
+// in messages, usually its first turn. The call's usage is returned even
+// when its reply cannot be parsed, so the caller can count its cost.
+func GenerateTitle(ctx context.Context, model llm.Model, apiKey string, messages []agentctx.AgentMessage) (*SessionTitle, llm.Usage, error) {
+	var usage llm.Usage
+	transcript := titleTranscript(messages)
+	if transcript == "" {
+		return nil, usage, fmt.Errorf("no conversation to title")
+	}
+	llmCtx := llm.LLMContext{
+		Messages: []llm.LLMMessage{{
+			Role:    "user",
+			Content: fmt.Sprintf("%s\n\n## Conversation\n%s", titlePrompt, transcript),
+		}},
+		ThinkingLevel: "off",
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	stream := llm.StreamLLM(ctx, model, llmCtx, apiKey, 30*time.Second)
+	var response strings.Builder
+	for event := range stream.Iterator(ctx) {
+		if event.Done {
+			break
+		}
+		switch e := event.Value.(type) {
+		case llm.LLMTextDeltaEvent:
+			response.WriteString(e.Delta)
+		case llm.LLMDoneEvent:
+			usage = e.Usage
+		case llm.LLMErrorEvent:
+			return nil, usage, e.Error
+		}
+	}
+	title, err := ParseTitle(response.String())
+	return title, usage, err
+}
+
+// ParseTitle reads the JSON object of a title reply, ignoring text around
+// it. The title is cut to one short line; tags are lowercased and deduped.
+func ParseTitle(reply string) (*SessionTitle, error) {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in title reply")
+	}
+	var raw SessionTitle
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("parse title reply: %w", err)
+	}
+	title := strings.Join(strings.Fields(raw.Title), " ")
+	title = strings.TrimSuffix(strings.Trim(title, `"'`), ".")
+	if runes := []rune(title); len(runes) > maxTitleRunes {
+		title = strings.TrimSpace(string(runes[:maxTitleRunes-1])) + "…"
+	}
+	if title == "" {
+		return nil, fmt.Errorf("empty title in title reply")
+	}
+	parsed := &SessionTitle{Title: title}
+	seen := make(map[string]bool)
+	for _, tag := range raw.Tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+		if tag == "" || seen[tag] || len(parsed.Tags) == maxTags {
+			continue
+		}
+		seen[tag] = true
+		parsed.Tags = append(parsed.Tags, tag)
+	}
+	return parsed, nil
+}
+
+// titleTranscript renders the user and assistant text of messages, oldest
+// first, up to titleTranscriptChars.
+func titleTranscript(messages []agentctx.AgentMessage) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		if (msg.Role != "user" && msg.Role != "assistant") || !msg.IsAgentVisible() {
+			continue
+		}
+		text := strings.TrimSpace(msg.ExtractText())
+		if text == "" {
+			continue
+		}
+		if runes := []rune(text); len(runes) > titleMessageChars {
+			text = string(runes[:titleMessageChars]) + "..."
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n%s", msg.Role, text)
+		if b.Len() >= titleTranscriptChars {
+			break
+		}
+	}
+	return b.String()
+}
+
+// IsTitled reports whether the session has a title of its own, given by
+// the user or generated, rather than the placeholder it was created with.
+func (m SessionMeta) IsTitled() bool {
+	title := strings.TrimSpace(m.Title)
+	switch title {
+	case "", "Session", "Default Session", m.ID, strings.TrimSpace(m.Name):
+		return false
+	}
+	return !autoNamePattern.MatchString(title)
+}
+
+// MatchSessions returns the sessions that query matches best, newest
+// first. From best to worst, a match is an equal title or name, one that
+// starts with query, one that contains it, a session whose title, name and
+// tags hold every word of query, and a title holding the letters of query
+// in order. Matching ignores case. More than one result means query is
+// ambiguous.
+func MatchSessions(sessions []SessionMeta, query string) []SessionMeta {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+	var best []SessionMeta
+	bestScore := 0
+	for _, m := range sessions {
+		score := matchScore(m, query)
+		if score == 0 || score < bestScore {
+			continue
+		}
+		if score > bestScore {
+			best, bestScore = nil, score
+		}
+		best = append(best, m)
+	}
+	sort.SliceStable(best, func(i, j int) bool { return best[i].UpdatedAt.After(best[j].UpdatedAt) })
+	return best
+}
+
+func matchScore(m SessionMeta, query string) int {
+	title := strings.ToLower(strings.TrimSpace(m.Title))
+	name := strings.ToLower(strings.TrimSpace(m.Name))
+	switch {
+	case title == query || name == query:
+		return 5
+	case strings.HasPrefix(title, query) || strings.HasPrefix(name, query):
+		return 4
+	case strings.Contains(title, query) || strings.Contains(name, query):
+		return 3
+	}
+	text := title + " " + name + " " + strings.ToLower(strings.Join(m.Tags, " "))
+	allWords := true
+	for _, word := range strings.Fields(query) {
+		if !strings.Contains(text, word) {
+			allWords = false
+			break
+		}
+	}
+	if allWords {
+		return 2
+	}
+	if isSubsequence(query, title) {
+		return 1
+	}
+	return 0
+}
+
+// isSubsequence reports whether the runes of sub appear in s in order.
+func isSubsequence(sub, s string) bool {
+	rest := []rune(sub)
+	for _, r := range s {
+		if len(rest) == 0 {
+			break
+		}
+		if r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
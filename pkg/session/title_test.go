@@ -0,0 +1,142 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/llm"
+)
+
+func TestParseTitle(t *testing.T) {
+	got, err := ParseTitle("Sure:\n```json\n{\"title\": \"  Fix the   login bug. \", \"tags\": [\"Auth\", \"go\", \"auth\", \"unit tests\", \"a\", \"b\", \"c\"]}\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Fix the login bug" {
+		t.Errorf("title = %q", got.Title)
+	}
+	if strings.Join(got.Tags, ",") != "auth,go,unit-tests,a,b" {
+		t.Errorf("tags = %v", got.Tags)
+	}
+
+	long, err := ParseTitle(`{"title": "` + strings.Repeat("word ", 40) + `"}`)
+	if err != nil || len([]rune(long.Title)) > maxTitleRunes {
+		t.Errorf("long title = %q, %v", long.Title, err)
+	}
+	for _, reply := range []string{"no json", `{"title": ""}`, `{"title": 3}`} {
+		if _, err := ParseTitle(reply); err == nil {
+			t.Errorf("ParseTitle(%q) succeeded", reply)
+		}
+	}
+}
+
+func TestGenerateTitle(t *testing.T) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body strings.Builder
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Body.Read(buf)
+			body.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		prompt = body.String()
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"x","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"{\"title\": \"Fix the login bug\", \"tags\": [\"auth\"]}"},"finish_reason":null}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"x","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":1000,"completion_tokens":20,"total_tokens":1020}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	model := llm.Model{ID: "small", Provider: "p", BaseURL: server.URL, API: "openai"}
+	messages := []agentctx.AgentMessage{
+		agentctx.NewUserMessage("login fails with a 500"),
+		agentctx.NewAssistantMessage(),
+	}
+	title, usage, err := GenerateTitle(context.Background(), model, "k", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.InputTokens != 1000 || usage.OutputTokens != 20 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if title.Title != "Fix the login bug" || len(title.Tags) != 1 {
+		t.Errorf("title = %+v", title)
+	}
+	if !strings.Contains(prompt, "login fails with a 500") {
+		t.Errorf("prompt lacks the conversation: %s", prompt)
+	}
+
+	if _, _, err := GenerateTitle(context.Background(), model, "k", nil); err == nil {
+		t.Error("GenerateTitle without messages succeeded")
+	}
+}
+
+func TestSessionTitleAndTags(t *testing.T) {
+	sm := NewSessionManager(filepath.Join(t.TempDir(), "--proj--"))
+	sess, err := sm.CreateSession("20260101-120000", "20260101-120000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := sm.GetMeta(sess.GetID())
+	if err != nil || meta.IsTitled() {
+		t.Fatalf("new session titled: %+v, %v", meta, err)
+	}
+
+	if _, err := sess.AppendSessionInfo("", "Fix the login bug", "auth", "go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetSessionTitle(sess.GetID(), "Fix the login bug", []string{"auth", "go"}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSession(sess.GetDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GetSessionName() != "20260101-120000" || loaded.GetSessionTitle() != "Fix the login bug" || len(loaded.GetSessionTags()) != 2 {
+		t.Errorf("name %q, title %q, tags %v", loaded.GetSessionName(), loaded.GetSessionTitle(), loaded.GetSessionTags())
+	}
+	meta, err = sm.GetMeta(sess.GetID())
+	if err != nil || !meta.IsTitled() || meta.IsNamed() || len(meta.Tags) != 2 {
+		t.Errorf("meta = %+v, %v", meta, err)
+	}
+}
+
+func TestMatchSessions(t *testing.T) {
+	now := time.Now()
+	sessions := []SessionMeta{
+		{ID: "a", Name: "20260101-120000", Title: "Fix the login bug", Tags: []string{"auth"}, UpdatedAt: now.Add(-time.Hour)},
+		{ID: "b", Name: "release", Title: "Prepare the release notes", Tags: []string{"docs"}, UpdatedAt: now},
+		{ID: "c", Name: "20260102-120000", Title: "Login page styling", Tags: []string{"css"}, UpdatedAt: now.Add(-2 * time.Hour)},
+	}
+	ids := func(metas []SessionMeta) string {
+		var out []string
+		for _, m := range metas {
+			out = append(out, m.ID)
+		}
+		return strings.Join(out, ",")
+	}
+	for _, tt := range []struct{ query, want string }{
+		{"fix the login bug", "a"},
+		{"RELEASE", "b"},
+		{"login", "c"},      // a title starting with the query beats one containing it
+		{"bug fix", "a"},    // every word, in any order
+		{"auth login", "a"}, // words may come from tags
+		{"prprel", "b"},     // letters in order
+		{"the", "b,a"},      // ambiguous: newest first
+		{"kubernetes", ""},
+	} {
+		if got := ids(MatchSessions(sessions, tt.query)); got != tt.want {
+			t.Errorf("MatchSessions(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
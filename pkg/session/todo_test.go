@@ -0,0 +1,59 @@
+package session
+
+import (
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func TestSessionTodos_SurviveCompactionAndReload(t *testing.T) {
+	dir := t.TempDir()
+	sess := NewSession(dir)
+
+	if got := sess.GetTodos(); got != nil {
+		t.Fatalf("expected no todos on a new session, got %v", got)
+	}
+
+	todos := []agentctx.TodoItem{
+		{ID: "1", Content: "write parser", Status: agentctx.TodoStatusCompleted},
+		{ID: "2", Content: "add tests", Status: agentctx.TodoStatusInProgress},
+	}
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("start")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.AppendTodos(todos); err != nil {
+		t.Fatalf("AppendTodos: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := sess.AppendMessage(agentctx.NewUserMessage("work")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := sess.AppendCompaction("summary", []agentctx.AgentMessage{agentctx.NewUserMessage("[summary]")}); err != nil {
+		t.Fatalf("AppendCompaction: %v", err)
+	}
+	if got := sess.GetTodos(); len(got) != 2 || got[1].Status != agentctx.TodoStatusInProgress {
+		t.Fatalf("todos after compaction = %v", got)
+	}
+
+	reloaded, err := LoadSession(dir)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	got := reloaded.GetTodos()
+	if len(got) != 2 || got[0].Content != "write parser" {
+		t.Fatalf("todos after reload = %v", got)
+	}
+	if msgs := reloaded.GetMessages(); len(msgs) != 1 {
+		t.Fatalf("todo entries leaked into messages: got %d messages", len(msgs))
+	}
+
+	// Clearing the list is persisted too.
+	if _, err := reloaded.AppendTodos(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.GetTodos(); len(got) != 0 {
+		t.Fatalf("expected cleared todos, got %v", got)
+	}
+}
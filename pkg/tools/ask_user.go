@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// UserQuestion is a question the ask_user tool is waiting on.
+type UserQuestion struct {
+	ID             string   `json:"id"`
+	ToolCallID     string   `json:"toolCallId,omitempty"`
+	Question       string   `json:"question"`
+	Options        []string `json:"options,omitempty"`
+	TimeoutSeconds int      `json:"timeoutSeconds,omitempty"`
+}
+
+type pendingQuestion struct {
+	question UserQuestion
+	answer   chan string
+}
+
+// AskUserTool lets the model ask the user a question mid-turn. The tool call
+// blocks until Answer is called, the timeout expires (the fallback answer is
+// returned) or the run is cancelled.
+type AskUserTool struct {
+	mu       sync.Mutex
+	pending  []*pendingQuestion
+	nextID   int
+	timeout  time.Duration
+	fallback string
+	onAsk    func(q UserQuestion)
+}
+
+// NewAskUserTool creates a new ask_user tool. timeout <= 0 waits indefinitely.
+// onAsk is called for every new question so the host can notify the user.
+func NewAskUserTool(timeout time.Duration, fallback string, onAsk func(q UserQuestion)) *AskUserTool {
+	return &AskUserTool{
+		timeout:  timeout,
+		fallback: fallback,
+		onAsk:    onAsk,
+	}
+}
+
+// Name returns the tool name.
+func (t *AskUserTool) Name() string {
+	return "ask_user"
+}
+
+// Description returns the tool description.
+func (t *AskUserTool) Description() string {
+	return "Ask the user a clarifying question and wait for the answer without ending your turn. Use only when a decision genuinely needs the user; offer options when the choices are known. If nobody answers in time you get a fallback instruction instead."
+}
+
+// Parameters returns the JSON Schema for the tool parameters.
+func (t *AskUserTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"question": map[string]any{
+				"type":        "string",
+				"description": "The question to ask",
+			},
+			"options": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Optional multiple-choice answers; the user may still answer freely",
+			},
+		},
+		"required": []string{"question"},
+	}
+}
+
+// Execute asks the question and blocks until it is answered.
+func (t *AskUserTool) Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error) {
+	question, _ := args["question"].(string)
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, fmt.Errorf("question is required")
+	}
+
+	p := t.register(UserQuestion{
+		ToolCallID:     agentctx.ToolExecutionCallID(ctx),
+		Question:       question,
+		Options:        todoStringList(args["options"]),
+		TimeoutSeconds: int(t.timeout / time.Second),
+	})
+	defer t.remove(p.question.ID)
+
+	if t.onAsk != nil {
+		t.onAsk(p.question)
+	}
+
+	var timeout <-chan time.Time
+	if t.timeout > 0 {
+		timer := time.NewTimer(t.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var text string
+	select {
+	case answer := <-p.answer:
+		text = "User answered: " + answer
+	case <-timeout:
+		text = fmt.Sprintf("No answer from the user within %s. %s", t.timeout, t.fallback)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return []agentctx.ContentBlock{
+		agentctx.TextContent{Type: "text", Text: strings.TrimSpace(text)},
+	}, nil
+}
+
+// Answer delivers answer to the pending question with the given id, or to
+// the oldest pending question when id is empty. A numeric answer selects the
+// matching option (1-based) when the question has options.
+func (t *AskUserTool) Answer(id, answer string) (UserQuestion, error) {
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return UserQuestion{}, fmt.Errorf("empty answer")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var p *pendingQuestion
+	for _, candidate := range t.pending {
+		if id == "" || candidate.question.ID == id {
+			p = candidate
+			break
+		}
+	}
+	if p == nil {
+		if id == "" {
+			return UserQuestion{}, fmt.Errorf("no pending question")
+		}
+		return UserQuestion{}, fmt.Errorf("no pending question %q", id)
+	}
+
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(p.question.Options) {
+		answer = p.question.Options[n-1]
+	}
+	select {
+	case p.answer <- answer:
+	default:
+		return UserQuestion{}, fmt.Errorf("question %q is already answered", p.question.ID)
+	}
+	return p.question, nil
+}
+
+// Pending returns the questions currently waiting for an answer, oldest first.
+func (t *AskUserTool) Pending() []UserQuestion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]UserQuestion, 0, len(t.pending))
+	for _, p := range t.pending {
+		out = append(out, p.question)
+	}
+	return out
+}
+
+func (t *AskUserTool) register(q UserQuestion) *pendingQuestion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	q.ID = "q" + strconv.Itoa(t.nextID)
+	p := &pendingQuestion{question: q, answer: make(chan string, 1)}
+	t.pending = append(t.pending, p)
+	return p
+}
+
+func (t *AskUserTool) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, p := range t.pending {
+		if p.question.ID == id {
+			t.pending = append(t.pending[:i], t.pending[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+type askResult struct {
+	text string
+	err  error
+}
+
+func askAsync(tool *AskUserTool, ctx context.Context, args map[string]any) <-chan askResult {
+	done := make(chan askResult, 1)
+	go func() {
+		result, err := tool.Execute(ctx, args)
+		if err != nil {
+			done <- askResult{err: err}
+			return
+		}
+		done <- askResult{text: result[0].(agentctx.TextContent).Text}
+	}()
+	return done
+}
+
+func TestAskUserTool_AnswerSelectsOption(t *testing.T) {
+	asked := make(chan UserQuestion, 1)
+	tool := NewAskUserTool(time.Minute, "fallback", func(q UserQuestion) { asked <- q })
+
+	ctx := agentctx.WithToolExecutionCallID(context.Background(), "call-1")
+	done := askAsync(tool, ctx, map[string]any{
+		"question": "Which database?",
+		"options":  []any{"postgres", "sqlite"},
+	})
+
+	q := <-asked
+	if q.ID != "q1" || q.ToolCallID != "call-1" || len(q.Options) != 2 || q.TimeoutSeconds != 60 {
+		t.Fatalf("unexpected question: %+v", q)
+	}
+	if pending := tool.Pending(); len(pending) != 1 || pending[0].ID != "q1" {
+		t.Fatalf("unexpected pending: %+v", pending)
+	}
+
+	if _, err := tool.Answer("q9", "x"); err == nil {
+		t.Fatal("expected error for unknown question id")
+	}
+	if _, err := tool.Answer("", "2"); err != nil {
+		t.Fatalf("Answer error: %v", err)
+	}
+
+	res := <-done
+	if res.err != nil || res.text != "User answered: sqlite" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if len(tool.Pending()) != 0 {
+		t.Fatal("question should be removed once answered")
+	}
+	if _, err := tool.Answer("", "late"); err == nil {
+		t.Fatal("expected error without pending question")
+	}
+}
+
+func TestAskUserTool_TimeoutReturnsFallback(t *testing.T) {
+	tool := NewAskUserTool(10*time.Millisecond, "Proceed with your best judgement.", nil)
+	res := <-askAsync(tool, context.Background(), map[string]any{"question": "Rename the package?"})
+	if res.err != nil {
+		t.Fatalf("Execute error: %v", res.err)
+	}
+	if !strings.Contains(res.text, "No answer") || !strings.HasSuffix(res.text, "Proceed with your best judgement.") {
+		t.Fatalf("unexpected fallback result: %q", res.text)
+	}
+}
+
+func TestAskUserTool_CancelAndValidation(t *testing.T) {
+	asked := make(chan UserQuestion, 1)
+	tool := NewAskUserTool(0, "", func(q UserQuestion) { asked <- q })
+
+	if _, err := tool.Execute(context.Background(), map[string]any{"question": "  "}); err == nil {
+		t.Fatal("expected error without question")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := askAsync(tool, ctx, map[string]any{"question": "Continue?"})
+	<-asked
+	cancel()
+	if res := <-done; !errors.Is(res.err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %+v", res)
+	}
+	if len(tool.Pending()) != 0 {
+		t.Fatal("cancelled question should not stay pending")
+	}
+}
@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+// TodoTool maintains the agent's task list in AgentState.Todos.
+// The list lives outside the conversation so it survives compaction;
+// setTodos lets the host store it under its own lock, and onChange lets the
+// host persist every modification.
+type TodoTool struct {
+	mu       sync.Mutex
+	setTodos func(todos []agentctx.TodoItem)
+	onChange func(todos []agentctx.TodoItem)
+}
+
+// NewTodoTool creates a new todo tool. setTodos replaces the list on the
+// agent state; when nil, the tool assigns AgentState.Todos itself, which is
+// only safe while nothing else reads the state. onChange may be nil; when
+// set it is called with a copy of the list after every add or update.
+func NewTodoTool(setTodos, onChange func(todos []agentctx.TodoItem)) *TodoTool {
+	return &TodoTool{setTodos: setTodos, onChange: onChange}
+}
+
+// Name returns the tool name.
+func (t *TodoTool) Name() string {
+	return "todo"
+}
+
+// Description returns the tool description.
+func (t *TodoTool) Description() string {
+	return "Track subtasks of a long task. action=add appends items (status pending), action=update changes an item's status (pending, in_progress, completed, cancelled) or content by id, action=list shows the list. The list is kept across context compaction, so use it instead of remembering the plan in conversation."
+}
+
+// Parameters returns the JSON Schema for the tool parameters.
+func (t *TodoTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []string{"add", "update", "list"},
+				"description": "Operation to perform",
+			},
+			"items": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Item descriptions to add (action=add)",
+			},
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Item id to update (action=update)",
+			},
+			"status": map[string]any{
+				"type":        "string",
+				"enum":        []string{agentctx.TodoStatusPending, agentctx.TodoStatusInProgress, agentctx.TodoStatusCompleted, agentctx.TodoStatusCancelled},
+				"description": "New status (action=update)",
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "New item description (action=update), or a single item to add (action=add)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// Execute applies the requested action and returns the resulting list.
+func (t *TodoTool) Execute(ctx context.Context, args map[string]any) ([]agentctx.ContentBlock, error) {
+	agentCtx := agentctx.ToolExecutionAgentContext(ctx)
+	if agentCtx == nil || agentCtx.AgentState == nil {
+		return nil, fmt.Errorf("todo tool requires an active agent context")
+	}
+
+	action, _ := args["action"].(string)
+	action = strings.ToLower(strings.TrimSpace(action))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := agentCtx.AgentState
+	switch action {
+	case "add":
+		items := todoStringList(args["items"])
+		if content, _ := args["content"].(string); strings.TrimSpace(content) != "" {
+			items = append(items, strings.TrimSpace(content))
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("add requires items or content")
+		}
+		todos := agentctx.CloneTodos(state.Todos)
+		next := nextTodoID(todos)
+		for _, content := range items {
+			todos = append(todos, agentctx.TodoItem{
+				ID:      strconv.Itoa(next),
+				Content: content,
+				Status:  agentctx.TodoStatusPending,
+			})
+			next++
+		}
+		t.commit(state, todos)
+	case "update":
+		id := strings.TrimSpace(fmt.Sprint(args["id"]))
+		if id == "" || id == "<nil>" {
+			return nil, fmt.Errorf("update requires id")
+		}
+		status, _ := args["status"].(string)
+		status = strings.ToLower(strings.TrimSpace(status))
+		content, _ := args["content"].(string)
+		content = strings.TrimSpace(content)
+		if status == "" && content == "" {
+			return nil, fmt.Errorf("update requires status or content")
+		}
+		if status != "" && !agentctx.IsValidTodoStatus(status) {
+			return nil, fmt.Errorf("invalid status %q", status)
+		}
+		todos := agentctx.CloneTodos(state.Todos)
+		found := false
+		for i := range todos {
+			if todos[i].ID != id {
+				continue
+			}
+			if status != "" {
+				todos[i].Status = status
+			}
+			if content != "" {
+				todos[i].Content = content
+			}
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("todo item %q not found", id)
+		}
+		t.commit(state, todos)
+	case "list":
+	default:
+		return nil, fmt.Errorf("unknown action %q (want add, update or list)", action)
+	}
+
+	return []agentctx.ContentBlock{
+		agentctx.TextContent{Type: "text", Text: formatTodoResult(state.Todos)},
+	}, nil
+}
+
+// commit stores todos on the agent state and notifies the host.
+// Must be called with t.mu held.
+func (t *TodoTool) commit(state *agentctx.AgentState, todos []agentctx.TodoItem) {
+	if t.setTodos != nil {
+		t.setTodos(agentctx.CloneTodos(todos))
+	} else {
+		state.Todos = todos
+	}
+	if t.onChange != nil {
+		t.onChange(agentctx.CloneTodos(todos))
+	}
+}
+
+func formatTodoResult(todos []agentctx.TodoItem) string {
+	if len(todos) == 0 {
+		return "Todo list is empty."
+	}
+	done, total := agentctx.TodoCounts(todos)
+	return fmt.Sprintf("Todo list (%d/%d done):\n%s", done, total, agentctx.FormatTodoList(todos))
+}
+
+// nextTodoID returns one more than the largest numeric id in todos.
+func nextTodoID(todos []agentctx.TodoItem) int {
+	maxID := 0
+	for _, item := range todos {
+		if n, err := strconv.Atoi(item.ID); err == nil && n > maxID {
+			maxID = n
+		}
+	}
+	return maxID + 1
+}
+
+// todoStringList accepts a JSON array, a []string, or a JSON-encoded string
+// array (some models stringify array arguments) and returns trimmed entries.
+func todoStringList(v any) []string {
+	var raw []any
+	switch val := v.(type) {
+	case []any:
+		raw = val
+	case []string:
+		for _, s := range val {
+			raw = append(raw, s)
+		}
+	case string:
+		trimmed := strings.TrimSpace(val)
+		if strings.HasPrefix(trimmed, "[") {
+			_ = json.Unmarshal([]byte(trimmed), &raw)
+		} else if trimmed != "" {
+			raw = []any{trimmed}
+		}
+	}
+	out := make([]string, 0, len(raw))
+	for _, item := range raw {
+		s, ok := item.(string)
+		if !ok {
+			continue
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
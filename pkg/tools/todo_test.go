@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+)
+
+func runTodo(t *testing.T, tool *TodoTool, ctx context.Context, args map[string]any) string {
+	t.Helper()
+	result, err := tool.Execute(ctx, args)
+	if err != nil {
+		t.Fatalf("Execute(%v) error: %v", args, err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("expected one content block, got %d", len(result))
+	}
+	return result[0].(agentctx.TextContent).Text
+}
+
+func TestTodoTool_AddUpdateList(t *testing.T) {
+	agentCtx := agentctx.NewAgentContext("sys")
+	ctx := agentctx.WithToolExecutionAgentContext(context.Background(), agentCtx)
+
+	var persisted [][]agentctx.TodoItem
+	tool := NewTodoTool(nil, func(todos []agentctx.TodoItem) {
+		persisted = append(persisted, todos)
+	})
+
+	text := runTodo(t, tool, ctx, map[string]any{
+		"action": "add",
+		"items":  []any{"write parser", "add tests"},
+	})
+	if !strings.Contains(text, "(0/2 done)") || !strings.Contains(text, "[ ] 2. add tests") {
+		t.Fatalf("unexpected add result: %q", text)
+	}
+
+	text = runTodo(t, tool, ctx, map[string]any{"action": "update", "id": "1", "status": "completed"})
+	if !strings.Contains(text, "(1/2 done)") || !strings.Contains(text, "[x] 1. write parser") {
+		t.Fatalf("unexpected update result: %q", text)
+	}
+
+	// Items added later continue the id sequence.
+	runTodo(t, tool, ctx, map[string]any{"action": "add", "content": "update docs"})
+	if got := agentCtx.AgentState.Todos[2].ID; got != "3" {
+		t.Fatalf("third item id = %q, want 3", got)
+	}
+
+	text = runTodo(t, tool, ctx, map[string]any{"action": "list"})
+	if !strings.Contains(text, "(1/3 done)") {
+		t.Fatalf("unexpected list result: %q", text)
+	}
+
+	if len(persisted) != 3 {
+		t.Fatalf("onChange called %d times, want 3 (list must not persist)", len(persisted))
+	}
+	persisted[2][0].Status = agentctx.TodoStatusPending
+	if agentCtx.AgentState.Todos[0].Status != agentctx.TodoStatusCompleted {
+		t.Fatal("onChange received a list sharing storage with the agent state")
+	}
+}
+
+func TestTodoTool_Errors(t *testing.T) {
+	agentCtx := agentctx.NewAgentContext("sys")
+	ctx := agentctx.WithToolExecutionAgentContext(context.Background(), agentCtx)
+	tool := NewTodoTool(nil, nil)
+	runTodo(t, tool, ctx, map[string]any{"action": "add", "items": `["one"]`})
+
+	tests := []struct {
+		name string
+		args map[string]any
+	}{
+		{name: "unknown action", args: map[string]any{"action": "remove"}},
+		{name: "add without items", args: map[string]any{"action": "add"}},
+		{name: "update without id", args: map[string]any{"action": "update", "status": "completed"}},
+		{name: "update without change", args: map[string]any{"action": "update", "id": "1"}},
+		{name: "invalid status", args: map[string]any{"action": "update", "id": "1", "status": "done"}},
+		{name: "missing id", args: map[string]any{"action": "update", "id": "9", "status": "completed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tool.Execute(ctx, tt.args); err == nil {
+				t.Fatalf("expected error for %v", tt.args)
+			}
+		})
+	}
+
+	if _, err := tool.Execute(context.Background(), map[string]any{"action": "list"}); err == nil {
+		t.Fatal("expected error without agent context")
+	}
+}
+
+func TestTodoTool_SetTodos(t *testing.T) {
+	agentCtx := agentctx.NewAgentContext("sys")
+	ctx := agentctx.WithToolExecutionAgentContext(context.Background(), agentCtx)
+
+	// The host owns the lock around the agent state.
+	var mu sync.Mutex
+	calls := 0
+	tool := NewTodoTool(func(todos []agentctx.TodoItem) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		agentCtx.AgentState.Todos = todos
+	}, nil)
+
+	runTodo(t, tool, ctx, map[string]any{"action": "add", "items": []any{"one", "two"}})
+	text := runTodo(t, tool, ctx, map[string]any{"action": "update", "id": "2", "status": "completed"})
+	if calls != 2 || !strings.Contains(text, "(1/2 done)") {
+		t.Fatalf("setTodos called %d times, result %q", calls, text)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/tiancaiamao/ai/pkg/session"
 	tui "github.com/tiancaiamao/ai/subcommand/run/tui"
 )
 
@@ -24,6 +25,7 @@ func LsSubcommand() {
 		os.Exit(1)
 	}
 	runsDir := filepath.Join(home, ".ai", "runs")
+	sessions := heldSessions(filepath.Join(home, ".ai", "sessions"))
 
 	entries, err := os.ReadDir(runsDir)
 	if err != nil {
@@ -73,27 +75,46 @@ func LsSubcommand() {
 	})
 
 	if *jsonFlag {
-		emitJSON(runs)
+		emitJSON(runs, sessions)
 	} else {
-		emitTable(runs)
+		emitTable(runs, sessions)
 	}
 }
 
+// heldSessions maps run IDs to the session each run holds.
+func heldSessions(sessionsRoot string) map[string]session.HeldSession {
+	held, err := session.ListHeldSessions(sessionsRoot)
+	if err != nil {
+		return nil
+	}
+	byRun := make(map[string]session.HeldSession, len(held))
+	for _, h := range held {
+		if h.Owner.RunID != "" {
+			byRun[h.Owner.RunID] = h
+		}
+	}
+	return byRun
+}
+
 // lsRunEntry is the JSON output structure with added fields.
 type lsRunEntry struct {
 	tui.RunMeta
-	Age    string            `json:"age"`
-	Status string            `json:"status"` // overridden: includes "idle" for completed-prompt agents
-	End    *tui.AgentEndInfo `json:"end,omitempty"`
+	Age     string            `json:"age"`
+	Status  string            `json:"status"`                 // overridden: includes "idle" for completed-prompt agents
+	Session string            `json:"session,omitempty"`      // ID of the session the run holds
+	Title   string            `json:"sessionTitle,omitempty"` // its title, if it has one
+	End     *tui.AgentEndInfo `json:"end,omitempty"`
 }
 
-func emitJSON(runs []tui.RunMeta) {
+func emitJSON(runs []tui.RunMeta, sessions map[string]session.HeldSession) {
 	entries := make([]lsRunEntry, len(runs))
 	for i, r := range runs {
 		entry := lsRunEntry{
 			RunMeta: r,
 			Age:     formatAge(r.StartedAt),
 			Status:  r.Status,
+			Session: sessions[r.ID].ID,
+			Title:   sessions[r.ID].Title,
 		}
 
 		// For running agents, check if they've completed at least one prompt.
@@ -119,13 +140,13 @@ func emitJSON(runs []tui.RunMeta) {
 	fmt.Println(string(data))
 }
 
-func emitTable(runs []tui.RunMeta) {
+func emitTable(runs []tui.RunMeta, sessions map[string]session.HeldSession) {
 	if len(runs) == 0 {
 		return
 	}
 
 	// Header
-	fmt.Printf("%-10s  %-12s  %-30s  %s\n", "ID", "STATUS", "NAME", "AGE")
+	fmt.Printf("%-10s  %-12s  %-30s  %-8s  %s\n", "ID", "STATUS", "NAME", "AGE", "SESSION")
 
 	for _, r := range runs {
 		id := r.ID
@@ -153,7 +174,15 @@ func emitTable(runs []tui.RunMeta) {
 
 		age := formatAge(r.StartedAt)
 
-		fmt.Printf("%-10s  %-12s  %-30s  %s\n", id, coloredStatus, name, age)
+		sess := sessions[r.ID].ID
+		if title := sessions[r.ID].Title; title != "" {
+			sess += "  " + title
+		}
+		if sess == "" {
+			sess = "-"
+		}
+
+		fmt.Printf("%-10s  %-12s  %-30s  %-8s  %s\n", id, coloredStatus, name, age, sess)
 	}
 }
 
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/tiancaiamao/ai/pkg/session"
 	tui "github.com/tiancaiamao/ai/subcommand/run/tui"
 )
 
@@ -130,7 +132,7 @@ func TestEmitJSON(t *testing.T) {
 		},
 	}
 
-	emitJSON(runs)
+	emitJSON(runs, map[string]session.HeldSession{"test1": {ID: "sess-1", Title: "Fix the login bug"}})
 
 	// Restore stdout and read captured output
 	w.Close()
@@ -156,6 +158,12 @@ func TestEmitJSON(t *testing.T) {
 	if entries[1].ID != "test2" {
 		t.Errorf("expected ID test2, got %s", entries[1].ID)
 	}
+	if entries[0].Session != "sess-1" || entries[1].Session != "" {
+		t.Errorf("sessions = %q, %q", entries[0].Session, entries[1].Session)
+	}
+	if entries[0].Title != "Fix the login bug" {
+		t.Errorf("session title = %q", entries[0].Title)
+	}
 }
 
 func TestEmitTable(t *testing.T) {
@@ -182,7 +190,7 @@ func TestEmitTable(t *testing.T) {
 		},
 	}
 
-	emitTable(runs)
+	emitTable(runs, map[string]session.HeldSession{"test1": {ID: "sess-1", Title: "Fix the login bug"}})
 
 	// Restore stdout and read captured output
 	w.Close()
@@ -201,11 +209,14 @@ func TestEmitTable(t *testing.T) {
 	if !contains(output, "test1") || !contains(output, "test2") {
 		t.Errorf("output should contain run IDs\nGot:\n%s", output)
 	}
+	if !contains(output, "SESSION") || !contains(output, "sess-1") || !contains(output, "Fix the login bug") {
+		t.Errorf("output should show held sessions\nGot:\n%s", output)
+	}
 
 	// Empty list should produce no output
 	r2, w2, _ := os.Pipe()
 	os.Stdout = w2
-	emitTable([]tui.RunMeta{})
+	emitTable([]tui.RunMeta{}, nil)
 	w2.Close()
 	os.Stdout = oldStdout
 
@@ -225,3 +236,29 @@ func contains(s, substr string) bool {
 	}
 	return false
 }
+
+func TestHeldSessions(t *testing.T) {
+	root := t.TempDir()
+	sm := session.NewSessionManager(filepath.Join(root, "--proj--"))
+	var want string
+	for _, runID := range []string{"run1", "", "run2"} {
+		sess, err := sm.CreateSession("s-"+runID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runID == "run2" {
+			// Not held: its run has exited.
+			continue
+		}
+		if err := sess.Lock(session.NewSessionOwner(runID), false); err != nil {
+			t.Fatal(err)
+		}
+		defer sess.Unlock()
+		if runID == "run1" {
+			want = sess.GetID()
+		}
+	}
+	if got := heldSessions(root); len(got) != 1 || got["run1"].ID != want {
+		t.Errorf("heldSessions = %v, want run1 -> %s", got, want)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/tiancaiamao/ai/pkg/rpc"
+	"github.com/tiancaiamao/ai/pkg/session"
 	"github.com/tiancaiamao/ai/subcommand/helpers"
 )
 
@@ -22,6 +23,9 @@ func RPCSubcommand() {
 	roleFlag := fs.String("role", "", "Agent role name (e.g. coder, orchestrator, validator). Loads ~/.ai/roles/<name>/agent.yaml")
 	modelFlag := fs.String("model", "", `Override LLM model ID. Use "provider/id" for exact match (e.g. opencode/deepseek-v4-flash). Run "ai models" to list available options.`)
 	runidFlag := fs.String("runid", "", "Run ID from parent ai serve process (used for subagent tracking)")
+	readOnlyFlag := fs.Bool("read-only", false, "Open the session without writing to it (e.g. while another process holds it)")
+	forceTakeoverFlag := fs.Bool("force-takeover", false, "Take the session over from the process holding it; that process turns read-only")
+	ephemeralFlag := fs.Bool("ephemeral", false, "Keep the session in memory only; nothing is written under ~/.ai/sessions")
 	fs.Parse(os.Args[1:])
 
 	// Setup signal handling for graceful shutdown.
@@ -42,7 +46,11 @@ func RPCSubcommand() {
 
 	// Use fmt.Fprintf for startup errors because slog writes to io.Discard
 	// during initialization (see logger.NewLogger).
-	if err := rpc.RunRPC(*sessionPathFlag, *debugAddr, os.Stdin, os.Stdout, systemPrompt, *maxTurnsFlag, *timeoutFlag, *roleFlag, *modelFlag, *runidFlag); err != nil {
+	var store session.SessionStore
+	if *ephemeralFlag {
+		store = session.NewMemoryStore()
+	}
+	if err := rpc.RunRPCWithStore(store, *sessionPathFlag, *debugAddr, os.Stdin, os.Stdout, systemPrompt, *maxTurnsFlag, *timeoutFlag, *roleFlag, *modelFlag, *runidFlag, *readOnlyFlag, *forceTakeoverFlag); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
@@ -64,6 +72,8 @@ Subcommands:
   watch           Attach to a running serve instance (TUI)
   send            Send a message to a running serve instance
   kill            Stop a running agent instance
+  session         Export, import, search, clean up, check or share sessions (ai session export|import|search|gc|fsck|pack|unpack; also 'ai sessions')
+  export          Export a session (same as 'ai session export')
 
 Flags for 'run':
   --session <path>         Session file path
@@ -73,6 +83,8 @@ Flags for 'run':
   --timeout <duration>     Total execution timeout (0 = unlimited)
   --input <text>           Initial prompt to send after startup
   --model <id>             Override LLM model ID. Use "provider/id" for exact match (e.g. opencode/deepseek-v4-flash). Run "ai models" to list available options.
+  --read-only              Open the session without writing to it
+  --force-takeover         Take the session over from the run holding it
 
 Flags for 'serve':
   --session <path>         Session file path
@@ -86,6 +98,8 @@ Flags for 'serve':
   --name <text>            Human-readable name for the run
   --id-file <path>         Write run ID to this file after startup
   --model <id>             Override LLM model ID. Use "provider/id" for exact match (e.g. opencode/deepseek-v4-flash). Run "ai models" to list available options.
+  --read-only              Open the session without writing to it
+  --force-takeover         Take the session over from the run holding it
 
 Flags for 'rpc':
   --session <path>         Session file path
@@ -95,6 +109,9 @@ Flags for 'rpc':
   --timeout <duration>     Total execution timeout (0 = unlimited)
   --http <addr>            Enable HTTP debug server (e.g., ':6060')
     --model <id>             Override LLM model ID. Use "provider/id" for exact match (e.g. opencode/deepseek-v4-flash). Run "ai models" to list available options.
+  --read-only              Open the session without writing to it
+  --force-takeover         Take the session over from the run holding it
+  --ephemeral              Keep the session in memory only (nothing written to ~/.ai/sessions)
 
 Flags for 'ls':
   --all                    Include finished runs
@@ -117,6 +134,49 @@ Flags for 'kill':
   --id <run-id>            Run ID or prefix (auto-selects by cwd if omitted)
   --force                  Send SIGKILL instead of graceful abort
 
+Flags for 'session export' (and 'export'):
+  --session <dir|id>       Session directory or ID (required)
+  --format <name>          html, md, json, openai, anthropic or sharegpt (default: from -o extension, else html)
+  --leaf <entry-id>        Export the branch ending at this entry (default: current leaf)
+  -o, --output <path>      Output file (default: stdout)
+
+Flags for 'session import <file|->':
+  --format <name>          auto, openai, anthropic, sharegpt or json (an exported transcript; default auto)
+  --name <text>            Session name (default: transcript name or file name)
+
+Flags for 'session search <terms>' (terms AND together; 'foo*' matches a prefix):
+  --cwd <dir>              Only sessions started in this directory or below
+  --since <date>           Only entries at or after: YYYY-MM-DD, RFC 3339 or an age like 7d
+  --until <date>           Only entries before this time
+  --role <role>            user, assistant, tool or compaction
+  --tool <name>            Only entries calling or reporting this tool
+  --limit <n>              Maximum hits (default 20)
+  --json                   JSON output
+  --reindex                Rebuild the search indexes first
+
+Flags for 'session gc' (defaults from "retention" in config.json):
+  --dry-run                Show what would be removed without removing it
+  --max-age <age>          Remove sessions and finished runs older than this: 30d, 12h
+  --max-size <size>        Then remove the oldest sessions until all fit: 500MB, 2GB
+  --keep-named             Keep sessions with a user-given name (default true)
+  --keep-forked            Keep sessions that other sessions were forked from (default true)
+  --archive-max-age <age>  Remove compaction archives older than this
+  --json                   JSON output
+
+Flags for 'session fsck [<dir|id>...]' (default: every session of this project):
+  --repair                 Apply safe repairs; messages.jsonl is backed up first
+  --all                    Check the sessions of every project
+  --json                   JSON output
+
+Flags for 'session pack <dir|id>' (session, compactions, traces, runs and redacted config in one .tar.gz):
+  -o <file>                Output file, or - for stdout (default: session-<id>.tar.gz)
+  --run <id>               Also include this run (repeatable)
+  --no-config              Leave out the redacted config
+
+Flags for 'session unpack <file|->':
+  --cwd <dir>              Project directory to resume the session in (default: the working directory)
+  --keep-paths             Do not rewrite the bundle's cwd paths
+
 Examples:
   ai run                          Start agent with interactive TUI
   ai run --input "fix the bug"    Start with an initial prompt
@@ -125,6 +185,7 @@ Examples:
   ai rpc                          Start raw JSON-RPC on stdin/stdout
   ai ls                           List running agents
   ai ls --all                     Include finished runs
+  ai run --session <dir> --read-only  Look at a session another run holds
   ai models                       List available models
   ai models deepseek               Search models by keyword
   ai send "hello"                 Send message to agent in current directory
@@ -135,5 +196,13 @@ Examples:
   ai kill                         Stop agent in current directory
   ai kill --id abc123             Stop specific run by ID
   ai kill --force                 Force kill (SIGKILL)
+  ai export --session <id> -o s.html  Export a session as HTML
+  ai session export --session <id> --format openai -o t.jsonl
+  ai session import t.jsonl       Import a transcript as a new session
+  ai sessions search deadlock --since 7d  Search all sessions
+  ai sessions gc --dry-run --max-age 30d  Show what cleanup would remove
+  ai sessions fsck --repair <id>  Check a session and repair it
+  ai session pack <id>            Bundle a session for a bug report
+  ai session unpack session-<id>.tar.gz  Unpack a bundle to resume it here
 `)
 }
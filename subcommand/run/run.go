@@ -18,6 +18,7 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/tiancaiamao/ai/pkg/session"
 	"github.com/tiancaiamao/ai/subcommand/helpers"
 	tui "github.com/tiancaiamao/ai/subcommand/run/tui"
 )
@@ -32,6 +33,8 @@ type serveConfig struct {
 	name         string
 	role         string
 	model        string
+	readOnly     bool // open the session without writing to it
+	takeover     bool // take the session over from the run holding it
 	daemon       bool // true for serve (new process group), false for run
 }
 
@@ -60,6 +63,18 @@ func (sp *serveProcess) Close() {
 // startServeProcess launches an RPC subprocess with shared infrastructure:
 // run ID, log file, stdin/stdout pipes, event broadcaster, and socket server.
 func startServeProcess(binPath string, cfg serveConfig) *serveProcess {
+	// Refuse a held session here: the rpc subprocess would fail the same
+	// way, but only into its error.log.
+	if cfg.session != "" && !cfg.readOnly && !cfg.takeover {
+		if dir, err := session.NormalizeSessionPath(cfg.session); err == nil {
+			if owner, _ := session.ReadSessionOwner(dir); owner != nil {
+				fmt.Fprintf(os.Stderr, "error: session %s is in use by another process (%s)\n", filepath.Base(dir), owner)
+				fmt.Fprintln(os.Stderr, "Use --read-only to open it without writing, or --force-takeover to take it over.")
+				os.Exit(1)
+			}
+		}
+	}
+
 	// Generate run ID and create directory.
 	id := tui.GenerateID()
 	homeDir, err := os.UserHomeDir()
@@ -92,6 +107,12 @@ func startServeProcess(binPath string, cfg serveConfig) *serveProcess {
 		}
 		rpcFlags = append(rpcFlags, "--role", cfg.role)
 	}
+	if cfg.readOnly {
+		rpcFlags = append(rpcFlags, "--read-only")
+	}
+	if cfg.takeover {
+		rpcFlags = append(rpcFlags, "--force-takeover")
+	}
 	cmd := exec.Command(binPath, append([]string{"rpc"}, rpcFlags...)...)
 	cwd, _ := os.Getwd()
 	cmd.Dir = cwd
@@ -218,6 +239,8 @@ func RunSubcommand(binPath string) {
 	nameFlag := fs.String("name", "", "Human-readable name for the run")
 	roleFlag := fs.String("role", "", "Agent role name (e.g. coder, orchestrator, validator). Loads ~/.ai/roles/<name>/agent.yaml")
 	modelFlag := fs.String("model", "", "Override LLM model ID (e.g. claude-sonnet-4-20250514)")
+	readOnlyFlag := fs.Bool("read-only", false, "Open the session without writing to it (forwarded to ai rpc)")
+	takeoverFlag := fs.Bool("force-takeover", false, "Take the session over from the run holding it (forwarded to ai rpc)")
 	fs.Parse(os.Args[1:])
 
 	sp := startServeProcess(binPath, serveConfig{
@@ -229,6 +252,8 @@ func RunSubcommand(binPath string) {
 		name:         *nameFlag,
 		role:         *roleFlag,
 		model:        *modelFlag,
+		readOnly:     *readOnlyFlag,
+		takeover:     *takeoverFlag,
 	})
 	defer sp.Close()
 
@@ -294,6 +319,8 @@ func ServeSubcommand(binPath string) {
 	roleFlag := fs.String("role", "", "Agent role name (e.g. coder, orchestrator, validator). Loads ~/.ai/roles/<name>/agent.yaml")
 	idFileFlag := fs.String("id-file", "", "Write run ID to this file after startup (useful for background mode)")
 	modelFlag := fs.String("model", "", "Override LLM model ID (e.g. claude-sonnet-4-20250514)")
+	readOnlyFlag := fs.Bool("read-only", false, "Open the session without writing to it (forwarded to ai rpc)")
+	takeoverFlag := fs.Bool("force-takeover", false, "Take the session over from the run holding it (forwarded to ai rpc)")
 	fs.Parse(os.Args[1:])
 
 	sp := startServeProcess(binPath, serveConfig{
@@ -305,6 +332,8 @@ func ServeSubcommand(binPath string) {
 		name:         *nameFlag,
 		role:         *roleFlag,
 		model:        *modelFlag,
+		readOnly:     *readOnlyFlag,
+		takeover:     *takeoverFlag,
 		daemon:       true,
 	})
 	defer sp.Close()
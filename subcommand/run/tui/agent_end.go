@@ -16,6 +16,7 @@ type AgentEndInfo struct {
 	Success bool   `json:"success"`
 	Turns   int    `json:"turns,omitempty"`
 	Error   string `json:"error,omitempty"`
+	Verify  string `json:"verify,omitempty"` // verification summary, if the run was verified
 }
 
 // FindLastAgentEnd scans events.jsonl from the end to find the last agent_end event.
@@ -100,6 +101,9 @@ func parseAgentEndLine(line string) *AgentEndInfo {
 	if eventType != "agent_end" {
 		return nil
 	}
+	if parent, _ := evt["parentToolCallId"].(string); parent != "" {
+		return nil
+	}
 
 	info := &AgentEndInfo{
 		Found:   true,
@@ -120,6 +124,10 @@ func parseAgentEndLine(line string) *AgentEndInfo {
 		info.Turns = int(turns)
 	}
 
+	if result := parseVerifyResult(evt); result != nil {
+		info.Verify = result.Summary()
+	}
+
 	return info
 }
 
@@ -244,6 +244,48 @@ func TestParseEvent_AgentEnd_WithErrMsg(t *testing.T) {
 	}
 }
 
+func TestParseEvent_AgentEnd_WithTodos(t *testing.T) {
+	evt := ParseEvent(`{"type":"agent_end","todos":[{"id":"1","content":"write parser","status":"completed"},{"id":"2","content":"add tests","status":"pending"}]}`)
+	if evt == nil {
+		t.Fatal("expected non-nil event")
+	}
+	if !strings.HasPrefix(evt.Text, "ai: agent done") {
+		t.Fatalf("unexpected text: %q", evt.Text)
+	}
+	for _, want := range []string{"todos (1/2 done)", "[x] 1. write parser", "[ ] 2. add tests"} {
+		if !strings.Contains(evt.Text, want) {
+			t.Fatalf("expected %q in text, got: %q", want, evt.Text)
+		}
+	}
+}
+
+func TestParseEvent_SubagentEvents(t *testing.T) {
+	evt := ParseEvent(`{"type":"tool_execution_start","toolName":"read","args":{"path":"a.go"},"parentToolCallId":"call-1"}`)
+	if evt == nil {
+		t.Fatal("expected subagent tool start to be rendered")
+	}
+	if !strings.HasPrefix(evt.Text, "  ↳ tool: tool read start") {
+		t.Fatalf("unexpected text: %q", evt.Text)
+	}
+
+	for _, line := range []string{
+		`{"type":"agent_start","parentToolCallId":"call-1"}`,
+		`{"type":"agent_end","parentToolCallId":"call-1"}`,
+		`{"type":"tool_execution_end","toolName":"read","parentToolCallId":"call-1"}`,
+	} {
+		if evt := ParseEvent(line); evt != nil {
+			t.Fatalf("expected %s to be silent, got %q", line, evt.Text)
+		}
+	}
+}
+
+func TestParseEvent_TaskToolStartShowsDescription(t *testing.T) {
+	evt := ParseEvent(`{"type":"tool_execution_start","toolName":"task","args":{"prompt":"long text","description":"audit parser"}}`)
+	if evt == nil || !strings.Contains(evt.Text, "audit parser") {
+		t.Fatalf("expected task description in text, got %+v", evt)
+	}
+}
+
 func TestParseEvent_TurnStart(t *testing.T) {
 	evt := ParseEvent(`{"type":"turn_start"}`)
 	// turn_start is silent
@@ -781,3 +823,42 @@ func TestParseEvent_LLMRetry_ServerError(t *testing.T) {
 		t.Fatalf("expected error type, got: %s", evt.Text)
 	}
 }
+
+func TestParseEvent_UserQuestion(t *testing.T) {
+	raw := `{"type":"user_question","id":"q1","question":"Which database?","options":["postgres","sqlite"],"timeoutSeconds":600}`
+	evt := ParseEvent(raw)
+	if evt == nil {
+		t.Fatal("expected non-nil event for user_question")
+	}
+	if evt.Kind != KindMeta {
+		t.Fatalf("expected KindMeta, got %s", evt.Kind)
+	}
+	for _, want := range []string{"Which database?", "1. postgres", "2. sqlite", "10m0s"} {
+		if !contains(evt.Text, want) {
+			t.Fatalf("expected %q in: %s", want, evt.Text)
+		}
+	}
+
+	if ParseEvent(`{"type":"user_question"}`) != nil {
+		t.Fatal("expected nil for user_question without question")
+	}
+}
+
+func TestParseEvent_Verify(t *testing.T) {
+	raw := `{"type":"verify","verify":{"passed":false,"attempts":1,"maxAttempts":3,"checks":[{"command":"go build ./...","passed":true},{"command":"go test ./...","passed":false,"exitCode":1,"output":"FAIL"}]}}`
+	evt := ParseEvent(raw)
+	if evt == nil || evt.Kind != KindMeta {
+		t.Fatalf("expected meta event for verify, got %+v", evt)
+	}
+	if !contains(evt.Text, "verify failed: 1/2 checks failed (attempt 1/3)") || !contains(evt.Text, "✗ go test ./... (exit 1)") {
+		t.Fatalf("unexpected verify text: %s", evt.Text)
+	}
+	if contains(evt.Text, "go build") {
+		t.Fatalf("passing checks should not be listed: %s", evt.Text)
+	}
+
+	end := ParseEvent(`{"type":"agent_end","verify":{"passed":true,"attempts":2,"maxAttempts":3,"checks":[{"command":"make","passed":true}]}}`)
+	if end == nil || !contains(end.Text, "verify passed: 1/1 checks (attempt 2/3)") {
+		t.Fatalf("agent_end should report verify result, got %+v", end)
+	}
+}
@@ -6,18 +6,21 @@ import (
 	"strings"
 	"time"
 
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
 	truncpkg "github.com/tiancaiamao/ai/pkg/truncate"
 )
 
-// IsAgentEnd reports whether a JSONL event is an agent_end event.
+// IsAgentEnd reports whether a JSONL event is the top-level agent_end event.
+// A task subagent's agent_end (tagged with parentToolCallId) does not count.
 func IsAgentEnd(line string) bool {
 	var evt struct {
-		Type string `json:"type"`
+		Type             string `json:"type"`
+		ParentToolCallID string `json:"parentToolCallId"`
 	}
 	if err := json.Unmarshal([]byte(line), &evt); err != nil {
 		return false
 	}
-	return evt.Type == "agent_end"
+	return evt.Type == "agent_end" && evt.ParentToolCallID == ""
 }
 
 func ParseEvent(line string) *FormattedEvent {
@@ -33,6 +36,10 @@ func ParseEvent(line string) *FormattedEvent {
 
 	eventType, _ := evt["type"].(string)
 
+	if parent, _ := evt["parentToolCallId"].(string); parent != "" {
+		return parseSubagentEvent(eventType, evt)
+	}
+
 	switch eventType {
 	case "message_start":
 		return parseMessageStart(evt)
@@ -76,6 +83,33 @@ func ParseEvent(line string) *FormattedEvent {
 		return parseLoopGuard(evt)
 	case "tool_call_recovery":
 		return parseToolCallRecovery(evt)
+	case "user_question":
+		return parseUserQuestion(evt)
+	case "verify":
+		return parseVerify(evt)
+	default:
+		return nil
+	}
+}
+
+// parseSubagentEvent renders events of a task subagent as indented progress
+// lines under the parent's task call. Only tool starts and errors are shown;
+// the subagent's report arrives as the task tool result.
+func parseSubagentEvent(eventType string, evt map[string]any) *FormattedEvent {
+	switch eventType {
+	case "tool_execution_start":
+		fe := parseToolExecutionStart(evt)
+		if fe == nil {
+			return nil
+		}
+		fe.Text = "  ↳ " + fe.Text
+		return fe
+	case "error":
+		errMsg, _ := evt["error"].(string)
+		if errMsg == "" {
+			errMsg = "unknown error"
+		}
+		return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: "  ↳ subagent error: " + errMsg}
 	default:
 		return nil
 	}
@@ -290,22 +324,104 @@ func parseToolExecutionEnd(evt map[string]any) *FormattedEvent {
 		}
 	}
 
+	text := fmt.Sprintf("tool: %s done", label)
+	// The todo tool's result is the current list; show it inline so
+	// watchers can follow progress.
+	if toolName == "todo" {
+		if list := resultText(evt); list != "" {
+			text += "\n" + list
+		}
+	}
+
 	return &FormattedEvent{
 		Kind: KindTool,
 		Role: "tool",
-		Text: fmt.Sprintf("tool: %s done", label),
+		Text: text,
 	}
 }
 
+// resultText joins the text blocks of a tool_execution_end result message.
+func resultText(evt map[string]any) string {
+	result, _ := evt["result"].(map[string]any)
+	content, _ := result["content"].([]any)
+	var parts []string
+	for _, item := range content {
+		block, _ := item.(map[string]any)
+		if blockType, _ := block["type"].(string); blockType == "text" {
+			if t, _ := block["text"].(string); t != "" {
+				parts = append(parts, t)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
 func parseAgentEnd(evt map[string]any) *FormattedEvent {
+	text := "ai: agent done"
 	errMsg, _ := evt["error"].(string)
 	if errMsg != "" {
-		return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: "ai: agent failed: " + errMsg}
+		text = "ai: agent failed: " + errMsg
+	} else if success, ok := evt["success"].(bool); ok && !success {
+		text = "ai: agent failed"
+	}
+	if todos := parseTodos(evt); len(todos) > 0 {
+		done, total := agentctx.TodoCounts(todos)
+		text += fmt.Sprintf("\nai: todos (%d/%d done):\n%s", done, total, agentctx.FormatTodoList(todos))
+	}
+	if result := parseVerifyResult(evt); result != nil {
+		text += "\nai: " + result.Summary()
+	}
+	return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: text}
+}
+
+// parseVerify handles verify events: one line for the round plus the
+// failing commands.
+func parseVerify(evt map[string]any) *FormattedEvent {
+	result := parseVerifyResult(evt)
+	if result == nil {
+		return nil
+	}
+	text := "ai: " + result.Summary()
+	for _, c := range result.Checks {
+		if !c.Passed {
+			text += fmt.Sprintf("\n  ✗ %s (exit %d)", c.Command, c.ExitCode)
+		}
+	}
+	return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: text}
+}
+
+// parseVerifyResult decodes the verify field carried by verify and agent_end events.
+func parseVerifyResult(evt map[string]any) *agentctx.VerifyResult {
+	raw, ok := evt["verify"]
+	if !ok || raw == nil {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
 	}
-	if success, ok := evt["success"].(bool); ok && !success {
-		return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: "ai: agent failed"}
+	var result agentctx.VerifyResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
 	}
-	return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: "ai: agent done"}
+	return &result
+}
+
+// parseTodos decodes the todos field carried by agent_end events.
+func parseTodos(evt map[string]any) []agentctx.TodoItem {
+	raw, ok := evt["todos"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var todos []agentctx.TodoItem
+	if err := json.Unmarshal(data, &todos); err != nil {
+		return nil
+	}
+	return todos
 }
 
 func parseSessionSwitch(evt map[string]any) *FormattedEvent {
@@ -414,6 +530,27 @@ func parseToolCallRecovery(evt map[string]any) *FormattedEvent {
 	return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: "ai: recovered malformed tool call: " + truncpkg.TruncateString(reason, 220)}
 }
 
+// parseUserQuestion handles user_question events from the ask_user tool.
+// Options are numbered; answering with the number picks that option.
+func parseUserQuestion(evt map[string]any) *FormattedEvent {
+	question, _ := evt["question"].(string)
+	if question == "" {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("ai: question: " + question)
+	options, _ := evt["options"].([]any)
+	for i, opt := range options {
+		fmt.Fprintf(&b, "\n  %d. %v", i+1, opt)
+	}
+	b.WriteString("\n  (reply to answer")
+	if timeout := intFromMap(evt, "timeoutSeconds"); timeout > 0 {
+		fmt.Fprintf(&b, "; falls back after %s", time.Duration(timeout)*time.Second)
+	}
+	b.WriteString(")")
+	return &FormattedEvent{Kind: KindMeta, Role: "ai", Text: b.String()}
+}
+
 // parseLLMRetry handles llm_retry events, making rate-limit and other
 // transient LLM errors visible to watchers.
 func parseLLMRetry(evt map[string]any) *FormattedEvent {
@@ -465,6 +602,12 @@ func formatToolDetail(evt map[string]any, toolName string) string {
 		return ""
 	}
 
+	if toolName == "task" {
+		if desc, _ := args["description"].(string); desc != "" {
+			return " " + desc
+		}
+	}
+
 	// Pick the most relevant argument based on common tools
 	parts := make([]string, 0, 2)
 	for _, key := range []string{"path", "file", "command", "pattern", "query", "url"} {
@@ -9,6 +9,7 @@ func TestIsAgentEnd(t *testing.T) {
 		want bool
 	}{
 		{name: "agent end", line: `{"type":"agent_end"}`, want: true},
+		{name: "subagent end", line: `{"type":"agent_end","parentToolCallId":"call-1"}`},
 		{name: "text containing marker", line: `{"type":"text_delta","delta":"agent_end"}`},
 		{name: "invalid json", line: `agent_end`},
 		{name: "other event", line: `{"type":"agent_start"}`},
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/tiancaiamao/ai/pkg/compact"
 	"github.com/tiancaiamao/ai/pkg/config"
 	"github.com/tiancaiamao/ai/pkg/rpc"
+	"github.com/tiancaiamao/ai/pkg/session"
 	truncpkg "github.com/tiancaiamao/ai/pkg/truncate"
 )
 
@@ -48,6 +50,11 @@ func parseResponseEvent(evt map[string]any) *FormattedEvent {
 		return renderSkills(dataJSON)
 	}
 
+	// /context --breakdown → {breakdown: ContextBreakdown}
+	if _, hasBreakdown := dataRaw["breakdown"]; hasBreakdown {
+		return renderContextBreakdown(dataJSON)
+	}
+
 	// /context → {state: SessionState, stats: SessionStats, models: ...}
 	if _, hasState := dataRaw["state"]; hasState {
 		return renderContext(dataJSON)
@@ -106,6 +113,38 @@ func parseResponseEvent(evt map[string]any) *FormattedEvent {
 		return renderTraceEvents(dataJSON)
 	}
 
+	// /memory → {memories: [...]}
+	if _, hasMemories := dataRaw["memories"]; hasMemories {
+		return renderMemories(dataJSON)
+	}
+
+	// /search → {query, hits: [...]}
+	if _, hasHits := dataRaw["hits"]; hasHits {
+		return renderSearchHits(dataJSON)
+	}
+
+	// /branches → {branches: [...]}
+	if _, hasBranches := dataRaw["branches"]; hasBranches {
+		return renderBranches(dataJSON)
+	}
+
+	// /diff-branch → {a, b, forkPoint, onlyA, onlyB, filesA, filesB}
+	if _, hasOnlyA := dataRaw["onlyA"]; hasOnlyA {
+		return renderBranchDiff(dataJSON)
+	}
+
+	// /merge-branch → {merged, entryId, summary, files}
+	if merged, ok := dataRaw["merged"].(string); ok {
+		return &FormattedEvent{Kind: KindMeta, Text: fmt.Sprintf("Merged branch %s as a branch summary (entry %v)", merged, dataRaw["entryId"])}
+	}
+
+	// /export → {path, format, entries, turns}
+	if path, ok := dataRaw["path"].(string); ok {
+		if format, ok := dataRaw["format"].(string); ok {
+			return &FormattedEvent{Kind: KindMeta, Text: fmt.Sprintf("Exported %v turns (%s) to %s", dataRaw["turns"], format, path)}
+		}
+	}
+
 	// /tree → {entries: [...]} or {root: ...}
 	if _, hasEntries := dataRaw["entries"]; hasEntries {
 		return renderTree(dataJSON)
@@ -141,15 +180,127 @@ func FormatResponseData(data any) string {
 	return result.Text
 }
 
+// renderSearchHits renders /search output.
+func renderSearchHits(dataJSON []byte) *FormattedEvent {
+	var result rpc.SearchResult
+	if err := json.Unmarshal(dataJSON, &result); err != nil {
+		return fallbackJSON(dataJSON)
+	}
+	if len(result.Hits) == 0 {
+		return &FormattedEvent{Kind: KindMeta, Text: fmt.Sprintf("No matches for %q", result.Query)}
+	}
+
+	var b strings.Builder
+	for _, h := range result.Hits {
+		name := h.SessionName
+		if name == "" {
+			name = h.SessionID
+		}
+		b.WriteString(fmt.Sprintf("%s  %s  %s (id: %s)\n", h.Time.Local().Format("2006-01-02 15:04"), h.Role, name, h.SessionID))
+		b.WriteString(fmt.Sprintf("    %s\n", h.Snippet))
+		if h.ForkEntryID != "" {
+			b.WriteString(fmt.Sprintf("    /fork %s:%s\n", h.SessionID, h.ForkEntryID))
+		}
+	}
+	b.WriteString("\nUsage:\n  - /resume <id>\n  - /fork <id>:<entryId>\n")
+	return &FormattedEvent{Kind: KindResponse, Text: b.String()}
+}
+
+// renderBranches renders /branches output.
+func renderBranches(dataJSON []byte) *FormattedEvent {
+	var result rpc.BranchesResult
+	if err := json.Unmarshal(dataJSON, &result); err != nil {
+		return fallbackJSON(dataJSON)
+	}
+
+	var b strings.Builder
+	for _, br := range result.Branches {
+		mark := " "
+		if br.Current {
+			mark = "*"
+		}
+		where := br.SessionName
+		if where == "" {
+			where = br.SessionID
+		}
+		b.WriteString(fmt.Sprintf("%s %d. %s  %s  %d messages, %d after fork  %s\n", mark, br.Index, br.Ref, where, br.Messages, br.Diverged, br.Updated.Local().Format("2006-01-02 15:04")))
+		if br.Summary != "" {
+			b.WriteString(fmt.Sprintf("    %s\n", br.Summary))
+		}
+	}
+	b.WriteString("\nUsage:\n  - /diff-branch <A> [B]\n  - /merge-branch <branch>\n")
+	return &FormattedEvent{Kind: KindResponse, Text: b.String()}
+}
+
+// renderBranchDiff renders /diff-branch output.
+func renderBranchDiff(dataJSON []byte) *FormattedEvent {
+	var diff session.BranchDiff
+	if err := json.Unmarshal(dataJSON, &diff); err != nil {
+		return fallbackJSON(dataJSON)
+	}
+
+	var b strings.Builder
+	if diff.ForkPoint != "" {
+		b.WriteString(fmt.Sprintf("Branches diverge after entry %s\n", diff.ForkPoint))
+	} else {
+		b.WriteString("Branches share no entries\n")
+	}
+	side := func(name string, br session.BranchInfo, messages []session.BranchMessage, files []session.FileChange) {
+		b.WriteString(fmt.Sprintf("\n%s: %s (%d messages)\n", name, br.Ref, len(messages)))
+		for _, m := range messages {
+			line := m.Text
+			if len(m.Tools) > 0 {
+				line = strings.TrimSpace(line + " [" + strings.Join(m.Tools, ", ") + "]")
+			}
+			b.WriteString(fmt.Sprintf("  %-10s %s\n", m.Role, line))
+		}
+		if len(files) > 0 {
+			b.WriteString("  Files changed:\n")
+			for _, line := range strings.Split(session.FormatFileChanges(files), "\n") {
+				b.WriteString("  " + line + "\n")
+			}
+		}
+	}
+	side("A", diff.A, diff.OnlyA, diff.FilesA)
+	side("B", diff.B, diff.OnlyB, diff.FilesB)
+	return &FormattedEvent{Kind: KindResponse, Text: b.String()}
+}
+
+// renderMemories renders /memory output.
+func renderMemories(dataJSON []byte) *FormattedEvent {
+	var payload struct {
+		Memories []rpc.MemoryItem `json:"memories"`
+	}
+	if err := json.Unmarshal(dataJSON, &payload); err != nil {
+		return fallbackJSON(dataJSON)
+	}
+	if len(payload.Memories) == 0 {
+		return &FormattedEvent{Kind: KindMeta, Text: "No memories found"}
+	}
+
+	var b strings.Builder
+	for _, m := range payload.Memories {
+		status := ""
+		if m.Proposed {
+			status = " (proposed)"
+		}
+		b.WriteString(fmt.Sprintf("[%s] %s%s  %s\n", m.ID, m.Scope, status, m.Updated))
+		b.WriteString(fmt.Sprintf("    %s\n", truncpkg.TruncateString(m.Content, 200)))
+	}
+	b.WriteString("\nUsage: /memory accept|delete [user] <id>")
+	return &FormattedEvent{Kind: KindResponse, Text: b.String()}
+}
+
 // renderSessions renders /sessions output.
 func renderSessions(dataJSON []byte) *FormattedEvent {
 	var payload struct {
 		Sessions []struct {
-			ID           string `json:"id"`
-			Name         string `json:"name"`
-			Title        string `json:"title"`
-			UpdatedAt    string `json:"updatedAt"`
-			MessageCount int    `json:"messageCount"`
+			ID           string   `json:"id"`
+			Name         string   `json:"name"`
+			Title        string   `json:"title"`
+			Tags         []string `json:"tags"`
+			UpdatedAt    string   `json:"updatedAt"`
+			MessageCount int      `json:"messageCount"`
 		} `json:"sessions"`
 	}
 	if err := json.Unmarshal(dataJSON, &payload); err != nil {
@@ -174,11 +325,18 @@ func renderSessions(dataJSON []byte) *FormattedEvent {
 			name = sess.ID
 		}
 		b.WriteString(fmt.Sprintf("%d: %s (id: %s)\n", i, name, sess.ID))
+		if title := strings.TrimSpace(sess.Title); title != "" && title != name && title != "Session" {
+			b.WriteString("    " + title)
+			if len(sess.Tags) > 0 {
+				b.WriteString("  [" + strings.Join(sess.Tags, ", ") + "]")
+			}
+			b.WriteString("\n")
+		}
 		b.WriteString(fmt.Sprintf("    updated: %s  messages: %d\n", truncpkg.TruncateString(sess.UpdatedAt, 16), sess.MessageCount))
 	}
 
 	b.WriteString("\n─────────────────────\n")
-	b.WriteString("Usage:\n  - /resume <index|id|path>\n")
+	b.WriteString("Usage:\n  - /resume <index|id|name|title>\n")
 
 	return &FormattedEvent{Kind: KindResponse, Text: b.String()}
 }
@@ -229,6 +387,7 @@ func renderContext(dataJSON []byte) *FormattedEvent {
 		Models struct {
 			Models []config.ModelInfo `json:"models"`
 		} `json:"models"`
+		Pinned *rpc.PinnedContext `json:"pinned"`
 	}
 	if err := json.Unmarshal(dataJSON, &payload); err != nil {
 		return fallbackJSON(dataJSON)
@@ -301,6 +460,9 @@ func renderContext(dataJSON []byte) *FormattedEvent {
 	b.WriteString(fmt.Sprintf(" Tools: %d calls, %d results\n",
 		stats.ToolCalls, stats.ToolResults))
 	b.WriteString(fmt.Sprintf(" Compactions: %d\n", stats.CompactionCount))
+	if state.Compaction != nil && state.Compaction.Summaries != nil {
+		b.WriteString(fmt.Sprintf(" Summaries: %s\n", formatSummaryLayout(state.Compaction.Summaries, state.Compaction.KeepSegments)))
+	}
 	b.WriteString(fmt.Sprintf(" Cost: $%.4f\n", stats.Cost))
 	b.WriteString(fmt.Sprintf(" Auto-compaction: %s\n", onOff(state.AutoCompactionEnabled)))
 	b.WriteString("\n")
@@ -308,8 +470,114 @@ func renderContext(dataJSON []byte) *FormattedEvent {
 	b.WriteString(fmt.Sprintf(" Context window: %dk tokens\n", tokensMax/1024))
 	b.WriteString(fmt.Sprintf(" Session total: %dk tokens (all turns)\n", stats.Tokens.Total/1024))
 	b.WriteString(fmt.Sprintf(" Streaming: %s", onOff(state.IsStreaming)))
+	if pinned := payload.Pinned; pinned != nil && (pinned.Instructions || len(pinned.Messages) > 0) {
+		b.WriteString("\n\n Pinned (never summarized)\n")
+		if pinned.Instructions {
+			b.WriteString("   skills and AGENTS.md instructions\n")
+		}
+		for _, m := range pinned.Messages {
+			b.WriteString(fmt.Sprintf("   [%d] %s: %s\n", m.Index, m.Role, m.Preview))
+		}
+	}
+
+	return &FormattedEvent{Kind: KindMeta, Text: strings.TrimRight(b.String(), "\n")}
+}
+
+// formatSummaryLayout describes the digest and segment summaries in context,
+// e.g. "digest (to archive 3, ~1k tokens) + 2/4 segments [4 5] (~2k tokens)".
+func formatSummaryLayout(layout *compact.SummaryLayout, keep int) string {
+	var parts []string
+	if d := layout.Digest; d != nil {
+		if d.Archive > 0 {
+			parts = append(parts, fmt.Sprintf("digest (to archive %d, ~%dk tokens)", d.Archive, d.Tokens/1024))
+		} else {
+			parts = append(parts, fmt.Sprintf("digest (~%dk tokens)", d.Tokens/1024))
+		}
+	}
+	if len(layout.Segments) > 0 {
+		tokens := 0
+		var archives []string
+		for _, s := range layout.Segments {
+			tokens += s.Tokens
+			if s.Archive > 0 {
+				archives = append(archives, strconv.Itoa(s.Archive))
+			}
+		}
+		seg := fmt.Sprintf("%d/%d segments", len(layout.Segments), keep)
+		if len(archives) > 0 {
+			seg += " [" + strings.Join(archives, " ") + "]"
+		}
+		parts = append(parts, fmt.Sprintf("%s (~%dk tokens)", seg, tokens/1024))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// breakdownListLimit caps the per-tool and per-path lists of /context --breakdown.
+const breakdownListLimit = 10
+
+// renderContextBreakdown renders /context --breakdown output.
+func renderContextBreakdown(dataJSON []byte) *FormattedEvent {
+	var payload struct {
+		Breakdown *rpc.ContextBreakdown `json:"breakdown"`
+	}
+	if err := json.Unmarshal(dataJSON, &payload); err != nil || payload.Breakdown == nil {
+		return fallbackJSON(dataJSON)
+	}
+	bd := payload.Breakdown
+	window := bd.ContextWindow
+	if window <= 0 {
+		window = 200000
+	}
+	line := func(b *strings.Builder, indent, name string, tokens int) {
+		b.WriteString(fmt.Sprintf("%s%-20s ~%6d tokens (%.1f%%)\n",
+			indent, name, tokens, float64(tokens)/float64(window)*100))
+	}
 
-	return &FormattedEvent{Kind: KindMeta, Text: b.String()}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("  Context Breakdown - ~%dk/%dk tokens (%.0f%%)\n",
+		bd.Total/1024, window/1024, float64(bd.Total)/float64(window)*100))
+	line(&b, "     ", "System prompt", bd.SystemPrompt)
+	line(&b, "     ", "Tool schemas", bd.Tools)
+	line(&b, "     ", "Skills + AGENTS.md", bd.Prefix)
+	line(&b, "     ", "Compaction summary", bd.CompactionSummary)
+	line(&b, "     ", "User messages", bd.UserMessages)
+	line(&b, "     ", "Injected messages", bd.Injected)
+	line(&b, "     ", "Assistant text", bd.AssistantText)
+	line(&b, "     ", "Thinking", bd.Thinking)
+	line(&b, "     ", "Tool calls", bd.ToolCalls)
+	line(&b, "     ", "Tool results", bd.ToolResults)
+	b.WriteString("     (Estimates based on string length)\n")
+
+	if len(bd.ByTool) > 0 {
+		b.WriteString("\n Tool results by tool\n")
+		for _, s := range bd.ByTool[:min(len(bd.ByTool), breakdownListLimit)] {
+			line(&b, "   ", fmt.Sprintf("%s (%d)", s.Name, s.Count), s.Tokens)
+		}
+	}
+	if len(bd.ByPath) > 0 {
+		b.WriteString("\n Tool results by file\n")
+		for _, s := range bd.ByPath[:min(len(bd.ByPath), breakdownListLimit)] {
+			b.WriteString(fmt.Sprintf("   ~%6d tokens  %s (%d)\n", s.Tokens, s.Name, s.Count))
+		}
+	}
+	if len(bd.Largest) > 0 {
+		b.WriteString("\n Largest messages (/pin, /fork by index or entry ID)\n")
+		for _, m := range bd.Largest {
+			label := m.Role
+			if m.ToolName != "" {
+				label = m.ToolName
+			}
+			if m.Path != "" {
+				label += " " + m.Path
+			}
+			id := ""
+			if m.EntryID != "" {
+				id = " " + m.EntryID
+			}
+			b.WriteString(fmt.Sprintf("   [%d]%s ~%d tokens %s: %s\n", m.Index, id, m.Tokens, label, m.Preview))
+		}
+	}
+	return &FormattedEvent{Kind: KindMeta, Text: strings.TrimRight(b.String(), "\n")}
 }
 
 // renderSessionState renders /session output.
@@ -625,6 +893,14 @@ func renderSessionStats(dataJSON []byte) *FormattedEvent {
 		stats.Tokens.Total,
 		stats.Cost,
 	)
+	if u := stats.CompactionUsage; u != nil {
+		text += fmt.Sprintf("\n  compaction model: %s/%s, %d calls, in %d, out %d, cache read %d, cost %.4f",
+			u.Provider, u.Model, u.Calls, u.InputTokens, u.OutputTokens, u.CachedTokens, u.Cost)
+	}
+	if u := stats.TitleUsage; u != nil {
+		text += fmt.Sprintf("\n  title model: %s/%s, in %d, out %d, cost %.4f",
+			u.Provider, u.Model, u.InputTokens, u.OutputTokens, u.Cost)
+	}
 
 	return &FormattedEvent{Kind: KindMeta, Text: text}
 }
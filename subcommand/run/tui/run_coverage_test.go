@@ -371,6 +371,35 @@ func TestFormatResponseData(t *testing.T) {
 	if got := FormatResponseData(map[string]any{"level": "low"}); !strings.Contains(got, "Thinking level: low") {
 		t.Errorf("expected thinking level, got %q", got)
 	}
+	exported := map[string]any{"path": "/tmp/s.html", "format": "html", "entries": 12, "turns": 3}
+	if got := FormatResponseData(exported); got != "Exported 3 turns (html) to /tmp/s.html" {
+		t.Errorf("expected export summary, got %q", got)
+	}
+	hits := map[string]any{"query": "deadlock", "hits": []any{map[string]any{
+		"sessionId": "s1", "sessionName": "sched", "entryId": "e2", "forkEntryId": "e1",
+		"time": "2026-10-01T12:00:00Z", "role": "assistant", "snippet": "…the deadlock in…",
+	}}}
+	if got := FormatResponseData(hits); !strings.Contains(got, "sched (id: s1)") || !strings.Contains(got, "/fork s1:e1") || !strings.Contains(got, "…the deadlock in…") {
+		t.Errorf("expected search hits, got %q", got)
+	}
+	if got := FormatResponseData(map[string]any{"query": "x1", "hits": []any{}}); got != `No matches for "x1"` {
+		t.Errorf("expected no matches, got %q", got)
+	}
+	branches := map[string]any{"branches": []any{map[string]any{
+		"index": 1, "ref": "e9", "sessionId": "s1", "current": true, "messages": 4, "diverged": 0,
+		"updated": "2026-10-01T12:00:00Z", "summary": "fix the parser → done",
+	}}}
+	if got := FormatResponseData(branches); !strings.Contains(got, "* 1. e9  s1  4 messages") || !strings.Contains(got, "fix the parser → done") {
+		t.Errorf("expected branches, got %q", got)
+	}
+	diff := map[string]any{
+		"a": map[string]any{"ref": "e4"}, "b": map[string]any{"ref": "s2:e7"}, "forkPoint": "e1",
+		"onlyA": []any{map[string]any{"entryId": "e3", "role": "assistant", "text": "patching", "tools": []any{"edit"}}},
+		"onlyB": []any{}, "filesA": []any{map[string]any{"path": "lexer.go", "edits": 2}}, "filesB": []any{},
+	}
+	if got := FormatResponseData(diff); !strings.Contains(got, "diverge after entry e1") || !strings.Contains(got, "patching [edit]") || !strings.Contains(got, "- lexer.go (2 edits)") {
+		t.Errorf("expected branch diff, got %q", got)
+	}
 }
 
 func TestRenderSkills(t *testing.T) {
@@ -401,6 +430,21 @@ func TestRenderContext(t *testing.T) {
 		t.Errorf("unexpected: %+v", r)
 	}
 
+	// Pinned section
+	pinned := strings.TrimSuffix(data, "}") + `,"pinned":{"instructions":true,"messages":[{"index":0,"role":"user","preview":"fix the flaky test","priority":1}]}}`
+	r = renderContext([]byte(pinned))
+	if r == nil || !strings.Contains(r.Text, "AGENTS.md") || !strings.Contains(r.Text, "[0] user: fix the flaky test") {
+		t.Errorf("expected pinned section: %+v", r)
+	}
+
+	// Summary layout
+	summaries := strings.Replace(data, `"aiWorkingDir":"/tmp"`, `"aiWorkingDir":"/tmp","compaction":{"keepSegments":4,`+
+		`"summaries":{"digest":{"archive":3,"tokens":2048},"segments":[{"archive":4,"tokens":1024},{"archive":5,"tokens":1024}]}}`, 1)
+	r = renderContext([]byte(summaries))
+	if r == nil || !strings.Contains(r.Text, "Summaries: digest (to archive 3, ~2k tokens) + 2/4 segments [4 5] (~2k tokens)") {
+		t.Errorf("expected summary layout: %+v", r)
+	}
+
 	// Bad JSON
 	r = renderContext([]byte(`bad`))
 	if r == nil {
@@ -408,6 +452,29 @@ func TestRenderContext(t *testing.T) {
 	}
 }
 
+func TestRenderContextBreakdown(t *testing.T) {
+	data := `{"breakdown":{"systemPrompt":1000,"tools":2000,"prefix":500,"toolResults":40000,"total":43500,"contextWindow":100000,` +
+		`"byTool":[{"name":"read","tokens":30000,"count":3}],"byPath":[{"name":"pkg/big.go","tokens":25000,"count":2}],` +
+		`"largest":[{"index":7,"entryId":"abc123","role":"toolResult","toolName":"read","path":"pkg/big.go","tokens":20000,"preview":"package big"}]}}`
+	var dataRaw map[string]any
+	if err := json.Unmarshal([]byte(data), &dataRaw); err != nil {
+		t.Fatal(err)
+	}
+	r := parseResponseEvent(map[string]any{"success": true, "data": dataRaw})
+	if r == nil {
+		t.Fatal("expected rendered breakdown")
+	}
+	for _, want := range []string{"Context Breakdown", "Tool results", "40.0%", "read (3)", "pkg/big.go (2)", "[7] abc123 ~20000 tokens read pkg/big.go: package big"} {
+		if !strings.Contains(r.Text, want) {
+			t.Errorf("missing %q in:\n%s", want, r.Text)
+		}
+	}
+
+	if r := renderContextBreakdown([]byte(`bad`)); r == nil {
+		t.Error("expected fallback for bad JSON")
+	}
+}
+
 func TestRenderSessionState(t *testing.T) {
 	data := `{"sessionId":"s1","sessionName":"name","sessionFile":"/tmp/s","model":{"id":"m","provider":"p","name":"model"},"messageCount":5,"pendingMessageCount":1,"isStreaming":true,"isCompacting":false,"thinkingLevel":"low","autoCompactionEnabled":true,"aiPid":1234,"aiLogPath":"/tmp/log","aiWorkingDir":"/cwd"}`
 	r := renderSessionState([]byte(data))
@@ -907,3 +974,18 @@ func TestEventBroadcaster_UnsubscribeNil(t *testing.T) {
 	b := NewEventBroadcaster()
 	b.Unsubscribe(nil) // must not panic
 }
+
+func TestRenderMemories(t *testing.T) {
+	data := `{"memories":[{"id":"m2","scope":"user","content":"likes short commits","proposed":true,"updated":"2026-10-01 10:00"}]}`
+	var dataRaw map[string]any
+	if err := json.Unmarshal([]byte(data), &dataRaw); err != nil {
+		t.Fatal(err)
+	}
+	r := parseResponseEvent(map[string]any{"success": true, "data": dataRaw})
+	if r == nil || !strings.Contains(r.Text, "[m2] user (proposed)  2026-10-01 10:00\n    likes short commits") {
+		t.Fatalf("unexpected render: %+v", r)
+	}
+	if r := renderMemories([]byte(`{"memories":[]}`)); r == nil || r.Text != "No memories found" {
+		t.Fatalf("unexpected empty render: %+v", r)
+	}
+}
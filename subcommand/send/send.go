@@ -22,6 +22,7 @@ func SendSubcommand() {
 	waitFlag := fs.Bool("wait", false, "wait for agent to finish processing and stream the response")
 	summaryFlag := fs.Bool("summary", false, "with --wait: only show final assistant text (suppress tool output)")
 	timeoutFlag := fs.Duration("timeout", 0, "with --wait: max wait time (0 = unlimited)")
+	answerFlag := fs.Bool("answer", false, "answer the pending ask_user question (a number picks that option)")
 	fs.Parse(os.Args[1:])
 
 	// Determine the message to send.
@@ -55,6 +56,10 @@ func SendSubcommand() {
 		os.Exit(1)
 	}
 
+	if *answerFlag {
+		message = "/answer " + strings.TrimSpace(message)
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to get home directory: %v\n", err)
@@ -199,7 +204,7 @@ func waitStreamSummary(scanner *bufio.Scanner) {
 			continue
 		}
 
-		if strings.Contains(line, `"agent_end"`) {
+		if tui.IsAgentEnd(line) {
 			text := strings.TrimSpace(currentText.String())
 			if text != "" {
 				fmt.Println(text)
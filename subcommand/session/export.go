@@ -0,0 +1,75 @@
+package sessionsubcommand
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tiancaiamao/ai/pkg/session"
+	sessionexport "github.com/tiancaiamao/ai/pkg/session/export"
+)
+
+// runExport writes a saved session branch in any export format.
+func runExport(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	sessionFlag := fs.String("session", "", "Session directory or ID (required)")
+	formatFlag := fs.String("format", "", "Output format: html, md, json, openai, anthropic or sharegpt (default: from -o extension, else html)")
+	leafFlag := fs.String("leaf", "", "Export the branch ending at this entry ID (default: current leaf)")
+	outputFlag := fs.String("o", "", "Output file (default: stdout)")
+	fs.StringVar(outputFlag, "output", "", "Output file (default: stdout)")
+	fs.Parse(args)
+
+	if *sessionFlag == "" {
+		return fmt.Errorf("--session is required")
+	}
+	if *formatFlag == "" {
+		*formatFlag = sessionexport.FormatForPath(*outputFlag)
+	}
+	format, err := sessionexport.ParseFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+	sess, err := loadSession(*sessionFlag)
+	if err != nil {
+		return err
+	}
+	t, err := sessionexport.FromSession(sess, *leafFlag)
+	if err != nil {
+		return err
+	}
+
+	if *outputFlag == "" {
+		return sessionexport.Render(stdout, t, format)
+	}
+	f, err := os.Create(*outputFlag)
+	if err != nil {
+		return err
+	}
+	if err := sessionexport.Render(f, t, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadSession loads ref as a session directory when it exists, otherwise as
+// a session ID in the default sessions directory of the working directory.
+func loadSession(ref string) (*session.Session, error) {
+	if info, err := os.Stat(ref); err == nil && info.IsDir() {
+		return session.LoadSession(ref)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("get cwd: %w", err)
+	}
+	dir, err := session.GetDefaultSessionsDir(cwd)
+	if err != nil {
+		return nil, err
+	}
+	sm := session.NewSessionManager(dir)
+	if _, err := sm.GetMeta(ref); err != nil {
+		return nil, fmt.Errorf("session %q not found in %s", ref, dir)
+	}
+	return sm.GetSession(ref)
+}
@@ -0,0 +1,46 @@
+package sessionsubcommand
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func TestRunExport(t *testing.T) {
+	dir := t.TempDir()
+	sess := session.NewSession(dir)
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello export")); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runExport([]string{"--session", dir, "--format", "md"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "## Turn 1") || !strings.Contains(stdout.String(), "hello export") {
+		t.Errorf("unexpected markdown:\n%s", stdout.String())
+	}
+
+	out := filepath.Join(t.TempDir(), "s.json")
+	if err := runExport([]string{"--session", dir, "--format", "json", "-o", out}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(out); err != nil || !strings.Contains(string(data), `"version": 1`) {
+		t.Errorf("json export: %v\n%s", err, data)
+	}
+}
+
+func TestRunExport_Errors(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := runExport(nil, &stdout); err == nil || !strings.Contains(err.Error(), "--session") {
+		t.Errorf("missing --session: %v", err)
+	}
+	if err := runExport([]string{"--session", t.TempDir(), "--format", "pdf"}, &stdout); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
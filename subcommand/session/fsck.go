@@ -0,0 +1,189 @@
+package sessionsubcommand
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+// runFsck checks, and with --repair fixes, the given sessions, the
+// sessions of the working directory's project, or with --all every session.
+// --repair skips sessions a running agent holds unless --force is given.
+func runFsck(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "Apply safe repairs (messages.jsonl is backed up first)")
+	force := fs.Bool("force", false, "With --repair, also repair sessions a running agent holds")
+	all := fs.Bool("all", false, "Check the sessions of every project")
+	jsonOut := fs.Bool("json", false, "JSON output")
+	fs.Parse(args)
+
+	dirs, err := fsckTargets(fs.Args(), *all)
+	if err != nil {
+		return err
+	}
+	check := session.CheckSession
+	if *repair {
+		check = func(dir string) (*session.FsckReport, error) {
+			return session.RepairSession(dir, *force)
+		}
+	}
+
+	reports := make([]*session.FsckReport, 0, len(dirs))
+	var held []error
+	for _, dir := range dirs {
+		report, err := check(dir)
+		var locked *session.SessionLockedError
+		if errors.As(err, &locked) {
+			// Leave it to its owner; the other sessions are still repaired.
+			held = append(held, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		reports = append(reports, report)
+	}
+
+	broken, repairable := 0, 0
+	for _, r := range reports {
+		if r.Errors() > 0 {
+			broken++
+		}
+		for _, issue := range r.Issues {
+			if issue.Repair != "" && !issue.Repaired {
+				repairable++
+			}
+		}
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		printFsck(stdout, reports, repairable)
+		for _, err := range held {
+			fmt.Fprintf(stdout, "Skipped: %v\n", err)
+		}
+	}
+	if broken > 0 {
+		return fmt.Errorf("%d of %d sessions have errors", broken, len(reports))
+	}
+	if len(held) > 0 {
+		return fmt.Errorf("%d sessions in use were not repaired; stop their agents or pass --force", len(held))
+	}
+	return nil
+}
+
+func printFsck(w io.Writer, reports []*session.FsckReport, repairable int) {
+	for _, r := range reports {
+		if len(r.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %d errors, %d warnings\n", r.SessionDir, r.Errors(), r.Warnings())
+		for _, issue := range r.Issues {
+			where := ""
+			switch {
+			case issue.Line > 0:
+				where = fmt.Sprintf("line %d: ", issue.Line)
+			case issue.EntryID != "":
+				where = fmt.Sprintf("entry %s: ", issue.EntryID)
+			}
+			fmt.Fprintf(w, "  %-7s  %-20s  %s%s", issue.Severity, issue.Code, where, issue.Message)
+			switch {
+			case issue.Repaired:
+				fmt.Fprintf(w, "  [repaired: %s]", issue.Repair)
+			case issue.Repair != "":
+				fmt.Fprintf(w, "  [--repair: %s]", issue.Repair)
+			}
+			fmt.Fprintln(w)
+		}
+		if r.Backup != "" {
+			fmt.Fprintf(w, "  backup: %s\n", r.Backup)
+		}
+	}
+	clean := 0
+	for _, r := range reports {
+		if len(r.Issues) == 0 {
+			clean++
+		}
+	}
+	fmt.Fprintf(w, "Checked %d sessions, %d clean\n", len(reports), clean)
+	if repairable > 0 {
+		fmt.Fprintf(w, "%d issues can be repaired with --repair\n", repairable)
+	}
+}
+
+// fsckTargets resolves session directories or IDs; without any it returns
+// every session of the current project, or of all projects with all.
+func fsckTargets(refs []string, all bool) ([]string, error) {
+	if len(refs) > 0 {
+		var dirs []string
+		for _, ref := range refs {
+			dir, err := sessionDir(ref)
+			if err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, dir)
+		}
+		return dirs, nil
+	}
+
+	var projects []string
+	if all {
+		var err error
+		if projects, err = sessionsDirs(); err != nil {
+			return nil, err
+		}
+	} else {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("get cwd: %w", err)
+		}
+		dir, err := session.GetDefaultSessionsDir(cwd)
+		if err != nil {
+			return nil, err
+		}
+		projects = []string{dir}
+	}
+	var dirs []string
+	for _, project := range projects {
+		entries, err := os.ReadDir(project)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, e := range entries {
+			dir := filepath.Join(project, e.Name())
+			if _, err := os.Stat(filepath.Join(dir, "messages.jsonl")); e.IsDir() && err == nil {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// sessionDir resolves ref like loadSession, without loading the session.
+func sessionDir(ref string) (string, error) {
+	if info, err := os.Stat(ref); err == nil && info.IsDir() {
+		return ref, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("get cwd: %w", err)
+	}
+	dir, err := session.GetDefaultSessionsDir(cwd)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ref, "messages.jsonl")); err != nil {
+		return "", fmt.Errorf("session %q not found in %s", ref, dir)
+	}
+	return filepath.Join(dir, ref), nil
+}
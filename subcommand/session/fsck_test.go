@@ -0,0 +1,71 @@
+package sessionsubcommand
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func TestRunFsck(t *testing.T) {
+	dir := t.TempDir()
+	sess := session.NewSession(dir)
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello")); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.OpenFile(sess.GetPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"type":"mess`)
+	f.Close()
+
+	var stdout bytes.Buffer
+	if err := runFsck([]string{dir}, &stdout); err == nil {
+		t.Error("expected error for a torn session")
+	}
+	if out := stdout.String(); !strings.Contains(out, "torn_tail") || !strings.Contains(out, "can be repaired with --repair") {
+		t.Errorf("check output:\n%s", out)
+	}
+
+	stdout.Reset()
+	if err := runFsck([]string{"--repair", "--json", dir}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	var reports []session.FsckReport
+	if err := json.Unmarshal(stdout.Bytes(), &reports); err != nil || len(reports) != 1 || !reports[0].Issues[0].Repaired {
+		t.Errorf("repair reports = %+v, %v", reports, err)
+	}
+
+	stdout.Reset()
+	if err := runFsck([]string{dir}, &stdout); err != nil || !strings.Contains(stdout.String(), "Checked 1 sessions, 1 clean") {
+		t.Errorf("after repair = %q, %v", stdout.String(), err)
+	}
+}
+
+func TestRunFsck_HeldSession(t *testing.T) {
+	dir := t.TempDir()
+	sess := session.NewSession(dir)
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Lock(session.NewSessionOwner("run1"), false); err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Unlock()
+	f, _ := os.OpenFile(sess.GetPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"type":"mess`)
+	f.Close()
+
+	var stdout bytes.Buffer
+	err := runFsck([]string{"--repair", dir}, &stdout)
+	if err == nil || !strings.Contains(err.Error(), "--force") || !strings.Contains(stdout.String(), "Skipped: ") {
+		t.Errorf("repair of a held session = %v, output:\n%s", err, stdout.String())
+	}
+
+	stdout.Reset()
+	if err := runFsck([]string{"--repair", "--force", dir}, &stdout); err != nil || !strings.Contains(stdout.String(), "repaired") {
+		t.Errorf("forced repair = %v, output:\n%s", err, stdout.String())
+	}
+}
@@ -0,0 +1,139 @@
+package sessionsubcommand
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tiancaiamao/ai/pkg/config"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+// runGC applies the retention policy of the config file, overridden by
+// flags, to ~/.ai.
+func runGC(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show what would be removed without removing it")
+	maxAge := fs.String("max-age", "", "Remove sessions and runs older than this: 30d, 12h (default: retention.maxAgeDays)")
+	maxSize := fs.String("max-size", "", "Then remove the oldest sessions until all fit: 500MB, 2GB (default: retention.maxTotalMB)")
+	keepNamed := fs.Bool("keep-named", true, "Keep sessions the user named (default: retention.keepNamed)")
+	keepForked := fs.Bool("keep-forked", true, "Keep sessions that were forked from (default: retention.keepForked)")
+	archiveMaxAge := fs.String("archive-max-age", "", "Remove compaction archives older than this (default: retention.archiveMaxAgeDays)")
+	jsonOut := fs.Bool("json", false, "JSON output")
+	fs.Parse(args)
+
+	policy := loadRetention().Policy()
+	policy.DryRun = *dryRun
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch f.Name {
+		case "max-age":
+			policy.MaxAge, err = parseAge(*maxAge)
+		case "max-size":
+			policy.MaxTotalBytes, err = parseSize(*maxSize)
+		case "archive-max-age":
+			policy.ArchiveMaxAge, err = parseAge(*archiveMaxAge)
+		case "keep-named":
+			policy.KeepNamed = *keepNamed
+		case "keep-forked":
+			policy.KeepForked = *keepForked
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	report, err := session.CollectGarbage(filepath.Join(home, ".ai"), policy, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	verb := "Removed"
+	if report.DryRun {
+		verb = "Would remove"
+	}
+	for _, item := range report.Removed {
+		fmt.Fprintf(stdout, "%-7s  %8s  %s  (%s)\n", item.Kind, formatSize(item.Bytes), item.Path, item.Reason)
+	}
+	fmt.Fprintf(stdout, "%s %d items, %s, of %d sessions scanned\n", verb, len(report.Removed), formatSize(report.Bytes), report.Sessions)
+	for _, e := range report.Errors {
+		fmt.Fprintf(stdout, "error: %s\n", e)
+	}
+	return nil
+}
+
+// loadRetention returns the retention section of the config file.
+func loadRetention() *config.RetentionConfig {
+	path, err := config.ResolveConfigPath()
+	if err != nil {
+		return nil
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; using the default retention policy\n", err)
+		return nil
+	}
+	return cfg.Retention
+}
+
+// parseAge parses 30d, 12h or 90m; a bare number is days.
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && days >= 0 {
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid age %q (want e.g. 30d or 12h)", s)
+}
+
+// parseSize parses 500MB, 2GB or 100KB; a bare number is megabytes.
+func parseSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1 << 20)
+	for _, u := range []struct {
+		suffix string
+		bytes  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}} {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, unit = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 500MB or 2GB)", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
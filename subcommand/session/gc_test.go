@@ -0,0 +1,73 @@
+package sessionsubcommand
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func TestRunGC(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	sm := session.NewSessionManager(filepath.Join(home, ".ai", "sessions", "--proj--"))
+	sess, err := sm.CreateSession("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.AppendMessage(agentctx.NewUserMessage("old work"))
+	old := time.Now().AddDate(0, 0, -40)
+	filepath.Walk(sess.GetDir(), func(path string, _ os.FileInfo, _ error) error {
+		return os.Chtimes(path, old, old)
+	})
+
+	var stdout bytes.Buffer
+	if err := runGC([]string{"--dry-run", "--max-age", "30d"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "Would remove") || !strings.Contains(out, sess.GetDir()) {
+		t.Errorf("dry run output:\n%s", out)
+	}
+	if _, err := os.Stat(sess.GetDir()); err != nil {
+		t.Fatalf("dry run removed the session: %v", err)
+	}
+
+	stdout.Reset()
+	if err := runGC([]string{"--json", "--max-age", "30d"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	var report session.GCReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || report.DryRun || len(report.Removed) == 0 {
+		t.Errorf("json report = %+v, %v", report, err)
+	}
+	if _, err := os.Stat(sess.GetDir()); !os.IsNotExist(err) {
+		t.Errorf("session not removed: %v", err)
+	}
+	if err := runGC([]string{"--max-age", "soon"}, io.Discard); err == nil {
+		t.Error("expected error for invalid age")
+	}
+}
+
+func TestParseAgeAndSize(t *testing.T) {
+	for in, want := range map[string]time.Duration{"30d": 30 * 24 * time.Hour, "7": 7 * 24 * time.Hour, "12h": 12 * time.Hour} {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for in, want := range map[string]int64{"500MB": 500 << 20, "2GB": 2 << 30, "1.5g": 3 << 29, "64k": 64 << 10, "100": 100 << 20} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("expected error for invalid size")
+	}
+}
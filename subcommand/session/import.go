@@ -0,0 +1,83 @@
+package sessionsubcommand
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+	"github.com/tiancaiamao/ai/pkg/session/convert"
+	sessionexport "github.com/tiancaiamao/ai/pkg/session/export"
+)
+
+// runImport creates a session in the sessions directory of the working
+// directory from a transcript file, or stdin when the file is "-".
+func runImport(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	formatFlag := fs.String("format", "auto", "Input format: auto, openai, anthropic, sharegpt or json (an 'ai export' transcript)")
+	nameFlag := fs.String("name", "", "Session name (default: transcript title or file name)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: ai session import [--format auto|openai|anthropic|sharegpt|json] [--name <text>] <file|->")
+	}
+	path := fs.Arg(0)
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	format := strings.ToLower(*formatFlag)
+	if format == "auto" {
+		format = convert.Detect(data)
+	}
+	name, title := *nameFlag, ""
+	var messages []agentctx.AgentMessage
+	switch format {
+	case convert.FormatTranscript:
+		t, err := sessionexport.ParseTranscript(data)
+		if err != nil {
+			return err
+		}
+		messages = t.Messages()
+		title = t.Title
+		if name == "" {
+			name = t.Name
+		}
+	default:
+		if messages, err = convert.Decode(data, format); err != nil {
+			return err
+		}
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("no messages in %s", path)
+	}
+	if name == "" && path != "-" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("get cwd: %w", err)
+	}
+	dir, err := session.GetDefaultSessionsDir(cwd)
+	if err != nil {
+		return err
+	}
+	sess, err := session.NewSessionManager(dir).ImportSession(name, title, messages)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Imported %d messages (%s) into session %s\n%s\n", len(messages), format, filepath.Base(sess.GetDir()), sess.GetDir())
+	return nil
+}
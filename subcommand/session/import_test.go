@@ -0,0 +1,52 @@
+package sessionsubcommand
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func TestRunImport(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	src := t.TempDir()
+	sess := session.NewSession(src)
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello import")); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"json", "openai", "anthropic"} {
+		file := filepath.Join(t.TempDir(), "trace."+format)
+		if err := runExport([]string{"--session", src, "--format", format, "-o", file}, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout bytes.Buffer
+		if err := runImport([]string{"--format", format, file}, nil, &stdout); err != nil {
+			t.Fatalf("import %s: %v", format, err)
+		}
+		if !strings.Contains(stdout.String(), "Imported 1 messages ("+format+")") {
+			t.Errorf("import %s: %s", format, stdout.String())
+		}
+		dir := strings.TrimSpace(strings.SplitN(stdout.String(), "\n", 2)[1])
+		imported, err := session.LoadSession(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := imported.GetMessages(); len(msgs) != 1 || msgs[0].ExtractText() != "hello import" {
+			t.Errorf("import %s: messages = %+v", format, msgs)
+		}
+		if imported.GetSessionName() != "trace" {
+			t.Errorf("import %s: name = %q", format, imported.GetSessionName())
+		}
+	}
+
+	if err := runImport([]string{"--format", "openai", "-"}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("expected error for empty input")
+	}
+}
@@ -0,0 +1,170 @@
+package sessionsubcommand
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tiancaiamao/ai/pkg/config"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+// runPack writes a session, its compactions, traces and runs, and the
+// redacted config into one archive.
+func runPack(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	output := fs.String("o", "", "Output file, or - for stdout (default: session-<id>.tar.gz)")
+	var runs stringList
+	fs.Var(&runs, "run", "Also include this run (repeatable); runs recorded in the session are included anyway")
+	noConfig := fs.Bool("no-config", false, "Leave out the redacted config")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: ai session pack [-o <file>] [--run <id>]... [--no-config] <dir|id>")
+	}
+	dir, err := findSessionDir(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	opts := session.PackOptions{AIDir: filepath.Join(home, ".ai"), Runs: runs}
+	if path, err := config.ResolveConfigPath(); err == nil {
+		if cfg, err := config.LoadConfig(path); err == nil {
+			opts.Model = cfg.Model.Provider + "/" + cfg.Model.ID
+			if !*noConfig {
+				if opts.Config, err = cfg.RedactedJSON(); err != nil {
+					return err
+				}
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: %v; packing without config\n", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	manifest, err := session.PackSession(&buf, dir, opts)
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		_, err := buf.WriteTo(stdout)
+		return err
+	}
+	path := *output
+	if path == "" {
+		path = fmt.Sprintf("session-%s.tar.gz", manifest.SessionID)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Packed session %s (%d files, %d traces, %d runs) into %s\n",
+		manifest.SessionID, len(manifest.Files), len(manifest.Traces), len(manifest.Runs), path)
+	return nil
+}
+
+// runUnpack extracts a bundle into the sessions directory of the working
+// directory, rewriting the session's paths to it.
+func runUnpack(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("unpack", flag.ExitOnError)
+	cwdFlag := fs.String("cwd", "", "Project directory the session is resumed in (default: the working directory)")
+	keepPaths := fs.Bool("keep-paths", false, "Do not rewrite the bundle's cwd paths")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: ai session unpack [--cwd <dir>] [--keep-paths] <file|->")
+	}
+	cwd := *cwdFlag
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			return fmt.Errorf("get cwd: %w", err)
+		}
+	}
+	cwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return err
+	}
+	sessionsDir, err := session.GetDefaultSessionsDir(cwd)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	in := stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	opts := session.UnpackOptions{SessionsDir: sessionsDir, Cwd: cwd, AIDir: filepath.Join(home, ".ai")}
+	if *keepPaths {
+		opts.Cwd = ""
+	}
+	result, err := session.UnpackSession(in, opts)
+	if err != nil {
+		return err
+	}
+
+	m := result.Manifest
+	fmt.Fprintf(stdout, "Unpacked session %s into %s\n", m.SessionID, result.SessionDir)
+	if opts.Cwd != "" && m.Cwd != cwd {
+		fmt.Fprintf(stdout, "Rewrote %d paths from %s to %s\n", result.Rewritten, m.Cwd, cwd)
+	}
+	if len(result.Traces) > 0 || len(result.Runs) > 0 {
+		fmt.Fprintf(stdout, "Added %d traces and %d runs (%s) under %s\n", len(result.Traces), len(result.Runs), strings.Join(result.Runs, ", "), opts.AIDir)
+	}
+	fmt.Fprintf(stdout, "Created by ai %s; configured model %s; answered by %s\n",
+		orUnknown(m.GitCommit), orUnknown(m.Model), orUnknown(strings.Join(m.Models, ", ")))
+	fmt.Fprintf(stdout, "Resume with: ai run --session %s\n", result.SessionDir)
+	return nil
+}
+
+// findSessionDir resolves ref like sessionDir, then looks for a session ID
+// in the other projects.
+func findSessionDir(ref string) (string, error) {
+	dir, err := sessionDir(ref)
+	if err == nil {
+		return dir, nil
+	}
+	projects, perr := sessionsDirs()
+	if perr != nil {
+		return "", err
+	}
+	for _, project := range projects {
+		candidate := filepath.Join(project, ref)
+		if _, statErr := os.Stat(filepath.Join(candidate, "messages.jsonl")); statErr == nil {
+			return candidate, nil
+		}
+	}
+	return "", err
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
@@ -0,0 +1,51 @@
+package sessionsubcommand
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agentctx "github.com/tiancaiamao/ai/pkg/context"
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func TestRunPackUnpack(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("AI_CONFIG_PATH", filepath.Join(home, "config.json"))
+	os.WriteFile(filepath.Join(home, "config.json"), []byte(`{"model":{"id":"glm-5","provider":"zai","baseUrl":"https://api.example.com/?key=sk-1"}}`), 0644)
+
+	dir := filepath.Join(t.TempDir(), "s1")
+	sess := session.NewSession(dir)
+	if _, err := sess.AppendMessage(agentctx.NewUserMessage("hello")); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(t.TempDir(), "s1.tar.gz")
+	var stdout bytes.Buffer
+	if err := runPack([]string{"-o", bundle, dir}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "Packed session") {
+		t.Errorf("pack output = %q", stdout.String())
+	}
+
+	cwd := t.TempDir()
+	stdout.Reset()
+	if err := runUnpack([]string{"--cwd", cwd, bundle}, nil, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "configured model zai/glm-5") || !strings.Contains(out, "Resume with: ai run --session ") {
+		t.Errorf("unpack output = %q", out)
+	}
+	sessionsDir, _ := session.GetDefaultSessionsDir(cwd)
+	loaded, err := session.LoadSession(filepath.Join(sessionsDir, sess.GetID()))
+	if err != nil || len(loaded.GetMessages()) != 1 {
+		t.Fatalf("unpacked session: %v", err)
+	}
+	if err := runUnpack([]string{"--cwd", cwd, bundle}, nil, &stdout); err == nil {
+		t.Error("unpacking twice: expected error")
+	}
+}
@@ -0,0 +1,103 @@
+package sessionsubcommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tiancaiamao/ai/pkg/session"
+	"github.com/tiancaiamao/ai/pkg/session/search"
+)
+
+// runSearch searches the sessions of every project under ~/.ai/sessions.
+func runSearch(args []string, stdout io.Writer) error {
+	var jsonOut, reindex bool
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			jsonOut = true
+		case "--reindex", "-reindex":
+			reindex = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	q, err := search.ParseQuery(rest, time.Now())
+	if err != nil {
+		return fmt.Errorf("%w\nusage: ai sessions search <terms> [--cwd dir] [--since date] [--until date] [--role r] [--tool name] [--limit n] [--json] [--reindex]", err)
+	}
+
+	dirs, err := sessionsDirs()
+	if err != nil {
+		return err
+	}
+	if reindex {
+		for _, dir := range dirs {
+			if err := session.RebuildSearchIndex(dir); err != nil {
+				return fmt.Errorf("reindex %s: %w", dir, err)
+			}
+		}
+	}
+	hits, err := session.SearchSessions(q, dirs...)
+	if err != nil {
+		return err
+	}
+
+	if jsonOut {
+		if hits == nil {
+			hits = []session.SearchHit{}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(hits)
+	}
+	if len(hits) == 0 {
+		fmt.Fprintf(stdout, "No matches for %q\n", q.Text)
+		return nil
+	}
+	for _, h := range hits {
+		name := h.SessionName
+		if name == "" {
+			name = h.SessionID
+		}
+		fmt.Fprintf(stdout, "%s  %-9s  %s  %s\n", h.Time.Local().Format("2006-01-02 15:04"), h.Role, name, h.Cwd)
+		fmt.Fprintf(stdout, "    %s\n", h.Snippet)
+		fmt.Fprintf(stdout, "    session %s  entry %s", h.SessionID, h.EntryID)
+		if h.ForkEntryID != "" {
+			fmt.Fprintf(stdout, "  fork %s:%s", h.SessionID, h.ForkEntryID)
+		}
+		fmt.Fprintln(stdout)
+	}
+	return nil
+}
+
+// sessionsDirs returns the sessions directory of every project.
+func sessionsDirs() ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("get cwd: %w", err)
+	}
+	dir, err := session.GetDefaultSessionsDir(cwd)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Dir(dir)
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, filepath.Join(root, e.Name()))
+		}
+	}
+	return dirs, nil
+}
@@ -0,0 +1,49 @@
+package sessionsubcommand
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tiancaiamao/ai/pkg/session"
+)
+
+func TestRunSearch(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	file := filepath.Join(t.TempDir(), "trace.jsonl")
+	os.WriteFile(file, []byte(`{"role":"user","content":"the scheduler deadlocks under load"}`+"\n"), 0644)
+	if err := runImport([]string{"--format", "openai", file}, nil, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runSearch([]string{"deadlocks", "--role", "user"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "trace") || !strings.Contains(out, "the scheduler deadlocks under load") {
+		t.Errorf("search output:\n%s", out)
+	}
+
+	stdout.Reset()
+	if err := runSearch([]string{"--json", "--reindex", "dead*"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	var hits []session.SearchHit
+	if err := json.Unmarshal(stdout.Bytes(), &hits); err != nil || len(hits) != 1 || hits[0].ForkEntryID != hits[0].EntryID {
+		t.Errorf("json hits = %+v, %v", hits, err)
+	}
+
+	stdout.Reset()
+	if err := runSearch([]string{"deadlocks", "--role", "assistant"}, &stdout); err != nil || !strings.Contains(stdout.String(), "No matches") {
+		t.Errorf("filtered search = %q, %v", stdout.String(), err)
+	}
+	if err := runSearch(nil, io.Discard); err == nil {
+		t.Error("expected error for empty query")
+	}
+}
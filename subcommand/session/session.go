@@ -0,0 +1,65 @@
+package sessionsubcommand
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// SessionSubcommand dispatches "ai session export|import|search|gc|fsck|pack|unpack".
+// "ai sessions" is the same command.
+func SessionSubcommand() {
+	if len(os.Args) < 2 {
+		printUsage(os.Stderr)
+		os.Exit(1)
+	}
+	args := os.Args[2:]
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(args, os.Stdout)
+	case "import":
+		err = runImport(args, os.Stdin, os.Stdout)
+	case "search":
+		err = runSearch(args, os.Stdout)
+	case "gc":
+		err = runGC(args, os.Stdout)
+	case "fsck":
+		err = runFsck(args, os.Stdout)
+	case "pack":
+		err = runPack(args, os.Stdout)
+	case "unpack":
+		err = runUnpack(args, os.Stdin, os.Stdout)
+	case "-h", "--help", "help":
+		printUsage(os.Stdout)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "ai session: unknown command %q\n\n", os.Args[1])
+		printUsage(os.Stderr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// ExportSubcommand is "ai export", short for "ai session export".
+func ExportSubcommand() {
+	if err := runExport(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage:
+  ai session export --session <dir|id> [--format html|md|json|openai|anthropic|sharegpt] [--leaf <entry-id>] [-o <path>]
+  ai session import [--format auto|openai|anthropic|sharegpt|json] [--name <text>] <file|->
+  ai session search <terms> [--cwd <dir>] [--since <date>] [--until <date>] [--role <role>] [--tool <name>] [--limit <n>] [--json] [--reindex]
+  ai session gc [--dry-run] [--max-age <age>] [--max-size <size>] [--keep-named=false] [--keep-forked=false] [--archive-max-age <age>] [--json]
+  ai session fsck [--repair [--force]] [--all] [--json] [<dir|id>...]
+  ai session pack [-o <file>] [--run <id>]... [--no-config] <dir|id>
+  ai session unpack [--cwd <dir>] [--keep-paths] <file|->
+`)
+}